@@ -2,10 +2,15 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"gorm.io/gorm"
 
@@ -61,8 +66,9 @@ var connectEmailService = true
 // @name Authorization
 
 func main() {
-	// Build context
-	ctx := context.Background()
+	// Build context (cancelled on interrupt/termination signal to begin graceful shutdown)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 	// Set context in app config
 	app.Ctx = ctx
 	// Load env variables
@@ -83,6 +89,13 @@ func main() {
 	// Set in app state
 	app.BaseURL = baseURL
 
+	// Load the keys used to sign and verify tokens (JWT_KEYS_DIR or HMAC_SECRET)
+	keys, err := auth.LoadKeyRing()
+	if err != nil {
+		log.Fatal(err)
+	}
+	auth.SetKeyRing(keys)
+
 	// Parse the template files in the templates directory
 	tmpl, err := adminpanel.ParseAdminTemplates()
 	if err != nil {
@@ -92,6 +105,13 @@ func main() {
 	// Set template in state
 	app.AdminTemplates = tmpl
 
+	// Parse the email templates
+	emailTemplates, err := email.LoadTemplates()
+	if err != nil {
+		log.Fatal(err)
+	}
+	app.EmailTemplates = emailTemplates
+
 	// Create client using DbConnect
 	client := db.DbConnect(true)
 	// Set in state
@@ -106,8 +126,14 @@ func main() {
 	app.Auth.Enforcer = e.Enforcer
 	app.Auth.Adapter = e.Adapter
 
-	// Setup new cache
-	app.Cache = &cache.CacheMap{}
+	// Setup new cache (in-memory or Redis, selected with CACHE_DRIVER)
+	cacheSettings := cache.SettingsFromEnv()
+	appCache, err := cache.New(ctx, cacheSettings)
+	if err != nil {
+		log.Fatal(err)
+	}
+	app.Cache = appCache
+	app.ListCacheTTL = cacheSettings.ListTTL
 
 	// Set state in other packages
 	setAppState(&app, stateFuncs)
@@ -118,8 +144,11 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// Create a separate connection to the database for the job queue
+	queueClient := db.DbConnect(false)
+
 	// Create api
-	api := ApiSetup(client, connectEmailService)
+	api, jobQueue := ApiSetup(client, queueClient, connectEmailService)
 
 	fmt.Printf("Starting application: http://%s%s\n", serverUrl, portNumber)
 
@@ -129,31 +158,90 @@ func main() {
 		Handler: api.Routes(),
 	}
 
-	// Listen and serve using server settings above
-	err = srv.ListenAndServe()
-	if err != nil {
-		log.Fatal(err)
+	// Listen and serve using server settings above (in background to allow for graceful shutdown)
+	serverErr := make(chan error, 1)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	// Wait for shutdown signal or server failure
+	select {
+	case <-ctx.Done():
+		fmt.Println("Shutdown signal received. Shutting down gracefully...")
+	case err := <-serverErr:
+		fmt.Println("Server error: ", err)
+		// Stop workers
+		stop()
+	}
+
+	// Shut down server and workers
+	shutdown(srv, jobQueue, client, queueClient)
+}
+
+// Drains the HTTP server and job queue workers (within the shutdown timeout), then closes database and cache connections
+func shutdown(srv *http.Server, jobQueue *queue.Queue, clients ...*gorm.DB) {
+	// Build shutdown timeout context
+	timeout := shutdownTimeout()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Stop accepting new requests and wait for in-flight requests to finish
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		fmt.Println("Error shutting down server: ", err)
+	}
+	// Wait for workers to finish their current jobs (they stop claiming jobs once the app context is cancelled)
+	if err := jobQueue.Wait(shutdownCtx); err != nil {
+		fmt.Println("Error stopping job queue: ", err)
+	}
+	// Close database connections
+	for _, client := range clients {
+		if err := db.CloseConnection(client); err != nil {
+			fmt.Println("Error closing database connection: ", err)
+		}
+	}
+	// Close cache connections (if any)
+	if closer, ok := app.Cache.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			fmt.Println("Error closing cache connection: ", err)
+		}
+	}
+	fmt.Println("Shutdown complete")
+}
+
+// Returns the graceful shutdown timeout from SHUTDOWN_TIMEOUT (eg. "30s"). Defaults to 30 seconds.
+func shutdownTimeout() time.Duration {
+	timeout, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT"))
+	if err != nil || timeout <= 0 {
+		return 30 * time.Second
 	}
+	return timeout
 }
 
 // Edit this to use the entire appconfig instead of just the client
 // Build API and store the services and repos in the config
-func ApiSetup(client *gorm.DB, connectEmail bool) routes.Api {
+// Returns the API and the job queue (used for graceful shutdown)
+func ApiSetup(client *gorm.DB, queueClient *gorm.DB, connectEmail bool) (routes.Api, *queue.Queue) {
 	var mail email.Email
-	// If connectEmail is true, use SMTP email
+	// If connectEmail is true, use the email driver set in the environment (SMTP or file outbox)
 	if connectEmail {
-		mail = email.NewSMTPEmail()
+		var err error
+		mail, err = email.New(email.SettingsFromEnv())
+		if err != nil {
+			log.Fatal(err)
+		}
 	} else {
 		// Else, use email mock
 		mail = &helpers.EmailMock{}
 	}
 
-	// Create a separate connection to the database for the job queue
-	queueClient := db.DbConnect(false)
-	// Create job queue
+	// Create job queue (using a separate connection to the database)
 	jobQueue := queue.NewQueue(queueClient, mail)
-	// Establish async job processing
-	go jobQueue.Worker()
+	// Schedule recurring maintenance jobs
+	scheduleMaintenanceJobs(jobQueue)
+	// Establish async job processing using a pool of workers (stopped when the app context is cancelled)
+	jobQueue.Start(app.Ctx, queue.SettingsFromEnv())
 
 	// Authorization
 	groupRepo := corerepositories.NewAuthPolicyRepository(client)
@@ -165,10 +253,28 @@ func ApiSetup(client *gorm.DB, connectEmail bool) routes.Api {
 	userService := coreservices.NewUserService(userRepo, groupRepo, jobQueue)
 	userController := core.NewUserController(userService)
 
+	// Job
+	jobRepo := corerepositories.NewJobRepository(client)
+	jobService := coreservices.NewJobService(jobRepo, jobQueue)
+	jobController := core.NewJobController(jobService)
+
+	// Email log
+	emailLogRepo := corerepositories.NewEmailLogRepository(client)
+	emailLogService := coreservices.NewEmailLogService(emailLogRepo)
+	emailLogController := core.NewEmailLogController(emailLogService)
+
+	// Cache
+	cacheController := core.NewCacheController(app.Cache)
+
 	// Action
 	actionRepo := corerepositories.NewActionRepository(client)
 	actionService := coreservices.NewActionService(actionRepo)
 	adminActionController := adminpanel.NewAdminActionController(actionService)
+	adminJobController := adminpanel.NewAdminJobController(jobService, actionService)
+	adminEmailLogController := adminpanel.NewAdminEmailLogController(emailLogService, actionService)
+	// Outbox (only available when using the file email driver)
+	outbox, _ := mail.(email.Outbox)
+	adminOutboxController := adminpanel.NewAdminOutboxController(outbox)
 
 	// Setup basic modules with new implementation (including admin controllers if available)
 	moduleMap := modules.SetupModules(modules.ModulesToSetup, client, actionService)
@@ -182,6 +288,9 @@ func ApiSetup(client *gorm.DB, connectEmail bool) routes.Api {
 		adminpanel.NewAdminUserController(userService, actionService),
 		adminpanel.NewAdminAuthPolicyController(groupService),
 		adminActionController,
+		adminJobController,
+		adminEmailLogController,
+		adminOutboxController,
 		// ADD ADDITIONAL MODULES HERE
 		moduleMap,
 	)
@@ -190,7 +299,7 @@ func ApiSetup(client *gorm.DB, connectEmail bool) routes.Api {
 	adminpanel.GenerateAndSetAdminSidebar(adminController)
 
 	// Build API using controllers
-	api := routes.NewApi(adminController, userController, groupController,
+	api := routes.NewApi(adminController, userController, groupController, jobController, emailLogController, cacheController,
 		// Created modules contained in moduleMap
 		moduleMap,
 	)
@@ -209,8 +318,41 @@ func ApiSetup(client *gorm.DB, connectEmail bool) routes.Api {
 		Controller:      groupController,
 	}
 
-	// Return API (controllers)
-	return api
+	// Return API (controllers) and job queue
+	return api, jobQueue
+}
+
+// Schedules recurring maintenance jobs (safe to run on every instance as schedules are stored by name)
+// ADD ADDITIONAL RECURRING JOBS HERE
+func scheduleMaintenanceJobs(jobQueue *queue.Queue) {
+	schedules := []struct {
+		name           string
+		cronExpression string
+		jobType        string
+		payload        string
+	}{
+		// Every hour
+		{"purge-verification-codes", "0 * * * *", queue.PurgeVerificationCodesJobType, "{}"},
+		{"purge-password-reset-tokens", "15 * * * *", queue.PurgePasswordResetTokensJobType, "{}"},
+		{"purge-refresh-tokens", "30 * * * *", queue.PurgeRefreshTokensJobType, "{}"},
+		{"purge-revoked-tokens", "45 * * * *", queue.PurgeRevokedTokensJobType, "{}"},
+		{"purge-login-throttles", "50 * * * *", queue.PurgeLoginThrottlesJobType, "{}"},
+		{"purge-sessions", "55 * * * *", queue.PurgeSessionsJobType, "{}"},
+		// Daily at 3:30am
+		{"prune-actions", "30 3 * * *", queue.PruneActionsJobType, `{"older_than_days":90}`},
+		// Daily at 3:45am
+		{"prune-jobs", "45 3 * * *", queue.PruneJobsJobType, `{"older_than_days":30}`},
+		// Daily at 4am
+		{"prune-email-logs", "0 4 * * *", queue.PruneEmailLogsJobType, `{"older_than_days":180}`},
+		// Daily at 4:15am
+		{"prune-login-events", "15 4 * * *", queue.PruneLoginEventsJobType, `{"older_than_days":90}`},
+	}
+	for _, schedule := range schedules {
+		err := jobQueue.Schedule(schedule.name, schedule.cronExpression, schedule.jobType, schedule.payload)
+		if err != nil {
+			log.Printf("Failed to schedule %s: %v\n", schedule.name, err)
+		}
+	}
 }
 
 // STATE MANAGEMENT
@@ -16,6 +16,7 @@ var header = HeaderSection{
 	ViewSiteUrl:       "#",
 	LogOutUrl:         "#",
 	ChangePasswordUrl: "#",
+	TwoFactorUrl:      "#",
 }
 
 // Function called in main.go to connect app state to current file
@@ -24,6 +25,7 @@ func SetStateInAdminPanel(a *config.AppConfig) {
 	// Set header urls after setting state
 	header.HomeUrl = template.URL("http://" + app.BaseURL + "/admin/home")
 	header.ChangePasswordUrl = template.URL("http://" + app.BaseURL + "/admin/change-password")
+	header.TwoFactorUrl = template.URL("http://" + app.BaseURL + "/admin/two-factor")
 	header.LogOutUrl = template.URL("http://" + app.BaseURL + "/admin/logout")
 	header.ViewSiteUrl = template.URL("http://" + app.BaseURL + "/swagger/index.html")
 }
@@ -35,6 +37,9 @@ type AdminPanelController struct {
 	User AdminUserController
 	Auth AdminAuthPolicyController
 	Action AdminActionController
+	Job    AdminJobController
+	EmailLog AdminEmailLogController
+	Outbox AdminOutboxController
 	// Additional modules contained in module map
 	ModuleMap models.ModuleMap
 }
@@ -45,8 +50,11 @@ func NewAdminPanelController(
 							users AdminUserController, 
 							authPolicies AdminAuthPolicyController, 
 							action AdminActionController,
+							job AdminJobController,
+							emailLog AdminEmailLogController,
+							outbox AdminOutboxController,
 							moduleMap models.ModuleMap) AdminPanelController {
-	return AdminPanelController{base, users, authPolicies, action, moduleMap}
+	return AdminPanelController{base, users, authPolicies, action, job, emailLog, outbox, moduleMap}
 }
 
 
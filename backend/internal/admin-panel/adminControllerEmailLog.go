@@ -0,0 +1,238 @@
+package adminpanel
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/dmawardi/Go-Template/internal/controller/core"
+	"github.com/dmawardi/Go-Template/internal/helpers/data"
+	"github.com/dmawardi/Go-Template/internal/helpers/request"
+	webapi "github.com/dmawardi/Go-Template/internal/helpers/webApi"
+	"github.com/dmawardi/Go-Template/internal/models"
+	coreservices "github.com/dmawardi/Go-Template/internal/service/core"
+	"github.com/go-chi/chi/v5"
+)
+
+// Table headers to show on find all page
+var emailLogTableHeaders = []TableHeader{
+	{Label: "ID", ColumnSortLabel: "id", Pointer: false, DataType: "int", Sortable: true},
+	{Label: "Recipient", ColumnSortLabel: "recipient", Pointer: false, DataType: "string", Sortable: true},
+	{Label: "Subject", ColumnSortLabel: "subject", Pointer: false, DataType: "string", Sortable: true},
+	{Label: "Template", ColumnSortLabel: "template", Pointer: false, DataType: "string", Sortable: true},
+	{Label: "Status", ColumnSortLabel: "status", Pointer: false, DataType: "string", Sortable: true},
+	{Label: "Attempts", ColumnSortLabel: "attempts", Pointer: false, DataType: "int", Sortable: true},
+	{Label: "UpdatedAt", ColumnSortLabel: "updated_at", Pointer: false, DataType: "string", Sortable: true},
+}
+
+func NewAdminEmailLogController(service coreservices.EmailLogService, actionService webapi.ActionService) AdminEmailLogController {
+	return &adminEmailLogController{
+		service:       service,
+		actionService: actionService,
+		// Use values from above
+		adminHomeUrl:     "/admin/email-logs",
+		schemaName:       "Email Log",
+		pluralSchemaName: "Email Logs",
+		tableHeaders:     emailLogTableHeaders,
+	}
+}
+
+type adminEmailLogController struct {
+	service       coreservices.EmailLogService
+	actionService webapi.ActionService
+	// For links
+	adminHomeUrl string
+	// For HTML text rendering
+	schemaName       string
+	pluralSchemaName string
+	// Custom table headers
+	tableHeaders []TableHeader
+}
+
+type AdminEmailLogController interface {
+	FindAll(w http.ResponseWriter, r *http.Request)
+	View(w http.ResponseWriter, r *http.Request)
+	// Permanently delete selected email logs (from table)
+	BulkDelete(w http.ResponseWriter, r *http.Request)
+}
+
+func (c adminEmailLogController) FindAll(w http.ResponseWriter, r *http.Request) {
+	// Grab query parameters
+	searchQuery := r.URL.Query().Get("search")
+	// Grab basic query params
+	baseQueryParams, err := request.ExtractBasicFindAllQueryParams(r)
+	if err != nil {
+		http.Error(w, "Error extracting query params", http.StatusBadRequest)
+		return
+	}
+	// Extract filter (eg. user_id for a user's emails)
+	filter, err := core.EmailLogFilterFromQuery(r)
+	if err != nil {
+		http.Error(w, "Error extracting query params", http.StatusBadRequest)
+		return
+	}
+
+	// Grab all items
+	found, err := c.service.FindAll(baseQueryParams.Limit, baseQueryParams.Offset, baseQueryParams.Order, filter)
+	if err != nil {
+		http.Error(w, "Error finding data", http.StatusInternalServerError)
+		return
+	}
+	// Convert data to AdminPanelSchema
+	schemaSlice := *found.Data
+	var adminSchemaSlice []models.AdminPanelSchema
+	for _, item := range schemaSlice {
+		// Append to schemaSlice
+		adminSchemaSlice = append(adminSchemaSlice, item)
+	}
+
+	// Build the table data
+	tableData := BuildTableData(adminSchemaSlice, found.Meta, c.adminHomeUrl, c.tableHeaders, false)
+
+	// Generate Find All page render data
+	data := GenerateFindAllRenderData(tableData, c.schemaName, c.pluralSchemaName, c.adminHomeUrl, searchQuery)
+	data.SectionTitle = "Select an email to inspect"
+	if filter.UserID != 0 {
+		data.SectionTitle = fmt.Sprintf("Emails sent to user %d", filter.UserID)
+	}
+	// Add status filter (with current selection)
+	data.SearchFilters = c.generateFilterFields(r, filter)
+
+	// Execute the template with data and write to response
+	err = app.AdminTemplates.ExecuteTemplate(w, "layout.go.tmpl", data)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+}
+
+func (c adminEmailLogController) View(w http.ResponseWriter, r *http.Request) {
+	// Init new Email Log view form
+	editForm := c.generateEditForm()
+
+	// Grab URL parameter
+	stringParameter := chi.URLParam(r, "id")
+	// Convert to int
+	idParameter, err := strconv.Atoi(stringParameter)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	// Search for by ID and store in found
+	found, err := c.service.FindById(idParameter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s not found", c.schemaName), http.StatusNotFound)
+		return
+	}
+
+	// Convert db struct to map for placeholder population
+	currentData := getValuesUsingFieldMap(*found)
+	// Populate form field placeholders with data from database
+	err = populateValuessWithDBData(&editForm, currentData)
+	if err != nil {
+		http.Error(w, "Error generating form", http.StatusInternalServerError)
+		return
+	}
+
+	data := GenerateEditRenderData(editForm, c.schemaName, c.pluralSchemaName, c.adminHomeUrl, stringParameter, false)
+	data.PageTitle = fmt.Sprintf("%s: %s", c.schemaName, stringParameter)
+	data.SectionTitle = fmt.Sprintf("%s (%s)", found.Subject, found.Status)
+	// Link to the job that sent the email
+	if found.JobID != 0 {
+		data.SectionDetail = template.HTML(fmt.Sprintf(`<p><a href="/admin/jobs/%d">View job %d</a></p>`, found.JobID, found.JobID))
+	}
+
+	// Execute the template with data and write to response
+	err = app.AdminTemplates.ExecuteTemplate(w, "layout.go.tmpl", data)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+}
+
+func (c adminEmailLogController) BulkDelete(w http.ResponseWriter, r *http.Request) {
+	// Grab body of request
+	// Init
+	var listOfIds BulkDeleteRequest
+
+	// Prepare response
+	bulkResponse := models.BulkDeleteResponse{
+		Errors: []error{},
+	}
+
+	// Decode request body as JSON and store
+	err := json.NewDecoder(r.Body).Decode(&listOfIds)
+	if err != nil {
+		fmt.Println("Decoding error: ", err)
+	}
+	bulkResponse.DeletedRecords = len(listOfIds.SelectedItems)
+
+	// Convert string slice to int slice
+	intIdList, err := data.ConvertStringSliceToIntSlice(listOfIds.SelectedItems)
+	if err != nil {
+		bulkResponse.Errors = append(bulkResponse.Errors, err)
+		bulkResponse.Success = false
+		request.WriteAsJSON(w, bulkResponse)
+		return
+	}
+
+	// Delete email logs
+	err = c.service.BulkDelete(intIdList)
+	// If error detected send error response
+	if err != nil {
+		bulkResponse.Errors = append(bulkResponse.Errors, err)
+		bulkResponse.Success = false
+		request.WriteAsJSON(w, bulkResponse)
+		return
+	}
+
+	// Record Bulk delete
+	err = c.actionService.RecordBulkDelete(r, c.schemaName, c.pluralSchemaName, intIdList, &models.RecordedAction{
+		ActionType: "bulk-delete",
+		EntityType: c.schemaName,
+		EntityID:   fmt.Sprint(intIdList),
+	})
+	if err != nil {
+		fmt.Printf("Error recording action: %s", err)
+	}
+	// else if successful
+	bulkResponse.Success = true
+	request.WriteAsJSON(w, bulkResponse)
+}
+
+// Filters
+// Builds the status filter field with the current selection (and keeps the user filter when searching)
+func (c adminEmailLogController) generateFilterFields(r *http.Request, filter models.EmailLogFilter) []FormField {
+	statusSelector := EmailLogStatusSelection()
+	setDefaultSelected(statusSelector, filter.Status)
+
+	fields := []FormField{
+		{Label: "Status", Name: "status", Type: "select", Selectors: statusSelector},
+	}
+	if filter.UserID != 0 {
+		fields = append(fields, FormField{Label: "User", Name: "user_id", Type: "hidden", Value: fmt.Sprint(filter.UserID)})
+	}
+	return fields
+}
+
+// Form generation
+// Used to build View form
+func (c adminEmailLogController) generateEditForm() []FormField {
+	return []FormField{
+		{DbLabel: "Recipient", Label: "Recipient", Name: "recipient", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "UserID", Label: "User ID", Name: "user_id", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "Subject", Label: "Subject", Name: "subject", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "Template", Label: "Template", Name: "template", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "JobID", Label: "Job ID", Name: "job_id", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "Status", Label: "Status", Name: "status", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "Attempts", Label: "Attempts", Name: "attempts", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "Response", Label: "Response", Name: "response", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "SentAt", Label: "Sent At", Name: "sent_at", Placeholder: "", Value: "", Type: "datetime-local", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+
+		{DbLabel: "CreatedAt", Label: "Created At", Name: "created_at", Placeholder: "", Value: "", Type: "datetime-local", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "UpdatedAt", Label: "Updated At", Name: "updated_at", Placeholder: "", Value: "", Type: "datetime-local", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+	}
+}
@@ -0,0 +1,308 @@
+package adminpanel
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/dmawardi/Go-Template/internal/controller/core"
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers"
+	"github.com/dmawardi/Go-Template/internal/helpers/data"
+	"github.com/dmawardi/Go-Template/internal/helpers/request"
+	webapi "github.com/dmawardi/Go-Template/internal/helpers/webApi"
+	"github.com/dmawardi/Go-Template/internal/models"
+	coreservices "github.com/dmawardi/Go-Template/internal/service/core"
+	"github.com/go-chi/chi/v5"
+)
+
+// Table headers to show on find all page
+var jobTableHeaders = []TableHeader{
+	{Label: "ID", ColumnSortLabel: "id", Pointer: false, DataType: "int", Sortable: true},
+	{Label: "JobType", ColumnSortLabel: "job_type", Pointer: false, DataType: "string", Sortable: true},
+	{Label: "Status", ColumnSortLabel: "status", Pointer: false, DataType: "string", Sortable: true},
+	{Label: "Priority", ColumnSortLabel: "priority", Pointer: false, DataType: "int", Sortable: true},
+	{Label: "Attempts", ColumnSortLabel: "attempts", Pointer: false, DataType: "string", Sortable: true},
+	{Label: "NextRunAt", ColumnSortLabel: "next_run_at", Pointer: false, DataType: "string", Sortable: true},
+	{Label: "LastError", ColumnSortLabel: "last_error", Pointer: false, DataType: "string", Sortable: false},
+}
+
+func NewAdminJobController(service coreservices.JobService, actionService webapi.ActionService) AdminJobController {
+	return &adminJobController{
+		service:       service,
+		actionService: actionService,
+		// Use values from above
+		adminHomeUrl:     "/admin/jobs",
+		schemaName:       "Job",
+		pluralSchemaName: "Jobs",
+		tableHeaders:     jobTableHeaders,
+	}
+}
+
+type adminJobController struct {
+	service       coreservices.JobService
+	actionService webapi.ActionService
+	// For links
+	adminHomeUrl string
+	// For HTML text rendering
+	schemaName       string
+	pluralSchemaName string
+	// Custom table headers
+	tableHeaders []TableHeader
+}
+
+type AdminJobController interface {
+	FindAll(w http.ResponseWriter, r *http.Request)
+	View(w http.ResponseWriter, r *http.Request)
+	// Move a dead, failed or cancelled job back into the queue
+	Retry(w http.ResponseWriter, r *http.Request)
+	RetrySuccess(w http.ResponseWriter, r *http.Request)
+	// Stop a pending job from being run
+	Cancel(w http.ResponseWriter, r *http.Request)
+	CancelSuccess(w http.ResponseWriter, r *http.Request)
+	// Permanently delete selected jobs (from table)
+	BulkDelete(w http.ResponseWriter, r *http.Request)
+}
+
+func (c adminJobController) FindAll(w http.ResponseWriter, r *http.Request) {
+	// Grab query parameters
+	searchQuery := r.URL.Query().Get("search")
+	// Grab basic query params
+	baseQueryParams, err := request.ExtractBasicFindAllQueryParams(r)
+	if err != nil {
+		http.Error(w, "Error extracting query params", http.StatusBadRequest)
+		return
+	}
+
+	// Build search and filter conditions
+	conditions := core.JobFilterConditions(r)
+
+	// Grab all items
+	found, err := c.service.FindAll(baseQueryParams.Limit, baseQueryParams.Offset, baseQueryParams.Order, conditions)
+	if err != nil {
+		http.Error(w, "Error finding data", http.StatusInternalServerError)
+		return
+	}
+	// Convert data to AdminPanelSchema
+	schemaSlice := *found.Data
+	var adminSchemaSlice []models.AdminPanelSchema
+	for _, item := range schemaSlice {
+		// Append to schemaSlice
+		adminSchemaSlice = append(adminSchemaSlice, item)
+	}
+
+	// Build the table data
+	tableData := BuildTableData(adminSchemaSlice, found.Meta, c.adminHomeUrl, c.tableHeaders, false)
+
+	// Generate Find All page render data
+	data := GenerateFindAllRenderData(tableData, c.schemaName, c.pluralSchemaName, c.adminHomeUrl, searchQuery)
+	data.SectionTitle = "Select a job to inspect"
+	// Add type and status filters (with current selection)
+	data.SearchFilters = c.generateFilterFields(r)
+
+	// Execute the template with data and write to response
+	err = app.AdminTemplates.ExecuteTemplate(w, "layout.go.tmpl", data)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+}
+
+func (c adminJobController) View(w http.ResponseWriter, r *http.Request) {
+	// Init new Job view form
+	editForm := c.generateEditForm()
+
+	// Grab URL parameter
+	stringParameter := chi.URLParam(r, "id")
+	// Convert to int
+	idParameter, err := strconv.Atoi(stringParameter)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	// Search for by ID and store in found
+	found, err := c.service.FindById(idParameter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s not found", c.schemaName), http.StatusNotFound)
+		return
+	}
+
+	// Convert db struct to map for placeholder population
+	currentData := getValuesUsingFieldMap(*found)
+	// Populate form field placeholders with data from database
+	err = populateValuessWithDBData(&editForm, currentData)
+	if err != nil {
+		http.Error(w, "Error generating form", http.StatusInternalServerError)
+		return
+	}
+
+	data := GenerateEditRenderData(editForm, c.schemaName, c.pluralSchemaName, c.adminHomeUrl, stringParameter, false)
+	data.PageTitle = fmt.Sprintf("%s: %s", c.schemaName, stringParameter)
+	data.SectionTitle = fmt.Sprintf("%s %s (%s)", c.schemaName, stringParameter, found.Status)
+	// Add retry/cancel buttons based on the job's status
+	data.SectionDetail = c.generateJobActionButtons(found)
+
+	// Execute the template with data and write to response
+	err = app.AdminTemplates.ExecuteTemplate(w, "layout.go.tmpl", data)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+}
+
+func (c adminJobController) Retry(w http.ResponseWriter, r *http.Request) {
+	c.updateJobStatus(w, r, "retry", c.service.Requeue)
+}
+
+func (c adminJobController) Cancel(w http.ResponseWriter, r *http.Request) {
+	c.updateJobStatus(w, r, "cancel", c.service.Cancel)
+}
+
+func (c adminJobController) BulkDelete(w http.ResponseWriter, r *http.Request) {
+	// Grab body of request
+	// Init
+	var listOfIds BulkDeleteRequest
+
+	// Prepare response
+	bulkResponse := models.BulkDeleteResponse{
+		Errors: []error{},
+	}
+
+	// Decode request body as JSON and store
+	err := json.NewDecoder(r.Body).Decode(&listOfIds)
+	if err != nil {
+		fmt.Println("Decoding error: ", err)
+	}
+	bulkResponse.DeletedRecords = len(listOfIds.SelectedItems)
+
+	// Convert string slice to int slice
+	intIdList, err := data.ConvertStringSliceToIntSlice(listOfIds.SelectedItems)
+	if err != nil {
+		bulkResponse.Errors = append(bulkResponse.Errors, err)
+		bulkResponse.Success = false
+		request.WriteAsJSON(w, bulkResponse)
+		return
+	}
+
+	// Purge jobs
+	err = c.service.BulkDelete(intIdList)
+	// If error detected send error response
+	if err != nil {
+		bulkResponse.Errors = append(bulkResponse.Errors, err)
+		bulkResponse.Success = false
+		request.WriteAsJSON(w, bulkResponse)
+		return
+	}
+
+	// Record Bulk delete
+	err = c.actionService.RecordBulkDelete(r, c.schemaName, c.pluralSchemaName, intIdList, &models.RecordedAction{
+		ActionType: "bulk-delete",
+		EntityType: c.schemaName,
+		EntityID:   fmt.Sprint(intIdList),
+	})
+	if err != nil {
+		fmt.Printf("Error recording action: %s", err)
+	}
+	// else if successful
+	bulkResponse.Success = true
+	request.WriteAsJSON(w, bulkResponse)
+}
+
+// Success handlers
+func (c adminJobController) RetrySuccess(w http.ResponseWriter, r *http.Request) {
+	// Serve admin success page
+	serveAdminSuccess(w, fmt.Sprintf("Retry %s", c.schemaName), fmt.Sprintf("%s Re-queued Successfully!", c.schemaName))
+}
+func (c adminJobController) CancelSuccess(w http.ResponseWriter, r *http.Request) {
+	// Serve admin success page
+	serveAdminSuccess(w, fmt.Sprintf("Cancel %s", c.schemaName), fmt.Sprintf("%s Cancelled Successfully!", c.schemaName))
+}
+
+// Applies a status change (retry/cancel) to the job in the URL, records the action and redirects to the success page
+func (c adminJobController) updateJobStatus(w http.ResponseWriter, r *http.Request, operation string, apply func(int) (*db.Job, error)) {
+	stringParameter := chi.URLParam(r, "id")
+	// Convert to int
+	idParameter, err := strconv.Atoi(stringParameter)
+	if err != nil {
+		serveAdminError(w, "Unable to interpret ID")
+		return
+	}
+
+	// Find current state of job (for change log)
+	current, err := c.service.FindById(idParameter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s not found", c.schemaName), http.StatusNotFound)
+		return
+	}
+
+	// Apply operation
+	updated, err := apply(idParameter)
+	if err != nil {
+		fmt.Printf("Error applying %s to job: %s\n", operation, err)
+		serveAdminError(w, fmt.Sprintf("Unable to %s %s %d (status: %s)", operation, c.schemaName, idParameter, current.Status))
+		return
+	}
+
+	// Record action
+	err = c.actionService.RecordAction(r, c.schemaName, uint(idParameter), &models.RecordedAction{
+		ActionType: "update",
+		EntityType: c.schemaName,
+		EntityID:   fmt.Sprint(idParameter),
+	}, helpers.ChangeLogInput{OldObj: current, NewObj: updated})
+	if err != nil {
+		fmt.Printf("Error recording action: %s", err)
+	}
+
+	// Redirect to success page
+	http.Redirect(w, r, fmt.Sprintf("%s/%s/success", c.adminHomeUrl, operation), http.StatusSeeOther)
+}
+
+// Filters
+// Builds the type and status filter fields with the current selection
+func (c adminJobController) generateFilterFields(r *http.Request) []FormField {
+	typeSelector := JobTypeSelection()
+	setDefaultSelected(typeSelector, r.URL.Query().Get("job_type"))
+	statusSelector := JobStatusSelection()
+	setDefaultSelected(statusSelector, r.URL.Query().Get("status"))
+
+	return []FormField{
+		{Label: "Type", Name: "job_type", Type: "select", Selectors: typeSelector},
+		{Label: "Status", Name: "status", Type: "select", Selectors: statusSelector},
+	}
+}
+
+// Builds the retry/cancel buttons for the view page (submitted using the surrounding form)
+func (c adminJobController) generateJobActionButtons(job *db.Job) template.HTML {
+	switch job.Status {
+	case db.JobStatusDead, db.JobStatusFailed, db.JobStatusCancelled:
+		return template.HTML(fmt.Sprintf(`<div class="button-container"><button type="submit" class="button-primary" formaction="%s/retry/%d">Retry</button></div>`, c.adminHomeUrl, job.ID))
+	case db.JobStatusPending:
+		return template.HTML(fmt.Sprintf(`<div class="button-container"><button type="submit" class="button-danger" formaction="%s/cancel/%d">Cancel</button></div>`, c.adminHomeUrl, job.ID))
+	}
+	return ""
+}
+
+// Form generation
+// Used to build View form
+func (c adminJobController) generateEditForm() []FormField {
+	return []FormField{
+		{DbLabel: "JobType", Label: "Job Type", Name: "job_type", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "Status", Label: "Status", Name: "status", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "Priority", Label: "Priority", Name: "priority", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "UniqueKey", Label: "Unique Key", Name: "unique_key", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "Payload", Label: "Payload", Name: "payload", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "Attempts", Label: "Attempts", Name: "attempts", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "MaxAttempts", Label: "Max Attempts", Name: "max_attempts", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "LastError", Label: "Last Error", Name: "last_error", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "NextRunAt", Label: "Next Run At", Name: "next_run_at", Placeholder: "", Value: "", Type: "datetime-local", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "StartedAt", Label: "Started At", Name: "started_at", Placeholder: "", Value: "", Type: "datetime-local", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "LockedBy", Label: "Locked By", Name: "locked_by", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "LockedUntil", Label: "Locked Until", Name: "locked_until", Placeholder: "", Value: "", Type: "datetime-local", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+
+		{DbLabel: "CreatedAt", Label: "Created At", Name: "created_at", Placeholder: "", Value: "", Type: "datetime-local", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "UpdatedAt", Label: "Updated At", Name: "updated_at", Placeholder: "", Value: "", Type: "datetime-local", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+	}
+}
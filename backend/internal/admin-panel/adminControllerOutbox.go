@@ -0,0 +1,256 @@
+package adminpanel
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/email"
+	"github.com/dmawardi/Go-Template/internal/helpers/data"
+	"github.com/dmawardi/Go-Template/internal/helpers/request"
+	"github.com/dmawardi/Go-Template/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// Table headers to show on find all page
+var outboxTableHeaders = []TableHeader{
+	{Label: "ID", ColumnSortLabel: "id", Pointer: false, DataType: "string", Sortable: false},
+	{Label: "Date", ColumnSortLabel: "date", Pointer: false, DataType: "string", Sortable: false},
+	{Label: "To", ColumnSortLabel: "to", Pointer: false, DataType: "string", Sortable: false},
+	{Label: "Subject", ColumnSortLabel: "subject", Pointer: false, DataType: "string", Sortable: false},
+}
+
+// The outbox is nil unless the file email driver is used
+func NewAdminOutboxController(outbox email.Outbox) AdminOutboxController {
+	return &adminOutboxController{
+		outbox: outbox,
+		// Use values from above
+		adminHomeUrl:     "/admin/outbox",
+		schemaName:       "Email",
+		pluralSchemaName: "Outbox",
+		tableHeaders:     outboxTableHeaders,
+	}
+}
+
+type adminOutboxController struct {
+	outbox email.Outbox
+	// For links
+	adminHomeUrl string
+	// For HTML text rendering
+	schemaName       string
+	pluralSchemaName string
+	// Custom table headers
+	tableHeaders []TableHeader
+}
+
+type AdminOutboxController interface {
+	FindAll(w http.ResponseWriter, r *http.Request)
+	View(w http.ResponseWriter, r *http.Request)
+	// Download a message as an .eml file
+	Raw(w http.ResponseWriter, r *http.Request)
+	// Delete selected messages (from table)
+	BulkDelete(w http.ResponseWriter, r *http.Request)
+}
+
+func (c adminOutboxController) FindAll(w http.ResponseWriter, r *http.Request) {
+	if c.outbox == nil {
+		serveAdminError(w, "The outbox is only available when using the file email driver (EMAIL_DRIVER=file)")
+		return
+	}
+	// Grab query parameters
+	searchQuery := r.URL.Query().Get("search")
+	// Grab basic query params
+	baseQueryParams, err := request.ExtractBasicFindAllQueryParams(r)
+	if err != nil {
+		http.Error(w, "Error extracting query params", http.StatusBadRequest)
+		return
+	}
+
+	// Grab all messages (newest first)
+	messages, err := c.outbox.List()
+	if err != nil {
+		http.Error(w, "Error finding data", http.StatusInternalServerError)
+		return
+	}
+	// Search (matches subject, sender and recipients)
+	found := filterOutboxMessages(messages, searchQuery)
+
+	// Select page and convert data to AdminPanelSchema
+	var adminSchemaSlice []models.AdminPanelSchema
+	for i := baseQueryParams.Offset; i < len(found) && i < baseQueryParams.Offset+baseQueryParams.Limit; i++ {
+		adminSchemaSlice = append(adminSchemaSlice, outboxRow(found[i]))
+	}
+	metaData := data.PaginationMetaData(int64(len(found)), baseQueryParams.Limit, baseQueryParams.Offset)
+
+	// Build the table data
+	tableData := BuildTableData(adminSchemaSlice, metaData, c.adminHomeUrl, c.tableHeaders, false)
+
+	// Generate Find All page render data
+	data := GenerateFindAllRenderData(tableData, c.schemaName, c.pluralSchemaName, c.adminHomeUrl, searchQuery)
+	data.SectionTitle = "Select an email to view"
+
+	// Execute the template with data and write to response
+	err = app.AdminTemplates.ExecuteTemplate(w, "layout.go.tmpl", data)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+}
+
+func (c adminOutboxController) View(w http.ResponseWriter, r *http.Request) {
+	if c.outbox == nil {
+		serveAdminError(w, "The outbox is only available when using the file email driver (EMAIL_DRIVER=file)")
+		return
+	}
+	// Grab URL parameter
+	idParameter := chi.URLParam(r, "id")
+
+	// Search for by ID and store in found
+	found, err := c.outbox.Find(idParameter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s not found", c.schemaName), http.StatusNotFound)
+		return
+	}
+
+	// Render message details and preview
+	var detail bytes.Buffer
+	err = app.AdminTemplates.ExecuteTemplate(&detail, "outbox-message", outboxMessageView{
+		OutboxMessage: *found,
+		Preview:       embedInlineImages(found.HTML, found.Attachments),
+		RawUrl:        fmt.Sprintf("%s/%s/raw", c.adminHomeUrl, found.ID),
+	})
+	if err != nil {
+		fmt.Println(err.Error())
+		http.Error(w, "Error rendering email", http.StatusInternalServerError)
+		return
+	}
+
+	data := GenerateEditRenderData([]FormField{}, c.schemaName, c.pluralSchemaName, c.adminHomeUrl, idParameter, false)
+	data.PageTitle = fmt.Sprintf("%s: %s", c.schemaName, found.Subject)
+	data.SectionTitle = found.Subject
+	data.SectionDetail = template.HTML(detail.String())
+
+	// Execute the template with data and write to response
+	err = app.AdminTemplates.ExecuteTemplate(w, "layout.go.tmpl", data)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+}
+
+func (c adminOutboxController) Raw(w http.ResponseWriter, r *http.Request) {
+	if c.outbox == nil {
+		http.Error(w, "Outbox not available", http.StatusNotFound)
+		return
+	}
+	// Grab URL parameter
+	idParameter := chi.URLParam(r, "id")
+
+	raw, err := c.outbox.Raw(idParameter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s not found", c.schemaName), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "message/rfc822")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", idParameter+".eml"))
+	w.Write(raw)
+}
+
+func (c adminOutboxController) BulkDelete(w http.ResponseWriter, r *http.Request) {
+	// Grab body of request
+	// Init
+	var listOfIds BulkDeleteRequest
+
+	// Prepare response
+	bulkResponse := models.BulkDeleteResponse{
+		Errors: []error{},
+	}
+	if c.outbox == nil {
+		bulkResponse.Errors = append(bulkResponse.Errors, fmt.Errorf("outbox not available"))
+		request.WriteAsJSON(w, bulkResponse)
+		return
+	}
+
+	// Decode request body as JSON and store
+	err := json.NewDecoder(r.Body).Decode(&listOfIds)
+	if err != nil {
+		fmt.Println("Decoding error: ", err)
+	}
+	bulkResponse.DeletedRecords = len(listOfIds.SelectedItems)
+
+	// Delete messages
+	err = c.outbox.Delete(listOfIds.SelectedItems...)
+	// If error detected send error response
+	if err != nil {
+		bulkResponse.Errors = append(bulkResponse.Errors, err)
+		bulkResponse.Success = false
+		request.WriteAsJSON(w, bulkResponse)
+		return
+	}
+
+	// else if successful
+	bulkResponse.Success = true
+	request.WriteAsJSON(w, bulkResponse)
+}
+
+// Data for the outbox-message template
+type outboxMessageView struct {
+	email.OutboxMessage
+	// HTML body with inline images embedded
+	Preview string
+	RawUrl  string
+}
+
+// Outbox message shown in the table
+type outboxRow email.OutboxMessage
+
+// Grabs the ID of the message
+func (m outboxRow) GetID() string {
+	return m.ID
+}
+
+func (m outboxRow) ObtainValue(keyValue string) string {
+	// Map of message fields
+	fieldMap := map[string]string{
+		"ID":      m.ID,
+		"Date":    m.Date.Format(time.RFC3339),
+		"From":    m.From,
+		"To":      m.To,
+		"Subject": m.Subject,
+	}
+	// Return value of key
+	return fieldMap[keyValue]
+}
+
+// Returns the messages matching the search (all messages if empty)
+func filterOutboxMessages(messages []email.OutboxMessage, search string) []email.OutboxMessage {
+	search = strings.ToLower(strings.TrimSpace(search))
+	if search == "" {
+		return messages
+	}
+	var found []email.OutboxMessage
+	for _, message := range messages {
+		fields := strings.ToLower(strings.Join([]string{message.Subject, message.From, message.Recipients}, " "))
+		if strings.Contains(fields, search) {
+			found = append(found, message)
+		}
+	}
+	return found
+}
+
+// Replaces references to inline images (cid:) with data URLs so they show in the preview
+func embedInlineImages(html string, attachments []email.Attachment) string {
+	for _, attachment := range attachments {
+		if attachment.ContentID == "" {
+			continue
+		}
+		dataUrl := fmt.Sprintf("data:%s;base64,%s", attachment.ContentType, base64.StdEncoding.EncodeToString(attachment.Data))
+		html = strings.ReplaceAll(html, "cid:"+attachment.ContentID, dataUrl)
+	}
+	return html
+}
@@ -1,12 +1,17 @@
 package adminpanel
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/dmawardi/Go-Template/internal/controller/core"
+	"github.com/dmawardi/Go-Template/internal/db"
 	"github.com/dmawardi/Go-Template/internal/helpers"
 	adminpanel "github.com/dmawardi/Go-Template/internal/helpers/adminPanel"
 	data "github.com/dmawardi/Go-Template/internal/helpers/data"
@@ -59,10 +64,17 @@ type AdminUserController interface {
 	Delete(w http.ResponseWriter, r *http.Request)
 	// Bulk delete (from table)
 	BulkDelete(w http.ResponseWriter, r *http.Request)
+	// Unlock account (after failed logins)
+	Unlock(w http.ResponseWriter, r *http.Request)
+	// Active sessions and login history
+	Sessions(w http.ResponseWriter, r *http.Request)
+	RevokeSession(w http.ResponseWriter, r *http.Request)
 	// Success pages
 	CreateSuccess(w http.ResponseWriter, r *http.Request)
 	EditSuccess(w http.ResponseWriter, r *http.Request)
 	DeleteSuccess(w http.ResponseWriter, r *http.Request)
+	UnlockSuccess(w http.ResponseWriter, r *http.Request)
+	RevokeSessionSuccess(w http.ResponseWriter, r *http.Request)
 	// For sidebar
 	ObtainUrlDetails() models.URLDetails
 }
@@ -238,7 +250,7 @@ func (c adminUserController) Edit(w http.ResponseWriter, r *http.Request) {
 		// If validation passes
 		if pass {
 			// Update user
-			updated, err := c.service.Update(idParameter, &toValidate)
+			updated, err := c.service.Update(idParameter, &toValidate, time.Time{})
 			if err != nil {
 				http.Error(w, fmt.Sprintf("Error updating %s", c.schemaName), http.StatusInternalServerError)
 				return
@@ -286,6 +298,11 @@ func (c adminUserController) Edit(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := GenerateEditRenderData(editForm, c.schemaName, c.pluralSchemaName, c.adminHomeUrl, stringParameter, true)
+	// Link to the user's email delivery history and sessions
+	data.SectionDetail = template.HTML(fmt.Sprintf(`<p><a href="/admin/email-logs?user_id=%d">View email history</a></p>`, idParameter))
+	data.SectionDetail += template.HTML(fmt.Sprintf(`<p><a href="%s/sessions/%d">View sessions and login history</a></p>`, c.adminHomeUrl, idParameter))
+	// Failed logins (with a button to unlock the account)
+	data.SectionDetail += c.generateLoginThrottleDetail(idParameter)
 
 	// Execute the template with data and write to response
 	err = app.AdminTemplates.ExecuteTemplate(w, "layout.go.tmpl", data)
@@ -305,7 +322,7 @@ func (c adminUserController) Delete(w http.ResponseWriter, r *http.Request) {
 	// If form is being submitted (method = POST)
 	if r.Method == "POST" {
 		// Delete
-		err = c.service.Delete(idParameter)
+		err = c.service.Delete(idParameter, time.Time{})
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Error deleting %s", c.schemaName), http.StatusInternalServerError)
 			return
@@ -399,6 +416,187 @@ func (c adminUserController) DeleteSuccess(w http.ResponseWriter, r *http.Reques
 	// Serve admin success page
 	serveAdminSuccess(w, fmt.Sprintf("Delete %s", c.schemaName), fmt.Sprintf("%s Deleted Successfully!", c.schemaName))
 }
+func (c adminUserController) UnlockSuccess(w http.ResponseWriter, r *http.Request) {
+	// Serve admin success page
+	serveAdminSuccess(w, fmt.Sprintf("Unlock %s", c.schemaName), fmt.Sprintf("%s Unlocked Successfully!", c.schemaName))
+}
+
+// Clears the failed logins of the user in the URL (unlocking their account), records the action and redirects to the success page
+func (c adminUserController) Unlock(w http.ResponseWriter, r *http.Request) {
+	stringParameter := chi.URLParam(r, "id")
+	// Convert to int
+	idParameter, err := strconv.Atoi(stringParameter)
+	if err != nil {
+		serveAdminError(w, "Unable to interpret ID")
+		return
+	}
+
+	// Find failed logins (for change log)
+	current, err := c.service.FindLoginThrottle(idParameter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s not found", c.schemaName), http.StatusNotFound)
+		return
+	}
+	if current == nil {
+		current = &db.LoginThrottle{}
+	}
+
+	err = c.service.UnlockUser(idParameter)
+	if err != nil {
+		fmt.Printf("Error unlocking user: %s\n", err)
+		serveAdminError(w, fmt.Sprintf("Unable to unlock %s %d", c.schemaName, idParameter))
+		return
+	}
+
+	// Record action
+	err = c.actionService.RecordAction(r, c.schemaName, uint(idParameter), &models.RecordedAction{
+		ActionType: "update",
+		EntityType: c.schemaName,
+		EntityID:   stringParameter,
+	}, helpers.ChangeLogInput{OldObj: current, NewObj: &db.LoginThrottle{}})
+	if err != nil {
+		fmt.Printf("Error recording action: %s", err)
+	}
+
+	// Redirect to success page
+	http.Redirect(w, r, fmt.Sprintf("%s/unlock/success", c.adminHomeUrl), http.StatusSeeOther)
+}
+
+func (c adminUserController) RevokeSessionSuccess(w http.ResponseWriter, r *http.Request) {
+	// Serve admin success page
+	serveAdminSuccess(w, "Revoke Session", "Session Revoked Successfully!")
+}
+
+// Shows the active sessions and recent logins of the user in the URL
+func (c adminUserController) Sessions(w http.ResponseWriter, r *http.Request) {
+	stringParameter := chi.URLParam(r, "id")
+	// Convert to int
+	idParameter, err := strconv.Atoi(stringParameter)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	found, err := c.service.FindById(idParameter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s not found", c.schemaName), http.StatusNotFound)
+		return
+	}
+
+	sessions, err := c.service.FindSessions(idParameter, "")
+	if err != nil {
+		http.Error(w, "Error finding sessions", http.StatusInternalServerError)
+		return
+	}
+	loginEvents, err := c.service.FindLoginEvents(idParameter)
+	if err != nil {
+		http.Error(w, "Error finding login history", http.StatusInternalServerError)
+		return
+	}
+
+	// Render sessions (with revoke buttons) and login history
+	var detail bytes.Buffer
+	err = app.AdminTemplates.ExecuteTemplate(&detail, "user-sessions", userSessionsView{
+		Sessions:    sessions,
+		LoginEvents: loginEvents,
+		UserUrl:     fmt.Sprintf("%s/%d", c.adminHomeUrl, idParameter),
+		RevokeUrl:   fmt.Sprintf("%s/sessions/%d", c.adminHomeUrl, idParameter),
+	})
+	if err != nil {
+		fmt.Println(err.Error())
+		http.Error(w, "Error rendering sessions", http.StatusInternalServerError)
+		return
+	}
+
+	data := GenerateEditRenderData([]FormField{}, c.schemaName, c.pluralSchemaName, c.adminHomeUrl, stringParameter, false)
+	data.PageTitle = fmt.Sprintf("%s Sessions: %s", c.schemaName, found.Email)
+	data.SectionTitle = fmt.Sprintf("Sessions: %s", found.Email)
+	data.SectionDetail = template.HTML(detail.String())
+
+	// Execute the template with data and write to response
+	err = app.AdminTemplates.ExecuteTemplate(w, "layout.go.tmpl", data)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+}
+
+// Revokes a session of the user in the URL, records the action and redirects to the success page
+func (c adminUserController) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	stringParameter := chi.URLParam(r, "id")
+	// Convert to int
+	idParameter, err := strconv.Atoi(stringParameter)
+	if err != nil {
+		serveAdminError(w, "Unable to interpret ID")
+		return
+	}
+	sessionId, err := strconv.Atoi(chi.URLParam(r, "session"))
+	if err != nil {
+		serveAdminError(w, "Unable to interpret session ID")
+		return
+	}
+
+	// Find session (for change log)
+	sessions, err := c.service.FindSessions(idParameter, "")
+	if err != nil {
+		serveAdminError(w, "Unable to find sessions")
+		return
+	}
+	current := &db.Session{}
+	for i := range sessions {
+		if sessions[i].ID == uint(sessionId) {
+			current = &sessions[i].Session
+		}
+	}
+
+	err = c.service.RevokeSession(idParameter, sessionId)
+	if errors.Is(err, coreservices.ErrSessionNotFound) {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error revoking session: %s\n", err)
+		serveAdminError(w, fmt.Sprintf("Unable to revoke session %d", sessionId))
+		return
+	}
+
+	// Record action
+	revoked := *current
+	revokedAt := time.Now()
+	revoked.RevokedAt = &revokedAt
+	err = c.actionService.RecordAction(r, c.schemaName, uint(idParameter), &models.RecordedAction{
+		ActionType: "update",
+		EntityType: c.schemaName,
+		EntityID:   stringParameter,
+	}, helpers.ChangeLogInput{OldObj: current, NewObj: &revoked})
+	if err != nil {
+		fmt.Printf("Error recording action: %s", err)
+	}
+
+	// Redirect to success page
+	http.Redirect(w, r, fmt.Sprintf("%s/sessions/revoke/success", c.adminHomeUrl), http.StatusSeeOther)
+}
+
+// Shows the failed logins of a user's account, with a button to unlock it (submitted using the surrounding form)
+func (c adminUserController) generateLoginThrottleDetail(id int) template.HTML {
+	throttle, err := c.service.FindLoginThrottle(id)
+	if err != nil || throttle == nil {
+		return ""
+	}
+	status := fmt.Sprintf("%d failed login attempts", throttle.Failures)
+	if throttle.LockedUntil != nil && throttle.LockedUntil.After(time.Now()) {
+		status = fmt.Sprintf("Locked until %s after %d failed login attempts", throttle.LockedUntil.Format(time.RFC1123), throttle.Failures)
+	}
+	return template.HTML(fmt.Sprintf(`<p>%s</p><div class="button-container"><button type="submit" class="button-primary" formaction="%s/unlock/%d">Unlock</button></div>`, template.HTMLEscapeString(status), c.adminHomeUrl, id))
+}
+
+// Data for the user sessions template
+type userSessionsView struct {
+	Sessions    []models.UserSession
+	LoginEvents []db.LoginEvent
+	UserUrl     string
+	// Sessions are revoked at <RevokeUrl>/<session id>/revoke
+	RevokeUrl string
+}
 
 // Form generation
 // Used to build Create form
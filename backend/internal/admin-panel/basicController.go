@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/dmawardi/Go-Template/internal/helpers"
 	adminpanel "github.com/dmawardi/Go-Template/internal/helpers/adminPanel"
@@ -237,7 +238,7 @@ func (c basicAdminController[dbSchema, create, update]) Edit(w http.ResponseWrit
 		// If validation passes
 		if pass {
 			// Update
-			updated, err := c.Service.Update(idParameter, toValidate)
+			updated, err := c.Service.Update(idParameter, toValidate, time.Time{})
 			if err != nil {
 				http.Error(w, fmt.Sprintf("Error updating %s", c.SchemaName), http.StatusInternalServerError)
 				return
@@ -300,7 +301,7 @@ func (c basicAdminController[dbSchema, create, update]) Delete(w http.ResponseWr
 	// If form is being submitted (method = POST)
 	if r.Method == "POST" {
 		// Delete user
-		err = c.Service.Delete(idParameter)
+		err = c.Service.Delete(idParameter, time.Time{})
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Error deleting %s", c.SchemaName), http.StatusInternalServerError)
 			return
@@ -1,6 +1,7 @@
 package adminpanel
 
 import (
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
@@ -27,6 +28,10 @@ type AdminCoreController interface {
 	ChangePassword(w http.ResponseWriter, r *http.Request)
 	// Change Password Success handler
 	ChangePasswordSuccess(w http.ResponseWriter, r *http.Request)
+	// Completes a login with a two factor code
+	TwoFactorLogin(w http.ResponseWriter, r *http.Request)
+	// Two factor authentication setup handler
+	TwoFactorSetup(w http.ResponseWriter, r *http.Request)
 	// Admin redirect handler
 	AdminRedirectBasedOnLoginStatus(w http.ResponseWriter, r *http.Request)
 }
@@ -60,8 +65,7 @@ func (c adminCoreController) Home(w http.ResponseWriter, r *http.Request) {
 
 // Admin login page
 func (c adminCoreController) Login(w http.ResponseWriter, r *http.Request) {
-	// Init token string
-	tokenString := ""
+	// Init error message
 	loginErrorMsg := ""
 
 	// Generate form
@@ -77,8 +81,10 @@ func (c adminCoreController) Login(w http.ResponseWriter, r *http.Request) {
 		}
 		// Build to login struct
 		login := models.Login{
-			Email:    loginMap["email"],
-			Password: loginMap["password"],
+			Email:     loginMap["email"],
+			Password:  loginMap["password"],
+			IPAddress: request.ClientIP(r),
+			UserAgent: r.UserAgent(),
 		}
 		// Validate form data
 		// Validate struct
@@ -87,10 +93,15 @@ func (c adminCoreController) Login(w http.ResponseWriter, r *http.Request) {
 		// If validation passes
 		if pass {
 			// Login user
-			tokenString, err = c.service.LoginUser(&login)
+			loginResponse, err := c.service.LoginUserSession(&login)
 			if err == nil {
+				// Users with two factor authentication enter a code to complete the login
+				if loginResponse.TwoFactorRequired {
+					c.renderTwoFactorLogin(w, loginResponse.TwoFactorToken, "")
+					return
+				}
 				// Set token in cookie
-				auth.CreateAndSetHeaderCookie(w, tokenString)
+				auth.CreateAndSetHeaderCookie(w, loginResponse.Token)
 
 				// Redirect or render a success message
 				http.Redirect(w, r, "/admin/home", http.StatusSeeOther)
@@ -99,6 +110,13 @@ func (c adminCoreController) Login(w http.ResponseWriter, r *http.Request) {
 			// Else if login fails
 			fmt.Printf("Error logging in for email: %s\n", login.Email)
 			loginErrorMsg = "Invalid email or password"
+			// Too many failed attempts for the account or IP address
+			var throttled *coreservices.LoginThrottledError
+			if errors.As(err, &throttled) {
+				loginErrorMsg = "Too many login attempts. Try again later"
+				w.Header().Set("Retry-After", fmt.Sprint(int(throttled.RetryAfter.Seconds())))
+				w.WriteHeader(http.StatusTooManyRequests)
+			}
 		}
 
 		// Else if validation fails
@@ -140,6 +158,15 @@ func (c adminCoreController) Login(w http.ResponseWriter, r *http.Request) {
 
 // Admin logout page
 func (c adminCoreController) Logout(w http.ResponseWriter, r *http.Request) {
+	// Revoke the session token (if still valid)
+	tokenData, err := auth.ValidateAndParseToken(r)
+	if err == nil {
+		err = c.service.Logout(tokenData, "")
+		if err != nil {
+			fmt.Println("Error revoking session token: ", err)
+		}
+	}
+
 	http.SetCookie(w, &http.Cookie{
 		Name:     "jwt_token", // Use the name of your auth cookie
 		Value:    "",
@@ -203,11 +230,18 @@ func (c adminCoreController) ChangePassword(w http.ResponseWriter, r *http.Reque
 			if changePassword.NewPassword == changePassword.ConfirmNewPassword && passMatch {
 
 				// Update the user's password
-				_, err = c.service.Update(userID, &models.UpdateUser{Password: changePassword.ConfirmNewPassword})
+				_, err = c.service.Update(userID, &models.UpdateUser{Password: changePassword.ConfirmNewPassword}, time.Time{})
+				if err != nil {
+					fmt.Println(err.Error())
+					return
+				}
+				// Changing the password ends all sessions, so start a new session
+				tokenString, err := c.service.StartSession(userID, tokenData.TwoFactor, request.ClientIP(r), r.UserAgent())
 				if err != nil {
 					fmt.Println(err.Error())
 					return
 				}
+				auth.CreateAndSetHeaderCookie(w, tokenString)
 
 				// Redirect or render a success message
 				http.Redirect(w, r, "/admin/change-password-success", http.StatusSeeOther)
@@ -260,6 +294,172 @@ func (c adminCoreController) ChangePasswordSuccess(w http.ResponseWriter, r *htt
 	serveAdminSuccess(w, "Change Password Success - Admin", "Change Password Success")
 }
 
+// Completes a login with a code from the user's authenticator app (or a recovery code)
+func (c adminCoreController) TwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	// Extract form data
+	form, err := adminpanel.ParseFormToMap(r)
+	if err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+	login := models.TwoFactorLogin{
+		TwoFactorToken: form["two_factor_token"],
+		Code:           form["code"],
+		IPAddress:      request.ClientIP(r),
+		UserAgent:      r.UserAgent(),
+	}
+
+	// Validate struct
+	pass, _ := request.GoValidateStruct(login)
+	if pass {
+		tokenString, err := c.service.VerifyTwoFactorSession(&login)
+		if err == nil {
+			// Set token in cookie
+			auth.CreateAndSetHeaderCookie(w, tokenString)
+			http.Redirect(w, r, "/admin/home", http.StatusSeeOther)
+			return
+		}
+		fmt.Println("Error verifying two factor code: ", err)
+		// Too many failed attempts for the account or IP address
+		var throttled *coreservices.LoginThrottledError
+		if errors.As(err, &throttled) {
+			w.Header().Set("Retry-After", fmt.Sprint(int(throttled.RetryAfter.Seconds())))
+			w.WriteHeader(http.StatusTooManyRequests)
+			c.renderTwoFactorLogin(w, login.TwoFactorToken, "Too many login attempts. Try again later")
+			return
+		}
+	}
+	c.renderTwoFactorLogin(w, login.TwoFactorToken, "Invalid or expired code")
+}
+
+// Two factor authentication setup (required before using the admin panel for roles in TWO_FACTOR_REQUIRED_ROLES)
+func (c adminCoreController) TwoFactorSetup(w http.ResponseWriter, r *http.Request) {
+	// Find user using the token
+	tokenData, err := auth.ValidateAndParseToken(r)
+	if err != nil {
+		http.Error(w, "Error parsing authentication token", http.StatusForbidden)
+		return
+	}
+	userID, err := strconv.Atoi(tokenData.UserID)
+	if err != nil {
+		http.Error(w, "Error parsing authentication token", http.StatusForbidden)
+		return
+	}
+
+	notification := ""
+	// If form is being submitted (method = POST)
+	if r.Method == "POST" {
+		form, err := adminpanel.ParseFormToMap(r)
+		if err != nil {
+			http.Error(w, "Error parsing form", http.StatusBadRequest)
+			return
+		}
+		recoveryCodes, err := c.service.ConfirmTwoFactor(userID, form["code"])
+		if err == nil {
+			// Replace the session with a session that completed two factor authentication
+			tokenString, err := c.service.StartSession(userID, true, request.ClientIP(r), r.UserAgent())
+			if err != nil {
+				fmt.Println(err.Error())
+				return
+			}
+			err = c.service.Logout(tokenData, "")
+			if err != nil {
+				fmt.Println("Error ending previous session: ", err)
+			}
+			auth.CreateAndSetHeaderCookie(w, tokenString)
+
+			// Show recovery codes (only shown once)
+			detail := "<p>Two factor authentication is enabled. Store these recovery codes somewhere safe. Each can be used once to log in without your authenticator app.</p><ul>"
+			for _, code := range recoveryCodes.RecoveryCodes {
+				detail += "<li><code>" + template.HTMLEscapeString(code) + "</code></li>"
+			}
+			c.renderTwoFactorSetup(w, template.HTML(detail+"</ul>"), false)
+			return
+		}
+		fmt.Println("Error confirming two factor authentication: ", err)
+		notification = "Invalid code. Please try again"
+		// Too many invalid codes
+		if errors.Is(err, coreservices.ErrLoginThrottled) {
+			notification = "Too many invalid codes. Try again later"
+		}
+	}
+
+	// Generate (or reuse) the secret to add to the authenticator app
+	enrollment, err := c.service.EnrollTwoFactor(userID)
+	if errors.Is(err, coreservices.ErrTwoFactorAlreadyEnabled) {
+		detail := "<p>Two factor authentication is enabled for your account.</p>"
+		// Sessions started before it was enabled need a new login
+		if !tokenData.TwoFactor {
+			detail += `<p>Please <a href="/admin/logout">log in again</a> with your authenticator app to continue.</p>`
+		}
+		c.renderTwoFactorSetup(w, template.HTML(detail), false)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error setting up two factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	detail := fmt.Sprintf(`<p>%s</p><p>Add this account to your authenticator app using the link below (or by entering the secret), then enter the code it shows to confirm.</p><p><a href="%s">%s</a></p><p>Secret: <code>%s</code></p>`,
+		template.HTMLEscapeString(notification),
+		template.HTMLEscapeString(enrollment.URI),
+		template.HTMLEscapeString(enrollment.URI),
+		template.HTMLEscapeString(enrollment.Secret))
+	c.renderTwoFactorSetup(w, template.HTML(detail), true)
+}
+
+// Renders the second step of the login (entering a two factor code)
+func (c adminCoreController) renderTwoFactorLogin(w http.ResponseWriter, twoFactorToken string, errorMsg string) {
+	err := app.AdminTemplates.ExecuteTemplate(w, "login.go.tmpl", PageRenderData{
+		PageTitle: "Two Factor Authentication",
+		// The section title is used on this page, to display login errors
+		SectionTitle: errorMsg,
+		FormData: FormData{
+			FormDetails: FormDetails{
+				FormAction: "/admin/login/2fa",
+				FormMethod: "POST",
+			},
+			FormFields: c.generateTwoFactorLoginForm(twoFactorToken),
+		},
+		HeaderSection: header,
+	})
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+}
+
+// Renders the two factor setup page (with a code form if showForm is set)
+func (c adminCoreController) renderTwoFactorSetup(w http.ResponseWriter, detail template.HTML, showForm bool) {
+	data := PageRenderData{
+		SectionTitle:  "Two Factor Authentication",
+		PageTitle:     "Two Factor Authentication",
+		SectionDetail: detail,
+		PageType: PageType{
+			ViewPage: true,
+		},
+		FormData: FormData{
+			FormDetails: FormDetails{
+				FormAction: auth.TwoFactorSetupURL,
+				FormMethod: "POST",
+			},
+		},
+		HeaderSection: header,
+		SidebarList:   sidebar,
+	}
+	if showForm {
+		data.PageType = PageType{EditPage: true}
+		data.FormData.FormFields = c.generateTwoFactorSetupForm()
+	}
+
+	// Execute the template with data and write to response
+	err := app.AdminTemplates.ExecuteTemplate(w, "layout.go.tmpl", data)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+}
+
 // Redirect
 func (c adminCoreController) AdminRedirectBasedOnLoginStatus(w http.ResponseWriter, r *http.Request) {
 	_, err := auth.ValidateAndParseToken(r)
@@ -286,3 +486,14 @@ func (c adminCoreController) generateChangePasswordForm() []FormField {
 		{DbLabel: "Password", Label: "Confirm new Password", Name: "confirmNewPassword", Placeholder: "", Value: "", Type: "password", Required: true, Disabled: false, Errors: []ErrorMessage{}},
 	}
 }
+func (c adminCoreController) generateTwoFactorLoginForm(twoFactorToken string) []FormField {
+	return []FormField{
+		{DbLabel: "code", Label: "Authentication Code (or Recovery Code)", Name: "code", Placeholder: "123456", Value: "", Type: "text", Required: true, Disabled: false, Errors: []ErrorMessage{}},
+		{DbLabel: "two_factor_token", Label: "", Name: "two_factor_token", Placeholder: "", Value: twoFactorToken, Type: "hidden", Required: false, Disabled: false, Errors: []ErrorMessage{}},
+	}
+}
+func (c adminCoreController) generateTwoFactorSetupForm() []FormField {
+	return []FormField{
+		{DbLabel: "code", Label: "Authentication Code", Name: "code", Placeholder: "123456", Value: "", Type: "text", Required: true, Disabled: false, Errors: []ErrorMessage{}},
+	}
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/dmawardi/Go-Template/internal/db"
 	"github.com/dmawardi/Go-Template/internal/helpers/utility"
+	"github.com/dmawardi/Go-Template/internal/queue"
 	coreservices "github.com/dmawardi/Go-Template/internal/service/core"
 )
 
@@ -65,6 +66,35 @@ func UserSelection() []FormFieldSelector {
 
 	return selector
 }
+// Job type filter (includes an option for all types)
+func JobTypeSelection() []FormFieldSelector {
+	selector := []FormFieldSelector{{Value: "", Label: "All types", Selected: true}}
+	// Build from job types with a registered handler
+	for _, jobType := range queue.RegisteredTypes() {
+		selector = append(selector, FormFieldSelector{Value: jobType, Label: jobType})
+	}
+	return selector
+}
+// Job status filter (includes an option for all statuses)
+func JobStatusSelection() []FormFieldSelector {
+	return []FormFieldSelector{
+		{Value: "", Label: "All statuses", Selected: true},
+		{Value: db.JobStatusPending, Label: "Pending", Selected: false},
+		{Value: db.JobStatusRunning, Label: "Running", Selected: false},
+		{Value: db.JobStatusProcessed, Label: "Processed", Selected: false},
+		{Value: db.JobStatusDead, Label: "Dead", Selected: false},
+		{Value: db.JobStatusFailed, Label: "Failed", Selected: false},
+		{Value: db.JobStatusCancelled, Label: "Cancelled", Selected: false},
+	}
+}
+// Email log status filter (includes an option for all statuses)
+func EmailLogStatusSelection() []FormFieldSelector {
+	return []FormFieldSelector{
+		{Value: "", Label: "All statuses", Selected: true},
+		{Value: db.EmailStatusSent, Label: "Sent", Selected: false},
+		{Value: db.EmailStatusFailed, Label: "Failed", Selected: false},
+	}
+}
 
 // Helpers
 // Takes a slice of FormFieldSelector and sets the Selected field to true for the value that matches valueToSelect
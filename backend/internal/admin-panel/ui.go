@@ -30,6 +30,8 @@ type PageRenderData struct {
 	// Search
 	SearchTerm             string
 	RecordsPerPageSelector []int
+	// Optional select filters shown beside search (eg. job status)
+	SearchFilters []FormField
 	// Special section data for policies
 	PolicySection PolicySection
 	HeaderSection HeaderSection
@@ -40,6 +42,7 @@ type HeaderSection struct {
 	HomeUrl           template.URL
 	ViewSiteUrl       template.URL
 	ChangePasswordUrl template.URL
+	TwoFactorUrl      template.URL
 	LogOutUrl         template.URL
 }
 
@@ -168,7 +171,7 @@ func GenerateAndSetAdminSidebar(adminCont AdminPanelController) {
 		fieldValue := valueOfCont.Field(i).Interface()
 
 		// If not base controller, add to sidebar list
-		if fieldName != "Base" && fieldName != "Auth" && fieldName != "ModuleMap" && fieldName != "Action" {
+		if fieldName != "Base" && fieldName != "Auth" && fieldName != "ModuleMap" && fieldName != "Action" && fieldName != "Job" && fieldName != "EmailLog" && fieldName != "Outbox" {
 			currentController := ObtainUrlDetailsForBasicAdminController(fieldValue)
 			// Create sidebar item
 			item := sidebarItem{
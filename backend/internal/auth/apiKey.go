@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/casbin/casbin/v2/util"
+	"github.com/dmawardi/Go-Template/internal/cache"
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers"
+	"gorm.io/gorm"
+)
+
+// Authorization scheme used for API keys (Authorization: ApiKey <key>)
+const ApiKeyScheme = "ApiKey"
+
+// How long API key lookups are cached (entries are removed when the key is revoked or its user is updated)
+const apiKeyCacheTTL = time.Minute
+
+// A key's last used time is recorded at most once per interval
+const apiKeyLastUsedInterval = time.Minute
+
+// Returned when an API key is unknown, revoked or expired
+var ErrInvalidApiKey = errors.New("invalid API key")
+
+// Actions API key scopes can grant (* grants all actions)
+var apiKeyScopeActions = []string{"read", "create", "update", "delete", "*"}
+
+// Cached result of looking up an API key
+type apiKeyOwner struct {
+	ID        uint
+	UserID    uint
+	Email     string
+	Role      string
+	Scopes    []string
+	ExpiresAt *time.Time
+}
+
+// Parses an API key, returning the claims of its user (limited to the key's scopes)
+func parseApiKey(key string) (*AuthToken, error) {
+	if key == "" {
+		return nil, ErrInvalidApiKey
+	}
+	owner, err := cache.GetOrLoad(app.Cache, apiKeyCacheKey(helpers.HashToken(key)), apiKeyCacheTTL, func() (*apiKeyOwner, error) {
+		return findApiKeyOwner(helpers.HashToken(key))
+	}, cache.TagWith(apiKeyTags), cache.CacheNotFound(apiKeyCacheTTL))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidApiKey
+	}
+	if err != nil {
+		fmt.Println("error in finding API key: ", err)
+		return nil, ErrInvalidApiKey
+	}
+	if owner.ExpiresAt != nil && owner.ExpiresAt.Before(time.Now()) {
+		return nil, ErrInvalidApiKey
+	}
+
+	recordApiKeyUse(owner.ID)
+	return &AuthToken{
+		UserID:   fmt.Sprint(owner.UserID),
+		Email:    owner.Email,
+		Role:     owner.Role,
+		ApiKeyID: owner.ID,
+		Scopes:   owner.Scopes,
+	}, nil
+}
+
+// Finds an active API key and its user by the hash of the key
+func findApiKeyOwner(keyHash string) (*apiKeyOwner, error) {
+	apiKey := db.ApiKey{}
+	err := app.DbClient.Where("key_hash = ? AND revoked_at IS NULL", keyHash).First(&apiKey).Error
+	if err != nil {
+		return nil, err
+	}
+	// Keys of deleted users are rejected
+	user := db.User{}
+	err = app.DbClient.Select("id", "email").Where("id = ?", apiKey.UserID).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	owner := &apiKeyOwner{ID: apiKey.ID, UserID: user.ID, Email: user.Email, Scopes: apiKey.Scopes, ExpiresAt: apiKey.ExpiresAt}
+	// Role without prefix (as in access tokens)
+	roles, err := app.Auth.Enforcer.GetRolesForUser(fmt.Sprint(user.ID))
+	if err == nil && len(roles) > 0 {
+		owner.Role = strings.TrimPrefix(roles[0], "role:")
+	}
+	return owner, nil
+}
+
+// Records when a key was last used (at most once per apiKeyLastUsedInterval)
+func recordApiKeyUse(id uint) {
+	var recorded bool
+	if app.Cache.Load(apiKeyUsedKey(id), &recorded) {
+		return
+	}
+	app.Cache.Store(apiKeyUsedKey(id), true, apiKeyLastUsedInterval)
+	err := app.DbClient.Model(&db.ApiKey{}).Where("id = ?", id).UpdateColumn("last_used_at", time.Now()).Error
+	if err != nil {
+		fmt.Println("error in recording API key use: ", err)
+	}
+}
+
+// Checks an API key scope is written as "<action>:<path>" (eg. read:/api/posts or *:/api/posts/*)
+func ValidateApiKeyScope(scope string) error {
+	action, path, found := strings.Cut(scope, ":")
+	if !found || !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("scope %q must be written as <action>:<path>", scope)
+	}
+	for _, allowed := range apiKeyScopeActions {
+		if action == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("scope %q has an unknown action (use one of %s)", scope, strings.Join(apiKeyScopeActions, ", "))
+}
+
+// Checks whether an API key's scopes allow an action on an object
+// Paths are matched like RBAC policies (keyMatch, eg. /api/posts/* matches /api/posts/1/comments)
+func ScopesAllow(scopes []string, object, action string) bool {
+	for _, scope := range scopes {
+		scopeAction, path, _ := strings.Cut(scope, ":")
+		if (scopeAction == "*" || scopeAction == action) && util.KeyMatch(object, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Removes a revoked API key from the cache
+func ForgetApiKey(id uint) {
+	app.Cache.InvalidateTag(cache.RecordTag("api-key", id))
+}
+
+// Removes a user's API keys from the cache (eg. once they're all revoked)
+func ForgetUserApiKeys(userID uint) {
+	app.Cache.InvalidateTag(cache.RecordTag("user", userID))
+}
+
+// Tags cached keys with the key and its user (so they're removed when either changes)
+func apiKeyTags(value interface{}) []string {
+	owner, ok := value.(*apiKeyOwner)
+	if !ok {
+		return nil
+	}
+	return []string{cache.RecordTag("api-key", owner.ID), cache.RecordTag("user", owner.UserID)}
+}
+
+// Cache keys
+func apiKeyCacheKey(keyHash string) string {
+	return "api-key-hash:" + keyHash
+}
+func apiKeyUsedKey(id uint) string {
+	return fmt.Sprintf("api-key-used:%d", id)
+}
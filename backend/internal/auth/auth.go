@@ -13,6 +13,7 @@ import (
 	"github.com/casbin/casbin/v2"
 	gormadapter "github.com/casbin/gorm-adapter/v3"
 	"github.com/dmawardi/Go-Template/internal/config"
+	"github.com/dmawardi/Go-Template/internal/helpers/utility"
 	webapi "github.com/dmawardi/Go-Template/internal/helpers/webApi"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -21,7 +22,12 @@ import (
 
 var app *config.AppConfig
 
-var JWTKey = []byte(os.Getenv("HMAC_SECRET"))
+// Times in tokens are recorded to the microsecond, so tokens issued just after a user's tokens are invalidated are accepted
+const jwtTimePrecision = time.Microsecond
+
+func init() {
+	jwt.TimePrecision = jwtTimePrecision
+}
 
 // Function called in main.go to connect app state to current file
 func SetStateInAuth(a *config.AppConfig) {
@@ -34,9 +40,35 @@ type AuthToken struct {
 	UserID string `json:"userID"`
 	Email  string `json:"email"`
 	Role   string `json:"role"`
+	// Set when the user completed two factor authentication
+	TwoFactor bool `json:"2fa,omitempty"`
+	// Set for tokens that can only be used for one purpose (eg. completing a two factor login)
+	Purpose string `json:"purpose,omitempty"`
+	// Token ID of the session the token was issued in (rejected once the session is revoked)
+	SessionID string `json:"sid,omitempty"`
+	// Set when authenticated with an API key (limited to the key's scopes)
+	ApiKeyID uint     `json:"-"`
+	Scopes   []string `json:"-"`
 	jwt.RegisteredClaims
 }
 
+// Used to set optional claims when generating a token
+type TokenOption func(claims *AuthToken)
+
+// Marks a token as issued after the user completed two factor authentication
+func WithTwoFactor() TokenOption {
+	return func(claims *AuthToken) {
+		claims.TwoFactor = true
+	}
+}
+
+// Marks a token as issued in a session (see db.Session)
+func WithSession(tokenID string) TokenOption {
+	return func(claims *AuthToken) {
+		claims.SessionID = tokenID
+	}
+}
+
 // Setup RBAC enforcer based using gorm client. Connects to DB and builds base policy
 func EnforcerSetup(db *gorm.DB, setupDefaultPolicy bool) (*config.AuthEnforcer, error) {
 	// Grab environment variables for connection
@@ -72,10 +104,48 @@ func EnforcerSetup(db *gorm.DB, setupDefaultPolicy bool) (*config.AuthEnforcer,
 	return &config.AuthEnforcer{Enforcer: enforcer, Adapter: adapter}, nil
 }
 
-// Generates a JSON web token based on user's details
+// Default lifetimes of tokens (see AccessTokenTTL, RefreshTokenTTL)
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+	// Tokens used for cookie sessions (Admin Panel) aren't refreshed
+	SessionTokenTTL = 12 * time.Hour
+)
+
+// Returns the lifetime of access tokens from JWT_ACCESS_TTL (eg. "15m"). Defaults to 15 minutes.
+func AccessTokenTTL() time.Duration {
+	return durationFromEnv("JWT_ACCESS_TTL", defaultAccessTokenTTL)
+}
+
+// Returns the lifetime of refresh tokens from JWT_REFRESH_TTL (eg. "720h"). Defaults to 30 days.
+func RefreshTokenTTL() time.Duration {
+	return durationFromEnv("JWT_REFRESH_TTL", defaultRefreshTokenTTL)
+}
+
+// Parses a duration from an environment variable, using the fallback if not set or invalid
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	duration, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || duration <= 0 {
+		return fallback
+	}
+	return duration
+}
+
+// Generates a short lived JSON web token (access token) based on user's details
 func GenerateJWT(userID int, email, roleName string) (string, error) {
-	// Build expiration time
-	expirationTime := time.Now().Add(12 * time.Hour)
+	return GenerateJWTWithTTL(userID, email, roleName, AccessTokenTTL())
+}
+
+// Generates a JSON web token based on user's details that expires after the given duration
+func GenerateJWTWithTTL(userID int, email, roleName string, ttl time.Duration, options ...TokenOption) (string, error) {
+	// Build issue and expiration time
+	issuedAt := time.Now()
+	expirationTime := issuedAt.Add(ttl)
+	// Generate token ID (used to revoke the token)
+	tokenID, err := utility.GenerateRandomString(24)
+	if err != nil {
+		return "", err
+	}
 
 	// Build claims to be stored in token
 	claims := &AuthToken{
@@ -84,14 +154,21 @@ func GenerateJWT(userID int, email, roleName string) (string, error) {
 		UserID: fmt.Sprint(userID),
 		Role:   roleName,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 		},
 	}
+	for _, option := range options {
+		option(claims)
+	}
 
-	// Create new token using built claims and signing method
-	authToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	// Decrypt token using key to generate string
-	tokenString, err := authToken.SignedString(JWTKey)
+	// Sign token using the current signing key
+	keys, err := CurrentKeyRing()
+	if err != nil {
+		return "", err
+	}
+	tokenString, err := keys.Sign(claims)
 	// If error
 	if err != nil {
 		return "", err
@@ -105,7 +182,16 @@ func ValidateAndParseToken(r *http.Request) (tokenData *AuthToken, err error) {
 	// Grab request header
 	header := r.Header
 	// Extract token string from Authorization header by removing prefix "Bearer "
-	_, tokenString, _ := strings.Cut(header.Get("Authorization"), " ")
+	scheme, tokenString, _ := strings.Cut(header.Get("Authorization"), " ")
+
+	// API keys (Authorization: ApiKey <key>)
+	if strings.EqualFold(scheme, ApiKeyScheme) {
+		claims, err := parseApiKey(tokenString)
+		if err != nil {
+			return &AuthToken{}, err
+		}
+		return claims, nil
+	}
 
 	// If token string is empty
 	if tokenString == "" {
@@ -125,14 +211,25 @@ func ValidateAndParseToken(r *http.Request) (tokenData *AuthToken, err error) {
 		tokenString = cookie.Value
 	}
 
-	// Parse token string and claims. Filter through auth token
-	token, err := jwt.ParseWithClaims(
-		tokenString,
-		&AuthToken{},
-		func(token *jwt.Token) (interface{}, error) {
-			return []byte(JWTKey), nil
-		},
-	)
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return &AuthToken{}, err
+	}
+	// Tokens issued for a single purpose can't be used to authenticate
+	if claims.Purpose != "" {
+		return &AuthToken{}, errors.New("token can't be used for authentication")
+	}
+	return claims, nil
+}
+
+// Parses a signed token, checking it hasn't expired or been revoked
+func parseToken(tokenString string) (*AuthToken, error) {
+	// Parse token string and claims (verified with the key matching the token's kid). Filter through auth token
+	keys, err := CurrentKeyRing()
+	if err != nil {
+		return &AuthToken{}, err
+	}
+	token, err := jwt.ParseWithClaims(tokenString, &AuthToken{}, keys.Keyfunc)
 	if err != nil {
 		err = errors.New("couldn't parse token")
 		return &AuthToken{}, err
@@ -154,6 +251,12 @@ func ValidateAndParseToken(r *http.Request) (tokenData *AuthToken, err error) {
 		err = errors.New("token expired")
 		return &AuthToken{}, err
 	}
+
+	// Check token hasn't been revoked (eg. logged out or the user's password changed)
+	err = checkTokenRevocation(claims)
+	if err != nil {
+		return &AuthToken{}, err
+	}
 	// else return claims
 	return claims, nil
 }
@@ -298,8 +401,8 @@ func SetupDefaultCasbinPolicy(enforcer *casbin.Enforcer) {
 // Used to set header in admin panel for SSR authentication
 // Create and set jwt token for SSR authentication
 func CreateAndSetHeaderCookie(w http.ResponseWriter, tokenString string) {
-	// Create the cookie
-	expire := time.Now().Add(24 * time.Hour)
+	// Create the cookie (expires with the session token)
+	expire := time.Now().Add(SessionTokenTTL)
 	cookie := http.Cookie{
 		Name: "jwt_token",
 		// Token string contians user info
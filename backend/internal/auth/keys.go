@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Minimum size of RSA signing keys
+const minRSAKeyBits = 2048
+
+// Returned when a token's kid (or algorithm) doesn't match a verification key
+var ErrUnknownSigningKey = errors.New("unknown signing key")
+
+// SigningKey is a key used to sign and/or verify tokens, identified by the kid header
+type SigningKey struct {
+	// Key ID (empty for the HMAC secret, which is used for tokens without a kid)
+	ID     string
+	Method jwt.SigningMethod
+	// Private key (nil for keys only used to verify tokens)
+	Private interface{}
+	// Public key (or the secret for HMAC keys)
+	Public interface{}
+}
+
+// KeyRing holds the key used to sign new tokens and the keys accepted when verifying them.
+// During rotation the previous key stays in the ring (verification only) until the tokens it signed have expired.
+type KeyRing struct {
+	signing *SigningKey
+	// Verification keys by ID
+	verification map[string]*SigningKey
+}
+
+// JSONWebKey is the public part of a verification key (RFC 7517)
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA
+	Modulus  string `json:"n,omitempty"`
+	Exponent string `json:"e,omitempty"`
+	// Ed25519
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JSONWebKeySet is served at /.well-known/jwks.json so other services can verify tokens
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// Current key ring (see SetKeyRing)
+var (
+	keyRingMutex sync.RWMutex
+	keyRing      *KeyRing
+)
+
+// SetKeyRing sets the keys used to sign and verify tokens (called in main.go)
+func SetKeyRing(keys *KeyRing) {
+	keyRingMutex.Lock()
+	defer keyRingMutex.Unlock()
+	keyRing = keys
+}
+
+// CurrentKeyRing returns the key ring in use, loading it from the environment if not set
+func CurrentKeyRing() (*KeyRing, error) {
+	keyRingMutex.RLock()
+	keys := keyRing
+	keyRingMutex.RUnlock()
+	if keys != nil {
+		return keys, nil
+	}
+
+	keys, err := LoadKeyRing()
+	if err != nil {
+		return nil, err
+	}
+	SetKeyRing(keys)
+	return keys, nil
+}
+
+// LoadKeyRing builds the key ring from the environment:
+// JWT_KEYS_DIR holds PEM keys (RSA or Ed25519) named <kid>.pem. Public keys are only used to verify tokens.
+// JWT_SIGNING_KEY_ID is the ID of the private key in JWT_KEYS_DIR used to sign new tokens.
+// HMAC_SECRET is used to sign tokens (HS256) if JWT_KEYS_DIR isn't set. Otherwise it's only used to
+// verify tokens without a kid (issued before switching to asymmetric keys).
+func LoadKeyRing() (*KeyRing, error) {
+	secret := os.Getenv("HMAC_SECRET")
+	keysDir := os.Getenv("JWT_KEYS_DIR")
+	if keysDir == "" {
+		if secret == "" {
+			return nil, errors.New("no token signing key configured (set JWT_KEYS_DIR or HMAC_SECRET)")
+		}
+		return NewHMACKeyRing([]byte(secret)), nil
+	}
+
+	keys, err := LoadKeysFromDir(keysDir)
+	if err != nil {
+		return nil, err
+	}
+	// Accept tokens signed with the HMAC secret
+	if secret != "" {
+		keys = append(keys, newHMACKey([]byte(secret)))
+	}
+	return NewKeyRing(os.Getenv("JWT_SIGNING_KEY_ID"), keys...)
+}
+
+// NewKeyRing builds a key ring that signs tokens with the key matching signingKeyID and verifies tokens with any of the keys
+func NewKeyRing(signingKeyID string, keys ...*SigningKey) (*KeyRing, error) {
+	ring := &KeyRing{verification: map[string]*SigningKey{}}
+	for _, key := range keys {
+		if _, exists := ring.verification[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate signing key ID: %q", key.ID)
+		}
+		ring.verification[key.ID] = key
+	}
+
+	signing, ok := ring.verification[signingKeyID]
+	if !ok || signingKeyID == "" {
+		return nil, fmt.Errorf("signing key %q not found", signingKeyID)
+	}
+	if signing.Private == nil {
+		return nil, fmt.Errorf("signing key %q has no private key", signingKeyID)
+	}
+	ring.signing = signing
+	return ring, nil
+}
+
+// NewHMACKeyRing builds a key ring that signs and verifies tokens (without a kid) with an HMAC secret
+func NewHMACKeyRing(secret []byte) *KeyRing {
+	key := newHMACKey(secret)
+	return &KeyRing{signing: key, verification: map[string]*SigningKey{key.ID: key}}
+}
+
+func newHMACKey(secret []byte) *SigningKey {
+	return &SigningKey{Method: jwt.SigningMethodHS256, Private: secret, Public: secret}
+}
+
+// Sign builds a signed token from claims using the signing key (with its ID in the kid header)
+func (k *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.signing.Method, claims)
+	if k.signing.ID != "" {
+		token.Header["kid"] = k.signing.ID
+	}
+	return token.SignedString(k.signing.Private)
+}
+
+// Keyfunc selects the key used to verify a token from its kid header (used with jwt.Parse)
+func (k *KeyRing) Keyfunc(token *jwt.Token) (interface{}, error) {
+	// Tokens without a kid are verified with the HMAC secret (if any)
+	keyID, _ := token.Header["kid"].(string)
+	key, ok := k.verification[keyID]
+	// The algorithm must match the key's (so a public key can't be used as an HMAC secret)
+	if !ok || token.Method.Alg() != key.Method.Alg() {
+		return nil, ErrUnknownSigningKey
+	}
+	return key.Public, nil
+}
+
+// JWKS returns the public verification keys (HMAC secrets aren't included)
+func (k *KeyRing) JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, key := range k.verification {
+		jwk := JSONWebKey{KeyID: key.ID, Use: "sig", Algorithm: key.Method.Alg()}
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.Modulus = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.Exponent = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].KeyID < set.Keys[j].KeyID })
+	return set
+}
+
+// LoadKeysFromDir loads the PEM keys (<kid>.pem) in a directory
+func LoadKeysFromDir(dir string) ([]*SigningKey, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no keys (*.pem) found in %s", dir)
+	}
+
+	keys := make([]*SigningKey, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		key, err := ParseSigningKey(strings.TrimSuffix(filepath.Base(file), ".pem"), data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load key %s: %w", file, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// ParseSigningKey parses a PEM encoded RSA (RS256) or Ed25519 (EdDSA) private or public key
+func ParseSigningKey(id string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type: %s", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{ID: id}
+	switch parsed := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodRS256, parsed, &parsed.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodRS256, parsed
+	case ed25519.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodEdDSA, parsed, parsed.Public()
+	case ed25519.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodEdDSA, parsed
+	default:
+		return nil, fmt.Errorf("unsupported key type: %T", parsed)
+	}
+	// Reject weak RSA keys
+	if public, ok := key.Public.(*rsa.PublicKey); ok && public.N.BitLen() < minRSAKeyBits {
+		return nil, fmt.Errorf("RSA keys must be at least %d bits", minRSAKeyBits)
+	}
+	return key, nil
+}
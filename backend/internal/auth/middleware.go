@@ -35,6 +35,12 @@ func AuthenticateJWT(next http.Handler) http.Handler {
 			return
 		}
 
+		// Roles required to use two factor authentication must set it up before using the admin panel
+		if twoFactorSetupRequired(object, tokenData) {
+			http.Redirect(w, r, TwoFactorSetupURL, http.StatusSeeOther)
+			return
+		}
+
 		// Enforce RBAC policy and determine if user is authorized to perform action
 		allowed := Authorize(tokenData.UserID, object, action)
 
@@ -43,6 +49,11 @@ func AuthenticateJWT(next http.Handler) http.Handler {
 			http.Error(w, "Not authorized to perform that action", http.StatusForbidden)
 			return
 		}
+		// API keys are also limited to their scopes
+		if tokenData.ApiKeyID != 0 && !ScopesAllow(tokenData.Scopes, object, action) {
+			http.Error(w, "API key not authorized to perform that action", http.StatusForbidden)
+			return
+		}
 
 		// Else, allow through
 		next.ServeHTTP(w, r)
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/cache"
+	"github.com/dmawardi/Go-Template/internal/db"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// How long revocation checks (including "not revoked" results) are cached.
+// Entries are removed when a token is revoked, but only from this instance's cache when using the
+// in-memory driver, so other instances accept a revoked token for up to this long (see CACHE_DRIVER=redis)
+const revocationCacheTTL = 10 * time.Second
+
+// Returned when a token has been revoked (logged out, or issued before the user's password or role changed)
+var ErrTokenRevoked = errors.New("token revoked")
+
+// Cached result of looking up a user's token watermark
+type tokenWatermark struct {
+	ValidAfter time.Time
+}
+
+// Checks a token hasn't been revoked and was issued after the user's watermark
+// Tokens of deleted users are rejected
+func checkTokenRevocation(claims *AuthToken) error {
+	// Revocation list
+	if claims.ID != "" {
+		_, err := cache.GetOrLoad(app.Cache, revokedTokenKey(claims.ID), revocationCacheTTL, func() (*db.RevokedToken, error) {
+			revoked := db.RevokedToken{}
+			if err := app.DbClient.Where("jti = ?", claims.ID).First(&revoked).Error; err != nil {
+				return nil, err
+			}
+			return &revoked, nil
+		}, cache.CacheNotFound(revocationCacheTTL))
+		// Found in revocation list
+		if err == nil {
+			return ErrTokenRevoked
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+	}
+
+	// User's watermark (removed from the cache when the user is updated or deleted)
+	watermark, err := cache.GetOrLoad(app.Cache, tokenWatermarkKey(claims.UserID), revocationCacheTTL, func() (*tokenWatermark, error) {
+		user := db.User{}
+		if err := app.DbClient.Select("id", "tokens_valid_after").Where("id = ?", claims.UserID).First(&user).Error; err != nil {
+			return nil, err
+		}
+		return &tokenWatermark{ValidAfter: user.TokensValidAfter}, nil
+	}, cache.Tags(cache.RecordTag("user", claims.UserID)), cache.CacheNotFound(revocationCacheTTL))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrTokenRevoked
+	}
+	if err != nil {
+		return err
+	}
+	// Issue times may be parsed a microsecond early (floating point seconds), so one unit of precision is allowed
+	if !watermark.ValidAfter.IsZero() && (claims.IssuedAt == nil || claims.IssuedAt.Add(jwtTimePrecision).Before(watermark.ValidAfter)) {
+		return ErrTokenRevoked
+	}
+
+	// Session (revoked when the user logs out of it or revokes it from another device)
+	if claims.SessionID != "" {
+		return checkSessionRevocation(claims)
+	}
+	return nil
+}
+
+// RevokeToken adds a token to the revocation list, so it's rejected until it expires (eg. on logout)
+func RevokeToken(claims *AuthToken) error {
+	if claims.ID == "" {
+		return errors.New("token has no ID (jti)")
+	}
+	var userID uint
+	fmt.Sscan(claims.UserID, &userID)
+	revoked := db.RevokedToken{JTI: claims.ID, UserID: userID, ExpiresAt: time.Now().Add(SessionTokenTTL)}
+	if claims.ExpiresAt != nil {
+		revoked.ExpiresAt = claims.ExpiresAt.Time
+	}
+	// Revoking a token twice has no effect
+	err := app.DbClient.Clauses(clause.OnConflict{DoNothing: true}).Create(&revoked).Error
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	// Remove cached (not revoked) result
+	app.Cache.Delete(revokedTokenKey(claims.ID))
+	return nil
+}
+
+// InvalidateUserTokens rejects all access tokens issued to the user before now (eg. on password or role change)
+func InvalidateUserTokens(userID uint) error {
+	// Same precision as the issued at claim
+	validAfter := time.Now().Truncate(jwtTimePrecision)
+	err := app.DbClient.Model(&db.User{}).Where("id = ?", userID).Update("tokens_valid_after", validAfter).Error
+	if err != nil {
+		return fmt.Errorf("failed to invalidate user tokens: %w", err)
+	}
+	// Remove cached watermark
+	app.Cache.Delete(tokenWatermarkKey(fmt.Sprint(userID)))
+	return nil
+}
+
+// Cache keys
+func revokedTokenKey(jti string) string {
+	return "revoked-token:" + jti
+}
+func tokenWatermarkKey(userID string) string {
+	return "token-watermark:" + userID
+}
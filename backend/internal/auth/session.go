@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/cache"
+	"github.com/dmawardi/Go-Template/internal/db"
+	"gorm.io/gorm"
+)
+
+// A session's last active time is recorded at most once per interval
+const sessionLastActiveInterval = time.Minute
+
+// Cached result of looking up a session
+type sessionState struct {
+	ID      uint
+	Revoked bool
+}
+
+// Checks the session a token was issued in hasn't been revoked, recording when the session was last active
+// Tokens of sessions that aren't found (eg. removed once expired) are accepted, as they're expired anyway
+func checkSessionRevocation(claims *AuthToken) error {
+	// Removed from the cache when the session is revoked or the user is updated
+	state, err := cache.GetOrLoad(app.Cache, sessionCacheKey(claims.SessionID), revocationCacheTTL, func() (*sessionState, error) {
+		session := db.Session{}
+		if err := app.DbClient.Select("id", "revoked_at").Where("token_id = ?", claims.SessionID).First(&session).Error; err != nil {
+			return nil, err
+		}
+		return &sessionState{ID: session.ID, Revoked: session.RevokedAt != nil}, nil
+	}, cache.Tags(cache.RecordTag("user", claims.UserID)), cache.CacheNotFound(revocationCacheTTL))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if state.Revoked {
+		return ErrTokenRevoked
+	}
+
+	recordSessionActivity(state.ID)
+	return nil
+}
+
+// Records when a session was last active (at most once per sessionLastActiveInterval)
+func recordSessionActivity(id uint) {
+	var recorded bool
+	if app.Cache.Load(sessionActiveKey(id), &recorded) {
+		return
+	}
+	app.Cache.Store(sessionActiveKey(id), true, sessionLastActiveInterval)
+	err := app.DbClient.Model(&db.Session{}).Where("id = ?", id).UpdateColumn("last_active_at", time.Now()).Error
+	if err != nil {
+		fmt.Println("error in recording session activity: ", err)
+	}
+}
+
+// Removes a revoked session from the cache, so its tokens are rejected from the next request
+func ForgetSession(tokenID string) {
+	app.Cache.Delete(sessionCacheKey(tokenID))
+}
+
+// Cache keys
+func sessionCacheKey(tokenID string) string {
+	return "session:" + tokenID
+}
+func sessionActiveKey(id uint) string {
+	return fmt.Sprintf("session-active:%d", id)
+}
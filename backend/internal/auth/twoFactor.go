@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"time"
+)
+
+// Two factor logins must be completed within this duration
+const TwoFactorPendingTokenTTL = 5 * time.Minute
+
+// Purpose of tokens issued after a password is checked for a user with two factor authentication
+const twoFactorPendingPurpose = "2fa-pending"
+
+// Admin panel page used to set up two factor authentication
+const TwoFactorSetupURL = "/admin/two-factor"
+
+// Generates a short lived token used to complete a login with a two factor code (it can't be used to authenticate)
+func GenerateTwoFactorPendingToken(userID int, email, roleName string) (string, error) {
+	return GenerateJWTWithTTL(userID, email, roleName, TwoFactorPendingTokenTTL, func(claims *AuthToken) {
+		claims.Purpose = twoFactorPendingPurpose
+	})
+}
+
+// Parses a token generated by GenerateTwoFactorPendingToken, checking it hasn't expired or been revoked
+func ParseTwoFactorPendingToken(tokenString string) (*AuthToken, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != twoFactorPendingPurpose {
+		return nil, errors.New("not a two factor token")
+	}
+	return claims, nil
+}
+
+// Checks whether users with a role must use two factor authentication to access the admin panel.
+// Roles are read from TWO_FACTOR_REQUIRED_ROLES (comma separated, eg. "admin,moderator")
+func TwoFactorRequired(role string) bool {
+	for _, required := range strings.Split(os.Getenv("TWO_FACTOR_REQUIRED_ROLES"), ",") {
+		required = strings.TrimPrefix(strings.TrimSpace(required), "role:")
+		if required != "" && required == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks whether a token must complete two factor authentication before accessing a path
+// (admin panel paths other than the setup page, for roles required to use two factor authentication)
+func twoFactorSetupRequired(object string, tokenData *AuthToken) bool {
+	if !strings.HasPrefix(object, "/admin/") || object == TwoFactorSetupURL {
+		return false
+	}
+	return !tokenData.TwoFactor && TwoFactorRequired(tokenData.Role)
+}
@@ -1,29 +1,178 @@
 package cache
 
 import (
+	"container/list"
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
+// Cache is implemented by each cache backend (in-memory map or Redis)
+type Cache interface {
+	// Store adds a value with an optional TTL (defaults to 10 minutes)
+	Store(key string, value interface{}, ttl ...time.Duration)
+	// Load copies the cached value into dest (a pointer) and returns whether it was found
+	Load(key string, dest interface{}) bool
+	// StoreWithTags adds a value that is also removed when any of its tags are invalidated
+	StoreWithTags(key string, value interface{}, tags []string, ttl ...time.Duration)
+	// Delete removes a value
+	Delete(key string)
+	// InvalidateTag removes all values stored with any of the tags
+	InvalidateTag(tags ...string)
+	// Stats returns the cache usage counters
+	Stats() Stats
+}
+
+// Cache drivers
+const (
+	MemoryDriver = "memory"
+	RedisDriver  = "redis"
+)
+
 // Used in case no TTL is provided
 const defaultTimeToLive = 10 * time.Minute
 
+// Cache defaults
+const (
+	// Maximum number of entries held before the least recently used entry is evicted
+	DefaultMaxEntries = 10000
+	// How often the janitor removes expired entries
+	DefaultSweepInterval = time.Minute
+)
+
 // Entry represents a cache entry with a value and an expiration timestamp
 type Entry struct {
 	Value      interface{}
 	Expiration int64
 }
 
-// CacheMap wraps sync.Map and provides basic TTL functionality
+// Element held in the LRU list
+type cacheItem struct {
+	key   string
+	entry Entry
+	tags  []string
+}
+
+// Stats holds cache usage counters
+type Stats struct {
+	Driver      string `json:"driver"`
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Evictions   uint64 `json:"evictions"`   // Entries removed to make room for new entries
+	Expirations uint64 `json:"expirations"` // Expired entries removed on load or by the janitor
+	Entries     int    `json:"entries"`
+	MaxEntries  int    `json:"max_entries,omitempty"`
+}
+
+// Settings for the cache
+type Settings struct {
+	// Cache backend (MemoryDriver or RedisDriver)
+	Driver string
+	// Maximum number of entries (least recently used entries are evicted beyond this)
+	MaxEntries int
+	// How often the janitor removes expired entries
+	SweepInterval time.Duration
+	// How long list (FindAll) results are cached (0 disables list caching)
+	ListTTL time.Duration
+	// Redis connection settings (used by the Redis driver)
+	Redis RedisSettings
+}
+
+// CacheMap is a bounded in-memory cache with TTL and least recently used (LRU) eviction.
+// The zero value is ready to use with DefaultMaxEntries.
 // Example usage: m.Store("key", "value", 10 * time.Second)
 type CacheMap struct {
-	internal sync.Map
+	mu sync.Mutex
+	// Entries by key (elements of order)
+	items map[string]*list.Element
+	// Most recently used entries at the front
+	order *list.List
+	// Keys by tag
+	tags       map[string]map[string]bool
+	maxEntries int
+	// Counters
+	hits, misses, evictions, expirations uint64
+}
+
+// NewCacheMap builds a cache that holds at most maxEntries entries (DefaultMaxEntries if 0 or less)
+func NewCacheMap(maxEntries int) *CacheMap {
+	m := &CacheMap{maxEntries: maxEntries}
+	m.init()
+	return m
+}
+
+// New builds the cache backend selected in the settings.
+// The in-memory cache's janitor runs until the context is cancelled.
+func New(ctx context.Context, settings Settings) (Cache, error) {
+	switch settings.Driver {
+	case "", MemoryDriver:
+		m := NewCacheMap(settings.MaxEntries)
+		m.StartJanitor(ctx, settings.SweepInterval)
+		return m, nil
+	case RedisDriver:
+		return NewRedisCache(settings.Redis)
+	default:
+		return nil, fmt.Errorf("unknown cache driver %q", settings.Driver)
+	}
+}
+
+// SettingsFromEnv builds cache settings from the environment variables:
+// CACHE_DRIVER ("memory" or "redis"), CACHE_MAX_ENTRIES, CACHE_SWEEP_INTERVAL (eg. "1m"),
+// CACHE_LIST_TTL (eg. "30s", list caching is disabled if not set) and the Redis settings (see RedisSettingsFromEnv). Defaults are used for missing or invalid values.
+func SettingsFromEnv() Settings {
+	settings := Settings{
+		Driver:        MemoryDriver,
+		MaxEntries:    DefaultMaxEntries,
+		SweepInterval: DefaultSweepInterval,
+		Redis:         RedisSettingsFromEnv(),
+	}
+	// Driver
+	if driver := strings.ToLower(strings.TrimSpace(os.Getenv("CACHE_DRIVER"))); driver != "" {
+		settings.Driver = driver
+	}
+	// Max entries
+	if maxEntries, err := strconv.Atoi(os.Getenv("CACHE_MAX_ENTRIES")); err == nil && maxEntries > 0 {
+		settings.MaxEntries = maxEntries
+	}
+	// Sweep interval
+	if interval, err := time.ParseDuration(os.Getenv("CACHE_SWEEP_INTERVAL")); err == nil && interval > 0 {
+		settings.SweepInterval = interval
+	}
+	// List TTL
+	if ttl, err := time.ParseDuration(os.Getenv("CACHE_LIST_TTL")); err == nil && ttl > 0 {
+		settings.ListTTL = ttl
+	}
+	return settings
+}
+
+// Initializes internal state (allows the zero value to be used). Must be called with the lock held.
+func (m *CacheMap) init() {
+	if m.items == nil {
+		m.items = make(map[string]*list.Element)
+		m.order = list.New()
+		m.tags = make(map[string]map[string]bool)
+	}
+	if m.maxEntries <= 0 {
+		m.maxEntries = DefaultMaxEntries
+	}
 }
 
 // Store adds a value to the map with a specified TTL (in seconds)
 // ttl is optional, and if not provided, a default TTL is used
+// If the cache is full, the least recently used entry is evicted
 // Example usage: m.Store("key", "value", 10 * time.Second)
-func (m *CacheMap) Store(key, value interface{}, ttl ...time.Duration) {
+func (m *CacheMap) Store(key string, value interface{}, ttl ...time.Duration) {
+	m.StoreWithTags(key, value, nil, ttl...)
+}
+
+// StoreWithTags adds a value to the map that is also removed when any of its tags are invalidated
+// Example usage: m.StoreWithTags("post:1", post, []string{"posts", "user:5"}, 10 * time.Second)
+func (m *CacheMap) StoreWithTags(key string, value interface{}, tags []string, ttl ...time.Duration) {
 	// Use default TTL if not provided
 	var ttlValue time.Duration
 	// Check if TTL is provided, and use if found
@@ -39,30 +188,201 @@ func (m *CacheMap) Store(key, value interface{}, ttl ...time.Duration) {
 	expiration := time.Now().Add(ttlValue).UnixNano()
 	// Build entry
 	entry := Entry{Value: value, Expiration: expiration}
-	// Store entry
-	m.internal.Store(key, entry)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.init()
+
+	// If key exists, update entry (and tags) and mark as most recently used
+	if element, ok := m.items[key]; ok {
+		item := element.Value.(*cacheItem)
+		m.untag(item)
+		item.entry = entry
+		item.tags = tags
+		m.tag(item)
+		m.order.MoveToFront(element)
+		return
+	}
+
+	// Else store new entry
+	item := &cacheItem{key: key, entry: entry, tags: tags}
+	m.items[key] = m.order.PushFront(item)
+	m.tag(item)
+	// Evict least recently used entries beyond the limit
+	for m.order.Len() > m.maxEntries {
+		m.removeElement(m.order.Back())
+		m.evictions++
+	}
 }
 
-// Load retrieves a value from the map, considering its TTL
-// Example usage: value, ok := m.Load("key")
-func (m *CacheMap) Load(key interface{}) (interface{}, bool) {
+// Load copies a value from the map into dest (a pointer), considering its TTL.
+// Pointers are dereferenced, so a stored *User can be loaded into a User (callers get their own copy).
+// Example usage: var user User; ok := m.Load("key", &user)
+func (m *CacheMap) Load(key string, dest interface{}) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.init()
+
 	// Load entry using key
-	result, ok := m.internal.Load(key)
+	element, ok := m.items[key]
 	if !ok {
-		return nil, false
+		m.misses++
+		return false
 	}
 	// If found,
-	entry := result.(Entry)
+	item := element.Value.(*cacheItem)
 	// check if expired
-	if time.Now().UnixNano() > entry.Expiration {
+	if time.Now().UnixNano() > item.entry.Expiration {
 		// If expired, delete entry and return false
-		m.internal.Delete(key) // Remove expired entry
-		return nil, false
+		m.removeElement(element) // Remove expired entry
+		m.expirations++
+		m.misses++
+		return false
 	}
-	// If not expired, return value and true
-	return entry.Value, true
+	// If not expired, copy into destination
+	if !assign(item.entry.Value, dest) {
+		// Treat values of a different type as a miss
+		m.misses++
+		return false
+	}
+	// Mark as most recently used and return true
+	m.order.MoveToFront(element)
+	m.hits++
+	return true
 }
 
-func (m *CacheMap) Delete(key interface{}) {
-	m.internal.Delete(key)
+// Delete removes a value from the map
+func (m *CacheMap) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.init()
+
+	if element, ok := m.items[key]; ok {
+		m.removeElement(element)
+	}
+}
+
+// InvalidateTag removes all values stored with any of the tags
+// Example usage: m.InvalidateTag("user:5")
+func (m *CacheMap) InvalidateTag(tags ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.init()
+
+	for _, tag := range tags {
+		for key := range m.tags[tag] {
+			if element, ok := m.items[key]; ok {
+				m.removeElement(element)
+			}
+		}
+	}
+}
+
+// DeleteExpired removes all expired entries and returns the number removed
+func (m *CacheMap) DeleteExpired() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.init()
+
+	now := time.Now().UnixNano()
+	removed := 0
+	// Iterate through all entries
+	for element := m.order.Front(); element != nil; {
+		next := element.Next()
+		if now > element.Value.(*cacheItem).entry.Expiration {
+			m.removeElement(element)
+			removed++
+		}
+		element = next
+	}
+	m.expirations += uint64(removed)
+	return removed
+}
+
+// StartJanitor removes expired entries at the given interval until the context is cancelled
+// (so entries that are never read again don't stay in memory until evicted)
+func (m *CacheMap) StartJanitor(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultSweepInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.DeleteExpired()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stats returns the cache usage counters and current size
+func (m *CacheMap) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.init()
+
+	return Stats{
+		Driver:      MemoryDriver,
+		Hits:        m.hits,
+		Misses:      m.misses,
+		Evictions:   m.evictions,
+		Expirations: m.expirations,
+		Entries:     m.order.Len(),
+		MaxEntries:  m.maxEntries,
+	}
+}
+
+// Removes an element from the map and LRU list. Must be called with the lock held.
+func (m *CacheMap) removeElement(element *list.Element) {
+	item := element.Value.(*cacheItem)
+	m.order.Remove(element)
+	delete(m.items, item.key)
+	m.untag(item)
+}
+
+// Adds an item's key to its tags. Must be called with the lock held.
+func (m *CacheMap) tag(item *cacheItem) {
+	for _, tag := range item.tags {
+		if m.tags[tag] == nil {
+			m.tags[tag] = make(map[string]bool)
+		}
+		m.tags[tag][item.key] = true
+	}
+}
+
+// Removes an item's key from its tags. Must be called with the lock held.
+func (m *CacheMap) untag(item *cacheItem) {
+	for _, tag := range item.tags {
+		delete(m.tags[tag], item.key)
+		if len(m.tags[tag]) == 0 {
+			delete(m.tags, tag)
+		}
+	}
+}
+
+// Copies value into dest (a non nil pointer), dereferencing value until its type matches.
+// Returns false if the types don't match.
+func assign(value, dest interface{}) bool {
+	target := reflect.ValueOf(dest)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return false
+	}
+	target = target.Elem()
+	source := reflect.ValueOf(value)
+	for source.IsValid() {
+		if source.Type().AssignableTo(target.Type()) {
+			target.Set(source)
+			return true
+		}
+		// Dereference pointers
+		if source.Kind() != reflect.Ptr || source.IsNil() {
+			return false
+		}
+		source = source.Elem()
+	}
+	return false
 }
@@ -0,0 +1,44 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dmawardi/Go-Template/internal/models"
+)
+
+// ListKey returns the cache key of a list (FindAll) query: the schema name and a hash of the normalized
+// query parameters, eg. "post:list:9f86d081884c7d65". Parameters that return the same results produce the same key:
+// the order is compared ignoring case and whitespace, and as conditions are combined with OR, their order is ignored.
+func ListKey(schemaName string, limit, offset int, order string, conditions []models.QueryConditionParameters) string {
+	// Normalize conditions
+	normalizedConditions := make([]string, 0, len(conditions))
+	for _, condition := range conditions {
+		value, err := json.Marshal(condition.Value)
+		if err != nil {
+			value = []byte(fmt.Sprintf("%#v", condition.Value))
+		}
+		normalizedConditions = append(normalizedConditions, strings.Join(strings.Fields(condition.Condition), " ")+" = "+string(value))
+	}
+	sort.Strings(normalizedConditions)
+
+	// Hash parameters
+	parameters, _ := json.Marshal(struct {
+		Limit      int      `json:"limit"`
+		Offset     int      `json:"offset"`
+		Order      string   `json:"order"`
+		Conditions []string `json:"conditions"`
+	}{limit, offset, strings.ToLower(strings.Join(strings.Fields(order), " ")), normalizedConditions})
+	hash := sha256.Sum256(parameters)
+	return fmt.Sprintf("%s:list:%s", strings.ToLower(schemaName), hex.EncodeToString(hash[:8]))
+}
+
+// ListTag returns the tag shared by all cached lists of a schema (invalidated when any record of the schema changes)
+// eg. ListTag("post") = "posts:list"
+func ListTag(schemaName string) string {
+	return SchemaTag(schemaName) + ":list"
+}
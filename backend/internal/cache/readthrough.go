@@ -0,0 +1,228 @@
+package cache
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LoadOption configures GetOrLoad
+type LoadOption func(*loadOptions)
+
+type loadOptions struct {
+	// How long not found results are cached (0 disables negative caching)
+	notFoundTTL time.Duration
+	// How long a value past its TTL is still served while it's reloaded in the background
+	staleWindow time.Duration
+	// Tags stored with every entry
+	tags []string
+	// Returns tags based on the loaded value
+	tagFuncs []func(value interface{}) []string
+}
+
+// CacheNotFound caches not found results (gorm.ErrRecordNotFound) for the given TTL,
+// so repeated requests for a missing record don't reach the database.
+// Keys should be deleted when the record is created.
+func CacheNotFound(ttl time.Duration) LoadOption {
+	return func(o *loadOptions) {
+		o.notFoundTTL = ttl
+	}
+}
+
+// StaleWhileRevalidate serves values for up to the given window after their TTL has passed,
+// reloading them in the background (so requests don't wait on the database).
+func StaleWhileRevalidate(window time.Duration) LoadOption {
+	return func(o *loadOptions) {
+		o.staleWindow = window
+	}
+}
+
+// Tags stores entries with the given tags (see Cache.InvalidateTag)
+func Tags(tags ...string) LoadOption {
+	return func(o *loadOptions) {
+		o.tags = append(o.tags, tags...)
+	}
+}
+
+// TagWith stores entries with the tags returned by tagFunc for the loaded value
+func TagWith(tagFunc func(value interface{}) []string) LoadOption {
+	return func(o *loadOptions) {
+		o.tagFuncs = append(o.tagFuncs, tagFunc)
+	}
+}
+
+// TagEntity stores entries with the tags of the loaded database entity (see EntityTags)
+func TagEntity(schemaName string) LoadOption {
+	return TagWith(func(value interface{}) []string {
+		return EntityTags(schemaName, value)
+	})
+}
+
+// How long the services cache records found by ID
+const RecordTTL = 10 * time.Minute
+
+// RecordOptions returns the options the services use when finding records by ID, followed by any extra options (eg. tags).
+// Missing records are cached briefly and expired records are served while reloaded in the background.
+func RecordOptions(options ...LoadOption) []LoadOption {
+	return append([]LoadOption{
+		CacheNotFound(30 * time.Second),
+		StaleWhileRevalidate(time.Minute),
+	}, options...)
+}
+
+// Value stored by GetOrLoad and Put
+type readThroughEntry[T any] struct {
+	Value    *T   `json:"value,omitempty"`
+	NotFound bool `json:"not_found,omitempty"`
+	// Time the value becomes stale (reloaded on the next request)
+	StaleAt time.Time `json:"stale_at"`
+}
+
+// GetOrLoad returns the value cached under key, or calls loader and caches its result for the TTL
+// (defaults to 10 minutes if 0). Concurrent misses for the same key share a single call to loader.
+// Callers get their own copy of the value.
+// Example usage: post, err := cache.GetOrLoad(app.Cache, "post:1", 10*time.Minute, func() (*db.Post, error) { return repo.FindById(1) })
+func GetOrLoad[T any](c Cache, key string, ttl time.Duration, loader func() (*T, error), options ...LoadOption) (*T, error) {
+	settings := buildLoadOptions(options)
+	if ttl <= 0 {
+		ttl = defaultTimeToLive
+	}
+
+	// Check cache
+	var entry readThroughEntry[T]
+	// Entries without a stale time weren't stored by GetOrLoad (treated as a miss)
+	if c.Load(key, &entry) && !entry.StaleAt.IsZero() {
+		// If stale, reload in the background (serving the stale value in the meantime)
+		if time.Now().After(entry.StaleAt) {
+			go func() {
+				if _, err := loadAndStore(c, key, ttl, loader, settings); err != nil && !isNotFound(err) {
+					log.Printf("Cache: Error reloading %q: %v\n", key, err)
+				}
+			}()
+		}
+		return entryResult(entry)
+	}
+
+	// Else, load (shared with concurrent misses) and store
+	entry, err := loadAndStore(c, key, ttl, loader, settings)
+	if err != nil {
+		return nil, err
+	}
+	return entryResult(entry)
+}
+
+// Put stores a value under key in the format used by GetOrLoad (eg. after an update).
+// The same TTL and options as GetOrLoad should be used.
+func Put[T any](c Cache, key string, value *T, ttl time.Duration, options ...LoadOption) {
+	settings := buildLoadOptions(options)
+	if ttl <= 0 {
+		ttl = defaultTimeToLive
+	}
+	entry := readThroughEntry[T]{Value: value, StaleAt: time.Now().Add(ttl)}
+	c.StoreWithTags(key, entry, settings.tagsFor(value), ttl+settings.staleWindow)
+}
+
+// Builds load options with defaults
+func buildLoadOptions(options []LoadOption) loadOptions {
+	settings := loadOptions{}
+	for _, option := range options {
+		option(&settings)
+	}
+	return settings
+}
+
+// Returns the tags of a value
+func (o loadOptions) tagsFor(value interface{}) []string {
+	tags := append([]string{}, o.tags...)
+	for _, tagFunc := range o.tagFuncs {
+		tags = append(tags, tagFunc(value)...)
+	}
+	return tags
+}
+
+// Returns a copy of the entry's value (or the not found error)
+func entryResult[T any](entry readThroughEntry[T]) (*T, error) {
+	if entry.NotFound || entry.Value == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	value := *entry.Value
+	return &value, nil
+}
+
+// Calls loader once for concurrent callers of the same key and stores its result
+func loadAndStore[T any](c Cache, key string, ttl time.Duration, loader func() (*T, error), settings loadOptions) (readThroughEntry[T], error) {
+	result, err := loads.do(flightKey{c, key}, func() (interface{}, error) {
+		value, err := loader()
+		// Cache not found results (if enabled)
+		if isNotFound(err) && settings.notFoundTTL > 0 {
+			entry := readThroughEntry[T]{NotFound: true, StaleAt: time.Now().Add(settings.notFoundTTL)}
+			c.StoreWithTags(key, entry, settings.tags, settings.notFoundTTL)
+			return entry, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		entry := readThroughEntry[T]{Value: value, StaleAt: time.Now().Add(ttl)}
+		c.StoreWithTags(key, entry, settings.tagsFor(value), ttl+settings.staleWindow)
+		return entry, nil
+	})
+	if err != nil {
+		return readThroughEntry[T]{}, err
+	}
+	return result.(readThroughEntry[T]), nil
+}
+
+// Checks whether an error is a not found error
+func isNotFound(err error) bool {
+	return errors.Is(err, gorm.ErrRecordNotFound)
+}
+
+// Loads in progress (shared by all caches)
+var loads = flightGroup{calls: map[flightKey]*flightCall{}}
+
+// Identifies a load by cache and key
+type flightKey struct {
+	cache Cache
+	key   string
+}
+
+// A load in progress (or completed)
+type flightCall struct {
+	wg    sync.WaitGroup
+	value interface{}
+	err   error
+}
+
+// Ensures only one load runs at a time for each key (other callers wait for and share its result)
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[flightKey]*flightCall
+}
+
+// Runs fn, or waits for the call already running for the key and returns its result
+func (g *flightGroup) do(key flightKey, fn func() (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	// If already loading, wait for result
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		call.wg.Wait()
+		return call.value, call.err
+	}
+	call := &flightCall{}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	// Once loaded, release waiting callers
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		call.wg.Done()
+	}()
+	call.value, call.err = fn()
+	return call.value, call.err
+}
@@ -0,0 +1,426 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Redis defaults
+const (
+	DefaultRedisAddr     = "localhost:6379"
+	DefaultRedisPrefix   = "cache:"
+	DefaultRedisPoolSize = 10
+	DefaultRedisTimeout  = 2 * time.Second
+)
+
+// RedisSettings holds the connection settings of a Redis (or Redis protocol compatible) server
+type RedisSettings struct {
+	Addr     string
+	Password string
+	DB       int
+	// Prepended to every key (allows multiple apps to share a database)
+	Prefix string
+	// Maximum number of idle connections kept open
+	PoolSize int
+	// Dial, read and write timeout
+	Timeout time.Duration
+}
+
+// RedisSettingsFromEnv builds Redis settings from the REDIS_ADDR, REDIS_PASSWORD, REDIS_DB
+// and CACHE_KEY_PREFIX environment variables. Defaults are used for missing or invalid values.
+func RedisSettingsFromEnv() RedisSettings {
+	settings := RedisSettings{
+		Addr:     DefaultRedisAddr,
+		Password: os.Getenv("REDIS_PASSWORD"),
+		Prefix:   DefaultRedisPrefix,
+		PoolSize: DefaultRedisPoolSize,
+		Timeout:  DefaultRedisTimeout,
+	}
+	if addr := os.Getenv("REDIS_ADDR"); addr != "" {
+		settings.Addr = addr
+	}
+	if db, err := strconv.Atoi(os.Getenv("REDIS_DB")); err == nil && db >= 0 {
+		settings.DB = db
+	}
+	if prefix, found := os.LookupEnv("CACHE_KEY_PREFIX"); found {
+		settings.Prefix = prefix
+	}
+	return settings
+}
+
+// RedisCache is a cache stored in a Redis server using the Redis serialization protocol (RESP).
+// As the cache is shared, a value updated or deleted by one instance is seen by all instances.
+// Values are stored as JSON, so fields ignored by JSON (eg. passwords) aren't cached.
+// Cache errors are logged and treated as misses, so the app keeps working (uncached) if Redis is down.
+type RedisCache struct {
+	settings RedisSettings
+	// Idle connections
+	pool chan *redisConn
+	// Counters
+	hits, misses uint64
+}
+
+// NewRedisCache connects to the Redis server and returns the cache
+func NewRedisCache(settings RedisSettings) (*RedisCache, error) {
+	if settings.Addr == "" {
+		settings.Addr = DefaultRedisAddr
+	}
+	if settings.PoolSize <= 0 {
+		settings.PoolSize = DefaultRedisPoolSize
+	}
+	if settings.Timeout <= 0 {
+		settings.Timeout = DefaultRedisTimeout
+	}
+	c := &RedisCache{settings: settings, pool: make(chan *redisConn, settings.PoolSize)}
+
+	// Check connection
+	if _, err := c.do("PING"); err != nil {
+		return nil, fmt.Errorf("failed connecting to redis at %s: %w", settings.Addr, err)
+	}
+	return c, nil
+}
+
+// Store adds a value (encoded as JSON) with a specified TTL
+// ttl is optional, and if not provided, a default TTL is used
+func (c *RedisCache) Store(key string, value interface{}, ttl ...time.Duration) {
+	// Use default TTL if not provided
+	ttlValue := defaultTimeToLive
+	if len(ttl) > 0 {
+		ttlValue = ttl[0]
+	}
+	// Redis expiry must be at least 1ms
+	if ttlValue < time.Millisecond {
+		ttlValue = time.Millisecond
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		log.Printf("Cache: Error encoding %q: %v\n", key, err)
+		return
+	}
+	_, err = c.do("SET", c.settings.Prefix+key, string(encoded), "PX", strconv.FormatInt(ttlValue.Milliseconds(), 10))
+	if err != nil {
+		log.Printf("Cache: Error storing %q: %v\n", key, err)
+	}
+}
+
+// StoreWithTags adds a value that is also removed when any of its tags are invalidated.
+// Each tag is stored as a set of keys that expires with the longest lived value stored with it.
+// Tags aren't removed when a value is stored again with different tags, so the value may also be
+// removed by its previous tags (an extra miss rather than a stale value).
+func (c *RedisCache) StoreWithTags(key string, value interface{}, tags []string, ttl ...time.Duration) {
+	c.Store(key, value, ttl...)
+
+	// Use default TTL if not provided
+	ttlValue := defaultTimeToLive
+	if len(ttl) > 0 {
+		ttlValue = ttl[0]
+	}
+	for _, tag := range tags {
+		tagKey := c.tagKey(tag)
+		if _, err := c.do("SADD", tagKey, c.settings.Prefix+key); err != nil {
+			log.Printf("Cache: Error tagging %q with %q: %v\n", key, tag, err)
+			continue
+		}
+		// Extend the tag's expiry to cover the value (so the tag outlives all of its values)
+		reply, err := c.do("PTTL", tagKey)
+		if remaining, ok := reply.(int64); err == nil && ok && remaining >= ttlValue.Milliseconds() {
+			continue
+		}
+		if _, err := c.do("PEXPIRE", tagKey, strconv.FormatInt(ttlValue.Milliseconds(), 10)); err != nil {
+			log.Printf("Cache: Error setting expiry of tag %q: %v\n", tag, err)
+		}
+	}
+}
+
+// Load decodes a value into dest (a pointer) and returns whether it was found
+func (c *RedisCache) Load(key string, dest interface{}) bool {
+	reply, err := c.do("GET", c.settings.Prefix+key)
+	if err != nil {
+		log.Printf("Cache: Error loading %q: %v\n", key, err)
+		atomic.AddUint64(&c.misses, 1)
+		return false
+	}
+	// Nil reply if not found (or expired)
+	value, ok := reply.(string)
+	if !ok {
+		atomic.AddUint64(&c.misses, 1)
+		return false
+	}
+	if err := json.Unmarshal([]byte(value), dest); err != nil {
+		// Treat values that can't be decoded (eg. after a struct change) as a miss
+		log.Printf("Cache: Error decoding %q: %v\n", key, err)
+		atomic.AddUint64(&c.misses, 1)
+		return false
+	}
+	atomic.AddUint64(&c.hits, 1)
+	return true
+}
+
+// Delete removes a value
+func (c *RedisCache) Delete(key string) {
+	if _, err := c.do("DEL", c.settings.Prefix+key); err != nil {
+		log.Printf("Cache: Error deleting %q: %v\n", key, err)
+	}
+}
+
+// InvalidateTag removes all values stored with any of the tags
+func (c *RedisCache) InvalidateTag(tags ...string) {
+	for _, tag := range tags {
+		tagKey := c.tagKey(tag)
+		reply, err := c.do("SMEMBERS", tagKey)
+		if err != nil {
+			log.Printf("Cache: Error invalidating tag %q: %v\n", tag, err)
+			continue
+		}
+		members, _ := reply.([]interface{})
+		if len(members) == 0 {
+			continue
+		}
+		// Delete the tagged keys, then remove them from the tag
+		// (keys tagged in the meantime are kept in the tag)
+		keys := make([]string, 0, len(members))
+		for _, member := range members {
+			if key, ok := member.(string); ok {
+				keys = append(keys, key)
+			}
+		}
+		if _, err := c.do(append([]string{"DEL"}, keys...)...); err != nil {
+			log.Printf("Cache: Error invalidating tag %q: %v\n", tag, err)
+			continue
+		}
+		if _, err := c.do(append([]string{"SREM", tagKey}, keys...)...); err != nil {
+			log.Printf("Cache: Error invalidating tag %q: %v\n", tag, err)
+		}
+	}
+}
+
+// Returns the key of a tag's set of keys
+func (c *RedisCache) tagKey(tag string) string {
+	return c.settings.Prefix + "tag:" + tag
+}
+
+// Stats returns this instance's hit and miss counters and the number of keys in the Redis database.
+// Evictions and expirations are handled by the Redis server.
+func (c *RedisCache) Stats() Stats {
+	stats := Stats{
+		Driver: RedisDriver,
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+	}
+	if reply, err := c.do("DBSIZE"); err == nil {
+		if size, ok := reply.(int64); ok {
+			stats.Entries = int(size)
+		}
+	}
+	return stats
+}
+
+// Close closes the idle connections
+func (c *RedisCache) Close() error {
+	for {
+		select {
+		case conn := <-c.pool:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// Sends a command and returns its reply.
+// Replies are nil, string (simple and bulk strings), int64 or []interface{} (arrays).
+func (c *RedisCache) do(args ...string) (interface{}, error) {
+	conn, pooled, err := c.conn()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := conn.do(args...)
+	// If a pooled connection was closed by the server, retry once with a new connection
+	if err != nil && pooled && !isRedisError(err) {
+		conn.Close()
+		if conn, err = c.dial(); err != nil {
+			return nil, err
+		}
+		reply, err = conn.do(args...)
+	}
+	// Connections aren't reused after network errors
+	if err != nil && !isRedisError(err) {
+		conn.Close()
+		return nil, err
+	}
+	c.release(conn)
+	return reply, err
+}
+
+// Returns an idle connection (pooled = true) or a new one
+func (c *RedisCache) conn() (conn *redisConn, pooled bool, err error) {
+	select {
+	case conn := <-c.pool:
+		return conn, true, nil
+	default:
+		conn, err := c.dial()
+		return conn, false, err
+	}
+}
+
+// Returns a connection to the pool (or closes it if the pool is full)
+func (c *RedisCache) release(conn *redisConn) {
+	select {
+	case c.pool <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// Opens a new connection, authenticating and selecting the database if required
+func (c *RedisCache) dial() (*redisConn, error) {
+	netConn, err := net.DialTimeout("tcp", c.settings.Addr, c.settings.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{
+		conn:    netConn,
+		reader:  bufio.NewReader(netConn),
+		writer:  bufio.NewWriter(netConn),
+		timeout: c.settings.Timeout,
+	}
+	if c.settings.Password != "" {
+		if _, err := conn.do("AUTH", c.settings.Password); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed authenticating: %w", err)
+		}
+	}
+	if c.settings.DB != 0 {
+		if _, err := conn.do("SELECT", strconv.Itoa(c.settings.DB)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed selecting database: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// Error replied by the Redis server (the connection can still be used)
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+// Checks whether an error was replied by the server
+func isRedisError(err error) bool {
+	var target redisError
+	return errors.As(err, &target)
+}
+
+// A single connection to a Redis server
+type redisConn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+	timeout time.Duration
+}
+
+// Close closes the connection
+func (c *redisConn) Close() error {
+	return c.conn.Close()
+}
+
+// Sends a command (as an array of bulk strings) and reads the reply
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return nil, err
+	}
+
+	// Write command
+	fmt.Fprintf(c.writer, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.writer, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := c.writer.Flush(); err != nil {
+		return nil, err
+	}
+	return readReply(c.reader)
+}
+
+// Reads a RESP reply
+func readReply(reader *bufio.Reader) (interface{}, error) {
+	line, err := readLine(reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	// Simple string
+	case '+':
+		return line[1:], nil
+	// Error
+	case '-':
+		return nil, redisError(line[1:])
+	// Integer
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	// Bulk string
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid bulk length %q", line)
+		}
+		// Nil
+		if size < 0 {
+			return nil, nil
+		}
+		// Read string and trailing CRLF
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		return string(data[:size]), nil
+	// Array
+	case '*':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid array length %q", line)
+		}
+		// Nil
+		if size < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, size)
+		for i := range items {
+			// Errors within arrays are returned as values
+			item, err := readReply(reader)
+			if err != nil && !isRedisError(err) {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
+
+// Reads a line terminated by CRLF (without the terminator)
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("redis: invalid line %q", line)
+	}
+	return line[:len(line)-2], nil
+}
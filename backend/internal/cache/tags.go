@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// RecordTag returns the tag of a single record
+// eg. RecordTag("user", 5) = "user:5"
+func RecordTag(schemaName string, id interface{}) string {
+	return fmt.Sprintf("%s:%v", strings.ToLower(schemaName), id)
+}
+
+// SchemaTag returns the tag shared by all cached records of a schema
+// eg. SchemaTag("post") = "posts"
+func SchemaTag(schemaName string) string {
+	return strings.ToLower(schemaName) + "s"
+}
+
+// EntityTags returns the tags of a database entity (struct or pointer to struct):
+// its schema tag, its record tag and the record tags of the related records it embeds.
+// Belongs to relationships are found using the foreign key (gorm foreignKey tag or <Field>ID field),
+// so the tags are known even if the relationship isn't loaded. Has many relationships use the IDs of the loaded records.
+// eg. EntityTags("post", post) = ["posts", "post:1", "user:5"]
+func EntityTags(schemaName string, entity interface{}) []string {
+	tags := []string{SchemaTag(schemaName)}
+
+	value := reflect.Indirect(reflect.ValueOf(entity))
+	if value.Kind() != reflect.Struct {
+		return tags
+	}
+	// Record tag
+	if id, ok := recordID(value); ok {
+		tags = append(tags, RecordTag(schemaName, id))
+	}
+
+	// Related record tags
+	valueType := value.Type()
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		switch fieldType.Kind() {
+		// Belongs to (eg. Post.User with Post.UserID)
+		case reflect.Struct:
+			foreignKey := value.FieldByName(foreignKeyName(field))
+			if !foreignKey.IsValid() || foreignKey.IsZero() {
+				continue
+			}
+			tags = append(tags, RecordTag(fieldType.Name(), foreignKey.Interface()))
+		// Has many (eg. User.Posts)
+		case reflect.Slice:
+			elementType := fieldType.Elem()
+			if elementType.Kind() == reflect.Ptr {
+				elementType = elementType.Elem()
+			}
+			if elementType.Kind() != reflect.Struct {
+				continue
+			}
+			related := value.Field(i)
+			for j := 0; j < related.Len(); j++ {
+				if id, ok := recordID(reflect.Indirect(related.Index(j))); ok {
+					tags = append(tags, RecordTag(elementType.Name(), id))
+				}
+			}
+		}
+	}
+	return tags
+}
+
+// Returns the non zero ID field of a struct value
+func recordID(value reflect.Value) (interface{}, bool) {
+	if value.Kind() != reflect.Struct {
+		return nil, false
+	}
+	id := value.FieldByName("ID")
+	if !id.IsValid() || id.IsZero() {
+		return nil, false
+	}
+	return id.Interface(), true
+}
+
+// Returns the name of the foreign key field of a belongs to relationship
+// (gorm foreignKey tag if set, else <Field>ID)
+func foreignKeyName(field reflect.StructField) string {
+	for _, setting := range strings.Split(field.Tag.Get("gorm"), ";") {
+		name, value, found := strings.Cut(setting, ":")
+		if found && strings.EqualFold(strings.TrimSpace(name), "foreignKey") {
+			return strings.TrimSpace(value)
+		}
+	}
+	return field.Name + "ID"
+}
@@ -3,10 +3,12 @@ package config
 import (
 	"context"
 	"html/template"
+	"time"
 
 	"github.com/casbin/casbin/v2"
 	gormadapter "github.com/casbin/gorm-adapter/v3"
 	"github.com/dmawardi/Go-Template/internal/cache"
+	"github.com/dmawardi/Go-Template/internal/email"
 	"github.com/dmawardi/Go-Template/internal/models"
 	"github.com/gorilla/sessions"
 	"gorm.io/gorm"
@@ -24,7 +26,11 @@ type AppConfig struct {
 	// Should be set to the base url of the app upon server start
 	BaseURL string
 	// Cache
-	Cache *cache.CacheMap
+	Cache cache.Cache
+	// Email templates (parsed on start)
+	EmailTemplates *email.TemplateRegistry
+	// How long list (FindAll) results of modules are cached (0 disables list caching)
+	ListCacheTTL time.Duration
 	// Core modules
 	User models.ModuleSet
 	Policy models.ModuleSet
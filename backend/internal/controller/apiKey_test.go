@@ -0,0 +1,142 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers"
+	"github.com/dmawardi/Go-Template/internal/models"
+)
+
+func TestUserController_ApiKeys(t *testing.T) {
+	userToken := testModule.accounts.user.token
+	userId := testModule.accounts.user.details.ID
+
+	// Sends a request with a bearer token or API key (apiKey set)
+	send := func(method, url string, body interface{}, token string, apiKey bool) *httptest.ResponseRecorder {
+		req, err := helpers.BuildApiRequest(method, url, helpers.BuildReqBody(body), true, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if apiKey {
+			req.Header.Set("Authorization", "ApiKey "+token)
+		}
+		rr := httptest.NewRecorder()
+		testModule.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Invalid keys
+	var invalidTests = []struct {
+		title  string
+		create models.CreateApiKey
+	}{
+		{title: "No scopes", create: models.CreateApiKey{Name: "Deploy"}},
+		{title: "Unknown action", create: models.CreateApiKey{Name: "Deploy", Scopes: []string{"write:/api/me"}}},
+		{title: "Missing path", create: models.CreateApiKey{Name: "Deploy", Scopes: []string{"read"}}},
+		{title: "Expired", create: models.CreateApiKey{Name: "Deploy", Scopes: []string{"read:/api/me"}, ExpiresAt: timePointer(time.Now().Add(-time.Hour))}},
+		{title: "No name", create: models.CreateApiKey{Scopes: []string{"read:/api/me"}}},
+	}
+	for _, v := range invalidTests {
+		if rr := send("POST", "me/api-keys", v.create, userToken, false); rr.Code != http.StatusBadRequest {
+			t.Errorf("Fail: Create API key (%v): got %v want %v", v.title, rr.Code, http.StatusBadRequest)
+		}
+	}
+
+	// Create a key that can read the user's profile
+	rr := send("POST", "me/api-keys", models.CreateApiKey{Name: "Deploy", Scopes: []string{"read:/api/me"}}, userToken, false)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Create API key: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	var created models.CreatedApiKey
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Key == "" || created.ApiKey.Prefix == "" || created.Key[:len(created.ApiKey.Prefix)] != created.ApiKey.Prefix {
+		t.Fatalf("Create API key: unexpected response %s", rr.Body.String())
+	}
+
+	// Use the key
+	var authTests = []struct {
+		title          string
+		method, url    string
+		key            string
+		expectedStatus int
+	}{
+		{title: "In scope", method: "GET", url: "me", key: created.Key, expectedStatus: http.StatusOK},
+		{title: "Action out of scope", method: "PUT", url: "me", key: created.Key, expectedStatus: http.StatusForbidden},
+		{title: "Path out of scope", method: "GET", url: "me/api-keys", key: created.Key, expectedStatus: http.StatusForbidden},
+		{title: "Not allowed by role", method: "GET", url: "users", key: created.Key, expectedStatus: http.StatusForbidden},
+		{title: "Unknown key", method: "GET", url: "me", key: created.Key + "x", expectedStatus: http.StatusForbidden},
+	}
+	for _, v := range authTests {
+		if rr := send(v.method, v.url, nil, v.key, true); rr.Code != v.expectedStatus {
+			t.Errorf("API key (%v): got %v want %v", v.title, rr.Code, v.expectedStatus)
+		}
+	}
+	// Acts as the key's user
+	var me models.UserWithRole
+	json.Unmarshal(send("GET", "me", nil, created.Key, true).Body.Bytes(), &me)
+	if me.ID != userId {
+		t.Errorf("API key user: got %v want %v", me.ID, userId)
+	}
+
+	// Listed with the time it was last used
+	rr = send("GET", "me/api-keys", nil, userToken, false)
+	var keys []db.ApiKey
+	if err := json.Unmarshal(rr.Body.Bytes(), &keys); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].ID != created.ApiKey.ID || keys[0].LastUsedAt == nil || len(keys[0].Scopes) != 1 {
+		t.Errorf("Find API keys: unexpected response %s", rr.Body.String())
+	}
+
+	// Keys can only create keys within their own scopes
+	limitedKey := send("POST", "me/api-keys", models.CreateApiKey{Name: "Limited", Scopes: []string{"create:/api/me/*", "create:/api/users/logout", "read:/api/posts/*"}}, userToken, false)
+	var limited models.CreatedApiKey
+	json.Unmarshal(limitedKey.Body.Bytes(), &limited)
+	for _, v := range []struct {
+		title          string
+		scopes         []string
+		expectedStatus int
+	}{
+		{title: "Within scopes", scopes: []string{"read:/api/posts/*"}, expectedStatus: http.StatusCreated},
+		{title: "Wider action", scopes: []string{"*:/api/posts/*"}, expectedStatus: http.StatusForbidden},
+		{title: "Wider path", scopes: []string{"read:/api/*"}, expectedStatus: http.StatusForbidden},
+		{title: "Partly within scopes", scopes: []string{"read:/api/posts/*", "delete:/api/posts/*"}, expectedStatus: http.StatusForbidden},
+	} {
+		if rr := send("POST", "me/api-keys", models.CreateApiKey{Name: "Copy", Scopes: v.scopes}, limited.Key, true); rr.Code != v.expectedStatus {
+			t.Errorf("API key creating API key (%s): got %v want %v", v.title, rr.Code, v.expectedStatus)
+		}
+	}
+	// Keys can't log out (they're revoked instead)
+	if rr := send("POST", "users/logout", nil, limited.Key, true); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "revoke the key") {
+		t.Errorf("Fail: API key logging out: got %v %q", rr.Code, rr.Body.String())
+	}
+
+	// Revoke
+	for _, id := range []uint{created.ApiKey.ID, limited.ApiKey.ID} {
+		if rr := send("DELETE", fmt.Sprintf("me/api-keys/%d", id), nil, userToken, false); rr.Code != http.StatusOK {
+			t.Errorf("Revoke API key: got %v want %v", rr.Code, http.StatusOK)
+		}
+	}
+	if rr := send("DELETE", fmt.Sprintf("me/api-keys/%d", created.ApiKey.ID), nil, userToken, false); rr.Code != http.StatusNotFound {
+		t.Errorf("Fail: Revoke revoked API key: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+	if rr := send("GET", "me", nil, created.Key, true); rr.Code != http.StatusForbidden {
+		t.Errorf("Fail: Revoked API key used: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	// Clean up created keys
+	testModule.dbClient.Where("user_id = ?", userId).Delete(&db.ApiKey{})
+}
+
+func timePointer(t time.Time) *time.Time {
+	return &t
+}
@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/dmawardi/Go-Template/internal/helpers"
 	data "github.com/dmawardi/Go-Template/internal/helpers/data"
@@ -313,6 +314,8 @@ func TestAuthController_AssignUserRole(t *testing.T) {
 			if !successValue {
 				t.Errorf("Expected to reset role reassignment, however, failed")
 			}
+			// Role changes reject the user's existing tokens
+			testModule.accounts.user.token = testModule.reissueToken(testModule.accounts.user.details)
 		}
 	}
 }
@@ -370,6 +373,8 @@ func TestAuthController_CreateRole(t *testing.T) {
 			if !successValue {
 				t.Fatal("Expected to reset role reassignment, however, failed")
 			}
+			// Role changes reject the user's existing tokens
+			testModule.accounts.user.token = testModule.reissueToken(testModule.accounts.user.details)
 
 			// Check user role to ensure completed correctly
 			foundRole, err := testModule.auth.serv.FindRoleByUserId(int(testModule.accounts.user.details.ID))
@@ -516,7 +521,7 @@ func TestAuthController_CreateInheritance(t *testing.T) {
 
 	// Cleanup
 	// Delete user
-	err = testModule.users.serv.Delete(int(createdUser.ID))
+	err = testModule.users.serv.Delete(int(createdUser.ID), time.Time{})
 	if err != nil {
 		t.Error(err)
 	}
@@ -607,7 +612,7 @@ func TestAuthController_DeleteInheritance(t *testing.T) {
 	}
 	// Cleanup
 	// Delete user
-	err = testModule.users.serv.Delete(int(createdUser.ID))
+	err = testModule.users.serv.Delete(int(createdUser.ID), time.Time{})
 	if err != nil {
 		t.Error(err)
 	}
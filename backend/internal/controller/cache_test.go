@@ -0,0 +1,50 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dmawardi/Go-Template/internal/cache"
+	"github.com/dmawardi/Go-Template/internal/helpers"
+)
+
+func TestCacheController_Stats(t *testing.T) {
+	var tests = []struct {
+		title                  string
+		token                  string
+		expectedResponseStatus int
+	}{
+		{"Admin can view cache stats", testModule.accounts.admin.token, http.StatusOK},
+		{"Basic user is forbidden", testModule.accounts.user.token, http.StatusForbidden},
+	}
+	for _, v := range tests {
+		req, err := helpers.BuildApiRequest("GET", "cache/stats", nil, true, v.token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Create a response recorder
+		rr := httptest.NewRecorder()
+		// Use handler with recorder and created request
+		testModule.router.ServeHTTP(rr, req)
+
+		// Check the response status code
+		if status := rr.Code; status != v.expectedResponseStatus {
+			t.Errorf("In test '%s': handler returned wrong status code: got %v want %v", v.title, status, v.expectedResponseStatus)
+			continue
+		}
+		if v.expectedResponseStatus != http.StatusOK {
+			continue
+		}
+
+		// Convert response JSON to struct
+		var stats cache.Stats
+		if err := json.Unmarshal(rr.Body.Bytes(), &stats); err != nil {
+			t.Errorf("In test '%s': failed to decode stats: %v", v.title, err)
+		}
+		if stats.MaxEntries == 0 {
+			t.Errorf("In test '%s': expected max entries to be reported, got %+v", v.title, stats)
+		}
+	}
+}
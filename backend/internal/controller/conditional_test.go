@@ -0,0 +1,234 @@
+package controller_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers"
+	"github.com/dmawardi/Go-Template/internal/models"
+)
+
+func TestConditionalRequests_IfNoneMatch(t *testing.T) {
+	// Create user
+	createdUser, err := testModule.users.serv.Create(&models.CreateUser{
+		Username: "Etagger",
+		Email:    "etag@ymail.com",
+		Password: "password",
+		Name:     "Etienne",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test user for test: %v", err)
+	}
+	defer testModule.users.serv.Delete(int(createdUser.ID), time.Time{})
+
+	for _, urlSuffix := range []string{fmt.Sprintf("users/%v", createdUser.ID), "users?limit=10&offset=0", "me"} {
+		// First request returns the ETag
+		req, err := helpers.BuildApiRequest("GET", urlSuffix, nil, true, testModule.accounts.admin.token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		testModule.router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: got status %v want %v", urlSuffix, rr.Code, http.StatusOK)
+		}
+		etag := rr.Header().Get("ETag")
+		if etag == "" {
+			t.Fatalf("%s: expected ETag header", urlSuffix)
+		}
+
+		// Matching ETag returns 304 without a body
+		req, _ = helpers.BuildApiRequest("GET", urlSuffix, nil, true, testModule.accounts.admin.token)
+		req.Header.Set("If-None-Match", etag)
+		rr = httptest.NewRecorder()
+		testModule.router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusNotModified {
+			t.Errorf("%s: got status %v want %v", urlSuffix, rr.Code, http.StatusNotModified)
+		}
+		if rr.Body.Len() != 0 {
+			t.Errorf("%s: expected empty body, got %q", urlSuffix, rr.Body.String())
+		}
+
+		// Different ETag returns the full response
+		req, _ = helpers.BuildApiRequest("GET", urlSuffix, nil, true, testModule.accounts.admin.token)
+		req.Header.Set("If-None-Match", `"stale"`)
+		rr = httptest.NewRecorder()
+		testModule.router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: got status %v want %v", urlSuffix, rr.Code, http.StatusOK)
+		}
+	}
+
+	// Single records have a Last-Modified date
+	req, _ := helpers.BuildApiRequest("GET", fmt.Sprintf("users/%v", createdUser.ID), nil, true, testModule.accounts.admin.token)
+	rr := httptest.NewRecorder()
+	testModule.router.ServeHTTP(rr, req)
+	lastModified := rr.Header().Get("Last-Modified")
+	if lastModified == "" {
+		t.Fatalf("expected Last-Modified header")
+	}
+	req, _ = helpers.BuildApiRequest("GET", fmt.Sprintf("users/%v", createdUser.ID), nil, true, testModule.accounts.admin.token)
+	req.Header.Set("If-Modified-Since", lastModified)
+	rr = httptest.NewRecorder()
+	testModule.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("If-Modified-Since: got status %v want %v", rr.Code, http.StatusNotModified)
+	}
+}
+
+func TestConditionalRequests_IfMatch(t *testing.T) {
+	// Create user
+	createdUser, err := testModule.users.serv.Create(&models.CreateUser{
+		Username: "Matcher",
+		Email:    "ifmatch@ymail.com",
+		Password: "password",
+		Name:     "Matthew",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test user for test: %v", err)
+	}
+	urlSuffix := fmt.Sprintf("users/%v", createdUser.ID)
+
+	// Get current ETag
+	req, _ := helpers.BuildApiRequest("GET", urlSuffix, nil, true, testModule.accounts.admin.token)
+	rr := httptest.NewRecorder()
+	testModule.router.ServeHTTP(rr, req)
+	etag := rr.Header().Get("ETag")
+
+	var tests = []struct {
+		testName               string
+		method                 string
+		ifMatch                string
+		data                   map[string]string
+		expectedResponseStatus int
+	}{
+		{"Fail case: Update with stale ETag", "PUT", `"stale"`, map[string]string{"Name": "Matthias"}, http.StatusPreconditionFailed},
+		{"Update with current ETag", "PUT", etag, map[string]string{"Name": "Matthias"}, http.StatusOK},
+		// ETag changed with the update
+		{"Fail case: Update with ETag from before update", "PUT", etag, map[string]string{"Name": "Mattie"}, http.StatusPreconditionFailed},
+		{"Fail case: Delete with ETag from before update", "DELETE", etag, nil, http.StatusPreconditionFailed},
+		{"Update without If-Match", "PUT", "", map[string]string{"Name": "Mattie"}, http.StatusOK},
+		{"Delete with any ETag", "DELETE", "*", nil, http.StatusOK},
+		// Resource no longer exists
+		{"Fail case: Delete removed user", "DELETE", "*", nil, http.StatusPreconditionFailed},
+	}
+
+	for _, v := range tests {
+		req, err := helpers.BuildApiRequest(v.method, urlSuffix, helpers.BuildReqBody(v.data), true, testModule.accounts.admin.token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.ifMatch != "" {
+			req.Header.Set("If-Match", v.ifMatch)
+		}
+		rr := httptest.NewRecorder()
+		testModule.router.ServeHTTP(rr, req)
+		if rr.Code != v.expectedResponseStatus {
+			t.Errorf("%s: got status %v want %v", v.testName, rr.Code, v.expectedResponseStatus)
+		}
+	}
+}
+
+func TestConditionalRequests_IfMatchVersionCheckedOnUpdate(t *testing.T) {
+	// Create user
+	createdUser, err := testModule.users.serv.Create(&models.CreateUser{
+		Username: "Racer",
+		Email:    "ifmatchrace@ymail.com",
+		Password: "password",
+		Name:     "Rachel",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test user for test: %v", err)
+	}
+	defer testModule.users.serv.Delete(int(createdUser.ID), time.Time{})
+	urlSuffix := fmt.Sprintf("users/%v", createdUser.ID)
+
+	// Get current ETag (caches the user)
+	req, _ := helpers.BuildApiRequest("GET", urlSuffix, nil, true, testModule.accounts.admin.token)
+	rr := httptest.NewRecorder()
+	testModule.router.ServeHTTP(rr, req)
+	etag := rr.Header().Get("ETag")
+
+	// Another update lands after the If-Match check (simulated by changing the user without updating the cache,
+	// so the ETag still matches when checked)
+	err = testModule.dbClient.Model(&db.User{}).Where("id = ?", createdUser.ID).
+		Updates(map[string]interface{}{"name": "Rocket", "updated_at": time.Now().Add(time.Second)}).Error
+	if err != nil {
+		t.Fatalf("failed to update test user: %v", err)
+	}
+
+	// Update is rejected as the user changed since the matched version
+	req, _ = helpers.BuildApiRequest("PUT", urlSuffix, helpers.BuildReqBody(map[string]string{"Name": "Raquel"}), true, testModule.accounts.admin.token)
+	req.Header.Set("If-Match", etag)
+	rr = httptest.NewRecorder()
+	testModule.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusPreconditionFailed {
+		t.Errorf("Update after concurrent change: got status %v want %v", rr.Code, http.StatusPreconditionFailed)
+	}
+	var found db.User
+	testModule.dbClient.First(&found, createdUser.ID)
+	if found.Name != "Rocket" {
+		t.Errorf("expected concurrent change to be kept, got name %q", found.Name)
+	}
+}
+
+func TestConditionalRequests_IfMatchVersionCheckedOnDelete(t *testing.T) {
+	// Create users
+	var createdUsers []*models.UserWithRole
+	for _, email := range []string{"ifmatchdeleterace@ymail.com", "ifmatchdelete@ymail.com"} {
+		createdUser, err := testModule.users.serv.Create(&models.CreateUser{
+			Username: "Racer",
+			Email:    email,
+			Password: "password",
+			Name:     "Rachel",
+		})
+		if err != nil {
+			t.Fatalf("failed to create test user for test: %v", err)
+		}
+		createdUsers = append(createdUsers, createdUser)
+	}
+	defer testModule.users.serv.Delete(int(createdUsers[0].ID), time.Time{})
+	// Sends a request with an If-Match header (if set), returning the response
+	send := func(method string, id uint, etag string) *httptest.ResponseRecorder {
+		req, _ := helpers.BuildApiRequest(method, fmt.Sprintf("users/%v", id), nil, true, testModule.accounts.admin.token)
+		if etag != "" {
+			req.Header.Set("If-Match", etag)
+		}
+		rr := httptest.NewRecorder()
+		testModule.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Get current ETag (caches the user)
+	etag := send("GET", createdUsers[0].ID, "").Header().Get("ETag")
+
+	// Another update lands after the If-Match check (simulated by changing the user without updating the cache,
+	// so the ETag still matches when checked)
+	err := testModule.dbClient.Model(&db.User{}).Where("id = ?", createdUsers[0].ID).
+		Updates(map[string]interface{}{"name": "Rocket", "updated_at": time.Now().Add(time.Second)}).Error
+	if err != nil {
+		t.Fatalf("failed to update test user: %v", err)
+	}
+
+	// Delete is rejected as the user changed since the matched version
+	if rr := send("DELETE", createdUsers[0].ID, etag); rr.Code != http.StatusPreconditionFailed {
+		t.Errorf("Delete after concurrent change: got status %v want %v", rr.Code, http.StatusPreconditionFailed)
+	}
+	var found db.User
+	if err := testModule.dbClient.First(&found, createdUsers[0].ID).Error; err != nil {
+		t.Errorf("expected changed user to be kept, got %v", err)
+	}
+
+	// Delete with the current version succeeds
+	etag = send("GET", createdUsers[1].ID, "").Header().Get("ETag")
+	if rr := send("DELETE", createdUsers[1].ID, etag); rr.Code != http.StatusOK {
+		t.Errorf("Delete with current ETag: got status %v want %v", rr.Code, http.StatusOK)
+	}
+	if err := testModule.dbClient.First(&db.User{}, createdUsers[1].ID).Error; err == nil {
+		t.Error("expected user to be deleted")
+	}
+}
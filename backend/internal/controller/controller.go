@@ -1,11 +1,12 @@
 package controller
 
 import (
-	"encoding/json"
+	"fmt"
 	"net/http"
 
+	"github.com/dmawardi/Go-Template/internal/auth"
 	"github.com/dmawardi/Go-Template/internal/config"
-	"github.com/dmawardi/Go-Template/internal/models"
+	"github.com/dmawardi/Go-Template/internal/helpers/request"
 )
 
 // Init state variable
@@ -17,21 +18,23 @@ func SetStateInHandlers(a *config.AppConfig) {
 	app = a
 }
 
-// Sample handler for JSON data: Jobs
-func GetJobs(w http.ResponseWriter, r *http.Request) {
-	var jobs []models.Job
-
-	jobs = append(jobs, models.Job{ID: 1, Name: "Accounting"})
-	jobs = append(jobs, models.Job{ID: 2, Name: "Programming"})
-
-	// Set header
-	w.Header().Set("Content-Type", "application/json")
-
-	// Build new JSON encoder to write to, then write jobs data
-	json.NewEncoder(w).Encode(jobs)
-}
-
 // Login URL check
 func HealthCheck(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("Welcome!"))
 }
+
+// Serves the public keys used to verify tokens (JWKS) so other services can verify them
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	keys, err := auth.CurrentKeyRing()
+	if err != nil {
+		http.Error(w, "Signing keys not configured", http.StatusInternalServerError)
+		fmt.Println("error loading signing keys: ", err)
+		return
+	}
+	// Allow clients to cache the keys briefly (new keys should be added before they're used to sign)
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	err = request.WriteAsJSON(w, keys.JWKS())
+	if err != nil {
+		fmt.Println("error writing JWKS to response: ", err)
+	}
+}
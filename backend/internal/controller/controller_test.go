@@ -2,6 +2,7 @@ package controller_test
 
 import (
 	"fmt"
+	"html/template"
 	"net/http"
 	"os"
 	"testing"
@@ -10,6 +11,7 @@ import (
 	"github.com/dmawardi/Go-Template/internal/auth"
 	"github.com/dmawardi/Go-Template/internal/cache"
 	"github.com/dmawardi/Go-Template/internal/controller/core"
+	"github.com/dmawardi/Go-Template/internal/email"
 	"github.com/dmawardi/Go-Template/internal/helpers"
 	webapi "github.com/dmawardi/Go-Template/internal/helpers/webApi"
 	"github.com/dmawardi/Go-Template/internal/models"
@@ -31,12 +33,16 @@ var testModule controllerTestModule
 var app config.AppConfig
 
 type controllerTestModule struct {
-	dbClient *gorm.DB
-	users    userModule
-	admin    adminpanel.AdminPanelController
-	auth     authModule
-	router   http.Handler
-	api      routes.Api
+	dbClient  *gorm.DB
+	users     userModule
+	admin     adminpanel.AdminPanelController
+	auth      authModule
+	jobs      jobModule
+	emailLogs emailLogModule
+	// Emails written by the file email driver
+	outbox *email.FileEmail
+	router http.Handler
+	api    routes.Api
 	// For authentication mocking
 	accounts userAccounts
 }
@@ -53,6 +59,18 @@ type authModule struct {
 	cont core.AuthPolicyController
 }
 
+type jobModule struct {
+	repo corerepositories.JobRepository
+	serv coreservices.JobService
+	cont core.JobController
+}
+
+type emailLogModule struct {
+	repo corerepositories.EmailLogRepository
+	serv coreservices.EmailLogService
+	cont core.EmailLogController
+}
+
 // Account structures
 type userAccounts struct {
 	admin dummyAccount
@@ -87,6 +105,26 @@ func TestMain(m *testing.M) {
 	// Setup new cache
 	app.Cache = &cache.CacheMap{}
 
+	// Sign tokens with a test secret
+	auth.SetKeyRing(auth.NewHMACKeyRing([]byte("test-secret")))
+
+	// Parse admin panel and email templates
+	app.AdminTemplates = parseAdminTemplates()
+	app.EmailTemplates, err = email.LoadTemplates()
+	if err != nil {
+		fmt.Println("Error parsing email templates: ", err)
+	}
+
+	// Capture emails in a temporary outbox
+	outboxDir, err := os.MkdirTemp("", "outbox")
+	if err != nil {
+		fmt.Println("Error creating outbox directory")
+	}
+	testModule.outbox, err = email.NewFileEmail(outboxDir, "noreply@example.com")
+	if err != nil {
+		fmt.Println("Error creating outbox: ", err)
+	}
+
 	// Sync app in authentication package for usage in authentication functions
 	SetAppWideState(&app)
 
@@ -109,16 +147,15 @@ func TestMain(m *testing.M) {
 
 	// Run the rest of the tests
 	exitCode := m.Run()
+	os.RemoveAll(outboxDir)
 	// exit with the same exit code as the tests
 	os.Exit(exitCode)
 }
 
 // Builds new API using routes package
 func (t *controllerTestModule) TestApiSetup(client *gorm.DB) routes.Api {
-	mail := &helpers.EmailMock{}
-
-	// Create job queue
-	jobQueue := queue.NewQueue(client, mail)
+	// Create job queue (emails are written to the outbox)
+	jobQueue := queue.NewQueue(client, t.outbox)
 	// Setup module stack
 	// Auth
 	t.auth.repo = corerepositories.NewAuthPolicyRepository(client)
@@ -129,6 +166,16 @@ func (t *controllerTestModule) TestApiSetup(client *gorm.DB) routes.Api {
 	t.users.serv = coreservices.NewUserService(t.users.repo, t.auth.repo, jobQueue)
 	t.users.cont = core.NewUserController(t.users.serv)
 
+	// Job
+	t.jobs.repo = corerepositories.NewJobRepository(client)
+	t.jobs.serv = coreservices.NewJobService(t.jobs.repo, jobQueue)
+	t.jobs.cont = core.NewJobController(t.jobs.serv)
+
+	// Email log
+	t.emailLogs.repo = corerepositories.NewEmailLogRepository(client)
+	t.emailLogs.serv = coreservices.NewEmailLogService(t.emailLogs.repo)
+	t.emailLogs.cont = core.NewEmailLogController(t.emailLogs.serv)
+
 	// Action
 	actionRepo := corerepositories.NewActionRepository(client)
 	actionService := coreservices.NewActionService(actionRepo)
@@ -143,6 +190,9 @@ func (t *controllerTestModule) TestApiSetup(client *gorm.DB) routes.Api {
 		adminpanel.NewAdminUserController(t.users.serv, actionService),
 		adminpanel.NewAdminAuthPolicyController(t.auth.serv),
 		adminActionController,
+		adminpanel.NewAdminJobController(t.jobs.serv, actionService),
+		adminpanel.NewAdminEmailLogController(t.emailLogs.serv, actionService),
+		adminpanel.NewAdminOutboxController(t.outbox),
 		// Additional modules
 		moduleMap,
 	)
@@ -155,6 +205,9 @@ func (t *controllerTestModule) TestApiSetup(client *gorm.DB) routes.Api {
 		t.admin,
 		t.users.cont,
 		t.auth.cont,
+		t.jobs.cont,
+		t.emailLogs.cont,
+		core.NewCacheController(app.Cache),
 		moduleMap,
 	)
 
@@ -207,6 +260,27 @@ func (t *controllerTestModule) generateUserWithRoleAndToken(user *models.CreateU
 	return createdUser, tokenString
 }
 
+// Issues a new token for a dummy account (eg. after a role change rejects its existing tokens)
+func (t *controllerTestModule) reissueToken(user *models.UserWithRole) string {
+	tokenString, err := auth.GenerateJWT(int(user.ID), user.Email, user.Role)
+	if err != nil {
+		fmt.Println("Failed to create JWT")
+	}
+	return tokenString
+}
+
+// Parses the admin panel templates (relative to this package's directory)
+func parseAdminTemplates() *template.Template {
+	tmpl := template.New("layout.go.tmpl")
+	for _, pattern := range []string{"../admin-panel/templates/*.tmpl", "../admin-panel/templates/sections/*.tmpl", "../admin-panel/templates/sections/*/*.tmpl"} {
+		_, err := tmpl.ParseGlob(pattern)
+		if err != nil {
+			fmt.Println("Error parsing admin templates: ", err)
+		}
+	}
+	return tmpl
+}
+
 // Sets app config state to all packages for usage
 func SetAppWideState(appConfig *config.AppConfig) {
 	controller.SetStateInHandlers(appConfig)
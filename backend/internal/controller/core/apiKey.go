@@ -0,0 +1,149 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/dmawardi/Go-Template/internal/auth"
+	"github.com/dmawardi/Go-Template/internal/helpers/request"
+	"github.com/dmawardi/Go-Template/internal/models"
+	coreservices "github.com/dmawardi/Go-Template/internal/service/core"
+	"github.com/go-chi/chi/v5"
+)
+
+// @Summary      Find my API keys
+// @Description  Returns the current user's API keys (excluding revoked keys), with when they were last used
+// @Tags         My Profile
+// @Accept       json
+// @Produce      json
+// @Success      200 {array} db.ApiKey
+// @Failure      400 {string} string "Failed to find API keys"
+// @Failure      403 {string} string "Error parsing authentication token"
+// @Router       /me/api-keys [get]
+// @Security BearerToken
+func (c userController) FindMyApiKeys(w http.ResponseWriter, r *http.Request) {
+	userId, err := userIdFromToken(r)
+	if err != nil {
+		http.Error(w, "Error parsing authentication token", http.StatusForbidden)
+		return
+	}
+
+	keys, err := c.service.FindApiKeys(userId)
+	if err != nil {
+		fmt.Println("Error finding API keys: ", err)
+		http.Error(w, "Failed to find API keys", http.StatusBadRequest)
+		return
+	}
+
+	request.WriteAsJSON(w, keys)
+}
+
+// @Summary      Create API key
+// @Description  Creates an API key for scripts and integrations, used with the header "Authorization: ApiKey <key>". The key acts as the current user, limited to its scopes (eg. read:/api/posts or *:/api/posts/*). Keys created with an API key are limited to that key's scopes. The key is only shown once. All of the user's keys are revoked when their password is changed or reset.
+// @Tags         My Profile
+// @Accept       json
+// @Produce      json
+// @Param        key body models.CreateApiKey true "New API Key"
+// @Success      201 {object} models.CreatedApiKey
+// @Failure      400 {string} string "Failed API key creation"
+// @Failure      400 {object} models.ValidationError "Validation Errors"
+// @Failure      403 {string} string "API key scopes must be within the scopes of the key creating it"
+// @Router       /me/api-keys [post]
+// @Security BearerToken
+func (c userController) CreateApiKey(w http.ResponseWriter, r *http.Request) {
+	tokenData, err := auth.ValidateAndParseToken(r)
+	if err != nil {
+		http.Error(w, "Error parsing authentication token", http.StatusForbidden)
+		return
+	}
+	userId, err := strconv.Atoi(tokenData.UserID)
+	if err != nil {
+		http.Error(w, "Error parsing authentication token", http.StatusForbidden)
+		return
+	}
+
+	var toCreate models.CreateApiKey
+	err = json.NewDecoder(r.Body).Decode(&toCreate)
+	if err != nil {
+		fmt.Println("Decoding error: ", err)
+		http.Error(w, "Failed API key creation", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the incoming DTO
+	pass, valErrors := request.GoValidateStruct(&toCreate)
+	if !pass {
+		// Write bad request header
+		w.WriteHeader(http.StatusBadRequest)
+		// Write validation errors to JSON
+		request.WriteAsJSON(w, valErrors)
+		return
+	}
+
+	// Keys created with a key are limited to its scopes
+	var callerScopes []string
+	if tokenData.ApiKeyID != 0 {
+		callerScopes = tokenData.Scopes
+	}
+	created, err := c.service.CreateApiKey(userId, &toCreate, callerScopes)
+	if errors.Is(err, coreservices.ErrApiKeyScopeNotAllowed) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, coreservices.ErrInvalidApiKeyScope) || errors.Is(err, coreservices.ErrInvalidApiKeyExpiry) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error creating API key: ", err)
+		http.Error(w, "Failed API key creation", http.StatusBadRequest)
+		return
+	}
+
+	// The key is only shown in this response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	request.WriteAsJSON(w, created)
+}
+
+// @Summary      Revoke API key
+// @Description  Revokes one of the current user's API keys. It's rejected from the next request
+// @Tags         My Profile
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "API Key ID"
+// @Success      200 {string} string "API key revoked"
+// @Failure      400 {string} string "Failed to revoke API key"
+// @Failure      403 {string} string "Error parsing authentication token"
+// @Failure      404 {string} string "API key not found"
+// @Router       /me/api-keys/{id} [delete]
+// @Security BearerToken
+func (c userController) RevokeApiKey(w http.ResponseWriter, r *http.Request) {
+	userId, err := userIdFromToken(r)
+	if err != nil {
+		http.Error(w, "Error parsing authentication token", http.StatusForbidden)
+		return
+	}
+	// Grab URL parameter
+	keyId, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+
+	err = c.service.RevokeApiKey(userId, keyId)
+	if errors.Is(err, coreservices.ErrApiKeyNotFound) {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error revoking API key: ", err)
+		http.Error(w, "Failed to revoke API key", http.StatusBadRequest)
+		return
+	}
+
+	request.WriteAsJSON(w, "API key revoked")
+}
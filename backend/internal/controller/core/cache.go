@@ -0,0 +1,38 @@
+package core
+
+import (
+	"net/http"
+
+	"github.com/dmawardi/Go-Template/internal/cache"
+	"github.com/dmawardi/Go-Template/internal/helpers/request"
+)
+
+type CacheController interface {
+	Stats(w http.ResponseWriter, r *http.Request)
+}
+
+type cacheController struct {
+	cache cache.Cache
+}
+
+func NewCacheController(cache cache.Cache) CacheController {
+	return &cacheController{cache}
+}
+
+// API/CACHE
+// @Summary      Cache statistics
+// @Description  Returns the number of entries held in the cache along with hit, miss, eviction and expiration counters since startup
+// @Tags         Cache
+// @Accept       json
+// @Produce      json
+// @Success      200 {object} cache.Stats
+// @Failure      500 {string} string "Can't write cache stats"
+// @Router       /cache/stats [get]
+// @Security BearerToken
+func (c cacheController) Stats(w http.ResponseWriter, r *http.Request) {
+	err := request.WriteAsJSON(w, c.cache.Stats())
+	if err != nil {
+		http.Error(w, "Can't write cache stats", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,121 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/dmawardi/Go-Template/internal/helpers/request"
+	"github.com/dmawardi/Go-Template/internal/models"
+	coreservices "github.com/dmawardi/Go-Template/internal/service/core"
+	"github.com/go-chi/chi/v5"
+)
+
+type EmailLogController interface {
+	FindAll(w http.ResponseWriter, r *http.Request)
+	Find(w http.ResponseWriter, r *http.Request)
+}
+
+type emailLogController struct {
+	service coreservices.EmailLogService
+}
+
+func NewEmailLogController(service coreservices.EmailLogService) EmailLogController {
+	return &emailLogController{service}
+}
+
+// Used to extract the email log filter from the query params (user_id, recipient, status, template and search)
+func EmailLogFilterFromQuery(r *http.Request) (models.EmailLogFilter, error) {
+	queryParams := r.URL.Query()
+	userID, err := request.GrabIntQueryParamOrDefault(r, "user_id", 0)
+	if err != nil || userID < 0 {
+		return models.EmailLogFilter{}, fmt.Errorf("invalid value for user_id: %s", queryParams.Get("user_id"))
+	}
+	return models.EmailLogFilter{
+		UserID:    uint(userID),
+		Recipient: queryParams.Get("recipient"),
+		Status:    queryParams.Get("status"),
+		Template:  queryParams.Get("template"),
+		Search:    queryParams.Get("search"),
+	}, nil
+}
+
+// API/EMAIL-LOGS
+// @Summary      Find a list of email logs
+// @Description  Accepts limit, offset, order, search (matches recipient, subject, template or response) and filter query parameters to search the delivery history of emails (eg. user_id=5 for a user's emails).
+// @Tags         EmailLog
+// @Accept       json
+// @Produce      json
+// @Param        limit   query      int  true  "limit"
+// @Param        offset   query      int  false  "offset"
+// @Param        order   query      int  false  "order by eg. (asc) "id" (desc) "id_desc" )"
+// @Param        search   query      string  false  "search (non-case sensitive LIKE search of recipient, subject, template and response)"
+// @Param        user_id query int false "user_id"
+// @Param        recipient query string false "recipient"
+// @Param        status query string false "status (sent, failed)"
+// @Param        template query string false "template (eg. password-reset)"
+// @Success      200 {object} models.PaginatedEmailLogs
+// @Failure      400 {string} string "Can't find email logs"
+// @Failure      400 {string} string "Must include limit parameter with a max value of 50"
+// @Failure      400 {string} string "Error extracting query params"
+// @Router       /email-logs [get]
+// @Security BearerToken
+func (c emailLogController) FindAll(w http.ResponseWriter, r *http.Request) {
+	// Grab basic query params set defaults as needed
+	baseQueryParams, err := request.ExtractBasicFindAllQueryParams(r)
+	if err != nil {
+		http.Error(w, "Error extracting query params", http.StatusBadRequest)
+		return
+	}
+	// Extract filter
+	filter, err := EmailLogFilterFromQuery(r)
+	if err != nil {
+		http.Error(w, "Error extracting query params", http.StatusBadRequest)
+		return
+	}
+
+	// Query database for matching email logs
+	found, err := c.service.FindAll(baseQueryParams.Limit, baseQueryParams.Offset, baseQueryParams.Order, filter)
+	if err != nil {
+		http.Error(w, "Can't find email logs", http.StatusBadRequest)
+		return
+	}
+	err = request.WriteAsJSON(w, found)
+	if err != nil {
+		http.Error(w, "Can't find email logs", http.StatusBadRequest)
+		fmt.Println("error writing email logs to response: ", err)
+		return
+	}
+}
+
+// @Summary      Find Email Log
+// @Description  Find an email log by ID
+// @Tags         EmailLog
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "Email Log ID"
+// @Success      200 {object} db.EmailLog
+// @Failure      400 {string} string "Can't find email log with ID: {id}"
+// @Router       /email-logs/{id} [get]
+// @Security BearerToken
+func (c emailLogController) Find(w http.ResponseWriter, r *http.Request) {
+	// Grab URL parameter
+	stringParameter := chi.URLParam(r, "id")
+	// Convert to int
+	idParameter, err := strconv.Atoi(stringParameter)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	found, err := c.service.FindById(idParameter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Can't find email log with ID: %v\n", idParameter), http.StatusBadRequest)
+		return
+	}
+	err = request.WriteAsJSON(w, found)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Can't find email log with ID: %v\n", idParameter), http.StatusBadRequest)
+		return
+	}
+}
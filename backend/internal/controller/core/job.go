@@ -0,0 +1,166 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dmawardi/Go-Template/internal/helpers/request"
+	"github.com/dmawardi/Go-Template/internal/models"
+	coreservices "github.com/dmawardi/Go-Template/internal/service/core"
+	"github.com/go-chi/chi/v5"
+)
+
+type JobController interface {
+	FindAll(w http.ResponseWriter, r *http.Request)
+	Find(w http.ResponseWriter, r *http.Request)
+	// Dead letter / failed
+	Retry(w http.ResponseWriter, r *http.Request)
+}
+
+type jobController struct {
+	service coreservices.JobService
+}
+
+func NewJobController(service coreservices.JobService) JobController {
+	return &jobController{service}
+}
+
+// Builds the search and filter conditions for finding jobs (shared with the admin panel).
+// Combined as a single condition so that filters narrow the search (rather than being OR'd with it)
+func JobFilterConditions(r *http.Request) []models.QueryConditionParameters {
+	queryParams := r.URL.Query()
+	var clauses []string
+	values := map[string]interface{}{}
+
+	// Filters
+	if jobType := queryParams.Get("job_type"); jobType != "" {
+		clauses = append(clauses, "job_type = @job_type")
+		values["job_type"] = jobType
+	}
+	if status := queryParams.Get("status"); status != "" {
+		clauses = append(clauses, "status = @status")
+		values["status"] = status
+	}
+	// Search (matches type, payload or last error)
+	if search := queryParams.Get("search"); search != "" {
+		clauses = append(clauses, "(LOWER(job_type) LIKE @search OR LOWER(payload) LIKE @search OR LOWER(last_error) LIKE @search)")
+		values["search"] = "%" + strings.ToLower(search) + "%"
+	}
+
+	// If no conditions, return empty
+	if len(clauses) == 0 {
+		return []models.QueryConditionParameters{}
+	}
+	return []models.QueryConditionParameters{{Condition: strings.Join(clauses, " AND "), Value: values}}
+}
+
+// API/JOBS
+// @Summary      Find a list of jobs
+// @Description  Accepts limit, offset, order, search (non-case sensitive LIKE search of type, payload and last error) and filter query parameters (eg. status=dead) to find a list of queued jobs. Filters and search are combined, so only jobs matching all of them are returned.
+// @Tags         Job
+// @Accept       json
+// @Produce      json
+// @Param        limit   query      int  true  "limit"
+// @Param        offset   query      int  false  "offset"
+// @Param        order   query      int  false  "order by eg. (asc) "id" (desc) "id_desc" )"
+// @Param        search   query      string  false  "search (non-case sensitive LIKE search of type, payload and last error)"
+// @Param        job_type query string false "job_type"
+// @Param        status query string false "status (pending, processed, dead, failed)"
+// @Success      200 {object} models.PaginatedJobs
+// @Failure      400 {string} string "Can't find jobs"
+// @Failure      400 {string} string "Must include limit parameter with a max value of 50"
+// @Failure      400 {string} string "Error extracting query params"
+// @Router       /jobs [get]
+// @Security BearerToken
+func (c jobController) FindAll(w http.ResponseWriter, r *http.Request) {
+	// Grab basic query params set defaults as needed
+	baseQueryParams, err := request.ExtractBasicFindAllQueryParams(r)
+	if err != nil {
+		http.Error(w, "Error extracting query params", http.StatusBadRequest)
+		return
+	}
+
+	// Build search and filter conditions (all must match)
+	conditions := JobFilterConditions(r)
+
+	// Query database for all jobs using query params
+	found, err := c.service.FindAll(baseQueryParams.Limit, baseQueryParams.Offset, baseQueryParams.Order, conditions)
+	if err != nil {
+		http.Error(w, "Can't find jobs", http.StatusBadRequest)
+		return
+	}
+	err = request.WriteAsJSON(w, found)
+	if err != nil {
+		http.Error(w, "Can't find jobs", http.StatusBadRequest)
+		fmt.Println("error writing jobs to response: ", err)
+		return
+	}
+}
+
+// @Summary      Find Job
+// @Description  Find a job by ID
+// @Tags         Job
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "Job ID"
+// @Success      200 {object} db.Job
+// @Failure      400 {string} string "Can't find job with ID: {id}"
+// @Router       /jobs/{id} [get]
+// @Security BearerToken
+func (c jobController) Find(w http.ResponseWriter, r *http.Request) {
+	// Grab URL parameter
+	stringParameter := chi.URLParam(r, "id")
+	// Convert to int
+	idParameter, err := strconv.Atoi(stringParameter)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	found, err := c.service.FindById(idParameter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Can't find job with ID: %v\n", idParameter), http.StatusBadRequest)
+		return
+	}
+	err = request.WriteAsJSON(w, found)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Can't find job with ID: %v\n", idParameter), http.StatusBadRequest)
+		return
+	}
+}
+
+// @Summary      Retry Job
+// @Description  Re-queues a dead (retries exhausted), failed or cancelled job with a fresh set of attempts
+// @Tags         Job
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "Job ID"
+// @Success      200 {object} db.Job
+// @Failure      400 {string} string "Invalid ID"
+// @Failure      400 {string} string "Failed to re-queue job"
+// @Router       /jobs/retry/{id} [post]
+// @Security BearerToken
+func (c jobController) Retry(w http.ResponseWriter, r *http.Request) {
+	// Grab URL parameter
+	stringParameter := chi.URLParam(r, "id")
+	// Convert to int
+	idParameter, err := strconv.Atoi(stringParameter)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	// Re-queue job
+	requeued, err := c.service.Requeue(idParameter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to re-queue job: %s", err), http.StatusBadRequest)
+		return
+	}
+	// Write job to output
+	err = request.WriteAsJSON(w, requeued)
+	if err != nil {
+		fmt.Printf("Error encountered when writing to JSON. Err: %s", err)
+	}
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/dmawardi/Go-Template/internal/auth"
+	"github.com/dmawardi/Go-Template/internal/helpers/request"
+	coreservices "github.com/dmawardi/Go-Template/internal/service/core"
+	"github.com/go-chi/chi/v5"
+)
+
+// @Summary      Find my sessions
+// @Description  Returns the current user's active sessions (devices logged in with a password), with where and when each was last active. The session of the current request is marked as current
+// @Tags         My Profile
+// @Accept       json
+// @Produce      json
+// @Success      200 {array} models.UserSession
+// @Failure      400 {string} string "Failed to find sessions"
+// @Failure      403 {string} string "Error parsing authentication token"
+// @Router       /me/sessions [get]
+// @Security BearerToken
+func (c userController) FindMySessions(w http.ResponseWriter, r *http.Request) {
+	tokenData, userId, err := sessionFromToken(r)
+	if err != nil {
+		http.Error(w, "Error parsing authentication token", http.StatusForbidden)
+		return
+	}
+
+	sessions, err := c.service.FindSessions(userId, tokenData.SessionID)
+	if err != nil {
+		fmt.Println("Error finding sessions: ", err)
+		http.Error(w, "Failed to find sessions", http.StatusBadRequest)
+		return
+	}
+
+	request.WriteAsJSON(w, sessions)
+}
+
+// @Summary      Revoke session
+// @Description  Logs out one of the current user's sessions. Its access and refresh tokens are rejected from the next request
+// @Tags         My Profile
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "Session ID"
+// @Success      200 {string} string "Session revoked"
+// @Failure      400 {string} string "Failed to revoke session"
+// @Failure      403 {string} string "Error parsing authentication token"
+// @Failure      404 {string} string "Session not found"
+// @Router       /me/sessions/{id} [delete]
+// @Security BearerToken
+func (c userController) RevokeMySession(w http.ResponseWriter, r *http.Request) {
+	userId, err := userIdFromToken(r)
+	if err != nil {
+		http.Error(w, "Error parsing authentication token", http.StatusForbidden)
+		return
+	}
+	// Grab URL parameter
+	sessionId, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	err = c.service.RevokeSession(userId, sessionId)
+	if errors.Is(err, coreservices.ErrSessionNotFound) {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error revoking session: ", err)
+		http.Error(w, "Failed to revoke session", http.StatusBadRequest)
+		return
+	}
+
+	request.WriteAsJSON(w, "Session revoked")
+}
+
+// @Summary      Revoke other sessions
+// @Description  Logs out all of the current user's sessions except the session of the current request. API keys can't be used, as they aren't part of a session
+// @Tags         My Profile
+// @Accept       json
+// @Produce      json
+// @Success      200 {string} string "Other sessions revoked"
+// @Failure      400 {string} string "Failed to revoke sessions"
+// @Failure      400 {string} string "Other sessions can only be revoked from a login session"
+// @Failure      403 {string} string "Error parsing authentication token"
+// @Router       /me/sessions [delete]
+// @Security BearerToken
+func (c userController) RevokeMyOtherSessions(w http.ResponseWriter, r *http.Request) {
+	tokenData, userId, err := sessionFromToken(r)
+	if err != nil {
+		http.Error(w, "Error parsing authentication token", http.StatusForbidden)
+		return
+	}
+
+	err = c.service.RevokeOtherSessions(userId, tokenData.SessionID)
+	if errors.Is(err, coreservices.ErrNoCurrentSession) {
+		http.Error(w, "Other sessions can only be revoked from a login session", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error revoking sessions: ", err)
+		http.Error(w, "Failed to revoke sessions", http.StatusBadRequest)
+		return
+	}
+
+	request.WriteAsJSON(w, "Other sessions revoked")
+}
+
+// Extracts the token's details (including its session) and the user's id
+func sessionFromToken(r *http.Request) (*auth.AuthToken, int, error) {
+	tokenData, err := auth.ValidateAndParseToken(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	userId, err := strconv.Atoi(tokenData.UserID)
+	if err != nil {
+		return nil, 0, err
+	}
+	return tokenData, userId, nil
+}
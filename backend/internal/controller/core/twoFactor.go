@@ -0,0 +1,231 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/dmawardi/Go-Template/internal/auth"
+	"github.com/dmawardi/Go-Template/internal/helpers/request"
+	"github.com/dmawardi/Go-Template/internal/models"
+	coreservices "github.com/dmawardi/Go-Template/internal/service/core"
+)
+
+// Verify two factor login
+// Handler to complete a login with a two factor code
+// @Summary      Complete two factor login
+// @Description  Completes a login for a user with two factor authentication, using the two_factor_token returned by login and a code from their authenticator app (or a recovery code). The token expires after 5 minutes, and is revoked after 5 invalid codes. Invalid codes count as failed logins for the account and IP address, returning 429 with a Retry-After header once throttled.
+// @Tags         Login
+// @Accept       json
+// @Produce      json
+// @Param        login body models.TwoFactorLogin true "Two Factor Login Form"
+// @Success      200 {object} models.LoginResponse
+// @Failure      400 {string} string "Two factor login failed"
+// @Failure      400 {object} models.ValidationError "Validation Errors"
+// @Failure      401 {string} string "Invalid or expired code"
+// @Failure      429 {string} string "Too many login attempts. Try again later"
+// @Router       /users/login/2fa [post]
+func (c userController) VerifyTwoFactor(w http.ResponseWriter, r *http.Request) {
+	// Grab two factor token and code from request body
+	var login models.TwoFactorLogin
+	err := json.NewDecoder(r.Body).Decode(&login)
+	if err != nil {
+		fmt.Println("Decoding error: ", err)
+		http.Error(w, "Two factor login failed", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the incoming DTO
+	pass, valErrors := request.GoValidateStruct(&login)
+	// If failure detected
+	if !pass {
+		// Write bad request header
+		w.WriteHeader(http.StatusBadRequest)
+		// Write validation errors to JSON
+		request.WriteAsJSON(w, valErrors)
+		return
+	}
+	// else, validation passes and allow through
+	login.IPAddress = request.ClientIP(r)
+	login.UserAgent = r.UserAgent()
+	loginResponse, err := c.service.VerifyTwoFactorLogin(&login)
+	// Too many failed attempts for the account or IP address
+	var throttled *coreservices.LoginThrottledError
+	if errors.As(err, &throttled) {
+		w.Header().Set("Retry-After", fmt.Sprint(int(throttled.RetryAfter.Seconds())))
+		http.Error(w, "Too many login attempts. Try again later", http.StatusTooManyRequests)
+		return
+	}
+	if errors.Is(err, coreservices.ErrInvalidTwoFactorCode) {
+		http.Error(w, "Invalid or expired code", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error verifying two factor code: ", err)
+		http.Error(w, "Two factor login failed", http.StatusBadRequest)
+		return
+	}
+
+	// Send access and refresh tokens to user in body
+	request.WriteAsJSON(w, loginResponse)
+}
+
+// @Summary      Set up two factor authentication
+// @Description  Returns a secret and otpauth URI (shown as a QR code) to add to an authenticator app. Two factor authentication is enabled once a code is confirmed (see /me/2fa/confirm).
+// @Tags         My Profile
+// @Accept       json
+// @Produce      json
+// @Success      200 {object} models.TwoFactorEnrollment
+// @Failure      400 {string} string "Two factor setup failed"
+// @Failure      403 {string} string "Error parsing authentication token"
+// @Failure      409 {string} string "Two factor authentication already enabled"
+// @Router       /me/2fa/enroll [post]
+// @Security BearerToken
+func (c userController) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userId, err := userIdFromToken(r)
+	if err != nil {
+		http.Error(w, "Error parsing authentication token", http.StatusForbidden)
+		return
+	}
+
+	enrollment, err := c.service.EnrollTwoFactor(userId)
+	if errors.Is(err, coreservices.ErrTwoFactorAlreadyEnabled) {
+		http.Error(w, "Two factor authentication already enabled", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error enrolling in two factor authentication: ", err)
+		http.Error(w, "Two factor setup failed", http.StatusBadRequest)
+		return
+	}
+
+	request.WriteAsJSON(w, enrollment)
+}
+
+// @Summary      Enable two factor authentication
+// @Description  Enables two factor authentication with a code from the authenticator app, returning recovery codes (only shown once). Invalid codes are delayed and then locked, returning 429 with a Retry-After header
+// @Tags         My Profile
+// @Accept       json
+// @Produce      json
+// @Param        code body models.TwoFactorCode true "Two Factor Code"
+// @Success      200 {object} models.TwoFactorRecoveryCodes
+// @Failure      400 {string} string "Invalid code"
+// @Failure      400 {object} models.ValidationError "Validation Errors"
+// @Failure      403 {string} string "Error parsing authentication token"
+// @Failure      409 {string} string "Two factor authentication already enabled"
+// @Failure      429 {string} string "Too many invalid codes. Try again later"
+// @Router       /me/2fa/confirm [post]
+// @Security BearerToken
+func (c userController) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userId, err := userIdFromToken(r)
+	if err != nil {
+		http.Error(w, "Error parsing authentication token", http.StatusForbidden)
+		return
+	}
+	code, ok := decodeTwoFactorCode(w, r)
+	if !ok {
+		return
+	}
+
+	recoveryCodes, err := c.service.ConfirmTwoFactor(userId, code.Code)
+	// Too many invalid codes
+	var throttled *coreservices.LoginThrottledError
+	if errors.As(err, &throttled) {
+		w.Header().Set("Retry-After", fmt.Sprint(int(throttled.RetryAfter.Seconds())))
+		http.Error(w, "Too many invalid codes. Try again later", http.StatusTooManyRequests)
+		return
+	}
+	if errors.Is(err, coreservices.ErrTwoFactorAlreadyEnabled) {
+		http.Error(w, "Two factor authentication already enabled", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, coreservices.ErrTwoFactorNotEnrolled) {
+		http.Error(w, "Two factor authentication not set up", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error confirming two factor authentication: ", err)
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	request.WriteAsJSON(w, recoveryCodes)
+}
+
+// @Summary      Disable two factor authentication
+// @Description  Disables two factor authentication with a code from the authenticator app (or a recovery code). Invalid codes are delayed and then locked, returning 429 with a Retry-After header. Users with a role in TWO_FACTOR_REQUIRED_ROLES are logged out of all sessions
+// @Tags         My Profile
+// @Accept       json
+// @Produce      json
+// @Param        code body models.TwoFactorCode true "Two Factor Code"
+// @Success      200 {string} string "Two factor authentication disabled"
+// @Failure      400 {string} string "Invalid code"
+// @Failure      400 {object} models.ValidationError "Validation Errors"
+// @Failure      403 {string} string "Error parsing authentication token"
+// @Failure      429 {string} string "Too many invalid codes. Try again later"
+// @Router       /me/2fa/disable [post]
+// @Security BearerToken
+func (c userController) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userId, err := userIdFromToken(r)
+	if err != nil {
+		http.Error(w, "Error parsing authentication token", http.StatusForbidden)
+		return
+	}
+	code, ok := decodeTwoFactorCode(w, r)
+	if !ok {
+		return
+	}
+
+	err = c.service.DisableTwoFactor(userId, code.Code)
+	// Too many invalid codes
+	var throttled *coreservices.LoginThrottledError
+	if errors.As(err, &throttled) {
+		w.Header().Set("Retry-After", fmt.Sprint(int(throttled.RetryAfter.Seconds())))
+		http.Error(w, "Too many invalid codes. Try again later", http.StatusTooManyRequests)
+		return
+	}
+	if errors.Is(err, coreservices.ErrTwoFactorNotEnabled) {
+		http.Error(w, "Two factor authentication not enabled", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error disabling two factor authentication: ", err)
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	request.WriteAsJSON(w, "Two factor authentication disabled")
+}
+
+// Extracts the user's id from their authentication token
+func userIdFromToken(r *http.Request) (int, error) {
+	tokenData, err := auth.ValidateAndParseToken(r)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(tokenData.UserID)
+}
+
+// Decodes and validates a two factor code from the request body, writing the error response if invalid
+func decodeTwoFactorCode(w http.ResponseWriter, r *http.Request) (*models.TwoFactorCode, bool) {
+	var code models.TwoFactorCode
+	err := json.NewDecoder(r.Body).Decode(&code)
+	if err != nil {
+		fmt.Println("Decoding error: ", err)
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return nil, false
+	}
+
+	// Validate the incoming DTO
+	pass, valErrors := request.GoValidateStruct(&code)
+	if !pass {
+		// Write bad request header
+		w.WriteHeader(http.StatusBadRequest)
+		// Write validation errors to JSON
+		request.WriteAsJSON(w, valErrors)
+		return nil, false
+	}
+	return &code, true
+}
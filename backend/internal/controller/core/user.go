@@ -2,7 +2,9 @@ package core
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 
@@ -19,13 +21,31 @@ type UserController interface {
 	Create(w http.ResponseWriter, r *http.Request)
 	Update(w http.ResponseWriter, r *http.Request)
 	Delete(w http.ResponseWriter, r *http.Request)
+	// Unlock account (after failed logins)
+	Unlock(w http.ResponseWriter, r *http.Request)
 	// API/ME
 	GetMyUserDetails(w http.ResponseWriter, r *http.Request)
 	UpdateMyProfile(w http.ResponseWriter, r *http.Request)
 	// Login
 	Login(w http.ResponseWriter, r *http.Request)
+	Refresh(w http.ResponseWriter, r *http.Request)
+	Logout(w http.ResponseWriter, r *http.Request)
+	// Two factor authentication
+	VerifyTwoFactor(w http.ResponseWriter, r *http.Request)
+	EnrollTwoFactor(w http.ResponseWriter, r *http.Request)
+	ConfirmTwoFactor(w http.ResponseWriter, r *http.Request)
+	DisableTwoFactor(w http.ResponseWriter, r *http.Request)
+	// API keys
+	FindMyApiKeys(w http.ResponseWriter, r *http.Request)
+	CreateApiKey(w http.ResponseWriter, r *http.Request)
+	RevokeApiKey(w http.ResponseWriter, r *http.Request)
+	// Sessions
+	FindMySessions(w http.ResponseWriter, r *http.Request)
+	RevokeMySession(w http.ResponseWriter, r *http.Request)
+	RevokeMyOtherSessions(w http.ResponseWriter, r *http.Request)
 	// Reset password
 	ResetPassword(w http.ResponseWriter, r *http.Request)
+	ConfirmResetPassword(w http.ResponseWriter, r *http.Request)
 	// Email Verification
 	ResendVerificationEmail(w http.ResponseWriter, r *http.Request)
 	EmailVerification(w http.ResponseWriter, r *http.Request)
@@ -70,6 +90,8 @@ func UserConditionQueryParams() map[string]string {
 // @Failure      400 {string} string "Can't find users"
 // @Failure      400 {string} string "Must include limit parameter with a max value of 50"
 // @Failure      400 {string} string "Error extracting query params"
+// @Param        If-None-Match   header      string  false  "ETag of the cached response (304 if unchanged)"
+// @Success      304 {string} string "Not modified"
 // @Router       /users [get]
 // @Security BearerToken
 func (c userController) FindAll(w http.ResponseWriter, r *http.Request) {
@@ -111,6 +133,8 @@ func (c userController) FindAll(w http.ResponseWriter, r *http.Request) {
 // @Param        id   path      int  true  "User ID"
 // @Success      200 {object} models.UserWithRole
 // @Failure      400 {string} string "Can't find user with ID: {id}"
+// @Param        If-None-Match   header      string  false  "ETag of the cached response (304 if unchanged)"
+// @Success      304 {string} string "Not modified"
 // @Router       /users/{id} [get]
 // @Security BearerToken
 func (c userController) Find(w http.ResponseWriter, r *http.Request) {
@@ -197,6 +221,8 @@ func (c userController) Create(w http.ResponseWriter, r *http.Request) {
 // @Failure      400 {object} models.ValidationError "Validation Errors"
 // @Failure      400 {string} string "Failed user update"
 // @Failure      403 {string} string "Authentication Token not detected"
+// @Param        If-Match   header      string  false  "ETag of the version being changed"
+// @Failure      412 {string} string "Resource has been modified"
 // @Router       /users/{id} [put]
 // @Security BearerToken
 func (c userController) Update(w http.ResponseWriter, r *http.Request) {
@@ -226,7 +252,12 @@ func (c userController) Update(w http.ResponseWriter, r *http.Request) {
 	idParameter, _ := strconv.Atoi(stringParameter)
 
 	// Update user
-	updated, createErr := c.service.Update(idParameter, &toUpdate)
+	updated, createErr := c.service.Update(idParameter, &toUpdate, request.ExpectedVersion(r))
+	// If the user changed after the If-Match header was checked
+	if errors.Is(createErr, models.ErrRecordModified) {
+		http.Error(w, "Resource has been modified", http.StatusPreconditionFailed)
+		return
+	}
 	if createErr != nil {
 		http.Error(w, fmt.Sprintf("Failed user update: %s", createErr), http.StatusBadRequest)
 		return
@@ -246,6 +277,8 @@ func (c userController) Update(w http.ResponseWriter, r *http.Request) {
 // @Param        id   path      int  true  "User ID"
 // @Success      200 {string} string "Deletion successful!"
 // @Failure      400 {string} string "Failed user deletion"
+// @Param        If-Match   header      string  false  "ETag of the version being changed"
+// @Failure      412 {string} string "Resource has been modified"
 // @Router       /users/{id} [delete]
 // @Security BearerToken
 func (c userController) Delete(w http.ResponseWriter, r *http.Request) {
@@ -255,8 +288,12 @@ func (c userController) Delete(w http.ResponseWriter, r *http.Request) {
 	idParameter, _ := strconv.Atoi(stringParameter)
 
 	// Attampt to delete user using id
-	err := c.service.Delete(idParameter)
-
+	err := c.service.Delete(idParameter, request.ExpectedVersion(r))
+	// If the user changed after the If-Match header was checked
+	if errors.Is(err, models.ErrRecordModified) {
+		http.Error(w, "Resource has been modified", http.StatusPreconditionFailed)
+		return
+	}
 	// If error detected
 	if err != nil {
 		http.Error(w, "Failed user deletion", http.StatusBadRequest)
@@ -266,6 +303,36 @@ func (c userController) Delete(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("Deletion successful!"))
 }
 
+// @Summary      Unlock User
+// @Description  Unlocks a user's account after failed logins, clearing its failed attempts
+// @Tags         User
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "User ID"
+// @Success      200 {string} string "Account unlocked"
+// @Failure      400 {string} string "Invalid ID"
+// @Failure      404 {string} string "Can't find user with ID: {id}"
+// @Router       /users/{id}/unlock [post]
+// @Security BearerToken
+func (c userController) Unlock(w http.ResponseWriter, r *http.Request) {
+	// Grab URL parameter
+	stringParameter := chi.URLParam(r, "id")
+	// Convert to int
+	idParameter, err := strconv.Atoi(stringParameter)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	err = c.service.UnlockUser(idParameter)
+	if err != nil {
+		fmt.Println("Error unlocking user: ", err)
+		http.Error(w, fmt.Sprintf("Can't find user with ID: %v\n", idParameter), http.StatusNotFound)
+		return
+	}
+	request.WriteAsJSON(w, "Account unlocked")
+}
+
 // API/ME
 //
 // @Summary      Update my profile
@@ -279,6 +346,8 @@ func (c userController) Delete(w http.ResponseWriter, r *http.Request) {
 // @Failure      400 {string} string "Failed user update"
 // @Failure      403 {string} string "Authentication Token not detected"
 // @Failure      400 {string} string "Bad request"
+// @Param        If-Match   header      string  false  "ETag of the version being changed"
+// @Failure      412 {string} string "Resource has been modified"
 // @Router       /me [put]
 // @Security BearerToken
 func (c userController) UpdateMyProfile(w http.ResponseWriter, r *http.Request) {
@@ -320,7 +389,12 @@ func (c userController) UpdateMyProfile(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Update user
-	updated, createErr := c.service.Update(userId, &toUpdate)
+	updated, createErr := c.service.Update(userId, &toUpdate, request.ExpectedVersion(r))
+	// If the user changed after the If-Match header was checked
+	if errors.Is(createErr, models.ErrRecordModified) {
+		http.Error(w, "Resource has been modified", http.StatusPreconditionFailed)
+		return
+	}
 	if createErr != nil {
 		http.Error(w, fmt.Sprintf("Failed user update: %s", createErr), http.StatusBadRequest)
 		return
@@ -341,6 +415,8 @@ func (c userController) UpdateMyProfile(w http.ResponseWriter, r *http.Request)
 // @Success      200 {object} models.UserWithRole
 // @Failure      400 {string} string "Can't find user details"
 // @Failure      403 {string} string "Error parsing authentication token"
+// @Param        If-None-Match   header      string  false  "ETag of the cached response (304 if unchanged)"
+// @Success      304 {string} string "Not modified"
 // @Router       /me [get]
 // @Security BearerToken
 func (c userController) GetMyUserDetails(w http.ResponseWriter, r *http.Request) {
@@ -379,7 +455,7 @@ func (c userController) GetMyUserDetails(w http.ResponseWriter, r *http.Request)
 // Login
 // Handler to login with existing user
 // @Summary      Login
-// @Description  Log in to user account
+// @Description  Log in to user account. Failed attempts are delayed and then locked (per account and IP address), returning 429 with a Retry-After header
 // @Tags         Login
 // @Accept       json
 // @Produce      json
@@ -388,6 +464,7 @@ func (c userController) GetMyUserDetails(w http.ResponseWriter, r *http.Request)
 // @Failure      400 {object} models.ValidationError "Validation Errors"
 // @Failure      401 {string} string "Invalid Credentials"
 // @Failure      405 {string} string "Method not supported"
+// @Failure      429 {string} string "Too many login attempts. Try again later"
 // @Router       /users/login [post]
 func (c userController) Login(w http.ResponseWriter, r *http.Request) {
 	// Deny any request that is not a post
@@ -415,23 +492,123 @@ func (c userController) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// else, validation passes and allow through
-	tokenString, err := c.service.LoginUser(&login)
+	login.IPAddress = request.ClientIP(r)
+	login.UserAgent = r.UserAgent()
+	loginResponse, err := c.service.LoginUser(&login)
+	// Too many failed attempts for the account or IP address
+	var throttled *coreservices.LoginThrottledError
+	if errors.As(err, &throttled) {
+		w.Header().Set("Retry-After", fmt.Sprint(int(throttled.RetryAfter.Seconds())))
+		http.Error(w, "Too many login attempts. Try again later", http.StatusTooManyRequests)
+		return
+	}
 	if err != nil {
 		fmt.Printf("Error logging in: %s", err)
 		http.Error(w, "Invalid Credentials", http.StatusUnauthorized)
 		return
 	}
 
-	// Build login response
-	var loginResponse = models.LoginResponse{Token: tokenString}
-	// Send to user in body
+	// Send access and refresh tokens to user in body
+	request.WriteAsJSON(w, loginResponse)
+}
+
+// Refresh
+// Handler to exchange a refresh token for a new access token
+// @Summary      Refresh access token
+// @Description  Exchanges a refresh token for a new access token and refresh token. Each refresh token can only be used once: reusing a token revokes every token issued from the same login.
+// @Tags         Login
+// @Accept       json
+// @Produce      json
+// @Param        refresh body models.RefreshTokenRequest true "Refresh Token Form"
+// @Success      200 {object} models.LoginResponse
+// @Failure      400 {string} string "Token refresh failed"
+// @Failure      400 {object} models.ValidationError "Validation Errors"
+// @Failure      401 {string} string "Invalid or expired refresh token"
+// @Router       /users/refresh [post]
+func (c userController) Refresh(w http.ResponseWriter, r *http.Request) {
+	// Grab refresh token from request body
+	var refresh models.RefreshTokenRequest
+	err := json.NewDecoder(r.Body).Decode(&refresh)
+	if err != nil {
+		fmt.Println("Decoding error: ", err)
+		http.Error(w, "Token refresh failed", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the incoming DTO
+	pass, valErrors := request.GoValidateStruct(&refresh)
+	// If failure detected
+	if !pass {
+		// Write bad request header
+		w.WriteHeader(http.StatusBadRequest)
+		// Write validation errors to JSON
+		request.WriteAsJSON(w, valErrors)
+		return
+	}
+	// else, validation passes and allow through
+	loginResponse, err := c.service.RefreshAccessToken(refresh.RefreshToken)
+	if errors.Is(err, coreservices.ErrInvalidRefreshToken) || errors.Is(err, coreservices.ErrRefreshTokenReused) {
+		http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error refreshing token: ", err)
+		http.Error(w, "Token refresh failed", http.StatusBadRequest)
+		return
+	}
+
 	request.WriteAsJSON(w, loginResponse)
 }
 
+// Logout
+// Handler to revoke the user's access token (and refresh token)
+// @Summary      Logout
+// @Description  Revokes the access token used for the request. If a refresh token is provided, every token issued from the same login is revoked.
+// @Tags         Login
+// @Accept       json
+// @Produce      json
+// @Param        logout body models.LogoutRequest false "Logout Form"
+// @Success      200 {string} string "Logged out successfully"
+// @Failure      400 {string} string "Logout failed"
+// @Failure      400 {string} string "API keys can't log out, revoke the key instead"
+// @Failure      403 {string} string "Error parsing authentication token"
+// @Router       /users/logout [post]
+// @Security BearerToken
+func (c userController) Logout(w http.ResponseWriter, r *http.Request) {
+	// Extract the token's details
+	tokenData, err := auth.ValidateAndParseToken(r)
+	if err != nil {
+		http.Error(w, "Error parsing authentication token", http.StatusForbidden)
+		return
+	}
+
+	// Grab refresh token from request body (optional)
+	var logout models.LogoutRequest
+	err = json.NewDecoder(r.Body).Decode(&logout)
+	if err != nil && !errors.Is(err, io.EOF) {
+		fmt.Println("Decoding error: ", err)
+		http.Error(w, "Logout failed", http.StatusBadRequest)
+		return
+	}
+
+	err = c.service.Logout(tokenData, logout.RefreshToken)
+	if errors.Is(err, coreservices.ErrApiKeyLogout) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error logging out: ", err)
+		http.Error(w, "Logout failed", http.StatusBadRequest)
+		return
+	}
+
+	request.WriteAsJSON(w, "Logged out successfully")
+}
+
 // Reset password
-// Handler to reset password
+// Handler to request a password reset (emails a reset link)
 // @Summary      Reset password
-// @Description  Reset password
+// @Description  Emails a single use password reset link to the user
 // @Tags         Login
 // @Accept       json
 // @Produce      json
@@ -472,6 +649,54 @@ func (c userController) ResetPassword(w http.ResponseWriter, r *http.Request) {
 	request.WriteAsJSON(w, "Password reset request successful!")
 }
 
+// Handler to set a new password using the token from a password reset email
+// @Summary      Confirm password reset
+// @Description  Sets a new password using the token from a password reset email. Tokens can only be used once and expire after an hour.
+// @Tags         Login
+// @Accept       json
+// @Produce      json
+// @Param        reset body models.ConfirmPasswordReset true "Confirm Password Reset Form"
+// @Success      200 {string} string "Password reset successful!"
+// @Failure      400 {string} string "Password reset failed"
+// @Failure      400 {object} models.ValidationError "Validation Errors"
+// @Failure      401 {string} string "Invalid or expired token"
+// @Router       /users/reset-password/confirm [post]
+func (c userController) ConfirmResetPassword(w http.ResponseWriter, r *http.Request) {
+	// Grab token and new password from request body
+	var confirmReset models.ConfirmPasswordReset
+	err := json.NewDecoder(r.Body).Decode(&confirmReset)
+	if err != nil {
+		fmt.Println("Decoding error: ", err)
+		http.Error(w, "Password reset failed", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the incoming DTO
+	pass, valErrors := request.GoValidateStruct(&confirmReset)
+	// If failure detected
+	if !pass {
+		// Write bad request header
+		w.WriteHeader(http.StatusBadRequest)
+		// Write validation errors to JSON
+		request.WriteAsJSON(w, valErrors)
+		return
+	}
+	// else, validation passes and allow through
+	err = c.service.ConfirmPasswordReset(confirmReset.Token, confirmReset.Password)
+	if errors.Is(err, coreservices.ErrInvalidPasswordResetToken) {
+		http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error resetting password: ", err)
+		http.Error(w, "Password reset failed", http.StatusBadRequest)
+		return
+	}
+
+	// Else
+	request.WriteAsJSON(w, "Password reset successful!")
+}
+
 // Email Verification
 // @Summary      Email Verification
 // @Description  Email Verification
@@ -0,0 +1,97 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers"
+	"github.com/dmawardi/Go-Template/internal/models"
+)
+
+func TestEmailLogController_FindAll(t *testing.T) {
+	emailLogs := []db.EmailLog{
+		{UserID: 601, Recipient: "support@example.com", Subject: "Password Reset Request", Template: "password-reset", Status: db.EmailStatusFailed, Response: "550 mailbox unavailable"},
+		{UserID: 601, Recipient: "support@example.com", Subject: "Please Verify your Email", Template: "email-verification", Status: db.EmailStatusSent},
+		{UserID: 602, Recipient: "other@example.com", Subject: "Password Reset Request", Template: "password-reset", Status: db.EmailStatusFailed},
+	}
+	if err := testModule.dbClient.Create(&emailLogs).Error; err != nil {
+		t.Fatalf("failed to create test email logs: %v", err)
+	}
+
+	var tests = []struct {
+		title                  string
+		query                  string
+		token                  string
+		expectedResponseStatus int
+		expectedIDs            []uint
+	}{
+		{"Admin can search a user's emails", "user_id=601", testModule.accounts.admin.token, http.StatusOK, []uint{emailLogs[0].ID, emailLogs[1].ID}},
+		{"Filters narrow a user's emails", "user_id=601&status=failed&search=mailbox", testModule.accounts.admin.token, http.StatusOK, []uint{emailLogs[0].ID}},
+		{"Invalid user ID", "user_id=abc", testModule.accounts.admin.token, http.StatusBadRequest, nil},
+		{"Basic user is forbidden", "user_id=601", testModule.accounts.user.token, http.StatusForbidden, nil},
+	}
+	for _, v := range tests {
+		req, err := helpers.BuildApiRequest("GET", "email-logs?limit=10&"+v.query, nil, true, v.token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Create a response recorder
+		rr := httptest.NewRecorder()
+		// Use handler with recorder and created request
+		testModule.router.ServeHTTP(rr, req)
+
+		// Check the response status code
+		if status := rr.Code; status != v.expectedResponseStatus {
+			t.Errorf("In test '%s': handler returned wrong status code: got %v want %v", v.title, status, v.expectedResponseStatus)
+			continue
+		}
+		if v.expectedResponseStatus != http.StatusOK {
+			continue
+		}
+
+		// Convert response JSON to struct
+		var body *models.BasicPaginatedResponse[db.EmailLog]
+		json.Unmarshal(rr.Body.Bytes(), &body)
+		var foundIDs []uint
+		for _, emailLog := range *body.Data {
+			foundIDs = append(foundIDs, emailLog.ID)
+		}
+		if fmt.Sprint(foundIDs) != fmt.Sprint(v.expectedIDs) {
+			t.Errorf("In test '%s': expected email logs %v, got %v", v.title, v.expectedIDs, foundIDs)
+		}
+	}
+
+	// Clean up
+	testModule.dbClient.Unscoped().Delete(&emailLogs)
+}
+
+func TestAdminEmailLogController_FindAll(t *testing.T) {
+	emailLog := &db.EmailLog{UserID: 603, Recipient: "admin-view@example.com", Subject: "Password Reset Request", Template: "password-reset", Status: db.EmailStatusSent}
+	if err := testModule.dbClient.Create(emailLog).Error; err != nil {
+		t.Fatalf("failed to create test email log: %v", err)
+	}
+
+	req, err := http.NewRequest("GET", "/admin/email-logs?user_id=603", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("bearer %v", testModule.accounts.admin.token))
+	rr := httptest.NewRecorder()
+	testModule.router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	// The user's emails are listed and the user filter is kept when searching
+	if !strings.Contains(rr.Body.String(), "admin-view@example.com") || !strings.Contains(rr.Body.String(), `name="user_id" value="603"`) {
+		t.Errorf("expected user's email log and filter in page")
+	}
+
+	// Clean up
+	testModule.dbClient.Unscoped().Delete(emailLog)
+}
@@ -0,0 +1,113 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers"
+	"github.com/dmawardi/Go-Template/internal/models"
+)
+
+func TestJobController_FindAll(t *testing.T) {
+	// Create a dead job (and jobs only matching one of the filters)
+	dead := &db.Job{JobType: "email", Payload: "{}", Status: db.JobStatusDead, Attempts: 5, LastError: "timeout"}
+	pending := &db.Job{JobType: "email", Payload: "{}", Status: db.JobStatusPending}
+	otherDead := &db.Job{JobType: "purge-sessions", Payload: "{}", Status: db.JobStatusDead, Attempts: 5, LastError: "timeout"}
+	for _, job := range []*db.Job{dead, pending, otherDead} {
+		if err := testModule.dbClient.Create(job).Error; err != nil {
+			t.Fatalf("failed to create test job: %v", err)
+		}
+	}
+
+	var tests = []struct {
+		title                  string
+		token                  string
+		expectedResponseStatus int
+	}{
+		{"Admin can list dead jobs", testModule.accounts.admin.token, http.StatusOK},
+		{"Basic user is forbidden", testModule.accounts.user.token, http.StatusForbidden},
+	}
+	for _, v := range tests {
+		req, err := helpers.BuildApiRequest("GET", "jobs?limit=10&job_type=email&status=dead", nil, true, v.token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Create a response recorder
+		rr := httptest.NewRecorder()
+		// Use handler with recorder and created request
+		testModule.router.ServeHTTP(rr, req)
+
+		// Check the response status code
+		if status := rr.Code; status != v.expectedResponseStatus {
+			t.Errorf("In test '%s': handler returned wrong status code: got %v want %v", v.title, status, v.expectedResponseStatus)
+			continue
+		}
+		if v.expectedResponseStatus != http.StatusOK {
+			continue
+		}
+
+		// Convert response JSON to struct
+		var body *models.BasicPaginatedResponse[db.Job]
+		json.Unmarshal(rr.Body.Bytes(), &body)
+		// Only jobs matching both filters are returned
+		if len(*body.Data) != 1 || (*body.Data)[0].ID != dead.ID {
+			t.Errorf("In test '%s': expected only dead email job %d to be returned, got %v", v.title, dead.ID, *body.Data)
+		}
+	}
+
+	// Clean up
+	testModule.dbClient.Unscoped().Delete(&db.Job{}, []uint{dead.ID, pending.ID, otherDead.ID})
+}
+
+func TestJobController_Retry(t *testing.T) {
+	// Create a dead and a pending job
+	dead := &db.Job{JobType: "email", Payload: "{}", Status: db.JobStatusDead, Attempts: 5, LastError: "timeout"}
+	pending := &db.Job{JobType: "email", Payload: "{}"}
+	for _, job := range []*db.Job{dead, pending} {
+		if err := testModule.dbClient.Create(job).Error; err != nil {
+			t.Fatalf("failed to create test job: %v", err)
+		}
+	}
+
+	var tests = []struct {
+		title                  string
+		id                     uint
+		token                  string
+		expectedResponseStatus int
+	}{
+		{"Basic user is forbidden", dead.ID, testModule.accounts.user.token, http.StatusForbidden},
+		{"Admin re-queues dead job", dead.ID, testModule.accounts.admin.token, http.StatusOK},
+		{"Fail: Job is not dead", pending.ID, testModule.accounts.admin.token, http.StatusBadRequest},
+	}
+	for _, v := range tests {
+		req, err := helpers.BuildApiRequest("POST", fmt.Sprintf("jobs/retry/%d", v.id), nil, true, v.token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Create a response recorder
+		rr := httptest.NewRecorder()
+		// Use handler with recorder and created request
+		testModule.router.ServeHTTP(rr, req)
+
+		// Check the response status code
+		if status := rr.Code; status != v.expectedResponseStatus {
+			t.Errorf("In test '%s': handler returned wrong status code: got %v want %v", v.title, status, v.expectedResponseStatus)
+		}
+	}
+
+	// Check job is back in the queue
+	found, err := testModule.jobs.serv.FindById(int(dead.ID))
+	if err != nil {
+		t.Fatalf("failed to find re-queued job: %v", err)
+	}
+	if found.Status != db.JobStatusPending {
+		t.Errorf("expected re-queued job status %q, got %q", db.JobStatusPending, found.Status)
+	}
+
+	// Clean up
+	testModule.dbClient.Unscoped().Delete(&[]db.Job{*dead, *pending})
+}
@@ -0,0 +1,164 @@
+package controller_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/auth"
+	"github.com/dmawardi/Go-Template/internal/helpers"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestJWKS(t *testing.T) {
+	// Keys directory with an Ed25519 (previous) and RSA (current) key
+	keysDir := t.TempDir()
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePrivateKey(t, filepath.Join(keysDir, "2026-01.pem"), edKey)
+	writePrivateKey(t, filepath.Join(keysDir, "2026-02.pem"), rsaKey)
+
+	// Tokens signed with the HMAC secret (before switching to asymmetric keys) are still accepted
+	t.Setenv("JWT_KEYS_DIR", keysDir)
+	t.Setenv("HMAC_SECRET", "test-secret")
+	t.Cleanup(func() { auth.SetKeyRing(auth.NewHMACKeyRing([]byte("test-secret"))) })
+
+	// Sign with the previous key, then rotate
+	useKeyRing(t, "2026-01")
+	user := testModule.accounts.user.details
+	previousToken, err := auth.GenerateJWT(int(user.ID), user.Email, user.Role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	useKeyRing(t, "2026-02")
+	currentToken, err := auth.GenerateJWT(int(user.ID), user.Email, user.Role)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A token signed with the RSA public key as an HMAC secret
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &auth.AuthToken{
+		UserID:           fmt.Sprint(user.ID),
+		Email:            user.Email,
+		Role:             "admin",
+		RegisteredClaims: jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(time.Now()), ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+	})
+	forged.Header["kid"] = "2026-02"
+	forgedToken, err := forged.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		title                  string
+		token                  string
+		expectedResponseStatus int
+	}{
+		{"Token signed with the current key is accepted", currentToken, http.StatusOK},
+		{"Token signed with the previous key is accepted during rotation", previousToken, http.StatusOK},
+		{"Token signed with the HMAC secret is accepted", testModule.accounts.user.token, http.StatusOK},
+		{"Token signed with a public key as an HMAC secret is rejected", forgedToken, http.StatusForbidden},
+	}
+	for _, v := range tests {
+		if status := requestMyDetails(t, v.token); status != v.expectedResponseStatus {
+			t.Errorf("In test '%s': handler returned wrong status code: got %v want %v", v.title, status, v.expectedResponseStatus)
+		}
+	}
+
+	// Public keys are served for other services
+	req := httptest.NewRequest("GET", "/.well-known/jwks.json", nil)
+	rr := httptest.NewRecorder()
+	testModule.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("JWKS returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var keySet auth.JSONWebKeySet
+	if err := json.Unmarshal(rr.Body.Bytes(), &keySet); err != nil {
+		t.Fatal(err)
+	}
+	// The HMAC secret isn't published
+	if len(keySet.Keys) != 2 {
+		t.Fatalf("expected 2 keys, got %+v", keySet.Keys)
+	}
+	if keySet.Keys[0].KeyID != "2026-01" || keySet.Keys[0].KeyType != "OKP" || keySet.Keys[0].Algorithm != "EdDSA" {
+		t.Errorf("expected Ed25519 key 2026-01, got %+v", keySet.Keys[0])
+	}
+	rsaJWK := keySet.Keys[1]
+	if rsaJWK.KeyID != "2026-02" || rsaJWK.KeyType != "RSA" || rsaJWK.Algorithm != "RS256" {
+		t.Fatalf("expected RSA key 2026-02, got %+v", rsaJWK)
+	}
+
+	// The current token can be verified using the published key
+	modulus, _ := base64.RawURLEncoding.DecodeString(rsaJWK.Modulus)
+	exponent, _ := base64.RawURLEncoding.DecodeString(rsaJWK.Exponent)
+	publicKey := &rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: int(new(big.Int).SetBytes(exponent).Int64())}
+	_, err = jwt.ParseWithClaims(currentToken, &auth.AuthToken{}, func(token *jwt.Token) (interface{}, error) {
+		return publicKey, nil
+	})
+	if err != nil {
+		t.Errorf("failed to verify token with published key: %v", err)
+	}
+
+	// Once the previous key is removed its tokens are rejected
+	if err := os.Remove(filepath.Join(keysDir, "2026-01.pem")); err != nil {
+		t.Fatal(err)
+	}
+	useKeyRing(t, "2026-02")
+	if status := requestMyDetails(t, previousToken); status != http.StatusForbidden {
+		t.Errorf("expected token signed with a removed key to be rejected, got %v", status)
+	}
+}
+
+// Loads the key ring from the environment, signing with the given key
+func useKeyRing(t *testing.T, signingKeyID string) {
+	t.Setenv("JWT_SIGNING_KEY_ID", signingKeyID)
+	keys, err := auth.LoadKeyRing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.SetKeyRing(keys)
+}
+
+// Writes a private key to a PEM file (PKCS8)
+func writePrivateKey(t *testing.T, path string, key interface{}) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Requests the user's details (/api/me) with a token and returns the status code
+func requestMyDetails(t *testing.T, token string) int {
+	req, err := helpers.BuildApiRequest("GET", "me", nil, true, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	testModule.router.ServeHTTP(rr, req)
+	return rr.Code
+}
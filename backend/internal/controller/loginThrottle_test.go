@@ -0,0 +1,100 @@
+package controller_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers"
+	"github.com/dmawardi/Go-Template/internal/models"
+	"github.com/dmawardi/Go-Template/internal/queue"
+)
+
+func TestUserController_LoginThrottle(t *testing.T) {
+	t.Setenv("LOGIN_MAX_ATTEMPTS", "3")
+	createdUser, err := testModule.users.serv.Create(&models.CreateUser{
+		Username: "Jabar",
+		Email:    "locked@ymail.com",
+		Password: "password",
+		Name:     "Bamba",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test user for test: %v", err)
+	}
+
+	// Sends a login from an IP address
+	login := func(email, password, ip string) *httptest.ResponseRecorder {
+		req, err := helpers.BuildApiRequest("POST", "users/login", helpers.BuildReqBody(models.Login{Email: email, Password: password}), false, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.RemoteAddr = ip + ":5000"
+		rr := httptest.NewRecorder()
+		testModule.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Existing and unknown accounts are locked after the same number of failed attempts (with the same responses)
+	for _, email := range []string{createdUser.Email, "unknown-locked@ymail.com"} {
+		for attempt := 1; attempt <= 3; attempt++ {
+			rr := login(email, "wrong-password", fmt.Sprintf("198.51.100.%d", attempt))
+			if rr.Code != http.StatusUnauthorized || rr.Body.String() != "Invalid Credentials\n" {
+				t.Errorf("Failed login %d (%s): got %v %q", attempt, email, rr.Code, rr.Body.String())
+			}
+		}
+		rr := login(email, "password", "198.51.100.4")
+		if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+			t.Errorf("Fail: Login to locked account (%s): got %v (Retry-After: %q)", email, rr.Code, rr.Header().Get("Retry-After"))
+		}
+	}
+
+	// The user is emailed about the lockout
+	var lockoutEmails int64
+	testModule.dbClient.Model(&db.Job{}).Where("job_type = ? AND unique_key = ?", queue.EmailJobType, fmt.Sprintf("account-locked:%d", createdUser.ID)).Count(&lockoutEmails)
+	if lockoutEmails != 1 {
+		t.Errorf("Lockout emails: got %v want %v", lockoutEmails, 1)
+	}
+
+	// Only admins can unlock accounts
+	unlockUrl := fmt.Sprintf("users/%d/unlock", createdUser.ID)
+	for _, v := range []struct {
+		token          string
+		expectedStatus int
+	}{
+		{token: testModule.accounts.user.token, expectedStatus: http.StatusForbidden},
+		{token: testModule.accounts.admin.token, expectedStatus: http.StatusOK},
+	} {
+		req, _ := helpers.BuildApiRequest("POST", unlockUrl, nil, true, v.token)
+		rr := httptest.NewRecorder()
+		testModule.router.ServeHTTP(rr, req)
+		if rr.Code != v.expectedStatus {
+			t.Errorf("Unlock: got %v want %v", rr.Code, v.expectedStatus)
+		}
+	}
+	if rr := login(createdUser.Email, "password", "198.51.100.5"); rr.Code != http.StatusOK {
+		t.Errorf("Login after unlock: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// Failed logins from an IP address are delayed across accounts
+	for attempt := 1; attempt <= 3; attempt++ {
+		login(fmt.Sprintf("unknown-%d@ymail.com", attempt), "wrong-password", "203.0.113.7")
+	}
+	if rr := login(createdUser.Email, "password", "203.0.113.7"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Fail: Login from throttled IP address: got %v want %v", rr.Code, http.StatusTooManyRequests)
+	}
+	if rr := login(createdUser.Email, "password", "203.0.113.8"); rr.Code != http.StatusOK {
+		t.Errorf("Login from another IP address: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// Clean up created user, throttles and jobs
+	testModule.dbClient.Where("1 = 1").Delete(&db.LoginThrottle{})
+	testModule.dbClient.Where("unique_key = ?", fmt.Sprintf("account-locked:%d", createdUser.ID)).Delete(&db.Job{})
+	testModule.dbClient.Where("user_id = ?", createdUser.ID).Delete(&db.RefreshToken{})
+	err = testModule.users.serv.Delete(int(createdUser.ID), time.Time{})
+	if err != nil {
+		t.Fatalf("failed to delete created user: %v", err)
+	}
+}
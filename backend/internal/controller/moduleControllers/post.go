@@ -2,11 +2,13 @@ package modulecontrollers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/dmawardi/Go-Template/internal/helpers/request"
+	"github.com/dmawardi/Go-Template/internal/models"
 	schemamodels "github.com/dmawardi/Go-Template/internal/models/schemaModels"
 	moduleservices "github.com/dmawardi/Go-Template/internal/service/module"
 	"github.com/go-chi/chi/v5"
@@ -53,6 +55,8 @@ func PostConditionQueryParams() map[string]string {
 // @Failure      400 {string} string "Can't find posts"
 // @Failure      400 {string} string "Must include limit parameter with a max value of 50"
 // @Failure 	400 {string} string "Error extracting query params"
+// @Param        If-None-Match   header      string  false  "ETag of the cached response (304 if unchanged)"
+// @Success      304 {string} string "Not modified"
 // @Router       /posts [get]
 // @Security BearerToken
 func (c postController) FindAll(w http.ResponseWriter, r *http.Request) {
@@ -100,6 +104,8 @@ func (c postController) FindAll(w http.ResponseWriter, r *http.Request) {
 // @Param        id   path      int  true  "Post ID"
 // @Success      200 {object} db.Post
 // @Failure      400 {string} string "Can't find post with ID: {id}"
+// @Param        If-None-Match   header      string  false  "ETag of the cached response (304 if unchanged)"
+// @Success      304 {string} string "Not modified"
 // @Router       /posts/{id} [get]
 // @Security BearerToken
 func (c postController) Find(w http.ResponseWriter, r *http.Request) {
@@ -180,6 +186,8 @@ func (c postController) Create(w http.ResponseWriter, r *http.Request) {
 // @Failure      400 {object} models.ValidationError "Validation Errors"
 // @Failure      400 {string} string "Failed post update"
 // @Failure      403 {string} string "Authentication Token not detected"
+// @Param        If-Match   header      string  false  "ETag of the version being changed"
+// @Failure      412 {string} string "Resource has been modified"
 // @Router       /posts/{id} [put]
 // @Security BearerToken
 func (c postController) Update(w http.ResponseWriter, r *http.Request) {
@@ -209,7 +217,12 @@ func (c postController) Update(w http.ResponseWriter, r *http.Request) {
 	idParameter, _ := strconv.Atoi(stringParameter)
 
 	// Update post
-	updated, createErr := c.service.Update(idParameter, &toUpdate)
+	updated, createErr := c.service.Update(idParameter, &toUpdate, request.ExpectedVersion(r))
+	// If the post changed after the If-Match header was checked
+	if errors.Is(createErr, models.ErrRecordModified) {
+		http.Error(w, "Resource has been modified", http.StatusPreconditionFailed)
+		return
+	}
 	if createErr != nil {
 		http.Error(w, fmt.Sprintf("Failed post update: %s", createErr), http.StatusBadRequest)
 		return
@@ -229,6 +242,8 @@ func (c postController) Update(w http.ResponseWriter, r *http.Request) {
 // @Param        id   path      int  true  "Post ID"
 // @Success      200 {string} string "Deletion successful!"
 // @Failure      400 {string} string "Failed post deletion"
+// @Param        If-Match   header      string  false  "ETag of the version being changed"
+// @Failure      412 {string} string "Resource has been modified"
 // @Router       /posts/{id} [delete]
 // @Security BearerToken
 func (c postController) Delete(w http.ResponseWriter, r *http.Request) {
@@ -238,8 +253,12 @@ func (c postController) Delete(w http.ResponseWriter, r *http.Request) {
 	idParameter, _ := strconv.Atoi(stringParameter)
 
 	// Attampt to delete post using id
-	err := c.service.Delete(idParameter)
-
+	err := c.service.Delete(idParameter, request.ExpectedVersion(r))
+	// If the post changed after the If-Match header was checked
+	if errors.Is(err, models.ErrRecordModified) {
+		http.Error(w, "Resource has been modified", http.StatusPreconditionFailed)
+		return
+	}
 	// If error detected
 	if err != nil {
 		http.Error(w, "Failed post deletion", http.StatusBadRequest)
@@ -0,0 +1,86 @@
+package controller_test
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dmawardi/Go-Template/internal/email"
+	"github.com/dmawardi/Go-Template/internal/helpers"
+)
+
+func TestAdminOutboxController(t *testing.T) {
+	// Capture an email
+	msg := &email.Message{To: []string{"outbox@example.com"}, Subject: "Verify your email"}
+	logo := msg.Embed("logo.png", []byte("\x89PNG\r\n\x1a\n"))
+	msg.HTML = fmt.Sprintf(`<p>Your code is 123456</p><img src="%s">`, logo)
+	msg.Attach("terms.txt", []byte("terms"))
+	if err := testModule.outbox.Send(msg); err != nil {
+		t.Fatalf("failed to send email to outbox: %v", err)
+	}
+	messages, err := testModule.outbox.List()
+	if err != nil || len(messages) == 0 {
+		t.Fatalf("expected captured message, got %v (%v)", messages, err)
+	}
+	id := messages[0].ID
+
+	var tests = []struct {
+		testName               string
+		method                 string
+		urlSuffix              string
+		tokenToUse             string
+		expectedResponseStatus int
+		expectedContent        []string
+		unexpectedContent      []string
+	}{
+		{"List messages", "GET", "", testModule.accounts.admin.token, http.StatusOK, []string{"Verify your email", "outbox@example.com"}, nil},
+		{"Search messages", "GET", "?search=nomatch", testModule.accounts.admin.token, http.StatusOK, nil, []string{"Verify your email"}},
+		{"View message", "GET", "/" + id, testModule.accounts.admin.token, http.StatusOK, []string{"Verify your email", "Your code is 123456", "terms.txt", "data:image/png;base64,", "/admin/outbox/" + id + "/raw"}, nil},
+		{"Download message", "GET", "/" + id + "/raw", testModule.accounts.admin.token, http.StatusOK, []string{"Subject: Verify your email", "X-Envelope-To: outbox@example.com"}, nil},
+		{"Fail case: Message not found", "GET", "/missing", testModule.accounts.admin.token, http.StatusNotFound, nil, nil},
+		{"Fail case: Invalid message ID", "GET", "/..%2Foutbox/raw", testModule.accounts.admin.token, http.StatusNotFound, nil, nil},
+		{"Fail case: Not an admin", "GET", "", testModule.accounts.user.token, http.StatusForbidden, nil, nil},
+	}
+
+	for _, v := range tests {
+		req, err := http.NewRequest(v.method, "/admin/outbox"+v.urlSuffix, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("bearer %v", v.tokenToUse))
+		rr := httptest.NewRecorder()
+		testModule.router.ServeHTTP(rr, req)
+		if rr.Code != v.expectedResponseStatus {
+			t.Errorf("%s: got status %v want %v", v.testName, rr.Code, v.expectedResponseStatus)
+			continue
+		}
+		for _, content := range v.expectedContent {
+			if !strings.Contains(rr.Body.String(), content) {
+				t.Errorf("%s: expected response to contain %q", v.testName, content)
+			}
+		}
+		for _, content := range v.unexpectedContent {
+			if strings.Contains(rr.Body.String(), content) {
+				t.Errorf("%s: expected response not to contain %q", v.testName, content)
+			}
+		}
+	}
+
+	// Delete captured message
+	req, err := http.NewRequest("DELETE", "/admin/outbox/bulk-delete", helpers.BuildReqBody(map[string][]string{"selected_items": {id}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("bearer %v", testModule.accounts.admin.token))
+	rr := httptest.NewRecorder()
+	testModule.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !bytes.Contains(rr.Body.Bytes(), []byte(`"success": true`)) {
+		t.Errorf("Bulk delete: got status %v (%s)", rr.Code, rr.Body.String())
+	}
+	if _, err := testModule.outbox.Find(id); err == nil {
+		t.Errorf("expected message to be deleted")
+	}
+}
@@ -0,0 +1,169 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers"
+	"github.com/dmawardi/Go-Template/internal/models"
+)
+
+func TestUserController_Sessions(t *testing.T) {
+	createdUser, err := testModule.users.serv.Create(&models.CreateUser{
+		Username: "Jabar",
+		Email:    "sessions@ymail.com",
+		Password: "password",
+		Name:     "Bamba",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test user for test: %v", err)
+	}
+
+	// Logs in from a device, returning its tokens
+	login := func(password, userAgent string) (int, models.LoginResponse) {
+		req, _ := helpers.BuildApiRequest("POST", "users/login", helpers.BuildReqBody(models.Login{Email: createdUser.Email, Password: password}), false, "")
+		req.RemoteAddr = "198.51.100.20:5000"
+		req.Header.Set("User-Agent", userAgent)
+		rr := httptest.NewRecorder()
+		testModule.router.ServeHTTP(rr, req)
+		var response models.LoginResponse
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		return rr.Code, response
+	}
+	// Sends a request with an access token
+	send := func(method, url, token string) *httptest.ResponseRecorder {
+		req, _ := helpers.BuildApiRequest(method, url, nil, true, token)
+		rr := httptest.NewRecorder()
+		testModule.router.ServeHTTP(rr, req)
+		return rr
+	}
+	// Finds the sessions listed for an access token
+	findSessions := func(token string) []models.UserSession {
+		var sessions []models.UserSession
+		json.Unmarshal(send("GET", "me/sessions", token).Body.Bytes(), &sessions)
+		return sessions
+	}
+
+	// Log in from two devices (after a failed attempt)
+	if code, _ := login("wrong-password", "Laptop"); code != http.StatusUnauthorized {
+		t.Errorf("Failed login: got %v want %v", code, http.StatusUnauthorized)
+	}
+	_, laptop := login("password", "Laptop")
+	_, phone := login("password", "Phone")
+
+	// Listed with the current session marked
+	sessions := findSessions(laptop.Token)
+	if len(sessions) != 2 {
+		t.Fatalf("Find sessions: got %v sessions want %v", len(sessions), 2)
+	}
+	var laptopSession, phoneSession models.UserSession
+	for _, session := range sessions {
+		if session.UserAgent == "Laptop" {
+			laptopSession = session
+		} else {
+			phoneSession = session
+		}
+	}
+	if !laptopSession.Current || phoneSession.Current || phoneSession.UserAgent != "Phone" || laptopSession.IPAddress != "198.51.100.20" || laptopSession.Type != "api" {
+		t.Errorf("Find sessions: unexpected response %+v", sessions)
+	}
+
+	// Revoke the phone's session from the laptop
+	if rr := send("DELETE", fmt.Sprintf("me/sessions/%d", phoneSession.ID), laptop.Token); rr.Code != http.StatusOK {
+		t.Errorf("Revoke session: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if rr := send("GET", "me", phone.Token); rr.Code != http.StatusForbidden {
+		t.Errorf("Fail: Access token of revoked session: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+	req, _ := helpers.BuildApiRequest("POST", "users/refresh", helpers.BuildReqBody(models.RefreshTokenRequest{RefreshToken: phone.RefreshToken}), false, "")
+	rr := httptest.NewRecorder()
+	testModule.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Fail: Refresh token of revoked session: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	// Sessions of other users (or already revoked) aren't found
+	for _, v := range []struct {
+		token string
+		id    uint
+	}{
+		{token: laptop.Token, id: phoneSession.ID},
+		{token: testModule.accounts.user.token, id: laptopSession.ID},
+	} {
+		if rr := send("DELETE", fmt.Sprintf("me/sessions/%d", v.id), v.token); rr.Code != http.StatusNotFound {
+			t.Errorf("Fail: Revoke unknown session: got %v want %v", rr.Code, http.StatusNotFound)
+		}
+	}
+
+	// API keys aren't part of a session, so can't revoke other sessions
+	apiKey, err := testModule.users.serv.CreateApiKey(int(createdUser.ID), &models.CreateApiKey{Name: "Sessions", Scopes: []string{"delete:/api/me/sessions"}}, nil)
+	if err != nil {
+		t.Fatalf("failed to create API key: %v", err)
+	}
+	req, _ = helpers.BuildApiRequest("DELETE", "me/sessions", nil, true, "")
+	req.Header.Set("Authorization", "ApiKey "+apiKey.Key)
+	rr = httptest.NewRecorder()
+	testModule.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Fail: Revoke other sessions with API key: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	if rr := send("GET", "me", laptop.Token); rr.Code != http.StatusOK {
+		t.Errorf("Access token after API key request: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// Revoke all other sessions
+	_, tablet := login("password", "Tablet")
+	if rr := send("DELETE", "me/sessions", laptop.Token); rr.Code != http.StatusOK {
+		t.Errorf("Revoke other sessions: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if rr := send("GET", "me", tablet.Token); rr.Code != http.StatusForbidden {
+		t.Errorf("Fail: Access token of other session: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+	if sessions := findSessions(laptop.Token); len(sessions) != 1 || !sessions[0].Current {
+		t.Errorf("Sessions after revoking others: unexpected response %+v", sessions)
+	}
+
+	// Logins are recorded
+	var successes, failures int64
+	testModule.dbClient.Model(&db.LoginEvent{}).Where("user_id = ? AND success = ?", createdUser.ID, true).Count(&successes)
+	testModule.dbClient.Model(&db.LoginEvent{}).Where("user_id = ? AND success = ? AND reason = ?", createdUser.ID, false, "invalid credentials").Count(&failures)
+	if successes != 3 || failures != 1 {
+		t.Errorf("Login events: got %v successes and %v failures want %v and %v", successes, failures, 3, 1)
+	}
+
+	// Admins can view the user's sessions and login history, and revoke sessions
+	sendAdmin := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+testModule.accounts.admin.token)
+		rr := httptest.NewRecorder()
+		testModule.router.ServeHTTP(rr, req)
+		return rr
+	}
+	rr = sendAdmin("GET", fmt.Sprintf("/admin/users/sessions/%d", createdUser.ID))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Login history") || !strings.Contains(rr.Body.String(), "Laptop") {
+		t.Errorf("Admin sessions page: got %v", rr.Code)
+	}
+	rr = sendAdmin("POST", fmt.Sprintf("/admin/users/sessions/%d/%d/revoke", createdUser.ID, laptopSession.ID))
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("Admin revoke session: got %v want %v", rr.Code, http.StatusSeeOther)
+	}
+	if rr := send("GET", "me", laptop.Token); rr.Code != http.StatusForbidden {
+		t.Errorf("Fail: Access token of session revoked by admin: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	// Clean up created user, sessions and login history
+	testModule.dbClient.Where("user_id = ?", createdUser.ID).Delete(&db.Session{})
+	testModule.dbClient.Where("user_id = ?", createdUser.ID).Delete(&db.ApiKey{})
+	testModule.dbClient.Where("user_id = ?", createdUser.ID).Delete(&db.LoginEvent{})
+	testModule.dbClient.Where("user_id = ?", createdUser.ID).Delete(&db.RefreshToken{})
+	testModule.dbClient.Where("1 = 1").Delete(&db.LoginThrottle{})
+	err = testModule.users.serv.Delete(int(createdUser.ID), time.Time{})
+	if err != nil {
+		t.Fatalf("failed to delete created user: %v", err)
+	}
+}
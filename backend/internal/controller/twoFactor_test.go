@@ -0,0 +1,238 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/auth"
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers"
+	"github.com/dmawardi/Go-Template/internal/models"
+)
+
+func TestUserController_TwoFactor(t *testing.T) {
+	// Create user and login
+	createdUser, err := testModule.users.serv.Create(&models.CreateUser{
+		Username: "Jabar",
+		Email:    "two-factor@ymail.com",
+		Password: "password",
+		Name:     "Bamba",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test user for test: %v", err)
+	}
+	loginResponse, err := testModule.users.serv.LoginUser(&models.Login{Email: createdUser.Email, Password: "password"})
+	if err != nil {
+		t.Fatalf("failed to login: %v", err)
+	}
+	token := loginResponse.Token
+
+	// Sends a request, returning the response
+	sendRaw := func(method, url string, body interface{}, token string) *httptest.ResponseRecorder {
+		req, err := helpers.BuildApiRequest(method, url, helpers.BuildReqBody(body), token != "", token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		testModule.router.ServeHTTP(rr, req)
+		return rr
+	}
+	// Sends a request, decoding the JSON response into dest (if set)
+	send := func(method, url string, body interface{}, token string, dest interface{}) int {
+		rr := sendRaw(method, url, body, token)
+		if dest != nil && rr.Code == http.StatusOK {
+			if err := json.Unmarshal(rr.Body.Bytes(), dest); err != nil {
+				t.Fatalf("failed to decode %s response: %v", url, err)
+			}
+		}
+		return rr.Code
+	}
+
+	// Enrol and confirm
+	var enrollment models.TwoFactorEnrollment
+	if status := send("POST", "me/2fa/enroll", nil, token, &enrollment); status != http.StatusOK || enrollment.Secret == "" {
+		t.Fatalf("Enroll: got %v (%+v)", status, enrollment)
+	}
+	if status := send("POST", "me/2fa/confirm", models.TwoFactorCode{Code: "000000"}, token, nil); status != http.StatusBadRequest {
+		t.Errorf("Fail: Confirm with invalid code: got %v want %v", status, http.StatusBadRequest)
+	}
+	code, _ := helpers.TOTPCode(enrollment.Secret, time.Now())
+	// Invalid codes are throttled (even before a valid code)
+	expectThrottled(t, func() *httptest.ResponseRecorder {
+		return sendRaw("POST", "me/2fa/confirm", models.TwoFactorCode{Code: "000000"}, token)
+	}, func() *httptest.ResponseRecorder {
+		return sendRaw("POST", "me/2fa/confirm", models.TwoFactorCode{Code: code}, token)
+	})
+	var recoveryCodes models.TwoFactorRecoveryCodes
+	if status := send("POST", "me/2fa/confirm", models.TwoFactorCode{Code: code}, token, &recoveryCodes); status != http.StatusOK || len(recoveryCodes.RecoveryCodes) == 0 {
+		t.Fatalf("Confirm: got %v (%+v)", status, recoveryCodes)
+	}
+	if status := send("POST", "me/2fa/enroll", nil, token, nil); status != http.StatusConflict {
+		t.Errorf("Fail: Enroll when enabled: got %v want %v", status, http.StatusConflict)
+	}
+
+	// Login requires a code
+	var pending models.LoginResponse
+	if status := send("POST", "users/login", models.Login{Email: createdUser.Email, Password: "password"}, "", &pending); status != http.StatusOK || !pending.TwoFactorRequired || pending.Token != "" {
+		t.Fatalf("Login: got %v (%+v)", status, pending)
+	}
+	if status := send("GET", "me", nil, pending.TwoFactorToken, nil); status != http.StatusForbidden {
+		t.Errorf("Fail: Two factor token used to authenticate: got %v want %v", status, http.StatusForbidden)
+	}
+	if status := send("POST", "users/login/2fa", models.TwoFactorLogin{TwoFactorToken: pending.TwoFactorToken, Code: "000000"}, "", nil); status != http.StatusUnauthorized {
+		t.Errorf("Fail: Login with invalid code: got %v want %v", status, http.StatusUnauthorized)
+	}
+	var completed models.LoginResponse
+	if status := send("POST", "users/login/2fa", models.TwoFactorLogin{TwoFactorToken: pending.TwoFactorToken, Code: recoveryCodes.RecoveryCodes[0]}, "", &completed); status != http.StatusOK || completed.Token == "" {
+		t.Fatalf("Login with recovery code: got %v (%+v)", status, completed)
+	}
+
+	// Disable
+	if status := send("POST", "me/2fa/disable", models.TwoFactorCode{Code: recoveryCodes.RecoveryCodes[0]}, completed.Token, nil); status != http.StatusBadRequest {
+		t.Errorf("Fail: Disable with used recovery code: got %v want %v", status, http.StatusBadRequest)
+	}
+	expectThrottled(t, func() *httptest.ResponseRecorder {
+		return sendRaw("POST", "me/2fa/disable", models.TwoFactorCode{Code: "000000"}, completed.Token)
+	}, func() *httptest.ResponseRecorder {
+		return sendRaw("POST", "me/2fa/disable", models.TwoFactorCode{Code: recoveryCodes.RecoveryCodes[1]}, completed.Token)
+	})
+	if status := send("POST", "me/2fa/disable", models.TwoFactorCode{Code: recoveryCodes.RecoveryCodes[1]}, completed.Token, nil); status != http.StatusOK {
+		t.Errorf("Disable: got %v want %v", status, http.StatusOK)
+	}
+
+	// Clean up created user and tokens
+	testModule.dbClient.Where("user_id = ?", createdUser.ID).Delete(&db.RefreshToken{})
+	err = testModule.users.serv.Delete(int(createdUser.ID), time.Time{})
+	if err != nil {
+		t.Fatalf("failed to delete created user: %v", err)
+	}
+}
+
+func TestAdminCoreController_TwoFactor(t *testing.T) {
+	// Admins must use two factor authentication
+	t.Setenv("TWO_FACTOR_REQUIRED_ROLES", "admin")
+	createdUser, err := testModule.users.serv.Create(&models.CreateUser{
+		Username: "Jabar",
+		Email:    "admin-two-factor@ymail.com",
+		Password: "password",
+		Name:     "Bamba",
+		Role:     "admin",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test user for test: %v", err)
+	}
+	userId := int(createdUser.ID)
+	// Sends an admin panel request with a session cookie
+	send := func(method, path string, form url.Values, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if token != "" {
+			req.AddCookie(&http.Cookie{Name: "jwt_token", Value: token})
+		}
+		rr := httptest.NewRecorder()
+		testModule.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Sessions without two factor authentication are sent to the setup page
+	token, err := testModule.users.serv.StartSession(userId, false, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := send("GET", "/admin/home", nil, token)
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != auth.TwoFactorSetupURL {
+		t.Errorf("Fail: Admin home without two factor: got %v (%s)", rr.Code, rr.Header().Get("Location"))
+	}
+	rr = send("GET", "/admin/two-factor", nil, token)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "otpauth://totp/") {
+		t.Fatalf("Setup page: got %v", rr.Code)
+	}
+
+	// Confirming continues the session with two factor authentication
+	enrollment, err := testModule.users.serv.EnrollTwoFactor(userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := helpers.TOTPCode(enrollment.Secret, time.Now())
+	rr = send("POST", "/admin/two-factor", url.Values{"code": {code}}, token)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "recovery codes") {
+		t.Fatalf("Confirm: got %v", rr.Code)
+	}
+	recoveryCode := regexp.MustCompile(`<code>([a-z0-9]{5}-[a-z0-9]{5})</code>`).FindStringSubmatch(rr.Body.String())
+	if recoveryCode == nil {
+		t.Fatal("expected recovery codes to be shown")
+	}
+	sessionToken := sessionCookie(rr)
+	if rr := send("GET", "/admin/home", nil, sessionToken); rr.Code != http.StatusOK {
+		t.Errorf("Admin home after setup: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// Login takes two steps
+	rr = send("POST", "/admin/login", url.Values{"email": {createdUser.Email}, "password": {"password"}}, "")
+	pendingToken := regexp.MustCompile(`name="two_factor_token" value="([^"]+)"`).FindStringSubmatch(rr.Body.String())
+	if rr.Code != http.StatusOK || pendingToken == nil || sessionCookie(rr) != "" {
+		t.Fatalf("Login: expected two factor form, got %v", rr.Code)
+	}
+	rr = send("POST", "/admin/login/2fa", url.Values{"two_factor_token": {pendingToken[1]}, "code": {"000000"}}, "")
+	if rr.Code != http.StatusOK || sessionCookie(rr) != "" || !strings.Contains(rr.Body.String(), "Invalid or expired code") {
+		t.Errorf("Fail: Login with invalid code: got %v", rr.Code)
+	}
+	rr = send("POST", "/admin/login/2fa", url.Values{"two_factor_token": {pendingToken[1]}, "code": {recoveryCode[1]}}, "")
+	if rr.Code != http.StatusSeeOther || sessionCookie(rr) == "" {
+		t.Fatalf("Login with recovery code: got %v", rr.Code)
+	}
+	loginSession := sessionCookie(rr)
+	if rr := send("GET", "/admin/home", nil, loginSession); rr.Code != http.StatusOK {
+		t.Errorf("Admin home after login: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// Disabling two factor authentication (required for admins) logs out all sessions
+	nextCode, _ := helpers.TOTPCode(enrollment.Secret, time.Now().Add(30*time.Second))
+	err = testModule.users.serv.DisableTwoFactor(userId, nextCode)
+	if err != nil {
+		t.Fatalf("failed to disable two factor: %v", err)
+	}
+	if rr := send("GET", "/admin/home", nil, loginSession); rr.Code == http.StatusOK {
+		t.Errorf("Fail: Admin home after disabling two factor: got %v", rr.Code)
+	}
+
+	// Clean up created user and tokens
+	testModule.dbClient.Where("user_id = ?", createdUser.ID).Delete(&db.RecoveryCode{})
+	err = testModule.users.serv.Delete(userId, time.Time{})
+	if err != nil {
+		t.Fatalf("failed to delete created user: %v", err)
+	}
+}
+
+// Sends invalid codes until they're throttled, then checks a valid code is also throttled (clearing throttles after)
+func expectThrottled(t *testing.T, sendInvalid, sendValid func() *httptest.ResponseRecorder) {
+	t.Helper()
+	throttled := false
+	for attempt := 0; attempt < 5 && !throttled; attempt++ {
+		rr := sendInvalid()
+		throttled = rr.Code == http.StatusTooManyRequests && rr.Header().Get("Retry-After") != ""
+	}
+	if !throttled {
+		t.Error("Fail: expected invalid codes to be throttled")
+	}
+	if rr := sendValid(); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Fail: Valid code while throttled: got %v want %v", rr.Code, http.StatusTooManyRequests)
+	}
+	testModule.dbClient.Where("1 = 1").Delete(&db.LoginThrottle{})
+}
+
+// Returns the session token set in a response (empty if not set)
+func sessionCookie(rr *httptest.ResponseRecorder) string {
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == "jwt_token" {
+			return cookie.Value
+		}
+	}
+	return ""
+}
@@ -3,9 +3,11 @@ package controller_test
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/dmawardi/Go-Template/internal/db"
 	"github.com/dmawardi/Go-Template/internal/helpers"
@@ -49,7 +51,7 @@ func TestUserController_Find(t *testing.T) {
 	helpers.CompareObjects(body, createdUser, t, []string{"ID", "Username", "Email", "Name"})
 
 	// Delete the created user
-	delResult := testModule.users.serv.Delete(int(createdUser.ID))
+	delResult := testModule.users.serv.Delete(int(createdUser.ID), time.Time{})
 	if delResult != nil {
 		t.Fatalf("Error clearing created user")
 	}
@@ -256,7 +258,7 @@ func TestUserController_Update(t *testing.T) {
 	}
 
 	// Delete the created user
-	err = testModule.users.serv.Delete(int(createdUser.ID))
+	err = testModule.users.serv.Delete(int(createdUser.ID), time.Time{})
 	if err != nil {
 		t.Fatalf("Error clearing created user")
 	}
@@ -325,7 +327,7 @@ func TestUserController_Create(t *testing.T) {
 		json.Unmarshal(rr.Body.Bytes(), &body)
 
 		// Delete the created user
-		err = testModule.users.serv.Delete(int(body.ID))
+		err = testModule.users.serv.Delete(int(body.ID), time.Time{})
 		if err != nil {
 			t.Fatalf("Error clearing created user")
 		}
@@ -384,10 +386,11 @@ func TestUserController_UpdateMyProfile(t *testing.T) {
 	requestUrl := "me"
 
 	var tests = []struct {
-		testName               string
-		data                   map[string]string
-		useToken               bool
-		tokenToUse             string
+		testName string
+		data     map[string]string
+		useToken bool
+		// Tokens are reissued after each test (as password changes reject existing tokens)
+		tokenToUse             *string
 		expectedResponseStatus int
 		checkDetails           bool
 		loggedInDetails        models.UserWithRole
@@ -395,37 +398,37 @@ func TestUserController_UpdateMyProfile(t *testing.T) {
 		{"Admin self update", map[string]string{
 			"Username": "JabarCindi",
 			"Name":     "Bambaloonie",
-		}, true, testModule.accounts.admin.token, http.StatusOK, true, *testModule.accounts.admin.details},
+		}, true, &testModule.accounts.admin.token, http.StatusOK, true, *testModule.accounts.admin.details},
 		{"User self update", map[string]string{
 			"Username": "JabarHindi",
 			"Name":     "Bambaloonie",
 			"Password": "YeezusChris",
-		}, true, testModule.accounts.user.token, http.StatusOK, true, *testModule.accounts.user.details},
+		}, true, &testModule.accounts.user.token, http.StatusOK, true, *testModule.accounts.user.details},
 		{"User self update with invalid email", map[string]string{
 			"Email": "JabarHindi",
-		}, true, testModule.accounts.user.token, http.StatusBadRequest, false, *testModule.accounts.user.details},
+		}, true, &testModule.accounts.user.token, http.StatusBadRequest, false, *testModule.accounts.user.details},
 		{"Fail: User self update with duplicate email", map[string]string{
 			"Username": "Swahili",
 			"Email":    testModule.accounts.admin.details.Email,
-		}, true, testModule.accounts.user.token, http.StatusBadRequest, false, *testModule.accounts.user.details},
+		}, true, &testModule.accounts.user.token, http.StatusBadRequest, false, *testModule.accounts.user.details},
 		{"Fail: User update without token", map[string]string{
 			"Username": "JabarHindi",
 			"Name":     "Bambaloonie",
 			"Password": "YeezusChris",
-		}, false, "", http.StatusForbidden, false, *testModule.accounts.user.details},
+		}, false, new(string), http.StatusForbidden, false, *testModule.accounts.user.details},
 		{"Fail: Admin update with invalid validation", map[string]string{
 			"Username": "Gobod",
 			"Name":     "solu",
-		}, true, testModule.accounts.admin.token, http.StatusBadRequest, false, *testModule.accounts.admin.details},
+		}, true, &testModule.accounts.admin.token, http.StatusBadRequest, false, *testModule.accounts.admin.details},
 		{"Fail: User update with invalid validation", map[string]string{
 			"Username": "Gabor",
 			"Name":     "solu",
-		}, true, testModule.accounts.user.token, http.StatusBadRequest, false, *testModule.accounts.user.details},
+		}, true, &testModule.accounts.user.token, http.StatusBadRequest, false, *testModule.accounts.user.details},
 	}
 
 	for _, v := range tests {
 		// Make new request with user update in body
-		req, err := helpers.BuildApiRequest("PUT", requestUrl, helpers.BuildReqBody(v.data), v.useToken, v.tokenToUse)
+		req, err := helpers.BuildApiRequest("PUT", requestUrl, helpers.BuildReqBody(v.data), v.useToken, *v.tokenToUse)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -459,13 +462,15 @@ func TestUserController_UpdateMyProfile(t *testing.T) {
 			Password: testModule.accounts.admin.details.Password,
 			Email:    testModule.accounts.admin.details.Email,
 			Name:     testModule.accounts.admin.details.Name,
-		})
+		}, time.Time{})
 		testModule.users.serv.Update(int(testModule.accounts.user.details.ID), &models.UpdateUser{
 			Username: testModule.accounts.user.details.Username,
 			Password: testModule.accounts.user.details.Password,
 			Email:    testModule.accounts.user.details.Email,
 			Name:     testModule.accounts.user.details.Name,
-		})
+		}, time.Time{})
+		testModule.accounts.admin.token = testModule.reissueToken(testModule.accounts.admin.details)
+		testModule.accounts.user.token = testModule.reissueToken(testModule.accounts.user.details)
 	}
 }
 
@@ -543,6 +548,128 @@ func TestUserController_Login(t *testing.T) {
 	}
 }
 
+func TestUserController_Refresh(t *testing.T) {
+	requestUrl := "users/refresh"
+	// Login to get a refresh token
+	loginResponse, err := testModule.users.serv.LoginUser(&models.Login{
+		Email:    testModule.accounts.user.details.Email,
+		Password: testModule.accounts.user.details.Password,
+	})
+	if err != nil {
+		t.Fatalf("failed to login: %v", err)
+	}
+
+	var tests = []struct {
+		testName               string
+		data                   models.RefreshTokenRequest
+		expectedResponseStatus int
+		checkMessage           bool
+		expectedMessage        string
+	}{
+		{"Successful refresh", models.RefreshTokenRequest{
+			RefreshToken: loginResponse.RefreshToken}, http.StatusOK, false, ""},
+		{"Fail: Reused refresh token", models.RefreshTokenRequest{
+			RefreshToken: loginResponse.RefreshToken}, http.StatusUnauthorized, true, "Invalid or expired refresh token\n"},
+		{"Fail: Unknown refresh token", models.RefreshTokenRequest{
+			RefreshToken: "not-a-token"}, http.StatusUnauthorized, true, "Invalid or expired refresh token\n"},
+		// The below test should return a validation errors object
+		{"Fail: Empty refresh token", models.RefreshTokenRequest{
+			RefreshToken: ""}, http.StatusBadRequest, false, ""},
+	}
+
+	for _, v := range tests {
+		req, err := helpers.BuildApiRequest("POST", requestUrl, helpers.BuildReqBody(v.data), false, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Create a response recorder
+		rr := httptest.NewRecorder()
+
+		// Send request to mock server
+		testModule.router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != v.expectedResponseStatus {
+			t.Errorf("%v: Got %v want %v. \nResp: %v", v.testName,
+				status, v.expectedResponseStatus, rr.Body)
+		}
+
+		// If failure is expected
+		if v.checkMessage && rr.Body.String() != v.expectedMessage {
+			t.Errorf("%v: The body is: %v. expected: %v.", v.testName, rr.Body.String(), v.expectedMessage)
+		}
+		// Successful refreshes return new tokens
+		if rr.Code == http.StatusOK {
+			var body models.LoginResponse
+			json.Unmarshal(rr.Body.Bytes(), &body)
+			if body.Token == "" || body.RefreshToken == "" || body.RefreshToken == loginResponse.RefreshToken {
+				t.Errorf("%v: expected new tokens, got %+v", v.testName, body)
+			}
+		}
+	}
+
+	// Clean up refresh tokens
+	testModule.dbClient.Where("user_id = ?", testModule.accounts.user.details.ID).Delete(&db.RefreshToken{})
+}
+
+func TestUserController_Logout(t *testing.T) {
+	// Create user and login
+	createdUser, err := testModule.users.serv.Create(&models.CreateUser{
+		Username: "Jabar",
+		Email:    "logout@ymail.com",
+		Password: "password",
+		Name:     "Bamba",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test user for test: %v", err)
+	}
+	loginResponse, err := testModule.users.serv.LoginUser(&models.Login{Email: createdUser.Email, Password: "password"})
+	if err != nil {
+		t.Fatalf("failed to login: %v", err)
+	}
+
+	var tests = []struct {
+		testName               string
+		method                 string
+		url                    string
+		body                   interface{}
+		expectedResponseStatus int
+	}{
+		{"Profile before logout", "GET", "me", nil, http.StatusOK},
+		{"Logout", "POST", "users/logout", models.LogoutRequest{RefreshToken: loginResponse.RefreshToken}, http.StatusOK},
+		{"Fail: Profile after logout", "GET", "me", nil, http.StatusForbidden},
+		{"Fail: Logout twice", "POST", "users/logout", nil, http.StatusForbidden},
+		{"Fail: Refresh after logout", "POST", "users/refresh", models.RefreshTokenRequest{RefreshToken: loginResponse.RefreshToken}, http.StatusUnauthorized},
+	}
+
+	for _, v := range tests {
+		var body io.Reader = http.NoBody
+		if v.body != nil {
+			body = helpers.BuildReqBody(v.body)
+		}
+		req, err := helpers.BuildApiRequest(v.method, v.url, body, true, loginResponse.Token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Create a response recorder
+		rr := httptest.NewRecorder()
+
+		// Send request to mock server
+		testModule.router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != v.expectedResponseStatus {
+			t.Errorf("%v: Got %v want %v. \nResp: %v", v.testName,
+				status, v.expectedResponseStatus, rr.Body)
+		}
+	}
+
+	// Clean up created user and tokens
+	testModule.dbClient.Where("user_id = ?", createdUser.ID).Delete(&db.RefreshToken{})
+	err = testModule.users.serv.Delete(int(createdUser.ID), time.Time{})
+	if err != nil {
+		t.Fatalf("failed to delete created user: %v", err)
+	}
+}
+
 func TestUserController_ResetPassword(t *testing.T) {
 	// Create a request url with an "id" URL parameter
 	requestUrl := "users/forgot-password"
@@ -599,6 +726,80 @@ func TestUserController_ResetPassword(t *testing.T) {
 	}
 }
 
+func TestUserController_ConfirmResetPassword(t *testing.T) {
+	requestUrl := "users/reset-password/confirm"
+	// Create user
+	createdUser, err := testModule.users.serv.Create(&models.CreateUser{
+		Username: "Jabar",
+		Email:    "reset-link@ymail.com",
+		Password: "password",
+		Name:     "Bamba",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test user for test: %v", err)
+	}
+	// Create reset token
+	token, resetToken, err := helpers.GeneratePasswordResetToken(createdUser.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to generate password reset token: %v", err)
+	}
+	testModule.dbClient.Create(resetToken)
+
+	var tests = []struct {
+		testName               string
+		data                   models.ConfirmPasswordReset
+		expectedResponseStatus int
+		checkMessage           bool
+		expectedMessage        string
+	}{
+		// The below tests should return a validation errors object
+		{"Fail: Password too short", models.ConfirmPasswordReset{
+			Token: token, Password: "short"}, http.StatusBadRequest, false, ""},
+		{"Fail: Empty token", models.ConfirmPasswordReset{
+			Token: "", Password: "new-password"}, http.StatusBadRequest, false, ""},
+		{"Fail: Unknown token", models.ConfirmPasswordReset{
+			Token: "not-a-token", Password: "new-password"}, http.StatusUnauthorized, true, "Invalid or expired token\n"},
+		{"Successful password reset", models.ConfirmPasswordReset{
+			Token: token, Password: "new-password"}, http.StatusOK, false, ""},
+		{"Fail: Token already used", models.ConfirmPasswordReset{
+			Token: token, Password: "newer-password"}, http.StatusUnauthorized, true, "Invalid or expired token\n"},
+	}
+
+	for _, v := range tests {
+		req, err := helpers.BuildApiRequest("POST", requestUrl, helpers.BuildReqBody(v.data), false, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Create a response recorder
+		rr := httptest.NewRecorder()
+
+		// Send request to mock server
+		testModule.router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != v.expectedResponseStatus {
+			t.Errorf("%v: Got %v want %v. \nResp: %v", v.testName,
+				status, v.expectedResponseStatus, rr.Body)
+		}
+
+		// If failure is expected
+		if v.checkMessage && rr.Body.String() != v.expectedMessage {
+			t.Errorf("%v: The body is: %v. expected: %v.", v.testName, rr.Body.String(), v.expectedMessage)
+		}
+	}
+
+	// Check new password is used to login
+	if !testModule.users.serv.CheckPasswordMatch(int(createdUser.ID), []byte("new-password")) {
+		t.Error("expected password to be updated")
+	}
+
+	// Clean up created user and tokens
+	testModule.dbClient.Where("user_id = ?", createdUser.ID).Delete(&db.PasswordResetToken{})
+	err = testModule.users.serv.Delete(int(createdUser.ID), time.Time{})
+	if err != nil {
+		t.Fatalf("failed to delete created user: %v", err)
+	}
+}
+
 func TestUserController_ResendVerificationEmail(t *testing.T) {
 	// Create a request url with an "id" URL parameter
 	requestUrl := "users/send-verification-email"
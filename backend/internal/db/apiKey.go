@@ -0,0 +1,25 @@
+package db
+
+import "time"
+
+// ApiKey (personal access token used by scripts and integrations in place of the user's password)
+// Only a hash of the key is stored, and the key is only shown when created. Keys act as their user, limited to their scopes.
+type ApiKey struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `swaggertype:"string" json:"created_at,omitempty"`
+	UpdatedAt time.Time `swaggertype:"string" json:"updated_at,omitempty"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	Name      string    `json:"name"`
+	// Start of the key (used to recognise the key)
+	Prefix string `json:"prefix"`
+	// SHA-256 hash of the key
+	KeyHash string `json:"-" gorm:"uniqueIndex"`
+	// Actions and paths the key can be used for (eg. read:/api/posts)
+	Scopes []string `json:"scopes" gorm:"serializer:json"`
+	// The key can't be used after this time (never expires if not set)
+	ExpiresAt *time.Time `swaggertype:"string" json:"expires_at,omitempty" gorm:"default:null"`
+	// Recorded at most once a minute
+	LastUsedAt *time.Time `swaggertype:"string" json:"last_used_at,omitempty" gorm:"default:null"`
+	// Set when the key is revoked
+	RevokedAt *time.Time `swaggertype:"string" json:"revoked_at,omitempty" gorm:"default:null"`
+}
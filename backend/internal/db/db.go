@@ -79,3 +79,12 @@ func PointerToStringWithType(ptr interface{}, dataType string) string {
 
 	return ""
 }
+
+// Closes the connection pool of a client
+func CloseConnection(client *gorm.DB) error {
+	sqlDB, err := client.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
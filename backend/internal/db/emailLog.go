@@ -0,0 +1,69 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Email delivery statuses
+const (
+	// Accepted by the mail server (or written to the outbox)
+	EmailStatusSent = "sent"
+	// Last attempt failed (the job may still be retried, see JobID)
+	EmailStatusFailed = "failed"
+)
+
+// EmailLog (used to record the delivery of emails sent by the job queue)
+// Each email job has a single log, updated on each attempt
+type EmailLog struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time      `swaggertype:"string" json:"created_at,omitempty"`
+	UpdatedAt time.Time      `swaggertype:"string" json:"updated_at,omitempty"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	// User the email was sent to (0 if not sent to a user)
+	UserID    uint   `json:"user_id,omitempty" gorm:"index"`
+	Recipient string `json:"recipient" gorm:"index"`
+	Subject   string `json:"subject"`
+	// Name of the email template used (eg. "password-reset")
+	Template string `json:"template,omitempty" gorm:"index"`
+	// Job that sent the email
+	JobID uint `json:"job_id,omitempty" gorm:"index"`
+	// Delivery
+	Status   string `json:"status" gorm:"index"`
+	Attempts int    `json:"attempts"`
+	// Mail server's reply to the last attempt (or the error)
+	Response string    `json:"response,omitempty" gorm:"type:text"`
+	SentAt   time.Time `swaggertype:"string" json:"sent_at,omitempty" gorm:"default:null"`
+}
+
+// Grabs the ID of the schema object as string
+func (schemaObject EmailLog) GetID() string {
+	return fmt.Sprint(schemaObject.ID)
+}
+
+func (schemaObject EmailLog) ObtainValue(keyValue string) string {
+	// Not sent yet
+	sentAt := ""
+	if !schemaObject.SentAt.IsZero() {
+		sentAt = schemaObject.SentAt.Format(time.RFC3339)
+	}
+	// Map of email log fields
+	fieldMap := map[string]string{
+		"ID":        fmt.Sprint(schemaObject.ID),
+		"CreatedAt": schemaObject.CreatedAt.Format(time.RFC3339),
+		"UpdatedAt": schemaObject.UpdatedAt.Format(time.RFC3339),
+		"UserID":    fmt.Sprint(schemaObject.UserID),
+		"Recipient": schemaObject.Recipient,
+		"Subject":   schemaObject.Subject,
+		"Template":  schemaObject.Template,
+		"JobID":     fmt.Sprint(schemaObject.JobID),
+		"Status":    schemaObject.Status,
+		"Attempts":  fmt.Sprint(schemaObject.Attempts),
+		"Response":  schemaObject.Response,
+		"SentAt":    sentAt,
+	}
+	// Return value of key
+	return fieldMap[keyValue]
+}
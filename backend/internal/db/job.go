@@ -1,27 +1,115 @@
 package db
 
 import (
+	"fmt"
 	"time"
 
 	"gorm.io/gorm"
 )
 
+// Job statuses
+const (
+	// Waiting to be picked up by a worker (includes jobs waiting on a retry)
+	JobStatusPending = "pending"
+	// Claimed by a worker (held until the worker finishes or its lease expires)
+	JobStatusRunning = "running"
+	// Successfully processed
+	JobStatusProcessed = "processed"
+	// Retries exhausted (dead letter). Can be re-queued manually.
+	JobStatusDead = "dead"
+	// Failed with an error that retrying won't fix (eg. unknown job type). Can be re-queued manually.
+	JobStatusFailed = "failed"
+	// Cancelled by an admin before it was run. Can be re-queued manually.
+	JobStatusCancelled = "cancelled"
+)
+
+// Default number of attempts before a job is moved to the dead letter state
+const DefaultJobMaxAttempts = 5
+
 // Job (used for async jobs)
 type Job struct {
 	ID        uint           `json:"id" gorm:"primaryKey"`
 	CreatedAt time.Time      `swaggertype:"string" json:"created_at,omitempty"`
 	UpdatedAt time.Time      `swaggertype:"string" json:"updated_at,omitempty"`
-	DeletedAt gorm.DeletedAt `gorm:"index"`
-	JobType   string         // Type of job (e.g., "email", "otherType")
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	JobType   string         `json:"job_type"` // Type of job (e.g., "email", "otherType")
 	// Status
-	Status string `json:"status,omitempty" gorm:"default:'pending'"`
+	Status string `json:"status,omitempty" gorm:"default:'pending';index"`
 	// Payload
 	Payload   string `json:"payload,omitempty"`
-	Processed bool
+	Processed bool   `json:"processed"`
+	// Retries
+	Attempts    int       `json:"attempts" gorm:"default:0"`
+	MaxAttempts int       `json:"max_attempts" gorm:"default:5"`
+	LastError   string    `json:"last_error,omitempty" gorm:"type:text"`
+	NextRunAt   time.Time `swaggertype:"string" json:"next_run_at,omitempty" gorm:"index"`
+	// Lease (set while a worker is processing the job)
+	LockedBy    string    `json:"locked_by,omitempty"`
+	LockedUntil time.Time `swaggertype:"string" json:"locked_until,omitempty" gorm:"default:null"`
+	// Time the job was last claimed by a worker (used for rate limiting)
+	StartedAt time.Time `swaggertype:"string" json:"started_at,omitempty" gorm:"default:null;index"`
+	// Higher priority jobs are claimed first
+	Priority int `json:"priority" gorm:"default:0;index"`
+	// Uniqueness (further jobs with the same type and key are skipped until UniqueUntil)
+	UniqueKey   string    `json:"unique_key,omitempty" gorm:"index"`
+	UniqueUntil time.Time `swaggertype:"string" json:"unique_until,omitempty" gorm:"default:null"`
 }
 
 // Used prior to job creation
 func (job *Job) BeforeCreate(tx *gorm.DB) (err error) {
 	job.CreatedAt = time.Now()
+	// Jobs are runnable immediately unless scheduled otherwise
+	if job.NextRunAt.IsZero() {
+		job.NextRunAt = job.CreatedAt
+	}
+	// Use default max attempts if not set
+	if job.MaxAttempts == 0 {
+		job.MaxAttempts = DefaultJobMaxAttempts
+	}
 	return
 }
+
+// Grabs the ID of the schema object as string
+func (schemaObject Job) GetID() string {
+	return fmt.Sprint(schemaObject.ID)
+}
+
+func (schemaObject Job) ObtainValue(keyValue string) string {
+	// Map of job fields
+	fieldMap := map[string]string{
+		"ID":        fmt.Sprint(schemaObject.ID),
+		"CreatedAt": schemaObject.CreatedAt.Format(time.RFC3339),
+		"UpdatedAt": schemaObject.UpdatedAt.Format(time.RFC3339),
+		"JobType":   schemaObject.JobType,
+		"Priority":  fmt.Sprint(schemaObject.Priority),
+		"Status":    schemaObject.Status,
+		"Payload":   schemaObject.Payload,
+		"Attempts":  fmt.Sprintf("%d/%d", schemaObject.Attempts, schemaObject.MaxAttempts),
+		"LastError": schemaObject.LastError,
+		"NextRunAt": schemaObject.NextRunAt.Format(time.RFC3339),
+		"LockedBy":  schemaObject.LockedBy,
+	}
+	// Return value of key
+	return fieldMap[keyValue]
+}
+
+// JobSchedule (used for recurring jobs)
+// Each time the schedule is due, a job is added to the queue with the schedule's job type and payload
+type JobSchedule struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time      `swaggertype:"string" json:"created_at,omitempty"`
+	UpdatedAt time.Time      `swaggertype:"string" json:"updated_at,omitempty"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	// Unique name of schedule (eg. "prune-actions")
+	Name           string `json:"name" gorm:"uniqueIndex;not null"`
+	CronExpression string `json:"cron_expression" gorm:"not null"`
+	// Job to add
+	JobType string `json:"job_type" gorm:"not null"`
+	Payload string `json:"payload,omitempty"`
+	Enabled *bool  `json:"enabled" gorm:"default:true"`
+	// Run tracking
+	NextRunAt time.Time `swaggertype:"string" json:"next_run_at" gorm:"index"`
+	LastRunAt time.Time `swaggertype:"string" json:"last_run_at,omitempty" gorm:"default:null"`
+	// Incremented each time the schedule fires (used to ensure only one instance fires a run)
+	RunCount int `json:"run_count" gorm:"default:0"`
+}
@@ -0,0 +1,20 @@
+package db
+
+import "time"
+
+// LoginEvent (audit trail of successful and failed logins)
+type LoginEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `swaggertype:"string" json:"created_at,omitempty" gorm:"index"`
+	// Not set for unknown emails
+	UserID *uint `json:"user_id,omitempty" gorm:"index"`
+	// Email the login was attempted with
+	Email     string `json:"email"`
+	IPAddress string `json:"ip_address"`
+	UserAgent string `json:"user_agent"`
+	Success   bool   `json:"success"`
+	// Why the login failed (eg. invalid credentials)
+	Reason string `json:"reason,omitempty"`
+	// Token ID of the session started by a successful login
+	TokenID string `json:"-"`
+}
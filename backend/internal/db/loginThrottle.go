@@ -0,0 +1,18 @@
+package db
+
+import "time"
+
+// LoginThrottle (failed login attempts for an account or IP address)
+// Accounts are tracked by email, so unknown emails are throttled the same way as existing accounts
+type LoginThrottle struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `swaggertype:"string" json:"created_at,omitempty"`
+	UpdatedAt time.Time `swaggertype:"string" json:"updated_at,omitempty"`
+	// What's being throttled (eg. "account:jane@example.com" or "ip:203.0.113.7")
+	Key string `json:"key" gorm:"uniqueIndex"`
+	// Failed attempts since the counter was last reset
+	Failures      int       `json:"failures"`
+	LastFailureAt time.Time `swaggertype:"string" json:"last_failure_at"`
+	// Logins are rejected until this time
+	LockedUntil *time.Time `swaggertype:"string" json:"locked_until,omitempty" gorm:"default:null"`
+}
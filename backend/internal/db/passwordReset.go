@@ -0,0 +1,16 @@
+package db
+
+import "time"
+
+// PasswordResetToken (used to reset a user's password from an emailed link)
+// Only a hash of the token is stored, and each token can be used once before it expires
+type PasswordResetToken struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `swaggertype:"string" json:"created_at,omitempty"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	// SHA-256 hash of the emailed token
+	TokenHash string    `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt time.Time `swaggertype:"string" json:"expires_at"`
+	// Set when the token is used (or replaced by a newer token)
+	UsedAt *time.Time `swaggertype:"string" json:"used_at,omitempty" gorm:"default:null"`
+}
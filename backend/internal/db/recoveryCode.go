@@ -0,0 +1,15 @@
+package db
+
+import "time"
+
+// RecoveryCode (used to complete a two factor login without the authenticator app)
+// Only a hash of the code is stored, and each code can be used once. Codes are replaced when two factor authentication is enabled.
+type RecoveryCode struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `swaggertype:"string" json:"created_at,omitempty"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	// SHA-256 hash of the code
+	CodeHash string `json:"-" gorm:"index"`
+	// Set when the code is used
+	UsedAt *time.Time `swaggertype:"string" json:"used_at,omitempty" gorm:"default:null"`
+}
@@ -0,0 +1,23 @@
+package db
+
+import "time"
+
+// RefreshToken (used to issue new access tokens without logging in again)
+// Only a hash of the token is stored. Each token can be used once, and is replaced by a new token in the same family (rotation).
+// Using a token twice revokes its family, as the token may have been stolen.
+type RefreshToken struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `swaggertype:"string" json:"created_at,omitempty"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	// Tokens issued from the same login share a family
+	FamilyID string `json:"family_id" gorm:"index"`
+	// SHA-256 hash of the token
+	TokenHash string    `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt time.Time `swaggertype:"string" json:"expires_at"`
+	// Set when the token is exchanged for a new token
+	UsedAt *time.Time `swaggertype:"string" json:"used_at,omitempty" gorm:"default:null"`
+	// Set when the token's family is revoked (eg. token reuse or password reset)
+	RevokedAt *time.Time `swaggertype:"string" json:"revoked_at,omitempty" gorm:"default:null"`
+	// Set for families started with a two factor login (access tokens are issued with the two factor claim)
+	TwoFactor bool `json:"two_factor" gorm:"default:false"`
+}
@@ -0,0 +1,14 @@
+package db
+
+import "time"
+
+// RevokedToken (used to reject access tokens before they expire, eg. after logging out)
+// Records are only needed until the token expires
+type RevokedToken struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `swaggertype:"string" json:"created_at,omitempty"`
+	// ID of the token (jti claim)
+	JTI       string    `json:"jti" gorm:"column:jti;uniqueIndex"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	ExpiresAt time.Time `swaggertype:"string" json:"expires_at" gorm:"index"`
+}
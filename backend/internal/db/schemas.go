@@ -10,7 +10,17 @@ var Models = []interface{}{
 	// Core Schemas
 	&User{}, // Used for user management
 	&Job{},  // Used for job queuing
+	&JobSchedule{}, // Used for recurring jobs
 	&Action{}, // Used for logging actions
+	&EmailLog{}, // Used for logging sent emails
+	&PasswordResetToken{}, // Used for password reset links
+	&RefreshToken{}, // Used for refreshing access tokens
+	&RevokedToken{}, // Used for revoking access tokens
+	&RecoveryCode{}, // Used for two factor authentication recovery
+	&ApiKey{}, // Used for API keys (machine clients)
+	&LoginThrottle{}, // Used for brute force protection on login
+	&Session{}, // Used for active sessions (logged in devices)
+	&LoginEvent{}, // Used for the login audit trail
 	// Additional Schemas
 	&Post{},
 }
@@ -26,10 +36,19 @@ type User struct {
 	Username  string         `json:"username,omitempty"`
 	Email     string         `json:"email,omitempty" gorm:"uniqueIndex"`
 	Password  string         `json:"-"`
+	// Preferred language of emails (eg. "en" or "es")
+	Locale string `json:"locale,omitempty" gorm:"default:null"`
 	// Verification
 	Verified               *bool     `json:"verified,omitempty" gorm:"default:false"`
 	VerificationCode       string    `json:"verification_code,omitempty" gorm:"default:null"`
 	VerificationCodeExpiry time.Time `json:"verification_code_expiry,omitempty" gorm:"default:null"`
+	// Access tokens issued before this time are rejected (set on password or role change)
+	TokensValidAfter time.Time `json:"-" gorm:"default:null"`
+	// Two factor authentication (TOTP). The secret is set on enrolment and enabled once a code is confirmed
+	TwoFactorEnabled bool   `json:"two_factor_enabled" gorm:"default:false"`
+	TwoFactorSecret  string `json:"-" gorm:"default:null"`
+	// Time step of the last accepted code (so codes can't be reused)
+	TwoFactorLastStep int64 `json:"-" gorm:"default:0"`
 	// Relationships
 	Posts []Post `json:"posts,omitempty" gorm:"foreignKey:UserID"`
 }
@@ -0,0 +1,26 @@
+package db
+
+import "time"
+
+// Session (a login on a device, lasting until it expires, is revoked or the user logs out)
+// Access tokens issued in the session carry its token ID (sid claim), and are rejected once it's revoked
+type Session struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `swaggertype:"string" json:"created_at,omitempty"`
+	UpdatedAt time.Time `swaggertype:"string" json:"updated_at,omitempty"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	// Random ID in the session's access tokens (also the family ID of its refresh tokens)
+	TokenID string `json:"-" gorm:"uniqueIndex"`
+	// How the user logged in (api or admin)
+	Type      string `json:"type"`
+	IPAddress string `json:"ip_address"`
+	UserAgent string `json:"user_agent"`
+	// Set for sessions started with a two factor login
+	TwoFactor bool `json:"two_factor" gorm:"default:false"`
+	// Recorded at most once a minute
+	LastActiveAt time.Time `swaggertype:"string" json:"last_active_at"`
+	// Extended when refresh tokens are exchanged
+	ExpiresAt time.Time `swaggertype:"string" json:"expires_at" gorm:"index"`
+	// Set when the session is revoked (or the user logs out)
+	RevokedAt *time.Time `swaggertype:"string" json:"revoked_at,omitempty" gorm:"default:null"`
+}
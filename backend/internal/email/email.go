@@ -1,15 +1,75 @@
 package email
 
 import (
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/smtp"
 	"os"
+	"strings"
 )
 
 type Email interface {
+	// Send sends a message (see Message)
+	Send(message *Message) error
+	// SendEmail sends an HTML email to a single recipient
 	SendEmail(recipient, subject, body string) error
 }
 
+// ResponseSender is implemented by drivers that report the mail server's reply to a sent message
+// (eg. "250 2.0.0 Ok: queued as 4F1A2B"), used to record deliveries
+type ResponseSender interface {
+	SendWithResponse(message *Message) (string, error)
+}
+
+// Email drivers
+const (
+	// Sends using SMTP
+	SMTPDriver = "smtp"
+	// Writes messages to the outbox directory
+	FileDriver = "file"
+)
+
+// Used when no outbox directory is set
+const defaultOutboxDir = "./tmp/outbox"
+
+// Settings for the email service
+type Settings struct {
+	// Email driver (SMTPDriver or FileDriver)
+	Driver string
+	// Directory messages are written to by the file driver
+	OutboxDir string
+}
+
+// SettingsFromEnv builds email settings from the environment variables:
+// EMAIL_DRIVER ("smtp" or "file", defaults to smtp) and EMAIL_OUTBOX_DIR (defaults to ./tmp/outbox)
+func SettingsFromEnv() Settings {
+	settings := Settings{Driver: SMTPDriver, OutboxDir: defaultOutboxDir}
+	if driver := strings.ToLower(strings.TrimSpace(os.Getenv("EMAIL_DRIVER"))); driver != "" {
+		settings.Driver = driver
+	}
+	if dir := os.Getenv("EMAIL_OUTBOX_DIR"); dir != "" {
+		settings.OutboxDir = dir
+	}
+	return settings
+}
+
+// New builds the email service selected in the settings
+func New(settings Settings) (Email, error) {
+	switch settings.Driver {
+	case "", SMTPDriver:
+		return NewSMTPEmail(), nil
+	case FileDriver:
+		from := os.Getenv("SMTP_USERNAME")
+		if from == "" {
+			from = "noreply@localhost"
+		}
+		return NewFileEmail(settings.OutboxDir, from)
+	default:
+		return nil, fmt.Errorf("unknown email driver %q", settings.Driver)
+	}
+}
+
 // Email struct
 type email struct {
 	Auth        smtp.Auth
@@ -26,32 +86,95 @@ func NewSMTPEmail() Email {
 	}
 }
 
-// Sends email using SMTP
-func (e *email) SendEmail(recipient, subject, body string) error {
-	// Set MIME and other headers
-	headers := make(map[string]string)
-	headers["From"] = e.FromAddress
-	headers["To"] = recipient
-	headers["Subject"] = subject
-	headers["MIME-Version"] = "1.0"
-	headers["Content-Type"] = "text/html; charset=\"utf-8\""
-
-	// Build the headers
-	header := ""
-	for k, v := range headers {
-		header += fmt.Sprintf("%s: %s\r\n", k, v)
-	}
-
-	// The msg parameter should be an RFC 822-style email with headers first,
-	// a blank line, and then the message body (Go Template).
-	msg := []byte(
-		header + "\r\n" +
-			body + "\r\n")
+// Sends a message using SMTP
+func (e *email) Send(message *Message) error {
+	_, err := e.SendWithResponse(message)
+	return err
+}
+
+// Sends a message using SMTP and returns the server's reply to the message
+func (e *email) SendWithResponse(message *Message) (string, error) {
+	// Build MIME message
+	msg, err := message.Bytes(e.FromAddress)
+	if err != nil {
+		return "", err
+	}
+	recipients, err := message.Recipients()
+	if err != nil {
+		return "", err
+	}
 
 	// This sends the email with a plain auth setup
-	err := smtp.SendMail(e.SmtpAddress, e.Auth, e.FromAddress, []string{recipient}, msg)
+	response, err := sendMail(e.SmtpAddress, e.Auth, e.FromAddress, recipients, msg)
+	if err != nil {
+		return "", fmt.Errorf("smtp.SendMail() failed with: %s", err)
+	}
+	return response, nil
+}
+
+// Sends an HTML email (with a plain text alternative) using SMTP
+func (e *email) SendEmail(recipient, subject, body string) error {
+	return e.Send(&Message{To: []string{recipient}, Subject: subject, HTML: body})
+}
+
+// Sends a message in the same way as smtp.SendMail, but returns the server's reply to the message data
+// (smtp.Client discards it, so the DATA command is sent directly)
+func sendMail(addr string, a smtp.Auth, from string, to []string, msg []byte) (string, error) {
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+
+	// Use TLS and authenticate if supported
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		host, _, _ := net.SplitHostPort(addr)
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return "", err
+		}
+	}
+	if a != nil {
+		if ok, _ := c.Extension("AUTH"); ok {
+			if err := c.Auth(a); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	// Envelope
+	if err := c.Mail(from); err != nil {
+		return "", err
+	}
+	for _, recipient := range to {
+		if err := c.Rcpt(recipient); err != nil {
+			return "", err
+		}
+	}
+
+	// Message
+	id, err := c.Text.Cmd("DATA")
+	if err != nil {
+		return "", err
+	}
+	c.Text.StartResponse(id)
+	_, _, err = c.Text.ReadResponse(354)
+	c.Text.EndResponse(id)
 	if err != nil {
-		return fmt.Errorf("smtp.SendMail() failed with: %s", err)
+		return "", err
 	}
-	return nil
+	writer := c.Text.DotWriter()
+	if _, err := writer.Write(msg); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+	code, reply, err := c.Text.ReadResponse(250)
+	if err != nil {
+		return "", err
+	}
+
+	// The message has been accepted, so errors closing the connection are ignored
+	c.Quit()
+	return fmt.Sprintf("%d %s", code, reply), nil
 }
@@ -0,0 +1,355 @@
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Message is an email with HTML and plain text bodies, attachments and inline images.
+// Example usage: msg := &email.Message{To: []string{"jane@example.com"}, Subject: "Hello", HTML: "<p>Hi Jane</p>"}
+type Message struct {
+	// Sender address (the service's address is used if empty)
+	From    string
+	To      []string
+	Cc      []string
+	Bcc     []string
+	ReplyTo string
+	Subject string
+	HTML    string
+	// Plain text alternative (derived from HTML if empty)
+	Text        string
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to a message, or an inline image referenced from the HTML body as "cid:<ContentID>"
+type Attachment struct {
+	Filename string
+	// MIME type (detected from the filename or content if empty)
+	ContentType string
+	Data        []byte
+	// Inline attachments are shown within the HTML body
+	Inline    bool
+	ContentID string
+}
+
+// Attach adds a file attachment
+func (m *Message) Attach(filename string, data []byte) {
+	m.Attachments = append(m.Attachments, Attachment{Filename: filename, Data: data})
+}
+
+// AttachFile adds a file from disk as an attachment
+func (m *Message) AttachFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read attachment: %w", err)
+	}
+	m.Attach(filepath.Base(path), data)
+	return nil
+}
+
+// Embed adds an inline image and returns the URL to use in the HTML body (eg. <img src="cid:logo.png">)
+func (m *Message) Embed(filename string, data []byte) string {
+	m.Attachments = append(m.Attachments, Attachment{Filename: filename, Data: data, Inline: true, ContentID: filename})
+	return "cid:" + filename
+}
+
+// Recipients returns all recipient addresses (To, Cc and Bcc)
+func (m *Message) Recipients() ([]string, error) {
+	var recipients []string
+	for _, list := range [][]string{m.To, m.Cc, m.Bcc} {
+		for _, recipient := range list {
+			address, err := mail.ParseAddress(recipient)
+			if err != nil {
+				return nil, fmt.Errorf("invalid recipient %q: %w", recipient, err)
+			}
+			recipients = append(recipients, address.Address)
+		}
+	}
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("message has no recipients")
+	}
+	return recipients, nil
+}
+
+// Bytes builds the message as a MIME (RFC 5322) email using the sender address if the message has none.
+// Bcc recipients aren't included in the headers.
+func (m *Message) Bytes(from string) ([]byte, error) {
+	if m.From != "" {
+		from = m.From
+	}
+	if _, err := m.Recipients(); err != nil {
+		return nil, err
+	}
+
+	// Headers (in a fixed order)
+	var buf bytes.Buffer
+	fromAddress, err := formatAddresses([]string{from})
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender: %w", err)
+	}
+	writeHeader(&buf, "From", fromAddress)
+	for _, header := range []struct {
+		name      string
+		addresses []string
+	}{{"To", m.To}, {"Cc", m.Cc}, {"Reply-To", nonEmpty(m.ReplyTo)}} {
+		if len(header.addresses) == 0 {
+			continue
+		}
+		formatted, err := formatAddresses(header.addresses)
+		if err != nil {
+			return nil, err
+		}
+		writeHeader(&buf, header.name, formatted)
+	}
+	writeHeader(&buf, "Subject", mime.QEncoding.Encode("utf-8", stripNewlines(m.Subject)))
+	writeHeader(&buf, "Date", time.Now().Format(time.RFC1123Z))
+	writeHeader(&buf, "Message-ID", messageID(from))
+	writeHeader(&buf, "MIME-Version", "1.0")
+
+	// Body
+	if err := m.writeBody(&buf); err != nil {
+		return nil, fmt.Errorf("failed to build message body: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Writes the body as multipart/mixed (attachments) > multipart/related (inline images) > multipart/alternative (text and HTML)
+func (m *Message) writeBody(buf *bytes.Buffer) error {
+	var inline, attached []Attachment
+	for _, attachment := range m.Attachments {
+		if attachment.Inline {
+			inline = append(inline, attachment)
+		} else {
+			attached = append(attached, attachment)
+		}
+	}
+
+	// Outermost part's Content-Type is written with the message headers
+	var mixed, related *multipart.Writer
+	var parent *multipart.Writer
+	if len(attached) > 0 {
+		mixed = multipart.NewWriter(buf)
+		writeHeader(buf, "Content-Type", "multipart/mixed; boundary="+mixed.Boundary())
+		buf.WriteString("\r\n")
+		parent = mixed
+	}
+	if len(inline) > 0 {
+		var err error
+		if related, err = nestedWriter(buf, parent, "multipart/related"); err != nil {
+			return err
+		}
+		parent = related
+	}
+	alternative, err := nestedWriter(buf, parent, "multipart/alternative")
+	if err != nil {
+		return err
+	}
+
+	// Text and HTML alternatives (preferred last)
+	text := m.Text
+	if text == "" {
+		text = HTMLToText(m.HTML)
+	}
+	if err := writeTextPart(alternative, "text/plain; charset=utf-8", text); err != nil {
+		return err
+	}
+	if m.HTML != "" {
+		if err := writeTextPart(alternative, "text/html; charset=utf-8", m.HTML); err != nil {
+			return err
+		}
+	}
+	if err := alternative.Close(); err != nil {
+		return err
+	}
+
+	// Inline images
+	for _, attachment := range inline {
+		if err := writeAttachment(parent, attachment, "inline"); err != nil {
+			return err
+		}
+	}
+	if related != nil {
+		if err := related.Close(); err != nil {
+			return err
+		}
+	}
+	// Attachments
+	for _, attachment := range attached {
+		if err := writeAttachment(mixed, attachment, "attachment"); err != nil {
+			return err
+		}
+	}
+	if mixed != nil {
+		return mixed.Close()
+	}
+	return nil
+}
+
+// Starts a multipart section within parent (or as the message body if parent is nil)
+func nestedWriter(buf *bytes.Buffer, parent *multipart.Writer, contentType string) (*multipart.Writer, error) {
+	if parent == nil {
+		writer := multipart.NewWriter(buf)
+		writeHeader(buf, "Content-Type", contentType+"; boundary="+writer.Boundary())
+		buf.WriteString("\r\n")
+		return writer, nil
+	}
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	part, err := parent.CreatePart(textproto.MIMEHeader{"Content-Type": {contentType + "; boundary=" + boundary}})
+	if err != nil {
+		return nil, err
+	}
+	writer := multipart.NewWriter(part)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// Writes a quoted-printable text part
+func writeTextPart(writer *multipart.Writer, contentType, content string) error {
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	encoder := quotedprintable.NewWriter(part)
+	if _, err := encoder.Write([]byte(content)); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// Writes a base64 encoded attachment part
+func writeAttachment(writer *multipart.Writer, attachment Attachment, disposition string) error {
+	contentType := attachment.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(attachment.Filename))
+	}
+	if contentType == "" {
+		contentType = http.DetectContentType(attachment.Data)
+	}
+	filename := mime.QEncoding.Encode("utf-8", stripNewlines(attachment.Filename))
+	header := textproto.MIMEHeader{
+		"Content-Type":              {fmt.Sprintf("%s; name=%q", contentType, filename)},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {fmt.Sprintf("%s; filename=%q", disposition, filename)},
+	}
+	if attachment.ContentID != "" {
+		header.Set("Content-ID", "<"+stripNewlines(attachment.ContentID)+">")
+	}
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	// Lines are limited to 76 characters
+	encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+	for len(encoded) > 76 {
+		if _, err := io.WriteString(part, encoded[:76]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err = io.WriteString(part, encoded+"\r\n")
+	return err
+}
+
+// Writes a header line
+func writeHeader(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name + ": " + value + "\r\n")
+}
+
+// Parses and formats a list of addresses for a header
+func formatAddresses(addresses []string) (string, error) {
+	formatted := make([]string, 0, len(addresses))
+	for _, value := range addresses {
+		address, err := mail.ParseAddress(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid address %q: %w", value, err)
+		}
+		formatted = append(formatted, address.String())
+	}
+	return strings.Join(formatted, ", "), nil
+}
+
+// Builds a unique Message-ID using the sender's domain
+func messageID(from string) string {
+	domain := "localhost"
+	if address, err := mail.ParseAddress(from); err == nil {
+		if at := strings.LastIndex(address.Address, "@"); at >= 0 {
+			domain = address.Address[at+1:]
+		}
+	}
+	random := make([]byte, 16)
+	rand.Read(random)
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(random), domain)
+}
+
+// Returns a single value list, or nil if the value is empty
+func nonEmpty(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return []string{value}
+}
+
+// Removes line breaks (prevents header injection)
+func stripNewlines(value string) string {
+	return strings.NewReplacer("\r", "", "\n", " ").Replace(value)
+}
+
+// Used to convert HTML to plain text
+var (
+	htmlIgnoredElements = regexp.MustCompile(`(?is)<(head|style|script)[^>]*>.*?</(head|style|script)>`)
+	htmlLinks           = regexp.MustCompile(`(?is)<a\s[^>]*href\s*=\s*["']([^"']*)["'][^>]*>(.*?)</a>`)
+	htmlLineBreaks      = regexp.MustCompile(`(?i)<br\s*/?>`)
+	htmlBlockEnds       = regexp.MustCompile(`(?i)</?(p|div|h[1-6]|tr|table|ul|ol|blockquote)[^>]*>`)
+	htmlListItems       = regexp.MustCompile(`(?i)<li[^>]*>`)
+	htmlTags            = regexp.MustCompile(`<[^>]*>`)
+	spaces              = regexp.MustCompile(`[ \t]+`)
+	blankLines          = regexp.MustCompile(`\n{3,}`)
+)
+
+// HTMLToText converts an HTML body to a plain text alternative
+// (links are written as "text (url)", blocks are separated by blank lines).
+func HTMLToText(body string) string {
+	text := htmlIgnoredElements.ReplaceAllString(body, "")
+	text = htmlLinks.ReplaceAllStringFunc(text, func(link string) string {
+		match := htmlLinks.FindStringSubmatch(link)
+		label := strings.TrimSpace(htmlTags.ReplaceAllString(match[2], ""))
+		if label == "" || label == match[1] {
+			return match[1]
+		}
+		return fmt.Sprintf("%s (%s)", label, match[1])
+	})
+	text = htmlLineBreaks.ReplaceAllString(text, "\n")
+	text = htmlBlockEnds.ReplaceAllString(text, "\n\n")
+	text = htmlListItems.ReplaceAllString(text, "\n- ")
+	text = htmlTags.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+
+	// Tidy whitespace
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(spaces.ReplaceAllString(line, " "))
+	}
+	text = blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text)
+}
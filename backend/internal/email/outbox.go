@@ -0,0 +1,268 @@
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Outbox lists and reads messages captured by the file driver (see NewFileEmail)
+type Outbox interface {
+	// List returns the captured messages (headers only), newest first
+	List() ([]OutboxMessage, error)
+	// Find returns a captured message with its bodies and attachments
+	Find(id string) (*OutboxMessage, error)
+	// Raw returns a captured message as an .eml file
+	Raw(id string) ([]byte, error)
+	// Delete removes captured messages
+	Delete(ids ...string) error
+}
+
+// OutboxMessage is a message captured by the file driver
+type OutboxMessage struct {
+	// File name without the .eml extension
+	ID      string
+	From    string
+	To      string
+	Cc      string
+	Subject string
+	Date    time.Time
+	// All recipients (including Bcc)
+	Recipients  string
+	Text        string
+	HTML        string
+	Attachments []Attachment
+}
+
+// Header used to record the recipients of a captured message (Bcc recipients aren't in the message headers)
+const envelopeHeader = "X-Envelope-To"
+
+// Valid outbox message IDs (prevents reading files outside the outbox)
+var outboxID = regexp.MustCompile(`^[0-9A-Za-z-]+$`)
+
+// FileEmail writes each message as an .eml file in a directory (the outbox) instead of sending it.
+// Used in development and tests to inspect emails without a mail server.
+type FileEmail struct {
+	dir         string
+	FromAddress string
+}
+
+// NewFileEmail builds a file driver that writes messages to dir (created if missing)
+func NewFileEmail(dir, from string) (*FileEmail, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create outbox directory: %w", err)
+	}
+	return &FileEmail{dir: dir, FromAddress: from}, nil
+}
+
+// Writes a message to the outbox
+func (f *FileEmail) Send(message *Message) error {
+	_, err := f.SendWithResponse(message)
+	return err
+}
+
+// Writes a message to the outbox and returns its ID in the outbox
+func (f *FileEmail) SendWithResponse(message *Message) (string, error) {
+	msg, err := message.Bytes(f.FromAddress)
+	if err != nil {
+		return "", err
+	}
+	recipients, err := message.Recipients()
+	if err != nil {
+		return "", err
+	}
+
+	// Names start with the time sent (so they sort in order)
+	random := make([]byte, 4)
+	rand.Read(random)
+	id := fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102T150405.000000000Z"), hex.EncodeToString(random))
+	id = strings.ReplaceAll(id, ".", "-")
+	content := append([]byte(fmt.Sprintf("%s: %s\r\n", envelopeHeader, strings.Join(recipients, ", "))), msg...)
+	if err := os.WriteFile(filepath.Join(f.dir, id+".eml"), content, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write message to outbox: %w", err)
+	}
+	return "Written to outbox as " + id, nil
+}
+
+// Writes an HTML email to the outbox
+func (f *FileEmail) SendEmail(recipient, subject, body string) error {
+	return f.Send(&Message{To: []string{recipient}, Subject: subject, HTML: body})
+}
+
+// List returns the captured messages (headers only), newest first
+func (f *FileEmail) List() ([]OutboxMessage, error) {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read outbox: %w", err)
+	}
+	var ids []string
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".eml" {
+			ids = append(ids, strings.TrimSuffix(entry.Name(), ".eml"))
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+
+	messages := make([]OutboxMessage, 0, len(ids))
+	for _, id := range ids {
+		message, err := f.read(id, false)
+		if err != nil {
+			// Skip unreadable files (eg. removed since listed)
+			fmt.Printf("Outbox: Error reading %s: %v\n", id, err)
+			continue
+		}
+		messages = append(messages, *message)
+	}
+	return messages, nil
+}
+
+// Find returns a captured message with its bodies and attachments
+func (f *FileEmail) Find(id string) (*OutboxMessage, error) {
+	return f.read(id, true)
+}
+
+// Raw returns a captured message as an .eml file
+func (f *FileEmail) Raw(id string) ([]byte, error) {
+	path, err := f.path(id)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+// Delete removes captured messages
+func (f *FileEmail) Delete(ids ...string) error {
+	for _, id := range ids {
+		path, err := f.path(id)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete message %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// Returns the file path of a message
+func (f *FileEmail) path(id string) (string, error) {
+	if !outboxID.MatchString(id) {
+		return "", fmt.Errorf("invalid message ID %q", id)
+	}
+	return filepath.Join(f.dir, id+".eml"), nil
+}
+
+// Reads and parses a message (and its body if withBody is true)
+func (f *FileEmail) read(id string, withBody bool) (*OutboxMessage, error) {
+	raw, err := f.Raw(id)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse message: %w", err)
+	}
+
+	decoder := new(mime.WordDecoder)
+	subject, err := decoder.DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil {
+		subject = parsed.Header.Get("Subject")
+	}
+	date, _ := parsed.Header.Date()
+	message := &OutboxMessage{
+		ID:         id,
+		From:       parsed.Header.Get("From"),
+		To:         parsed.Header.Get("To"),
+		Cc:         parsed.Header.Get("Cc"),
+		Subject:    subject,
+		Date:       date,
+		Recipients: parsed.Header.Get(envelopeHeader),
+	}
+	if withBody {
+		if err := message.readPart(parsed.Header.Get("Content-Type"), parsed.Header.Get("Content-Transfer-Encoding"), "", "", parsed.Body); err != nil {
+			return nil, fmt.Errorf("failed to parse message body: %w", err)
+		}
+	}
+	return message, nil
+}
+
+// Reads a MIME part into the message's bodies and attachments (reading multipart sections recursively)
+func (m *OutboxMessage) readPart(contentType, encoding, disposition, contentID string, body io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	// Multipart sections
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			err = m.readPart(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part.Header.Get("Content-Disposition"), part.Header.Get("Content-ID"), part)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Decode content
+	switch strings.ToLower(encoding) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	// Text bodies (unless attached)
+	dispositionType, dispositionParams, _ := mime.ParseMediaType(disposition)
+	if dispositionType != "attachment" && dispositionType != "inline" {
+		switch {
+		case mediaType == "text/plain" && m.Text == "":
+			m.Text = string(content)
+			return nil
+		case mediaType == "text/html" && m.HTML == "":
+			m.HTML = string(content)
+			return nil
+		}
+	}
+
+	// Attachments
+	filename := dispositionParams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(filename); err == nil {
+		filename = decoded
+	}
+	m.Attachments = append(m.Attachments, Attachment{
+		Filename:    filename,
+		ContentType: mediaType,
+		Data:        content,
+		Inline:      dispositionType == "inline",
+		ContentID:   strings.Trim(contentID, "<>"),
+	})
+	return nil
+}
@@ -0,0 +1,193 @@
+package email
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html"
+	"html/template"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Email templates (.gohtml so they aren't parsed with the admin panel's .tmpl templates)
+//
+//go:embed templates
+var embeddedTemplates embed.FS
+
+// Used when no default locale is set
+const defaultLocale = "en"
+
+// TemplateRegistry holds the email templates, parsed once with the shared layout and partials.
+// Emails are found in emails/<name>.gohtml, with locale variants in emails/<name>.<locale>.gohtml (eg. password-reset.es.gohtml).
+// Each email defines a "subject" and "content" template, and may redefine partials (eg. "signature").
+type TemplateRegistry struct {
+	// Templates by name and locale ("" for the default variant)
+	templates map[string]map[string]*template.Template
+	// Locale of the default variants
+	defaultLocale string
+}
+
+// RenderedEmail is an email built from a template
+type RenderedEmail struct {
+	Subject string
+	HTML    string
+	// Locale of the variant used
+	Locale string
+}
+
+// Data passed to the layout
+type layoutData struct {
+	Locale string
+	Data   interface{}
+}
+
+// Functions available in templates
+var templateFuncs = template.FuncMap{
+	// Builds a map from key value pairs (used to pass multiple values to partials)
+	"dict": func(pairs ...interface{}) (map[string]interface{}, error) {
+		if len(pairs)%2 != 0 {
+			return nil, fmt.Errorf("dict requires key value pairs")
+		}
+		values := make(map[string]interface{}, len(pairs)/2)
+		for i := 0; i < len(pairs); i += 2 {
+			key, ok := pairs[i].(string)
+			if !ok {
+				return nil, fmt.Errorf("dict keys must be strings")
+			}
+			values[key] = pairs[i+1]
+		}
+		return values, nil
+	},
+}
+
+// LoadTemplates parses the embedded email templates. The default locale is read from EMAIL_DEFAULT_LOCALE (defaults to "en").
+func LoadTemplates() (*TemplateRegistry, error) {
+	templates, err := fs.Sub(embeddedTemplates, "templates")
+	if err != nil {
+		return nil, err
+	}
+	locale := os.Getenv("EMAIL_DEFAULT_LOCALE")
+	if locale == "" {
+		locale = defaultLocale
+	}
+	return NewTemplateRegistry(templates, locale)
+}
+
+// NewTemplateRegistry parses the layouts, partials and emails found in fsys
+func NewTemplateRegistry(fsys fs.FS, defaultLocale string) (*TemplateRegistry, error) {
+	// Shared layouts and partials (partials are optional)
+	patterns := []string{"layouts/*.gohtml"}
+	if partials, _ := fs.Glob(fsys, "partials/*.gohtml"); len(partials) > 0 {
+		patterns = append(patterns, "partials/*.gohtml")
+	}
+	base, err := template.New("email").Funcs(templateFuncs).ParseFS(fsys, patterns...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse email layouts: %w", err)
+	}
+
+	files, err := fs.Glob(fsys, "emails/*.gohtml")
+	if err != nil {
+		return nil, err
+	}
+	registry := &TemplateRegistry{
+		templates:     map[string]map[string]*template.Template{},
+		defaultLocale: normalizeLocale(defaultLocale),
+	}
+	for _, file := range files {
+		// Split file name into name and locale (eg. password-reset.es)
+		name, locale, _ := strings.Cut(strings.TrimSuffix(path.Base(file), ".gohtml"), ".")
+		locale = normalizeLocale(locale)
+
+		// Each email is parsed with its own copy of the layouts and partials (so it can redefine them)
+		tmpl, err := base.Clone()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tmpl.ParseFS(fsys, file); err != nil {
+			return nil, fmt.Errorf("failed to parse email template %s: %w", file, err)
+		}
+		for _, required := range []string{"layout", "subject", "content"} {
+			if tmpl.Lookup(required) == nil {
+				return nil, fmt.Errorf("email template %s has no %q template", file, required)
+			}
+		}
+
+		if registry.templates[name] == nil {
+			registry.templates[name] = map[string]*template.Template{}
+		}
+		registry.templates[name][locale] = tmpl
+	}
+	return registry, nil
+}
+
+// Render builds an email from the named template using the variant for the locale
+// (falling back to the language, eg. "es" for "es-MX", then the default variant).
+// Example usage: rendered, err := registry.Render("password-reset", user.Locale, data)
+func (r *TemplateRegistry) Render(name, locale string, data interface{}) (*RenderedEmail, error) {
+	variants, ok := r.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("email template %q not found", name)
+	}
+	tmpl, locale := r.variant(variants, normalizeLocale(locale))
+
+	// Subject (plain text, so escaping is removed)
+	var subject bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("failed to render subject of %q: %w", name, err)
+	}
+	// Body
+	var body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&body, "layout", layoutData{Locale: locale, Data: data}); err != nil {
+		return nil, fmt.Errorf("failed to render email %q: %w", name, err)
+	}
+
+	return &RenderedEmail{
+		Subject: strings.Join(strings.Fields(html.UnescapeString(subject.String())), " "),
+		HTML:    body.String(),
+		Locale:  locale,
+	}, nil
+}
+
+// Names returns the names of the registered templates
+func (r *TemplateRegistry) Names() []string {
+	names := make([]string, 0, len(r.templates))
+	for name := range r.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Selects the variant for a locale and returns it with its locale
+func (r *TemplateRegistry) variant(variants map[string]*template.Template, locale string) (*template.Template, string) {
+	// Exact match, then language
+	language, _, _ := strings.Cut(locale, "-")
+	for _, candidate := range []string{locale, language} {
+		if tmpl, ok := variants[candidate]; ok && candidate != "" {
+			return tmpl, candidate
+		}
+	}
+	// Default variant
+	if tmpl, ok := variants[""]; ok {
+		return tmpl, r.defaultLocale
+	}
+	if tmpl, ok := variants[r.defaultLocale]; ok {
+		return tmpl, r.defaultLocale
+	}
+	// Any variant (emails without a default)
+	locales := make([]string, 0, len(variants))
+	for candidate := range variants {
+		locales = append(locales, candidate)
+	}
+	sort.Strings(locales)
+	return variants[locales[0]], locales[0]
+}
+
+// Normalizes a locale (eg. "es_MX" to "es-mx")
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
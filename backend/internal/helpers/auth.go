@@ -1,6 +1,8 @@
 package helpers
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"strings"
 	"time"
 
@@ -27,6 +29,66 @@ func GenerateVerificationCodeAndSetExpiry() (*db.User, error) {
 	return userUpdate, nil
 }
 
+// Generates a password reset token for a user, returning the token to email and the token record to store (with only the token's hash)
+func GeneratePasswordResetToken(userID uint, validFor time.Duration) (string, *db.PasswordResetToken, error) {
+	token, err := utility.GenerateRandomString(40)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, &db.PasswordResetToken{
+		UserID:    userID,
+		TokenHash: HashToken(token),
+		ExpiresAt: time.Now().Add(validFor),
+	}, nil
+}
+
+// Generates a refresh token for a user, returning the token and the token record to store (with only the token's hash)
+// An empty familyID starts a new family (on login)
+func GenerateRefreshToken(userID uint, familyID string, validFor time.Duration) (string, *db.RefreshToken, error) {
+	token, err := utility.GenerateRandomString(48)
+	if err != nil {
+		return "", nil, err
+	}
+	if familyID == "" {
+		familyID, err = utility.GenerateRandomString(20)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	return token, &db.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: HashToken(token),
+		ExpiresAt: time.Now().Add(validFor),
+	}, nil
+}
+
+// Prefix of API keys (makes keys easy to recognise, eg. by secret scanners)
+const apiKeyPrefix = "gtk_"
+
+// Generates an API key for a user, returning the key and the key record to store (with only the key's hash)
+func GenerateApiKey(userID uint, name string, scopes []string, expiresAt *time.Time) (string, *db.ApiKey, error) {
+	secret, err := utility.GenerateRandomString(40)
+	if err != nil {
+		return "", nil, err
+	}
+	key := apiKeyPrefix + secret
+	return key, &db.ApiKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    key[:len(apiKeyPrefix)+6],
+		KeyHash:   HashToken(key),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// Hashes a token for storage and lookup (SHA-256 as hex)
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 // SearchG2Records searches through all fields of each G2Record for the searchTerm and adds any match found in the results
 func SearchGRecords(records []models.GRecord, searchTerm string) []models.GRecord {
 	var result []models.GRecord
@@ -2,8 +2,11 @@ package helpers_test
 
 import (
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/dmawardi/Go-Template/internal/helpers"
 	"github.com/dmawardi/Go-Template/internal/helpers/request"
 	"github.com/dmawardi/Go-Template/internal/helpers/utility"
 	"github.com/dmawardi/Go-Template/internal/models"
@@ -133,3 +136,70 @@ func TestGenerateRandomString(t *testing.T) {
 func isLetterOrDigit(r rune) bool {
 	return ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9')
 }
+
+// TestTOTPCode tests codes against the RFC 6238 test vectors (SHA1, last 6 digits)
+func TestTOTPCode(t *testing.T) {
+	// Base32 of "12345678901234567890"
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		got, err := helpers.TOTPCode(secret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("TOTPCode() error = %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("TOTPCode() at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+
+	// Codes from the previous and next period are accepted
+	now := time.Unix(1234567890, 0)
+	for _, offset := range []time.Duration{-30 * time.Second, 0, 30 * time.Second} {
+		code, _ := helpers.TOTPCode(secret, now.Add(offset))
+		if _, ok := helpers.ValidateTOTP(secret, code, now); !ok {
+			t.Errorf("ValidateTOTP() rejected code from offset %v", offset)
+		}
+	}
+	oldCode, _ := helpers.TOTPCode(secret, now.Add(-2*time.Minute))
+	if _, ok := helpers.ValidateTOTP(secret, oldCode, now); ok {
+		t.Error("ValidateTOTP() accepted an expired code")
+	}
+	if _, ok := helpers.ValidateTOTP(secret, "abc", now); ok {
+		t.Error("ValidateTOTP() accepted an invalid code")
+	}
+}
+
+// TestGenerateRecoveryCodes tests recovery codes are unique and match their hashes (ignoring case and dashes)
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, hashes, err := helpers.GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes() error = %v", err)
+	}
+	if len(codes) != 10 || len(hashes) != 10 {
+		t.Fatalf("GenerateRecoveryCodes() got %d codes and %d hashes, want 10", len(codes), len(hashes))
+	}
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if seen[code] {
+			t.Errorf("GenerateRecoveryCodes() returned duplicate code %s", code)
+		}
+		seen[code] = true
+		if helpers.HashRecoveryCode(strings.ToUpper(strings.ReplaceAll(code, "-", ""))) != hashes[i] {
+			t.Errorf("HashRecoveryCode() of %s doesn't match its hash", code)
+		}
+	}
+
+	// otpauth URI includes the issuer and secret
+	uri := helpers.TOTPURI("Go Template", "user@example.com", "SECRET")
+	if !strings.HasPrefix(uri, "otpauth://totp/Go%20Template:user@example.com?") || !strings.Contains(uri, "secret=SECRET") {
+		t.Errorf("TOTPURI() = %s", uri)
+	}
+}
@@ -1,11 +1,14 @@
 package request
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dmawardi/Go-Template/internal/models"
 )
@@ -25,6 +28,31 @@ func WriteAsJSON(w http.ResponseWriter, data interface{}) error {
 	return nil
 }
 
+// Returns the IP address of the client (without the port)
+// Forwarded headers aren't trusted, so behind a reverse proxy use middleware that sets RemoteAddr (eg. chi's RealIP)
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Context key for the version of the record matched by a request's If-Match header
+type expectedVersionKey struct{}
+
+// Returns the request with the version (updated_at) of the record matched by its If-Match header
+func WithExpectedVersion(r *http.Request, version time.Time) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), expectedVersionKey{}, version))
+}
+
+// Returns the version of the record matched by the request's If-Match header (zero if not sent).
+// Passed to updates so they only apply if the record hasn't changed since.
+func ExpectedVersion(r *http.Request) time.Time {
+	version, _ := r.Context().Value(expectedVersionKey{}).(time.Time)
+	return version
+}
+
 // URL parameter extraction helper functions
 // Special handling for search query if found
 func addSearchQueryToConditions(r *http.Request, conditionsToExtract map[string]string, currentConditions []models.QueryConditionParameters) []models.QueryConditionParameters {
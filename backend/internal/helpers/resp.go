@@ -0,0 +1,302 @@
+package helpers
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RESPServer is a minimal in-process Redis protocol (RESP) server used to test the Redis cache
+// without a Redis server. It supports the commands used by the cache (strings, sets and expiry).
+type RESPServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	// Open connections (closed with the server)
+	conns map[net.Conn]bool
+	// Values by key (string or set)
+	values map[string]interface{}
+	// Expiry times by key
+	expiry map[string]time.Time
+	wg     sync.WaitGroup
+}
+
+// StartRESPServer starts a RESP server listening on a random local port
+func StartRESPServer() (*RESPServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &RESPServer{
+		listener: listener,
+		conns:    map[net.Conn]bool{},
+		values:   map[string]interface{}{},
+		expiry:   map[string]time.Time{},
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the address the server is listening on
+func (s *RESPServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops the server and closes open connections
+func (s *RESPServer) Close() error {
+	err := s.listener.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// Accepts connections until closed
+func (s *RESPServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+// Reads commands from a connection and writes replies
+func (s *RESPServer) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	for {
+		args, err := readRESPCommand(reader)
+		if err != nil {
+			return
+		}
+		writer.WriteString(s.execute(args))
+		if err := writer.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// Executes a command and returns the encoded reply
+func (s *RESPServer) execute(args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(args) == 0 {
+		return "-ERR empty command\r\n"
+	}
+	// Remove expired keys
+	now := time.Now()
+	for key, expiry := range s.expiry {
+		if now.After(expiry) {
+			delete(s.values, key)
+			delete(s.expiry, key)
+		}
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "AUTH", "SELECT":
+		return "+OK\r\n"
+	case "FLUSHDB":
+		s.values = map[string]interface{}{}
+		s.expiry = map[string]time.Time{}
+		return "+OK\r\n"
+	case "DBSIZE":
+		return respInteger(len(s.values))
+	case "GET":
+		if len(args) != 2 {
+			return respArgumentError(args[0])
+		}
+		value, ok := s.values[args[1]].(string)
+		if !ok {
+			return "$-1\r\n"
+		}
+		return respBulk(value)
+	case "SET":
+		if len(args) < 3 {
+			return respArgumentError(args[0])
+		}
+		s.values[args[1]] = args[2]
+		delete(s.expiry, args[1])
+		// Expiry options
+		for i := 3; i+1 < len(args); i += 2 {
+			amount, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return "-ERR value is not an integer\r\n"
+			}
+			switch strings.ToUpper(args[i]) {
+			case "EX":
+				s.expiry[args[1]] = now.Add(time.Duration(amount) * time.Second)
+			case "PX":
+				s.expiry[args[1]] = now.Add(time.Duration(amount) * time.Millisecond)
+			}
+		}
+		return "+OK\r\n"
+	case "DEL", "UNLINK":
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, ok := s.values[key]; ok {
+				delete(s.values, key)
+				delete(s.expiry, key)
+				deleted++
+			}
+		}
+		return respInteger(deleted)
+	case "EXISTS":
+		found := 0
+		for _, key := range args[1:] {
+			if _, ok := s.values[key]; ok {
+				found++
+			}
+		}
+		return respInteger(found)
+	case "PEXPIRE":
+		if len(args) != 3 {
+			return respArgumentError(args[0])
+		}
+		milliseconds, err := strconv.Atoi(args[2])
+		if err != nil {
+			return "-ERR value is not an integer\r\n"
+		}
+		if _, ok := s.values[args[1]]; !ok {
+			return respInteger(0)
+		}
+		s.expiry[args[1]] = now.Add(time.Duration(milliseconds) * time.Millisecond)
+		return respInteger(1)
+	case "PTTL":
+		if len(args) != 2 {
+			return respArgumentError(args[0])
+		}
+		if _, ok := s.values[args[1]]; !ok {
+			return respInteger(-2)
+		}
+		expiry, ok := s.expiry[args[1]]
+		if !ok {
+			return respInteger(-1)
+		}
+		return respInteger(int(expiry.Sub(now).Milliseconds()))
+	case "SADD":
+		if len(args) < 3 {
+			return respArgumentError(args[0])
+		}
+		set, ok := s.values[args[1]].(map[string]bool)
+		if !ok {
+			set = map[string]bool{}
+			s.values[args[1]] = set
+		}
+		added := 0
+		for _, member := range args[2:] {
+			if !set[member] {
+				set[member] = true
+				added++
+			}
+		}
+		return respInteger(added)
+	case "SREM":
+		if len(args) < 3 {
+			return respArgumentError(args[0])
+		}
+		set, _ := s.values[args[1]].(map[string]bool)
+		removed := 0
+		for _, member := range args[2:] {
+			if set[member] {
+				delete(set, member)
+				removed++
+			}
+		}
+		// Empty sets are removed
+		if set != nil && len(set) == 0 {
+			delete(s.values, args[1])
+			delete(s.expiry, args[1])
+		}
+		return respInteger(removed)
+	case "SMEMBERS":
+		if len(args) != 2 {
+			return respArgumentError(args[0])
+		}
+		set, _ := s.values[args[1]].(map[string]bool)
+		reply := fmt.Sprintf("*%d\r\n", len(set))
+		for member := range set {
+			reply += respBulk(member)
+		}
+		return reply
+	default:
+		return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+	}
+}
+
+// Reads a command sent as an array of bulk strings
+func readRESPCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("expected array, got %q", line)
+	}
+	count, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, count)
+	for i := range args {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if !strings.HasPrefix(line, "$") {
+			return nil, fmt.Errorf("expected bulk string, got %q", line)
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		// Read string and trailing CRLF
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}
+
+// Encodes a bulk string reply
+func respBulk(value string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+}
+
+// Encodes an integer reply
+func respInteger(value int) string {
+	return fmt.Sprintf(":%d\r\n", value)
+}
+
+// Encodes a wrong number of arguments error reply
+func respArgumentError(command string) string {
+	return fmt.Sprintf("-ERR wrong number of arguments for '%s' command\r\n", strings.ToLower(command))
+}
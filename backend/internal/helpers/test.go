@@ -13,6 +13,7 @@ import (
 	"testing"
 
 	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/email"
 	"github.com/glebarez/sqlite"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
@@ -25,6 +26,11 @@ func SetupTestDatabase() *gorm.DB {
 	if err != nil {
 		fmt.Printf("failed to open database: %v", err)
 	}
+	// Each connection to an in-memory database is a new database, so limit to one connection
+	// (allows background workers to share the test database)
+	if sqlDB, err := dbClient.DB(); err == nil {
+		sqlDB.SetMaxOpenConns(1)
+	}
 
 	// Migrate the database schema
 	for _, table := range db.Models {
@@ -175,6 +181,10 @@ func HashPassAndGenerateUserInDb(user *db.User, client *gorm.DB, t *testing.T) (
 type EmailMock struct {
 }
 
+func (e *EmailMock) Send(message *email.Message) error {
+	return nil
+}
+
 func (e *EmailMock) SendEmail(recipient, subject, body string) error {
 	return nil
 }
@@ -1,9 +1,6 @@
 package webapi
 
 import (
-	"bytes"
-	"html/template"
-
 	"github.com/dmawardi/Go-Template/internal/models"
 	"gorm.io/gorm"
 )
@@ -55,19 +52,14 @@ func NewAdminController[Serv any, AS ActionService](controllerFunc func(Serv, AS
 	}
 }
 
-// LoadTemplate parses an HTML template, executes it with the provided data, and returns the result as a string.
-func LoadTemplate(templateFilePath string, data interface{}) (string, error) {
-	// Parse the template file
-	t, err := template.ParseFiles(templateFilePath)
-	if err != nil {
-		return "", err
-	}
-
-	// Build the template with the injected data
-	var tpl bytes.Buffer
-	if err := t.Execute(&tpl, data); err != nil {
-		return "", err
+// Helper function to register a module's job handlers. Takes a registration function that accepts the module's service
+// and returns a function that takes an interface (used in EntityConfig.RegisterJobHandlers)
+func NewJobHandlers[Serv any](registerFunc func(Serv)) func(interface{}) {
+	return func(serviceInterface interface{}) {
+		service, ok := serviceInterface.(Serv)
+		if !ok {
+			panic("Incorrect service type")
+		}
+		registerFunc(service)
 	}
-
-	return tpl.String(), nil
 }
@@ -1,6 +1,12 @@
 package models
 
-import "net/http"
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrRecordModified is returned by updates given a version (updated_at) when the record has changed since
+var ErrRecordModified = errors.New("record has been modified")
 
 type BasicController interface {
 	FindAll(w http.ResponseWriter, r *http.Request)
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+)
+
+// Used to create an API key
+type CreateApiKey struct {
+	Name string `json:"name" valid:"length(1|80),required"`
+	// Actions and paths the key can be used for, written as <action>:<path> (eg. read:/api/posts or *:/api/posts/*)
+	Scopes []string `json:"scopes"`
+	// Optional. The key can't be used after this time
+	ExpiresAt *time.Time `swaggertype:"string" json:"expires_at,omitempty"`
+}
+
+// Returned when an API key is created. The key is only shown once
+type CreatedApiKey struct {
+	Key    string     `json:"key"`
+	ApiKey *db.ApiKey `json:"api_key"`
+}
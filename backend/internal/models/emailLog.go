@@ -0,0 +1,18 @@
+package models
+
+import "github.com/dmawardi/Go-Template/internal/db"
+
+type PaginatedEmailLogs struct {
+	Data *[]db.EmailLog `json:"data"`
+	Meta SchemaMetaData `json:"meta"`
+}
+
+// Used to search email logs (empty fields are ignored)
+type EmailLogFilter struct {
+	UserID    uint
+	Recipient string
+	Status    string
+	Template  string
+	// Matches recipient, subject, template or response
+	Search string
+}
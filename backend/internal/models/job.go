@@ -0,0 +1,8 @@
+package models
+
+import "github.com/dmawardi/Go-Template/internal/db"
+
+type PaginatedJobs struct {
+	Data *[]db.Job      `json:"data"`
+	Meta SchemaMetaData `json:"meta"`
+}
@@ -1,10 +1,5 @@
 package models
 
-type Job struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
-}
-
 // Conditions when using a findall route
 type QueryConditionParameters struct {
 	Condition string
@@ -15,6 +10,9 @@ type QueryConditionParameters struct {
 type Login struct {
 	Email    string `json:"email" valid:"email,required"`
 	Password string `json:"password" valid:"required"`
+	// Set by the controller from the request (used to throttle failed logins and record sessions)
+	IPAddress string `json:"-"`
+	UserAgent string `json:"-"`
 }
 
 type ValidationError struct {
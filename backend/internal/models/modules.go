@@ -1,6 +1,10 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"encoding/json"
+
+	"gorm.io/gorm"
+)
 
 // Used in API setup to standardize the array of setup configurations
 type EntityConfig struct {
@@ -31,3 +35,19 @@ type BasicPaginatedResponse[dbSchema any] struct {
 	Data *[]dbSchema	`json:"data"`
 	Meta SchemaMetaData 		`json:"meta"`
 }
+
+// Decodes the meta data into the schema meta data struct (allows responses to be decoded, eg. from the cache)
+func (response *BasicPaginatedResponse[dbSchema]) UnmarshalJSON(data []byte) error {
+	var decoded struct {
+		Data *[]dbSchema      `json:"data"`
+		Meta *schemaMetaData `json:"meta"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	response.Data = decoded.Data
+	if decoded.Meta != nil {
+		response.Meta = decoded.Meta
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+package models
+
+import "github.com/dmawardi/Go-Template/internal/db"
+
+// An active session of the current user
+type UserSession struct {
+	db.Session
+	// Set for the session the request was made in
+	Current bool `json:"current"`
+}
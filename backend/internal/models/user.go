@@ -9,7 +9,52 @@ import (
 )
 
 type LoginResponse struct {
-	Token string `json:"token"`
+	// Access token (JWT)
+	Token string `json:"token,omitempty"`
+	// Used to get a new access token once it expires (see /api/users/refresh)
+	RefreshToken string `json:"refresh_token,omitempty"`
+	// Seconds until the access token (or two factor token) expires
+	ExpiresIn int `json:"expires_in"`
+	// Set for users with two factor authentication. The login is completed by sending the token with a code (see /api/users/login/2fa)
+	TwoFactorRequired bool   `json:"two_factor_required,omitempty"`
+	TwoFactorToken    string `json:"two_factor_token,omitempty"`
+}
+
+// Used to complete a login with a code from the user's authenticator app (or a recovery code)
+type TwoFactorLogin struct {
+	TwoFactorToken string `json:"two_factor_token" valid:"required"`
+	Code           string `json:"code" valid:"required"`
+	// Set by the controller from the request (used to record sessions)
+	IPAddress string `json:"-"`
+	UserAgent string `json:"-"`
+}
+
+// Used to confirm or disable two factor authentication
+type TwoFactorCode struct {
+	Code string `json:"code" valid:"required"`
+}
+
+// Returned when setting up two factor authentication
+type TwoFactorEnrollment struct {
+	// Base32 secret (for manual entry in authenticator apps)
+	Secret string `json:"secret"`
+	// otpauth URI (shown as a QR code)
+	URI string `json:"uri"`
+}
+
+// Returned once two factor authentication is enabled. The codes are only shown once
+type TwoFactorRecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// Used to log out (the refresh token's family is also revoked if provided)
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// Used to exchange a refresh token for a new access token (and refresh token)
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" valid:"required"`
 }
 
 type ChangePassword struct {
@@ -27,6 +72,7 @@ type CreateUser struct {
 	Email    string `json:"email" valid:"email,required"`
 	Verified bool   `json:"verified,omitempty"`
 	Role     string `json:"role,omitempty" valid:""`
+	Locale   string `json:"locale,omitempty" valid:"length(2|10)"`
 }
 
 // Update User structure for Data transfer.
@@ -37,12 +83,19 @@ type UpdateUser struct {
 	Email    string `json:"email,omitempty" valid:"email"`
 	Verified bool   `json:"verified,omitempty"`
 	Role     string `json:"role,omitempty" valid:""`
+	Locale   string `json:"locale,omitempty" valid:"length(2|10)"`
 }
 
 type ResetPasswordAndEmailVerification struct {
 	Email string `json:"email" valid:"email,required"`
 }
 
+// Used to set a new password using the token from a password reset email
+type ConfirmPasswordReset struct {
+	Token    string `json:"token" valid:"required"`
+	Password string `json:"password" valid:"length(6|30),required"`
+}
+
 type PaginatedUsers struct {
 	Data *[]db.User     `json:"data"`
 	Meta SchemaMetaData `json:"meta"`
@@ -68,10 +121,13 @@ type UserWithRole struct {
 	Email     string         `json:"email,omitempty"`
 	Password  string         `json:"-"`
 	Role      string         `json:"role,omitempty"`
+	Locale    string         `json:"locale,omitempty"`
 	// Verification
 	Verified               *bool     `json:"verified,omitempty" gorm:"default:false"`
 	VerificationCode       string    `json:"verification_code,omitempty" gorm:"default:null"`
 	VerificationCodeExpiry time.Time `json:"verification_code_expiry,omitempty" gorm:"default:null"`
+	// Two factor authentication
+	TwoFactorEnabled bool `json:"two_factor_enabled"`
 }
 
 func (schemaObject UserWithRole) ObtainValue(keyValue string) string {
@@ -86,6 +142,7 @@ func (schemaObject UserWithRole) ObtainValue(keyValue string) string {
 		"VerificationCode":       schemaObject.VerificationCode,
 		"VerificationCodeExpiry": schemaObject.VerificationCodeExpiry.Format(time.RFC3339),
 		"Role":                   schemaObject.Role,
+		"TwoFactorEnabled":       fmt.Sprint(schemaObject.TwoFactorEnabled),
 	}
 	// Return value of key
 	return fieldMap[keyValue]
@@ -20,6 +20,10 @@ var ModulesToSetup = []EntityConfig{
 		NewService:         webapi.NewService(moduleservices.NewPostService),
 		NewController:      webapi.NewController(modulecontrollers.NewPostController),
 		NewAdminController: webapi.NewAdminController(adminpanel.NewAdminPostController),
+		// (Optional) Register background job handlers using the module's service
+		// eg. RegisterJobHandlers: webapi.NewJobHandlers(func(s moduleservices.PostService) {
+		// 	queue.Register("post-thumbnail", s.GenerateThumbnail)
+		// }),
 	},
 	// ADD ADDITIONAL BASIC MODULES HERE
 }
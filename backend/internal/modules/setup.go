@@ -18,6 +18,11 @@ func SetupModules(modulesToSetup []EntityConfig, client *gorm.DB, actionService
 		service := module.NewService(repo)
 		controller := module.NewController(service)
 
+		// Register the module's job handlers (if any) with the job queue
+		if module.RegisterJobHandlers != nil {
+			module.RegisterJobHandlers(service)
+		}
+
 		// Assign constructor function to newAdminController
 		newAdminController := module.NewAdminController
 		// If admin controller constructor is not nil, add it to the module map
@@ -59,6 +64,9 @@ type EntityConfig struct {
 	NewService         func(interface{}) interface{}
 	NewController      func(interface{}) interface{}
 	NewAdminController func(interface{}, webapi.ActionService) models.BasicAdminController
+	// RegisterJobHandlers (optional) is called with the module's service at startup to register
+	// the module's background job handlers using queue.Register
+	RegisterJobHandlers func(interface{})
 	// PolicySet is used to setup the different policies for the module
 	// The policy set will set the policy for the non-admin CRUD portion of the API
 	PolicySet ModulePolicySet
@@ -0,0 +1,122 @@
+package queue
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Number of times a worker retries a claim after losing a race to another worker
+const maxClaimRetries = 5
+
+// ClaimJob claims the next job that is due to run for the given worker.
+// A job is claimable if it is pending and due, or if it is running but its lease has expired
+// (ie. the worker holding it crashed). Claiming a job counts as an attempt.
+// Higher priority jobs are claimed first, and job types that have reached their rate limit are skipped.
+//
+// On Postgres the candidate row is locked using FOR UPDATE SKIP LOCKED so concurrent workers
+// (including workers in other instances) skip over it. On databases without row locking (SQLite)
+// the claim is a conditional update that only succeeds for one worker.
+// Returns gorm.ErrRecordNotFound if no job is available.
+func (q *Queue) ClaimJob(workerID string) (*db.Job, error) {
+	for try := 0; try < maxClaimRetries; try++ {
+		job, claimed, err := q.claimNext(workerID)
+		if err != nil {
+			return nil, err
+		}
+		// If another worker won the race (or an abandoned job was retired), try again
+		if !claimed {
+			continue
+		}
+		return job, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// Attempts to claim the next claimable job. Returns false if the claim was lost to another worker.
+func (q *Queue) claimNext(workerID string) (*db.Job, bool, error) {
+	var job db.Job
+	claimed := false
+	err := q.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		postgres := q.db.Dialector.Name() == "postgres"
+		// Build query for the next claimable job
+		query := tx.Where("((status = ? AND (next_run_at IS NULL OR next_run_at <= ?)) OR (status = ? AND locked_until < ?))",
+			db.JobStatusPending, now, db.JobStatusRunning, now).
+			Order("priority DESC, next_run_at, id")
+		// Skip job types that have reached their rate limit
+		throttled, err := q.throttledTypes(tx, now)
+		if err != nil {
+			return err
+		}
+		if len(throttled) > 0 {
+			query = query.Where("job_type NOT IN ?", throttled)
+		}
+		// Lock the row, skipping rows locked by other workers (where supported)
+		if postgres {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+		if err := query.First(&job).Error; err != nil {
+			return err
+		}
+
+		// On Postgres, recount the rate limit while holding a lock for the job type
+		// so concurrent workers can't both take the last slot
+		if limit, ok := q.rateLimit(job.JobType); ok && postgres {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "queue-rate:"+job.JobType).Error; err != nil {
+				return err
+			}
+			reached, err := rateLimitReached(tx, job.JobType, limit, now)
+			if err != nil {
+				return err
+			}
+			// Leave the job for later (not claimed)
+			if reached {
+				return nil
+			}
+		}
+
+		// Updates only apply if the job hasn't changed since it was read (guards against races without row locking)
+		guard := tx.Model(&db.Job{}).Where("id = ? AND status = ? AND attempts = ?", job.ID, job.Status, job.Attempts)
+
+		// If the lease expired on a job that has used all of its attempts, move it to dead letter
+		if job.Status == db.JobStatusRunning && job.Attempts >= maxAttempts(&job) {
+			return guard.Updates(map[string]interface{}{
+				"status":       db.JobStatusDead,
+				"last_error":   fmt.Sprintf("lease held by %s expired after %d attempts", job.LockedBy, job.Attempts),
+				"locked_by":    "",
+				"locked_until": nil,
+			}).Error
+		}
+
+		// Claim the job
+		lockedUntil := now.Add(q.leaseTimeout)
+		result := guard.Updates(map[string]interface{}{
+			"status":       db.JobStatusRunning,
+			"attempts":     job.Attempts + 1,
+			"locked_by":    workerID,
+			"locked_until": lockedUntil,
+			"started_at":   now,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		// Claimed if the guard matched
+		if result.RowsAffected == 1 {
+			claimed = true
+			job.Status = db.JobStatusRunning
+			job.Attempts++
+			job.LockedBy = workerID
+			job.LockedUntil = lockedUntil
+			job.StartedAt = now
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return &job, claimed, nil
+}
@@ -1,24 +1,73 @@
 package queue
 
 import (
-	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/email"
+	"gorm.io/gorm"
 )
 
+// Job type used for sending emails
+const EmailJobType = "email"
+
 // EmailJobPayload defines the structure of the email job payload
 type EmailJobPayload struct {
 	Recipient string
 	Subject   string
 	Body      string
+	// Recorded in the email log (optional)
+	Template string
+	UserID   uint
 }
 
-// ProcessEmailJob processes an email job
-func (q *Queue) ProcessEmailJob(payload string) error {
-	var emailPayload EmailJobPayload
-	// Unmarshal the payload into the email payload struct
-	if err := json.Unmarshal([]byte(payload), &emailPayload); err != nil {
-		return err
+// ProcessEmailJob processes an email job and records the delivery in the email log
+func (q *Queue) ProcessEmailJob(job *db.Job, payload EmailJobPayload) error {
+	message := &email.Message{To: []string{payload.Recipient}, Subject: payload.Subject, HTML: payload.Body}
+
+	// Use the mail service to send the email (with the server's reply if supported)
+	var response string
+	var err error
+	if sender, ok := q.mailService.(email.ResponseSender); ok {
+		response, err = sender.SendWithResponse(message)
+	} else {
+		err = q.mailService.Send(message)
 	}
 
-	// Use the mail service to send the email
-	return q.mailService.SendEmail(emailPayload.Recipient, emailPayload.Subject, emailPayload.Body)
+	// Record the delivery (errors are logged so a sent email isn't retried)
+	if logErr := q.logEmail(job, payload, response, err); logErr != nil {
+		log.Printf("Queue: Error recording email log for job %d: %v\n", job.ID, logErr)
+	}
+	return err
+}
+
+// Records an attempt to send an email job's email, updating the job's existing log (if any)
+func (q *Queue) logEmail(job *db.Job, payload EmailJobPayload, response string, sendErr error) error {
+	emailLog := db.EmailLog{}
+	// Find the job's log from previous attempts
+	if job.ID != 0 {
+		err := q.db.Where("job_id = ?", job.ID).First(&emailLog).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+	}
+
+	emailLog.UserID = payload.UserID
+	emailLog.Recipient = payload.Recipient
+	emailLog.Subject = payload.Subject
+	emailLog.Template = payload.Template
+	emailLog.JobID = job.ID
+	emailLog.Attempts++
+	// Status
+	if sendErr != nil {
+		emailLog.Status = db.EmailStatusFailed
+		emailLog.Response = sendErr.Error()
+	} else {
+		emailLog.Status = db.EmailStatusSent
+		emailLog.Response = response
+		emailLog.SentAt = time.Now()
+	}
+	return q.db.Save(&emailLog).Error
 }
@@ -0,0 +1,187 @@
+package queue
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+)
+
+// Maintenance job types (usually run on a schedule, see Queue.Schedule)
+const (
+	// Clears verification codes that have expired
+	PurgeVerificationCodesJobType = "purge-verification-codes"
+	// Deletes password reset tokens that have expired
+	PurgePasswordResetTokensJobType = "purge-password-reset-tokens"
+	// Deletes refresh tokens that have expired
+	PurgeRefreshTokensJobType = "purge-refresh-tokens"
+	// Deletes revoked access tokens that have expired
+	PurgeRevokedTokensJobType = "purge-revoked-tokens"
+	// Deletes failed login counters without recent failures
+	PurgeLoginThrottlesJobType = "purge-login-throttles"
+	// Deletes sessions that have expired
+	PurgeSessionsJobType = "purge-sessions"
+	// Deletes recorded admin actions older than the given number of days
+	PruneActionsJobType = "prune-actions"
+	// Deletes processed jobs older than the given number of days
+	PruneJobsJobType = "prune-jobs"
+	// Deletes email logs older than the given number of days
+	PruneEmailLogsJobType = "prune-email-logs"
+	// Deletes login events older than the given number of days
+	PruneLoginEventsJobType = "prune-login-events"
+)
+
+// PrunePayload defines the structure of the prune job payloads
+type PrunePayload struct {
+	OlderThanDays int `json:"older_than_days"`
+}
+
+// Registers the maintenance job handlers
+func registerMaintenanceHandlers() {
+	registerHandler(PurgeVerificationCodesJobType, withQueue((*Queue).purgeExpiredVerificationCodes))
+	registerHandler(PurgePasswordResetTokensJobType, withQueue((*Queue).purgeExpiredPasswordResetTokens))
+	registerHandler(PurgeRefreshTokensJobType, withQueue((*Queue).purgeExpiredRefreshTokens))
+	registerHandler(PurgeRevokedTokensJobType, withQueue((*Queue).purgeExpiredRevokedTokens))
+	registerHandler(PurgeLoginThrottlesJobType, withQueue((*Queue).purgeLoginThrottles))
+	registerHandler(PurgeSessionsJobType, withQueue((*Queue).purgeExpiredSessions))
+	registerHandler(PruneActionsJobType, withQueue((*Queue).pruneActions))
+	registerHandler(PruneJobsJobType, withQueue((*Queue).pruneJobs))
+	registerHandler(PruneEmailLogsJobType, withQueue((*Queue).pruneEmailLogs))
+	registerHandler(PruneLoginEventsJobType, withQueue((*Queue).pruneLoginEvents))
+}
+
+// Adapts a maintenance handler (which doesn't need the job) for registerHandler
+func withQueue[T any](handler func(*Queue, T) error) func(*Queue, *db.Job, T) error {
+	return func(q *Queue, _ *db.Job, payload T) error {
+		return handler(q, payload)
+	}
+}
+
+// Clears expired verification codes from users
+func (q *Queue) purgeExpiredVerificationCodes(_ struct{}) error {
+	result := q.db.Model(&db.User{}).
+		Where("verification_code IS NOT NULL AND verification_code_expiry < ?", time.Now()).
+		Updates(map[string]interface{}{"verification_code": nil, "verification_code_expiry": nil})
+	if result.Error != nil {
+		return result.Error
+	}
+	log.Printf("Maintenance: Purged %d expired verification codes\n", result.RowsAffected)
+	return nil
+}
+
+// Deletes expired password reset tokens (used tokens are kept until they expire)
+func (q *Queue) purgeExpiredPasswordResetTokens(_ struct{}) error {
+	result := q.db.Where("expires_at < ?", time.Now()).Delete(&db.PasswordResetToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	log.Printf("Maintenance: Purged %d expired password reset tokens\n", result.RowsAffected)
+	return nil
+}
+
+// Deletes expired refresh tokens (used tokens are kept until they expire to detect reuse)
+func (q *Queue) purgeExpiredRefreshTokens(_ struct{}) error {
+	result := q.db.Where("expires_at < ?", time.Now()).Delete(&db.RefreshToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	log.Printf("Maintenance: Purged %d expired refresh tokens\n", result.RowsAffected)
+	return nil
+}
+
+// Deletes revoked access tokens that have expired (expired tokens are rejected anyway)
+func (q *Queue) purgeExpiredRevokedTokens(_ struct{}) error {
+	result := q.db.Where("expires_at < ?", time.Now()).Delete(&db.RevokedToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	log.Printf("Maintenance: Purged %d expired revoked tokens\n", result.RowsAffected)
+	return nil
+}
+
+// Deletes failed login counters that aren't locked and haven't failed in the last day (they're reset after the lockout duration anyway)
+func (q *Queue) purgeLoginThrottles(_ struct{}) error {
+	now := time.Now()
+	result := q.db.Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)", now.Add(-24*time.Hour), now).Delete(&db.LoginThrottle{})
+	if result.Error != nil {
+		return result.Error
+	}
+	log.Printf("Maintenance: Purged %d login throttles\n", result.RowsAffected)
+	return nil
+}
+
+// Deletes expired sessions (revoked sessions are kept until they expire, then their tokens are expired anyway)
+func (q *Queue) purgeExpiredSessions(_ struct{}) error {
+	result := q.db.Where("expires_at < ?", time.Now()).Delete(&db.Session{})
+	if result.Error != nil {
+		return result.Error
+	}
+	log.Printf("Maintenance: Purged %d expired sessions\n", result.RowsAffected)
+	return nil
+}
+
+// Permanently deletes recorded actions older than the given number of days
+func (q *Queue) pruneActions(payload PrunePayload) error {
+	cutoff, err := pruneCutoff(payload)
+	if err != nil {
+		return err
+	}
+	result := q.db.Unscoped().Where("created_at < ?", cutoff).Delete(&db.Action{})
+	if result.Error != nil {
+		return result.Error
+	}
+	log.Printf("Maintenance: Pruned %d actions older than %d days\n", result.RowsAffected, payload.OlderThanDays)
+	return nil
+}
+
+// Permanently deletes processed jobs older than the given number of days
+func (q *Queue) pruneJobs(payload PrunePayload) error {
+	cutoff, err := pruneCutoff(payload)
+	if err != nil {
+		return err
+	}
+	result := q.db.Unscoped().Where("status = ? AND updated_at < ?", db.JobStatusProcessed, cutoff).Delete(&db.Job{})
+	if result.Error != nil {
+		return result.Error
+	}
+	log.Printf("Maintenance: Pruned %d processed jobs older than %d days\n", result.RowsAffected, payload.OlderThanDays)
+	return nil
+}
+
+// Permanently deletes email logs older than the given number of days
+func (q *Queue) pruneEmailLogs(payload PrunePayload) error {
+	cutoff, err := pruneCutoff(payload)
+	if err != nil {
+		return err
+	}
+	result := q.db.Unscoped().Where("updated_at < ?", cutoff).Delete(&db.EmailLog{})
+	if result.Error != nil {
+		return result.Error
+	}
+	log.Printf("Maintenance: Pruned %d email logs older than %d days\n", result.RowsAffected, payload.OlderThanDays)
+	return nil
+}
+
+// Permanently deletes login events older than the given number of days
+func (q *Queue) pruneLoginEvents(payload PrunePayload) error {
+	cutoff, err := pruneCutoff(payload)
+	if err != nil {
+		return err
+	}
+	result := q.db.Where("created_at < ?", cutoff).Delete(&db.LoginEvent{})
+	if result.Error != nil {
+		return result.Error
+	}
+	log.Printf("Maintenance: Pruned %d login events older than %d days\n", result.RowsAffected, payload.OlderThanDays)
+	return nil
+}
+
+// Returns the time before which records should be pruned
+func pruneCutoff(payload PrunePayload) (time.Time, error) {
+	// Guard against accidentally deleting everything
+	if payload.OlderThanDays < 1 {
+		return time.Time{}, Permanent(fmt.Errorf("older_than_days must be at least 1, got %d", payload.OlderThanDays))
+	}
+	return time.Now().AddDate(0, 0, -payload.OlderThanDays), nil
+}
@@ -1,79 +1,388 @@
 package queue
 
 import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/dmawardi/Go-Template/internal/db"
 	"github.com/dmawardi/Go-Template/internal/email"
 	"gorm.io/gorm"
 )
 
+// Backoff settings for failed jobs
+var (
+	// Delay before the first retry
+	BaseBackoff = 30 * time.Second
+	// Maximum delay between retries
+	MaxBackoff = 1 * time.Hour
+)
+
+// Worker pool defaults
+const (
+	// Number of workers started per process
+	DefaultWorkers = 2
+	// How long a worker holds a job before it can be reclaimed by another worker
+	DefaultLeaseTimeout = 5 * time.Minute
+	// How often idle workers check for new jobs
+	DefaultPollInterval = 5 * time.Second
+)
+
+// Job priorities (higher priority jobs are claimed first, any int can be used)
+const (
+	// For bulk work that can wait (eg. newsletters)
+	PriorityLow = -10
+	// Default priority
+	PriorityNormal = 0
+	// For jobs a user is waiting on (eg. password resets)
+	PriorityHigh = 10
+)
+
+// ErrLeaseLost is returned when a worker finishes a job whose lease has expired and been reclaimed by another worker
+var ErrLeaseLost = errors.New("job lease lost")
+
+// ErrDuplicateJob is returned by AddJob when a unique job is skipped because an equivalent job was added within its window
+var ErrDuplicateJob = errors.New("duplicate job")
+
 // Queue represents a job queue backed by a SQL database.
 type Queue struct {
-	db          *gorm.DB   // Database connection
-	mu          sync.Mutex // Mutex for synchronizing access
-	cond        *sync.Cond // Condition variable for signaling
+	db          *gorm.DB // Database connection
 	mailService email.Email
+	// Used to name workers (unique per process)
+	instanceID string
+	// Worker pool settings
+	leaseTimeout     time.Duration
+	pollInterval     time.Duration
+	scheduleInterval time.Duration
+	// Used to wake an idle worker when a job is added
+	wake chan struct{}
+	// Tracks running workers (used for graceful shutdown)
+	running sync.WaitGroup
+	// Per job type rate limits
+	rateLimits map[string]RateLimit
+	rateMu     sync.RWMutex
+}
+
+// Settings for the worker pool
+type Settings struct {
+	// Number of concurrent workers
+	Workers int
+	// How long a claimed job is held before it is considered abandoned
+	LeaseTimeout time.Duration
+	// Maximum rate at which jobs of each type are started (eg. {"email": {Limit: 60, Per: time.Minute}})
+	RateLimits map[string]RateLimit
 }
 
 // Class method for creating a new job queue
 // Backed by the given database (uses the job table).
 func NewQueue(db *gorm.DB, mailService email.Email) *Queue {
+	// Build instance ID from hostname and process ID
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
 	// Create the queue
 	q := &Queue{
-		db:          db,
-		mailService: mailService,
+		db:               db,
+		mailService:      mailService,
+		instanceID:       fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		leaseTimeout:     DefaultLeaseTimeout,
+		pollInterval:     DefaultPollInterval,
+		scheduleInterval: DefaultScheduleInterval,
+		wake:             make(chan struct{}, 1),
+		rateLimits:       map[string]RateLimit{},
 	}
-	// Initialize the mutex and condition variable
-	q.cond = sync.NewCond(&q.mu)
 	return q
 }
 
+// Register built in job handlers (passed the queue running the job, so they're shared by all queues)
+func init() {
+	registerHandler(EmailJobType, (*Queue).ProcessEmailJob)
+	registerMaintenanceHandlers()
+}
+
+// SettingsFromEnv builds worker pool settings from the QUEUE_WORKERS, QUEUE_LEASE_TIMEOUT (eg. "5m")
+// and QUEUE_RATE_LIMITS (eg. "email=60/1m") environment variables. Defaults are used for missing or invalid values.
+func SettingsFromEnv() Settings {
+	settings := Settings{Workers: DefaultWorkers, LeaseTimeout: DefaultLeaseTimeout}
+	// Number of workers
+	if workers, err := strconv.Atoi(os.Getenv("QUEUE_WORKERS")); err == nil && workers > 0 {
+		settings.Workers = workers
+	}
+	// Lease timeout
+	if lease, err := time.ParseDuration(os.Getenv("QUEUE_LEASE_TIMEOUT")); err == nil && lease > 0 {
+		settings.LeaseTimeout = lease
+	}
+	// Rate limits
+	if rateLimits := os.Getenv("QUEUE_RATE_LIMITS"); rateLimits != "" {
+		limits, err := ParseRateLimits(rateLimits)
+		if err != nil {
+			log.Printf("Queue: Ignoring QUEUE_RATE_LIMITS: %v\n", err)
+		} else {
+			settings.RateLimits = limits
+		}
+	}
+	return settings
+}
+
+// JobOption configures a job when it is added to the queue
+type JobOption func(*db.Job)
+
+// RunAt delays a job until the given time
+func RunAt(runAt time.Time) JobOption {
+	return func(job *db.Job) {
+		job.NextRunAt = runAt
+	}
+}
+
+// Delay delays a job by the given duration
+func Delay(delay time.Duration) JobOption {
+	return func(job *db.Job) {
+		job.NextRunAt = time.Now().Add(delay)
+	}
+}
+
+// MaxAttempts sets the number of attempts before a job is moved to the dead letter state
+func MaxAttempts(attempts int) JobOption {
+	return func(job *db.Job) {
+		job.MaxAttempts = attempts
+	}
+}
+
+// Priority sets the priority of a job (see PriorityHigh, PriorityLow)
+func Priority(priority int) JobOption {
+	return func(job *db.Job) {
+		job.Priority = priority
+	}
+}
+
+// Unique prevents the same job being queued more than once within the window.
+// If a job with the same type and key was added within the window (and hasn't died, failed or been cancelled),
+// the new job is skipped and AddJob returns ErrDuplicateJob.
+//
+// eg. q.AddJob(queue.EmailJobType, payload, queue.Unique("verify-email:12", 5*time.Minute))
+func Unique(key string, window time.Duration) JobOption {
+	return func(job *db.Job) {
+		job.UniqueKey = key
+		job.UniqueUntil = time.Now().Add(window)
+	}
+}
+
 // AddJob adds a new job to the queue.
 // The jobType is a string that identifies the type of job.
 // The payload is a string that contains the job data.
-func (q *Queue) AddJob(jobType, payload string) error {
-	// Lock the queue
-	q.mu.Lock()
-	// Unlock the queue when the function returns
-	defer q.mu.Unlock()
+// Options can be used to delay the job (eg. queue.RunAt(t), queue.Delay(time.Hour)),
+// change its priority (queue.Priority) or skip duplicates (queue.Unique).
+func (q *Queue) AddJob(jobType, payload string, opts ...JobOption) error {
+	err := q.addJob(q.db, jobType, payload, opts...)
+	if err != nil {
+		return err
+	}
+	q.notify() // Wake an idle worker
+	return nil
+}
 
+// Adds a job using the given database connection (allows adding jobs within a transaction)
+// Workers aren't woken, as the job can't be seen until the transaction commits (callers notify after)
+func (q *Queue) addJob(tx *gorm.DB, jobType, payload string, opts ...JobOption) error {
 	// Create a new job
 	job := db.Job{
 		JobType: jobType,
 		Payload: payload,
 	}
+	// Apply options
+	for _, opt := range opts {
+		opt(&job)
+	}
 
 	// Store the job in the database
-	if err := q.db.Create(&job).Error; err != nil {
-		return err
+	var err error
+	if job.UniqueKey != "" {
+		err = q.createUniqueJob(tx, &job)
+	} else {
+		err = tx.Create(&job).Error
 	}
-	q.cond.Signal() // Signal any waiting workers that a job is available
-	return nil
+	return err
+}
+
+// Creates the job unless a job with the same type and unique key is still within its window
+func (q *Queue) createUniqueJob(tx *gorm.DB, job *db.Job) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		// Serialize adds of the same key (where supported) so concurrent adds can't both pass the check
+		if q.db.Dialector.Name() == "postgres" {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "queue-unique:"+job.JobType+":"+job.UniqueKey).Error; err != nil {
+				return err
+			}
+		}
+
+		// Check for an equivalent job within its window
+		var existing int64
+		err := tx.Model(&db.Job{}).
+			Where("job_type = ? AND unique_key = ? AND unique_until > ?", job.JobType, job.UniqueKey, time.Now()).
+			Where("status NOT IN ?", []string{db.JobStatusDead, db.JobStatusFailed, db.JobStatusCancelled}).
+			Count(&existing).Error
+		if err != nil {
+			return err
+		}
+		if existing > 0 {
+			return fmt.Errorf("%w: %s job with key %q already queued", ErrDuplicateJob, job.JobType, job.UniqueKey)
+		}
+
+		return tx.Create(job).Error
+	})
 }
 
-// GetJob retrieves the next unprocessed job from the queue.
-func (q *Queue) GetJob() (*db.Job, error) {
-	q.mu.Lock()
-	defer q.mu.Unlock()
+// MarkJobAsProcessed marks a job as processed in the database and releases its lease.
+func (q *Queue) MarkJobAsProcessed(job *db.Job) error {
+	// Mark the job as processed
+	job.Processed = true
+	job.Status = db.JobStatusProcessed
+	// Update the job in the database, returning any error
+	return q.releaseJob(job, map[string]interface{}{
+		"processed": true,
+		"status":    job.Status,
+	})
+}
+
+// MarkJobAsFailed records the error of a failed attempt and releases the job's lease.
+// Permanent errors (see Permanent) move the job straight to the failed state.
+// Otherwise the job is rescheduled using exponential backoff, or moved to the
+// dead letter state once its max attempts have been exhausted.
+func (q *Queue) MarkJobAsFailed(job *db.Job, jobErr error) error {
+	// Record the error (attempts are counted when the job is claimed)
+	job.LastError = jobErr.Error()
 
+	// If the error can't be fixed by retrying, fail the job
+	if IsPermanent(jobErr) {
+		job.Status = db.JobStatusFailed
+	} else if job.Attempts >= maxAttempts(job) {
+		// If retries are exhausted, move to dead letter state
+		job.Status = db.JobStatusDead
+	} else {
+		// else, schedule the next attempt
+		job.Status = db.JobStatusPending
+		job.NextRunAt = time.Now().Add(Backoff(job.Attempts))
+	}
+
+	// Update the job in the database, returning any error
+	return q.releaseJob(job, map[string]interface{}{
+		"status":      job.Status,
+		"last_error":  job.LastError,
+		"next_run_at": job.NextRunAt,
+	})
+}
+
+// RequeueJob moves a job back to the pending state with a fresh set of attempts.
+// Only dead, failed or cancelled jobs can be re-queued.
+func (q *Queue) RequeueJob(id uint) (*db.Job, error) {
 	var job db.Job
-	// Fetch the first unprocessed job from the database
-	if err := q.db.Where("processed = ?", false).First(&job).Error; err != nil {
+	// Find the job
+	if err := q.db.First(&job, id).Error; err != nil {
 		return nil, err
 	}
+	// Only dead, failed or cancelled jobs may be re-queued
+	if job.Status != db.JobStatusDead && job.Status != db.JobStatusFailed && job.Status != db.JobStatusCancelled {
+		return nil, fmt.Errorf("job %d is not dead, failed or cancelled (status: %s)", job.ID, job.Status)
+	}
+
+	// Reset retry state (last error is kept for reference)
+	job.Status = db.JobStatusPending
+	job.Processed = false
+	job.Attempts = 0
+	job.NextRunAt = time.Now()
+
+	// Update the job in the database
+	if err := q.db.Save(&job).Error; err != nil {
+		return nil, err
+	}
+	q.notify() // Wake an idle worker
 	return &job, nil
 }
 
-// MarkJobAsProcessed marks a job as processed in the database.
-func (q *Queue) MarkJobAsProcessed(job *db.Job) error {
-	// Lock the queue
-	q.mu.Lock()
-	defer q.mu.Unlock()
+// CancelJob stops a pending job (including delayed and retrying jobs) from being run.
+// Jobs that are already running can't be cancelled.
+func (q *Queue) CancelJob(id uint) (*db.Job, error) {
+	var job db.Job
+	// Find the job
+	if err := q.db.First(&job, id).Error; err != nil {
+		return nil, err
+	}
 
-	// Mark the job as processed
-	job.Processed = true
-	job.Status = "processed"
-	// Update the job in the database, returning any error
-	return q.db.Save(job).Error
+	// Only cancel if the job is still pending (a worker may claim it at any time)
+	result := q.db.Model(&db.Job{}).
+		Where("id = ? AND status = ?", job.ID, db.JobStatusPending).
+		Update("status", db.JobStatusCancelled)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("job %d is not pending (status: %s)", job.ID, job.Status)
+	}
+
+	job.Status = db.JobStatusCancelled
+	return &job, nil
+}
+
+// Applies the final updates to a job and releases its lease.
+// Returns ErrLeaseLost if the job is no longer held by the worker that claimed it.
+func (q *Queue) releaseJob(job *db.Job, updates map[string]interface{}) error {
+	// Release lease
+	updates["locked_by"] = ""
+	updates["locked_until"] = nil
+
+	// Only update if the lease is still held by the job's worker
+	result := heldLease(q.db, job).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrLeaseLost
+	}
+	job.LockedBy = ""
+	job.LockedUntil = time.Time{}
+	return nil
+}
+
+// Scopes an update to the job's lease. The worker and attempt count identify the lease,
+// as the attempt count increases each time the job is claimed (even by the same worker)
+func heldLease(tx *gorm.DB, job *db.Job) *gorm.DB {
+	return tx.Model(&db.Job{}).Where("id = ? AND locked_by = ? AND attempts = ?", job.ID, job.LockedBy, job.Attempts)
+}
+
+// Wakes an idle worker (if any) without blocking
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Returns the max attempts for a job, using the default if not set (jobs created before retries were introduced)
+func maxAttempts(job *db.Job) int {
+	if job.MaxAttempts <= 0 {
+		return db.DefaultJobMaxAttempts
+	}
+	return job.MaxAttempts
+}
+
+// Backoff returns the delay before the next attempt of a job that has failed the given number of times.
+// The delay doubles with each attempt (starting at BaseBackoff) and is capped at MaxBackoff.
+func Backoff(attempts int) time.Duration {
+	// First attempt has no backoff
+	if attempts <= 0 {
+		return 0
+	}
+	delay := BaseBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		// Cap delay
+		if delay >= MaxBackoff {
+			return MaxBackoff
+		}
+	}
+	return delay
 }
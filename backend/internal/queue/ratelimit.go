@@ -0,0 +1,104 @@
+package queue
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"gorm.io/gorm"
+)
+
+// RateLimit is the maximum number of jobs of a type that may be started per period.
+// Limits are enforced using the job table, so they apply across all workers and instances sharing the database.
+type RateLimit struct {
+	Limit int
+	Per   time.Duration
+}
+
+// SetRateLimit limits how many jobs of the given type are started per period (eg. 60 emails per minute).
+// Jobs over the limit stay pending until the rate allows them to run. A limit of 0 or less removes the rate limit.
+func (q *Queue) SetRateLimit(jobType string, limit int, per time.Duration) {
+	q.rateMu.Lock()
+	defer q.rateMu.Unlock()
+	if limit <= 0 || per <= 0 {
+		delete(q.rateLimits, jobType)
+		return
+	}
+	q.rateLimits[jobType] = RateLimit{Limit: limit, Per: per}
+}
+
+// Returns the rate limit of a job type (if any)
+func (q *Queue) rateLimit(jobType string) (RateLimit, bool) {
+	q.rateMu.RLock()
+	defer q.rateMu.RUnlock()
+	limit, ok := q.rateLimits[jobType]
+	return limit, ok
+}
+
+// Returns the job types that have reached their rate limit
+func (q *Queue) throttledTypes(tx *gorm.DB, now time.Time) ([]string, error) {
+	// Copy limits (so the lock isn't held during queries)
+	q.rateMu.RLock()
+	limits := make(map[string]RateLimit, len(q.rateLimits))
+	for jobType, limit := range q.rateLimits {
+		limits[jobType] = limit
+	}
+	q.rateMu.RUnlock()
+
+	var throttled []string
+	for jobType, limit := range limits {
+		reached, err := rateLimitReached(tx, jobType, limit, now)
+		if err != nil {
+			return nil, err
+		}
+		if reached {
+			throttled = append(throttled, jobType)
+		}
+	}
+	return throttled, nil
+}
+
+// Checks whether the number of jobs of the type started within the period has reached the limit
+func rateLimitReached(tx *gorm.DB, jobType string, limit RateLimit, now time.Time) (bool, error) {
+	var started int64
+	err := tx.Model(&db.Job{}).
+		Where("job_type = ? AND started_at > ?", jobType, now.Add(-limit.Per)).
+		Count(&started).Error
+	if err != nil {
+		return false, err
+	}
+	return started >= int64(limit.Limit), nil
+}
+
+// ParseRateLimits parses a comma separated list of rate limits in the format type=limit/period
+// eg. "email=60/1m,webhook=10/1s"
+func ParseRateLimits(value string) (map[string]RateLimit, error) {
+	limits := map[string]RateLimit{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		// Split into type, limit and period
+		jobType, rate, found := strings.Cut(entry, "=")
+		if !found || jobType == "" {
+			return nil, fmt.Errorf("invalid rate limit %q: expected type=limit/period", entry)
+		}
+		limitPart, perPart, found := strings.Cut(rate, "/")
+		if !found {
+			return nil, fmt.Errorf("invalid rate limit %q: expected type=limit/period", entry)
+		}
+		limit, err := strconv.Atoi(limitPart)
+		if err != nil || limit < 1 {
+			return nil, fmt.Errorf("invalid limit in %q", entry)
+		}
+		per, err := time.ParseDuration(perPart)
+		if err != nil || per <= 0 {
+			return nil, fmt.Errorf("invalid period in %q", entry)
+		}
+		limits[strings.TrimSpace(jobType)] = RateLimit{Limit: limit, Per: per}
+	}
+	return limits, nil
+}
@@ -0,0 +1,127 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+)
+
+// ErrUnknownJobType is returned when no handler is registered for a job's type
+var ErrUnknownJobType = errors.New("unknown job type")
+
+// HandlerFunc processes the raw payload of a job
+type HandlerFunc func(payload string) error
+
+// Processes a job. The registry is shared by all queues, so handlers receive the queue running the job
+// (rather than capturing one) along with the job so its details can be passed on (see RegisterWithJob)
+type jobHandlerFunc func(q *Queue, job *db.Job) error
+
+// Registry of job handlers keyed by job type
+var registry = struct {
+	mu       sync.RWMutex
+	handlers map[string]jobHandlerFunc
+}{handlers: make(map[string]jobHandlerFunc)}
+
+// Register adds a handler for the given job type. Registering a type twice replaces the previous handler.
+// The job payload is decoded as JSON into the handler's payload type before the handler is called
+// (string payloads are passed through as is). Payloads that can't be decoded fail permanently.
+//
+// eg. queue.Register("thumbnail", func(p ThumbnailPayload) error { ... })
+func Register[T any](jobType string, handler func(T) error) {
+	RegisterWithJob(jobType, func(_ *db.Job, payload T) error {
+		return handler(payload)
+	})
+}
+
+// RegisterWithJob adds a handler that also receives the job being processed (eg. to record its ID).
+// Payloads are decoded as with Register.
+//
+// eg. queue.RegisterWithJob("report", func(job *db.Job, p ReportPayload) error { ... })
+func RegisterWithJob[T any](jobType string, handler func(*db.Job, T) error) {
+	registerHandler(jobType, func(_ *Queue, job *db.Job, payload T) error {
+		return handler(job, payload)
+	})
+}
+
+// Adds a handler that is passed the queue running the job (used for the built in handlers)
+func registerHandler[T any](jobType string, handler func(*Queue, *db.Job, T) error) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	registry.handlers[jobType] = func(q *Queue, job *db.Job) error {
+		var decoded T
+		// Pass string payloads through without decoding
+		if s, ok := any(&decoded).(*string); ok {
+			*s = job.Payload
+		} else if err := json.Unmarshal([]byte(job.Payload), &decoded); err != nil {
+			// A payload that can't be decoded will never succeed, so don't retry
+			return Permanent(fmt.Errorf("failed decoding %q job payload: %w", jobType, err))
+		}
+		return handler(q, job, decoded)
+	}
+}
+
+// Deregister removes the handler for the given job type
+func Deregister(jobType string) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	delete(registry.handlers, jobType)
+}
+
+// Handler returns the handler registered for the given job type (run by this queue)
+func (q *Queue) Handler(jobType string) (HandlerFunc, bool) {
+	handler, ok := jobHandler(jobType)
+	if !ok {
+		return nil, false
+	}
+	return func(payload string) error {
+		return handler(q, &db.Job{JobType: jobType, Payload: payload})
+	}, true
+}
+
+// Returns the handler registered for the given job type
+func jobHandler(jobType string) (jobHandlerFunc, bool) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	handler, ok := registry.handlers[jobType]
+	return handler, ok
+}
+
+// RegisteredTypes returns a sorted list of job types with a registered handler
+func RegisteredTypes() []string {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	types := make([]string, 0, len(registry.handlers))
+	for jobType := range registry.handlers {
+		types = append(types, jobType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// permanentError marks an error that should not be retried
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps an error to signal the worker that the job should be marked as failed
+// instead of being retried. Handlers can return this for errors that retrying won't fix.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+// IsPermanent reports whether the error (or any error it wraps) was marked as permanent
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
@@ -0,0 +1,150 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"gorm.io/gorm"
+)
+
+// How often the scheduler checks for due schedules
+const DefaultScheduleInterval = 15 * time.Second
+
+// Schedule creates (or updates) a recurring job schedule stored in the database.
+// Each time the cron expression is due, a job with the given type and payload is added to the queue
+// and executed by the queue's workers. Schedules are identified by name, so calling Schedule on every
+// startup (from every instance) is safe.
+//
+// eg. q.Schedule("prune-actions", "30 3 * * *", queue.PruneActionsJobType, `{"older_than_days":90}`)
+func (q *Queue) Schedule(name, cronExpression, jobType, payload string) error {
+	// Validate cron expression
+	cron, err := ParseCron(cronExpression)
+	if err != nil {
+		return fmt.Errorf("failed scheduling %q: %w", name, err)
+	}
+
+	// Check if schedule already exists
+	var existing db.JobSchedule
+	err = q.db.Where("name = ?", name).First(&existing).Error
+	// If not found, create it
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		enabled := true
+		return q.db.Create(&db.JobSchedule{
+			Name:           name,
+			CronExpression: cronExpression,
+			JobType:        jobType,
+			Payload:        payload,
+			Enabled:        &enabled,
+			NextRunAt:      cron.Next(time.Now()),
+		}).Error
+	}
+	if err != nil {
+		return fmt.Errorf("failed finding schedule %q: %w", name, err)
+	}
+
+	// Else, update the existing schedule
+	updates := map[string]interface{}{
+		"job_type": jobType,
+		"payload":  payload,
+	}
+	// Only reschedule if the expression changed (keeps the next run stable across restarts)
+	if existing.CronExpression != cronExpression {
+		updates["cron_expression"] = cronExpression
+		updates["next_run_at"] = cron.Next(time.Now())
+	}
+	return q.db.Model(&existing).Updates(updates).Error
+}
+
+// Unschedule removes a recurring job schedule
+func (q *Queue) Unschedule(name string) error {
+	// Permanently delete so the name can be reused
+	return q.db.Unscoped().Where("name = ?", name).Delete(&db.JobSchedule{}).Error
+}
+
+// EnqueueDueSchedules adds a job to the queue for every enabled schedule that is due and moves
+// each schedule on to its next run. A run is only fired once even if multiple instances check at
+// the same time. Runs missed while no instance was running are fired once, not replayed.
+// Returns the number of jobs added.
+func (q *Queue) EnqueueDueSchedules() (int, error) {
+	// Find due schedules
+	var due []db.JobSchedule
+	err := q.db.Where("enabled = ? AND next_run_at <= ?", true, time.Now()).Find(&due).Error
+	if err != nil {
+		return 0, err
+	}
+
+	fired := 0
+	for _, schedule := range due {
+		ok, err := q.fireSchedule(schedule)
+		if err != nil {
+			log.Printf("Scheduler: Error firing schedule %q: %v\n", schedule.Name, err)
+			continue
+		}
+		if ok {
+			fired++
+		}
+	}
+	return fired, nil
+}
+
+// Adds the schedule's job and moves the schedule to its next run.
+// Returns false if the run was already fired by another instance.
+func (q *Queue) fireSchedule(schedule db.JobSchedule) (bool, error) {
+	cron, err := ParseCron(schedule.CronExpression)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+
+	fired := false
+	err = q.db.Transaction(func(tx *gorm.DB) error {
+		// Move schedule on to its next run, only if no other instance has fired this run
+		result := tx.Model(&db.JobSchedule{}).
+			Where("id = ? AND run_count = ?", schedule.ID, schedule.RunCount).
+			Updates(map[string]interface{}{
+				"next_run_at": cron.Next(now),
+				"last_run_at": now,
+				"run_count":   schedule.RunCount + 1,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		// If already fired elsewhere, skip
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		// Add the job (rolled back with the schedule update if this fails)
+		fired = true
+		return q.addJob(tx, schedule.JobType, schedule.Payload)
+	})
+	if err != nil {
+		return false, err
+	}
+	// Wake an idle worker once the job is committed
+	if fired {
+		q.notify()
+	}
+	return fired, nil
+}
+
+// Scheduler periodically adds jobs for due schedules until the context is cancelled
+func (q *Queue) Scheduler(ctx context.Context) {
+	ticker := time.NewTicker(q.scheduleInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := q.EnqueueDueSchedules(); err != nil {
+			log.Printf("Scheduler: Error checking schedules: %v\n", err)
+		}
+		// Wait for next check
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -1,47 +1,178 @@
 package queue
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log"
 	"time"
 
+	"github.com/dmawardi/Go-Template/internal/db"
 	"gorm.io/gorm"
 )
 
-// Worker processes jobs from the queue.
-func (q *Queue) Worker() {
+// Start launches a pool of workers to process jobs from the queue, along with the scheduler for recurring jobs.
+// When the context is cancelled, workers stop claiming new jobs and exit after finishing their current job
+// (use Wait to block until they have).
+func (q *Queue) Start(ctx context.Context, settings Settings) {
+	// Apply settings
+	if settings.LeaseTimeout > 0 {
+		q.leaseTimeout = settings.LeaseTimeout
+	}
+	for jobType, limit := range settings.RateLimits {
+		q.SetRateLimit(jobType, limit.Limit, limit.Per)
+	}
+	workers := settings.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	// Start workers
+	q.running.Add(workers + 1)
+	for i := 1; i <= workers; i++ {
+		go func(workerID string) {
+			defer q.running.Done()
+			q.Worker(ctx, workerID)
+		}(fmt.Sprintf("%s-%d", q.instanceID, i))
+	}
+	// Start scheduler
+	go func() {
+		defer q.running.Done()
+		q.Scheduler(ctx)
+	}()
+	log.Printf("Queue: Started %d workers (lease timeout: %v)\n", workers, q.leaseTimeout)
+}
+
+// Wait blocks until all workers started by Start have stopped, or the context expires.
+func (q *Queue) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		q.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("workers still running: %w", ctx.Err())
+	}
+}
+
+// Worker processes jobs from the queue until the context is cancelled.
+func (q *Queue) Worker(ctx context.Context, workerID string) {
 	for {
-		// Get the next job
-		job, err := q.GetJob()
+		// Stop claiming jobs once shutdown has started
+		if ctx.Err() != nil {
+			log.Printf("Worker %s: Stopped\n", workerID)
+			return
+		}
+		// Claim the next job
+		job, err := q.ClaimJob(workerID)
 		if err != nil {
 			// If there's another error aside from "record not found", log it
 			if !errors.Is(err, gorm.ErrRecordNotFound) {
-				log.Printf("Worker: Error getting job: %v\n", err)
+				log.Printf("Worker %s: Error claiming job: %v\n", workerID, err)
 			}
 			// Wait for a signal that a job is available
-			time.Sleep(5 * time.Second)
+			q.wait(ctx)
 			continue
 		}
-		// Process the job using the Process function with the payload
-		if err := q.ProcessJob(job.JobType, job.Payload); err != nil {
-			log.Printf("Worker: Error processing job: %v\n", err)
-			time.Sleep(5 * time.Second)
-			continue
+		// Process the job and record the result
+		q.runJob(workerID, job)
+	}
+}
+
+// Processes a claimed job and marks it as processed or failed
+func (q *Queue) runJob(workerID string, job *db.Job) {
+	// Keep the lease while the job runs, so long running jobs aren't reclaimed by another worker
+	stopHeartbeat := q.startHeartbeat(workerID, job)
+	// Process the job using the Process function with the payload
+	err := q.safeProcessJob(job)
+	stopHeartbeat()
+	if err != nil {
+		log.Printf("Worker %s: Error processing job %d: %v\n", workerID, job.ID, err)
+		// Record the failure (schedules a retry or moves the job to dead letter)
+		if err := q.MarkJobAsFailed(job, err); err != nil {
+			log.Printf("Worker %s: Error marking job %d as failed: %v\n", workerID, job.ID, err)
 		}
-		// Mark the job as processed
-		if err := q.MarkJobAsProcessed(job); err != nil {
-			log.Printf("Worker: Error marking job as processed: %v\n", err)
-			time.Sleep(5 * time.Second)
-			continue
+		return
+	}
+	// Mark the job as processed
+	if err := q.MarkJobAsProcessed(job); err != nil {
+		log.Printf("Worker %s: Error marking job %d as processed: %v\n", workerID, job.ID, err)
+	}
+}
+
+// Extends the job's lease every third of the lease timeout until the returned function is called
+// (which waits for the heartbeat to stop). Stops early if the lease has been lost.
+func (q *Queue) startHeartbeat(workerID string, job *db.Job) func() {
+	// Copy the lease details, as the handler may modify the job
+	lease := db.Job{ID: job.ID, LockedBy: job.LockedBy, Attempts: job.Attempts}
+	leaseTimeout := q.leaseTimeout
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(leaseTimeout / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				result := heldLease(q.db, &lease).Where("status = ?", db.JobStatusRunning).
+					Update("locked_until", time.Now().Add(leaseTimeout))
+				if result.Error != nil {
+					log.Printf("Worker %s: Error extending lease of job %d: %v\n", workerID, lease.ID, result.Error)
+					continue
+				}
+				// Another worker holds the job now (the result will be dropped)
+				if result.RowsAffected == 0 {
+					log.Printf("Worker %s: Lost lease of job %d\n", workerID, lease.ID)
+					return
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-stopped
+	}
+}
+
+// Processes the job, converting a panic in the handler into an error
+func (q *Queue) safeProcessJob(job *db.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job handler panicked: %v", r)
 		}
+	}()
+	return q.processJob(job)
+}
+
+// Blocks until a job is added, the poll interval has passed, or the context is cancelled
+func (q *Queue) wait(ctx context.Context) {
+	select {
+	case <-q.wake:
+	case <-time.After(q.pollInterval):
+	case <-ctx.Done():
 	}
 }
 
+// ProcessJob runs the handler registered for the job type with the given payload.
+// Unknown job types return a permanent error so the job is marked as failed rather than retried.
 func (q *Queue) ProcessJob(jobType, payload string) error {
-	switch jobType {
-	case "email":
-		return q.ProcessEmailJob(payload)
-	default:
-		return errors.New("unknown job type")
+	return q.processJob(&db.Job{JobType: jobType, Payload: payload})
+}
+
+// Runs the handler registered for the job's type
+func (q *Queue) processJob(job *db.Job) error {
+	handler, ok := jobHandler(job.JobType)
+	if !ok {
+		return Permanent(fmt.Errorf("%w: %q (no handler registered)", ErrUnknownJobType, job.JobType))
 	}
+	return handler(q, job)
 }
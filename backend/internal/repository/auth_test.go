@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/dmawardi/Go-Template/internal/db"
 	"github.com/dmawardi/Go-Template/internal/helpers"
@@ -120,7 +121,7 @@ func TestAuthPolicyRepository_AssignUserRole(t *testing.T) {
 		t.Errorf("Expected true, found %v", *success)
 	}
 	// Cleanup
-	err = testModule.users.repo.Delete(int(createdUser1.ID))
+	err = testModule.users.repo.Delete(int(createdUser1.ID), time.Time{})
 	if err != nil {
 		t.Errorf("Error deleting user: %v", err)
 	}
@@ -170,7 +171,7 @@ func TestAuthPolicyRepository_FindRoleByUserId(t *testing.T) {
 	}
 
 	// Cleanup
-	err = testModule.users.repo.Delete(int(createdUser.ID))
+	err = testModule.users.repo.Delete(int(createdUser.ID), time.Time{})
 	if err != nil {
 		t.Errorf("Error deleting user: %v", err)
 	}
@@ -209,7 +210,7 @@ func TestAuthPolicyRepository_CreateRole(t *testing.T) {
 	}
 
 	// Cleanup
-	err = testModule.users.repo.Delete(int(createdUser1.ID))
+	err = testModule.users.repo.Delete(int(createdUser1.ID), time.Time{})
 	if err != nil {
 		t.Errorf("Error deleting user: %v", err)
 	}
@@ -255,7 +256,7 @@ func TestAuthRoleRepository_DeleteRolesForUser(t *testing.T) {
 	}
 
 	// Cleanup
-	err = testModule.users.repo.Delete(int(createdUser.ID))
+	err = testModule.users.repo.Delete(int(createdUser.ID), time.Time{})
 	if err != nil {
 		t.Errorf("Error deleting user: %v", err)
 	}
@@ -323,7 +324,7 @@ func TestAuthPolicyRepository_CreateInheritance(t *testing.T) {
 		t.Errorf("Expected true, found %v", removed)
 	}
 	// Remove Delete user and role
-	err = testModule.users.repo.Delete(int(createdUser.ID))
+	err = testModule.users.repo.Delete(int(createdUser.ID), time.Time{})
 	if err != nil {
 		t.Errorf("Error deleting user: %v", err)
 	}
@@ -431,7 +432,7 @@ func createUserAndSetRole(user db.User, role string, t *testing.T) (*db.User, st
 
 // Deletes a user and the role manually
 func deleteUserAndRole(user *db.User, t *testing.T) error {
-	err := testModule.users.repo.Delete(int(user.ID))
+	err := testModule.users.repo.Delete(int(user.ID), time.Time{})
 	if err != nil {
 		t.Errorf("Error deleting user: %v", err)
 		return err
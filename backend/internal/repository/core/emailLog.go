@@ -0,0 +1,74 @@
+package corerepositories
+
+import (
+	"fmt"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers/data"
+	"github.com/dmawardi/Go-Template/internal/models"
+	"gorm.io/gorm"
+)
+
+type EmailLogRepository interface {
+	// Find a list of all email logs in the Database
+	FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[db.EmailLog], error)
+	FindById(int) (*db.EmailLog, error)
+	// Permanently delete email logs by ID
+	BulkDelete([]int) error
+}
+
+type emailLogRepository struct {
+	DB *gorm.DB
+}
+
+func NewEmailLogRepository(db *gorm.DB) EmailLogRepository {
+	return &emailLogRepository{db}
+}
+
+// Find a list of email logs in the database
+func (r *emailLogRepository) FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[db.EmailLog], error) {
+	// Build meta data for email logs
+	metaData, err := data.BuildMetaData(r.DB, db.EmailLog{}, limit, offset, order, conditions)
+	if err != nil {
+		fmt.Printf("Error building meta data: %s", err)
+		return nil, err
+	}
+
+	// Query all email logs based on the received parameters
+	var emailLogs []db.EmailLog
+	err = data.QueryAll(r.DB, &emailLogs, limit, offset, order, conditions, []string{})
+	if err != nil {
+		fmt.Printf("Error querying db for list of email logs: %s", err)
+		return nil, err
+	}
+
+	return &models.BasicPaginatedResponse[db.EmailLog]{
+		Data: &emailLogs,
+		Meta: *metaData,
+	}, nil
+}
+
+// Find email log in database by ID
+func (r *emailLogRepository) FindById(id int) (*db.EmailLog, error) {
+	// Create an empty ref object of type email log
+	emailLog := db.EmailLog{}
+	// Check if email log exists in db
+	result := r.DB.First(&emailLog, id)
+	// If error detected
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	// else
+	return &emailLog, nil
+}
+
+// Permanently deletes the email logs with the specified IDs
+func (r *emailLogRepository) BulkDelete(ids []int) error {
+	err := r.DB.Unscoped().Where("id IN ?", ids).Delete(&db.EmailLog{}).Error
+	if err != nil {
+		fmt.Println("error in deleting email logs: ", err)
+		return err
+	}
+	// else
+	return nil
+}
@@ -0,0 +1,75 @@
+package corerepositories
+
+import (
+	"fmt"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers/data"
+	"github.com/dmawardi/Go-Template/internal/models"
+	"gorm.io/gorm"
+)
+
+type JobRepository interface {
+	// Find a list of all jobs in the Database
+	FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[db.Job], error)
+	FindById(int) (*db.Job, error)
+	// Permanently delete jobs by ID (running jobs are skipped)
+	BulkDelete([]int) error
+}
+
+type jobRepository struct {
+	DB *gorm.DB
+}
+
+func NewJobRepository(db *gorm.DB) JobRepository {
+	return &jobRepository{db}
+}
+
+// Find a list of jobs in the database
+func (r *jobRepository) FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[db.Job], error) {
+	// Build meta data for jobs
+	metaData, err := data.BuildMetaData(r.DB, db.Job{}, limit, offset, order, conditions)
+	if err != nil {
+		fmt.Printf("Error building meta data: %s", err)
+		return nil, err
+	}
+
+	// Query all jobs based on the received parameters
+	var jobs []db.Job
+	err = data.QueryAll(r.DB, &jobs, limit, offset, order, conditions, []string{})
+	if err != nil {
+		fmt.Printf("Error querying db for list of jobs: %s", err)
+		return nil, err
+	}
+
+	return &models.BasicPaginatedResponse[db.Job]{
+		Data: &jobs,
+		Meta: *metaData,
+	}, nil
+}
+
+// Find job in database by ID
+func (r *jobRepository) FindById(id int) (*db.Job, error) {
+	// Create an empty ref object of type job
+	job := db.Job{}
+	// Check if job exists in db
+	result := r.DB.First(&job, id)
+	// If error detected
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	// else
+	return &job, nil
+}
+
+// Permanently deletes the jobs with the specified IDs.
+// Jobs that are currently held by a worker are left alone.
+func (r *jobRepository) BulkDelete(ids []int) error {
+	err := r.DB.Unscoped().Where("id IN ? AND status <> ?", ids, db.JobStatusRunning).Delete(&db.Job{}).Error
+	if err != nil {
+		fmt.Println("error in deleting jobs: ", err)
+		return err
+	}
+	// else
+	return nil
+}
@@ -1,28 +1,78 @@
 package corerepositories
 
 import (
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/dmawardi/Go-Template/internal/db"
 	"github.com/dmawardi/Go-Template/internal/helpers/data"
 	"github.com/dmawardi/Go-Template/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserRepository interface {
 	// Find a list of all users in the Database
 	FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[db.User], error)
 	Create(user *db.User) (*db.User, error)
-	Update(int, *db.User) (*db.User, error)
-	Delete(int) error
+	Update(int, *db.User, time.Time) (*db.User, error)
+	Delete(int, time.Time) error
 	BulkDelete([]int) error
 	// Find
 	FindById(int) (*db.User, error)
 	FindByEmail(string) (*db.User, error)
 	// Verification
 	FindByVerificationCode(string) (*db.User, error)
+	// Password reset
+	CreatePasswordResetToken(token *db.PasswordResetToken) error
+	FindPasswordResetToken(tokenHash string) (*db.PasswordResetToken, error)
+	ResetPasswordWithToken(token *db.PasswordResetToken, hashedPassword string) error
+	// Refresh tokens
+	CreateRefreshToken(token *db.RefreshToken) error
+	FindRefreshToken(tokenHash string) (*db.RefreshToken, error)
+	RotateRefreshToken(used *db.RefreshToken, replacement *db.RefreshToken) error
+	RevokeRefreshTokenFamily(familyID string) error
+	// Sessions
+	CreateSession(session *db.Session) error
+	FindSessions(userID uint) ([]db.Session, error)
+	FindSession(userID uint, id uint) (*db.Session, error)
+	ExtendSession(tokenID string, expiresAt time.Time) error
+	RevokeSession(tokenID string) error
+	RevokeUserSessions(userID uint, exceptTokenID string) error
+	// Login history
+	CreateLoginEvent(event *db.LoginEvent) error
+	FindLoginEvents(userID uint, limit int) ([]db.LoginEvent, error)
+	// Two factor authentication
+	SetTwoFactorSecret(userID uint, secret string) error
+	EnableTwoFactor(userID uint, recoveryCodeHashes []string) error
+	DisableTwoFactor(userID uint) error
+	UseTwoFactorStep(userID uint, step int64) error
+	UseRecoveryCode(userID uint, codeHash string) error
+	// API keys
+	CreateApiKey(key *db.ApiKey) error
+	FindApiKeys(userID uint) ([]db.ApiKey, error)
+	RevokeApiKey(userID uint, keyID uint) error
+	RevokeUserApiKeys(userID uint) error
+	// Login throttling
+	FindLoginThrottles(keys ...string) ([]db.LoginThrottle, error)
+	RecordLoginFailure(key string, resetBefore time.Time) (*db.LoginThrottle, error)
+	LockLogin(key string, until time.Time) error
+	ClearLoginThrottle(key string) error
 }
 
+// Returned when a password reset token has already been used
+var ErrPasswordResetTokenUsed = errors.New("password reset token already used")
+
+// Returned when a refresh token has already been used or revoked
+var ErrRefreshTokenUsed = errors.New("refresh token already used")
+
+// Returned when a two factor code's time step has already been used
+var ErrTwoFactorCodeUsed = errors.New("two factor code already used")
+
+// Returned when a recovery code is unknown or has already been used
+var ErrRecoveryCodeUsed = errors.New("recovery code not found or already used")
+
 type userRepository struct {
 	DB *gorm.DB
 }
@@ -70,7 +120,7 @@ func (r *userRepository) FindById(userId int) (*db.User, error) {
 	// Create an empty ref object of type user
 	user := db.User{}
 	// Check if user exists in db
-	result := r.DB.Select("ID", "name", "username", "email", "verified", "password", "created_at", "updated_at", "deleted_at", "verification_code_expiry").First(&user, userId)
+	result := r.DB.Select("ID", "name", "username", "email", "locale", "verified", "password", "created_at", "updated_at", "deleted_at", "verification_code_expiry", "two_factor_enabled", "two_factor_secret").First(&user, userId)
 
 	// If error detected
 	if result.Error != nil {
@@ -81,17 +131,25 @@ func (r *userRepository) FindById(userId int) (*db.User, error) {
 }
 
 // Delete user in database
-func (r *userRepository) Delete(id int) error {
+func (r *userRepository) Delete(id int, version time.Time) error {
 	// Create an empty ref object of type user
 	user := db.User{}
 	// Check if user exists in db
-	result := r.DB.Delete(&user, id)
+	query := r.DB
+	if !version.IsZero() {
+		query = query.Where("updated_at = ?", version)
+	}
+	result := query.Delete(&user, id)
 
 	// If error detected
 	if result.Error != nil {
 		fmt.Println("error in deleting user: ", result.Error)
 		return result.Error
 	}
+	// If the user changed since the version, nothing was deleted
+	if !version.IsZero() && result.RowsAffected == 0 {
+		return models.ErrRecordModified
+	}
 	// else
 	return nil
 }
@@ -110,7 +168,8 @@ func (r *userRepository) BulkDelete(ids []int) error {
 }
 
 // Updates user in database
-func (r *userRepository) Update(id int, user *db.User) (*db.User, error) {
+// If version is set (the updated_at last read), the update only applies if the user hasn't changed since
+func (r *userRepository) Update(id int, user *db.User, version time.Time) (*db.User, error) {
 	// Init
 	var err error
 	// Find user by id
@@ -121,11 +180,19 @@ func (r *userRepository) Update(id int, user *db.User) (*db.User, error) {
 	}
 
 	// Update user using found user
-	updateResult := r.DB.Model(&foundUser).Updates(user)
+	query := r.DB.Model(&foundUser)
+	if !version.IsZero() {
+		query = query.Where("updated_at = ?", version)
+	}
+	updateResult := query.Updates(user)
 	if updateResult.Error != nil {
 		fmt.Println("User update failed: ", updateResult.Error)
 		return nil, updateResult.Error
 	}
+	// If the user changed since the version, nothing was updated
+	if !version.IsZero() && updateResult.RowsAffected == 0 {
+		return nil, models.ErrRecordModified
+	}
 
 	// Retrieve changed user by id
 	updatedUser, err := r.FindById(id)
@@ -166,3 +233,352 @@ func (r *userRepository) FindByVerificationCode(token string) (*db.User, error)
 	// else
 	return &user, nil
 }
+
+// Stores a password reset token, invalidating the user's previous unused tokens
+func (r *userRepository) CreatePasswordResetToken(token *db.PasswordResetToken) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		// Mark previous tokens as used so only the latest link works
+		result := tx.Model(&db.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", token.UserID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		return tx.Create(token).Error
+	})
+}
+
+// Find a password reset token by the hash of the token
+func (r *userRepository) FindPasswordResetToken(tokenHash string) (*db.PasswordResetToken, error) {
+	token := db.PasswordResetToken{}
+	result := r.DB.Where("token_hash = ?", tokenHash).First(&token)
+
+	// If error detected
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	// else
+	return &token, nil
+}
+
+// Marks a password reset token as used and sets the user's (hashed) password
+// Returns ErrPasswordResetTokenUsed if the token was used in the meantime
+func (r *userRepository) ResetPasswordWithToken(token *db.PasswordResetToken, hashedPassword string) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		// Only succeeds for the first request using the token
+		result := tx.Model(&db.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", token.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrPasswordResetTokenUsed
+		}
+
+		// Update user's password
+		result = tx.Model(&db.User{}).Where("id = ?", token.UserID).Update("password", hashedPassword)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// Stores a refresh token
+func (r *userRepository) CreateRefreshToken(token *db.RefreshToken) error {
+	return r.DB.Create(token).Error
+}
+
+// Find a refresh token by the hash of the token
+func (r *userRepository) FindRefreshToken(tokenHash string) (*db.RefreshToken, error) {
+	token := db.RefreshToken{}
+	result := r.DB.Where("token_hash = ?", tokenHash).First(&token)
+
+	// If error detected
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	// else
+	return &token, nil
+}
+
+// Marks a refresh token as used and stores its replacement
+// Returns ErrRefreshTokenUsed if the token was used or revoked in the meantime
+func (r *userRepository) RotateRefreshToken(used *db.RefreshToken, replacement *db.RefreshToken) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		// Only succeeds for the first request using the token
+		result := tx.Model(&db.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", used.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenUsed
+		}
+		return tx.Create(replacement).Error
+	})
+}
+
+// Revokes all tokens in a refresh token family
+func (r *userRepository) RevokeRefreshTokenFamily(familyID string) error {
+	return r.DB.Model(&db.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// Stores a session
+func (r *userRepository) CreateSession(session *db.Session) error {
+	return r.DB.Create(session).Error
+}
+
+// Find a user's active sessions (not revoked or expired), most recently active first
+func (r *userRepository) FindSessions(userID uint) ([]db.Session, error) {
+	sessions := []db.Session{}
+	result := r.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).Order("last_active_at desc, id desc").Find(&sessions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return sessions, nil
+}
+
+// Find one of a user's active sessions
+// Returns gorm.ErrRecordNotFound if the user has no such (active) session
+func (r *userRepository) FindSession(userID uint, id uint) (*db.Session, error) {
+	session := db.Session{}
+	result := r.DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?", id, userID, time.Now()).First(&session)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &session, nil
+}
+
+// Extends a session (when its refresh token is exchanged), marking it as active
+func (r *userRepository) ExtendSession(tokenID string, expiresAt time.Time) error {
+	return r.DB.Model(&db.Session{}).Where("token_id = ?", tokenID).Updates(map[string]interface{}{
+		"expires_at":     expiresAt,
+		"last_active_at": time.Now(),
+	}).Error
+}
+
+// Revokes a session and its refresh tokens
+func (r *userRepository) RevokeSession(tokenID string) error {
+	now := time.Now()
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&db.Session{}).
+			Where("token_id = ? AND revoked_at IS NULL", tokenID).
+			Update("revoked_at", now).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&db.RefreshToken{}).
+			Where("family_id = ? AND revoked_at IS NULL", tokenID).
+			Update("revoked_at", now).Error
+	})
+}
+
+// Revokes all of a user's sessions and refresh tokens (logging the user out of all devices)
+// The session with exceptTokenID (if set) is kept
+func (r *userRepository) RevokeUserSessions(userID uint, exceptTokenID string) error {
+	now := time.Now()
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&db.Session{}).
+			Where("user_id = ? AND token_id <> ? AND revoked_at IS NULL", userID, exceptTokenID).
+			Update("revoked_at", now).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&db.RefreshToken{}).
+			Where("user_id = ? AND family_id <> ? AND revoked_at IS NULL", userID, exceptTokenID).
+			Update("revoked_at", now).Error
+	})
+}
+
+// Records a login attempt
+func (r *userRepository) CreateLoginEvent(event *db.LoginEvent) error {
+	return r.DB.Create(event).Error
+}
+
+// Find a user's most recent login attempts, newest first
+func (r *userRepository) FindLoginEvents(userID uint, limit int) ([]db.LoginEvent, error) {
+	events := []db.LoginEvent{}
+	result := r.DB.Where("user_id = ?", userID).Order("created_at desc, id desc").Limit(limit).Find(&events)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return events, nil
+}
+
+// Stores a new (unconfirmed) two factor secret for a user. Two factor authentication stays disabled until confirmed
+func (r *userRepository) SetTwoFactorSecret(userID uint, secret string) error {
+	result := r.DB.Model(&db.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"two_factor_secret":    secret,
+		"two_factor_enabled":   false,
+		"two_factor_last_step": 0,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Enables two factor authentication for a user, replacing their recovery codes
+func (r *userRepository) EnableTwoFactor(userID uint, recoveryCodeHashes []string) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&db.User{}).Where("id = ?", userID).Update("two_factor_enabled", true)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		// Replace recovery codes
+		if err := tx.Where("user_id = ?", userID).Delete(&db.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]db.RecoveryCode, 0, len(recoveryCodeHashes))
+		for _, hash := range recoveryCodeHashes {
+			codes = append(codes, db.RecoveryCode{UserID: userID, CodeHash: hash})
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// Disables two factor authentication for a user, removing their secret and recovery codes
+func (r *userRepository) DisableTwoFactor(userID uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&db.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"two_factor_secret":    nil,
+			"two_factor_enabled":   false,
+			"two_factor_last_step": 0,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("user_id = ?", userID).Delete(&db.RecoveryCode{}).Error
+	})
+}
+
+// Records the time step of an accepted two factor code
+// Returns ErrTwoFactorCodeUsed if a code from the same (or a later) time step was already accepted
+func (r *userRepository) UseTwoFactorStep(userID uint, step int64) error {
+	result := r.DB.Model(&db.User{}).
+		Where("id = ? AND two_factor_last_step < ?", userID, step).
+		Update("two_factor_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTwoFactorCodeUsed
+	}
+	return nil
+}
+
+// Marks a user's recovery code as used
+// Returns ErrRecoveryCodeUsed if the code is unknown or was already used
+func (r *userRepository) UseRecoveryCode(userID uint, codeHash string) error {
+	result := r.DB.Model(&db.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRecoveryCodeUsed
+	}
+	return nil
+}
+
+// Stores an API key
+func (r *userRepository) CreateApiKey(key *db.ApiKey) error {
+	return r.DB.Create(key).Error
+}
+
+// Find a user's API keys (excluding revoked keys), newest first
+func (r *userRepository) FindApiKeys(userID uint) ([]db.ApiKey, error) {
+	keys := []db.ApiKey{}
+	result := r.DB.Where("user_id = ? AND revoked_at IS NULL", userID).Order("created_at desc, id desc").Find(&keys)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return keys, nil
+}
+
+// Revokes one of a user's API keys
+// Returns gorm.ErrRecordNotFound if the user has no such (active) key
+func (r *userRepository) RevokeApiKey(userID uint, keyID uint) error {
+	result := r.DB.Model(&db.ApiKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", keyID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Revokes all of a user's API keys
+func (r *userRepository) RevokeUserApiKeys(userID uint) error {
+	return r.DB.Model(&db.ApiKey{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// Find the login throttles with the given keys (keys without failed attempts aren't returned)
+func (r *userRepository) FindLoginThrottles(keys ...string) ([]db.LoginThrottle, error) {
+	throttles := []db.LoginThrottle{}
+	result := r.DB.Where("key IN ?", keys).Find(&throttles)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return throttles, nil
+}
+
+// Counts a failed login, returning the updated throttle
+// The counter (and lock) is reset if the last failure was before resetBefore
+func (r *userRepository) RecordLoginFailure(key string, resetBefore time.Time) (*db.LoginThrottle, error) {
+	now := time.Now()
+	// Insert, or increment the existing counter in a single statement (safe for concurrent logins)
+	err := r.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"failures":        gorm.Expr("CASE WHEN last_failure_at < ? THEN 1 ELSE failures + 1 END", resetBefore),
+			"locked_until":    gorm.Expr("CASE WHEN last_failure_at < ? THEN NULL ELSE locked_until END", resetBefore),
+			"last_failure_at": now,
+			"updated_at":      now,
+		}),
+	}).Create(&db.LoginThrottle{Key: key, Failures: 1, LastFailureAt: now}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	throttle := db.LoginThrottle{}
+	result := r.DB.Where("key = ?", key).First(&throttle)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &throttle, nil
+}
+
+// Rejects logins for a throttle key until the given time
+func (r *userRepository) LockLogin(key string, until time.Time) error {
+	return r.DB.Model(&db.LoginThrottle{}).Where("key = ?", key).Update("locked_until", until).Error
+}
+
+// Removes a throttle (resetting its failed attempts and lock)
+func (r *userRepository) ClearLoginThrottle(key string) error {
+	return r.DB.Where("key = ?", key).Delete(&db.LoginThrottle{}).Error
+}
@@ -2,6 +2,7 @@ package modulerepositories
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/dmawardi/Go-Template/internal/db"
 	data "github.com/dmawardi/Go-Template/internal/helpers/data"
@@ -14,8 +15,8 @@ type PostRepository interface {
 	FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[db.Post], error)
 	FindById(int) (*db.Post, error)
 	Create(post *db.Post) (*db.Post, error)
-	Update(int, *db.Post) (*db.Post, error)
-	Delete(int) error
+	Update(int, *db.Post, time.Time) (*db.Post, error)
+	Delete(int, time.Time) error
 	BulkDelete([]int) error
 }
 
@@ -76,17 +77,25 @@ func (r *postRepository) FindById(id int) (*db.Post, error) {
 }
 
 // Delete post in database
-func (r *postRepository) Delete(id int) error {
+func (r *postRepository) Delete(id int, version time.Time) error {
 	// Create an empty ref object of type post
 	post := db.Post{}
 	// Check if post exists in db
-	result := r.DB.Delete(&post, id)
+	query := r.DB
+	if !version.IsZero() {
+		query = query.Where("updated_at = ?", version)
+	}
+	result := query.Delete(&post, id)
 
 	// If error detected
 	if result.Error != nil {
 		fmt.Println("error in deleting post: ", result.Error)
 		return result.Error
 	}
+	// If the post changed since the version, nothing was deleted
+	if !version.IsZero() && result.RowsAffected == 0 {
+		return models.ErrRecordModified
+	}
 	// else
 	return nil
 }
@@ -104,7 +113,8 @@ func (r *postRepository) BulkDelete(ids []int) error {
 }
 
 // Updates post in database
-func (r *postRepository) Update(id int, post *db.Post) (*db.Post, error) {
+// If version is set (the updated_at last read), the update only applies if the post hasn't changed since
+func (r *postRepository) Update(id int, post *db.Post, version time.Time) (*db.Post, error) {
 	// Init
 	var err error
 	// Find post by id
@@ -119,11 +129,19 @@ func (r *postRepository) Update(id int, post *db.Post) (*db.Post, error) {
 	}
 
 	// Update post using found post
-	updateResult := r.DB.Model(&found).Updates(post)
+	query := r.DB.Model(&found)
+	if !version.IsZero() {
+		query = query.Where("updated_at = ?", version)
+	}
+	updateResult := query.Updates(post)
 	if updateResult.Error != nil {
 		fmt.Println("Post update failed: ", updateResult.Error)
 		return nil, updateResult.Error
 	}
+	// If the post changed since the version, nothing was updated
+	if !version.IsZero() && updateResult.RowsAffected == 0 {
+		return nil, models.ErrRecordModified
+	}
 
 	// Retrieve changed post by id
 	updated, err := r.FindById(id)
@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/dmawardi/Go-Template/internal/config"
 	"github.com/dmawardi/Go-Template/internal/models"
 	corerepositories "github.com/dmawardi/Go-Template/internal/repository/core"
@@ -18,7 +20,9 @@ type BasicModuleRepository[dbSchema any] interface {
 	FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[dbSchema], error)
 	FindById(int) (*dbSchema, error)
 	Create(entity *dbSchema) (*dbSchema, error)
-	Update(int, *dbSchema) (*dbSchema, error)
-	Delete(int) error
+	// Updates only apply if the record hasn't changed since the given version (updated_at), if set
+	Update(int, *dbSchema, time.Time) (*dbSchema, error)
+	// Deletes only apply if the record hasn't changed since the given version (updated_at), if set
+	Delete(int, time.Time) error
 	BulkDelete([]int) error
 }
\ No newline at end of file
@@ -1,7 +1,9 @@
 package repository_test
 
 import (
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/dmawardi/Go-Template/internal/db"
 	"github.com/dmawardi/Go-Template/internal/helpers"
@@ -149,7 +151,7 @@ func TestUserRepository_Delete(t *testing.T) {
 	}
 
 	// Delete the created user
-	err = testModule.users.repo.Delete(int(createdUser.ID))
+	err = testModule.users.repo.Delete(int(createdUser.ID), time.Time{})
 	if err != nil {
 		t.Fatalf("failed to delete created user: %v", err)
 	}
@@ -215,7 +217,7 @@ func TestUserRepository_Update(t *testing.T) {
 
 	createdUser.Username = "Al-Amal"
 
-	updatedUser, err := testModule.users.repo.Update(int(createdUser.ID), createdUser)
+	updatedUser, err := testModule.users.repo.Update(int(createdUser.ID), createdUser, time.Time{})
 	if err != nil {
 		t.Fatalf("An error was encountered while updating: %v", err)
 	}
@@ -228,6 +230,16 @@ func TestUserRepository_Update(t *testing.T) {
 	// Verify that the found user matches the original user
 	helpers.CompareObjects(createdUser, foundUser, t, []string{"ID", "Email", "Username", "Name"})
 
+	// Updates given a version only apply if the user hasn't changed since
+	_, err = testModule.users.repo.Update(int(createdUser.ID), &db.User{Name: "Stale"}, createdUser.UpdatedAt.Add(-time.Second))
+	if !errors.Is(err, models.ErrRecordModified) {
+		t.Errorf("Update with stale version: expected %v, got %v", models.ErrRecordModified, err)
+	}
+	_, err = testModule.users.repo.Update(int(createdUser.ID), &db.User{Name: "Current"}, foundUser.UpdatedAt)
+	if err != nil {
+		t.Errorf("Update with current version: %v", err)
+	}
+
 	// Clean up: Delete created user
 	testModule.dbClient.Delete(updatedUser)
 }
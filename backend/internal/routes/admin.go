@@ -39,6 +39,26 @@ func AddAdminRouteSet(router *chi.Mux, protected bool, urlExtension string, cont
 	return router
 }
 
+// Adds user account routes (in addition to the basic CRUD route set) to the admin panel
+func AddAdminUserRouteSet(router *chi.Mux, protected bool, urlExtension string, controller adminpanel.AdminUserController) *chi.Mux {
+	// Reassign for consistency
+	r := router
+	r.Group(func(mux chi.Router) {
+		// Set to use JWT authentication if protected
+		if protected {
+			mux.Use(auth.AuthenticateJWT)
+		}
+		// Unlock account (after failed logins)
+		mux.Post(fmt.Sprintf("/admin/%s/unlock/{id}", urlExtension), controller.Unlock)
+		mux.Get(fmt.Sprintf("/admin/%s/unlock/success", urlExtension), controller.UnlockSuccess)
+		// Active sessions and login history
+		mux.Get(fmt.Sprintf("/admin/%s/sessions/{id}", urlExtension), controller.Sessions)
+		mux.Post(fmt.Sprintf("/admin/%s/sessions/{id}/{session}/revoke", urlExtension), controller.RevokeSession)
+		mux.Get(fmt.Sprintf("/admin/%s/sessions/revoke/success", urlExtension), controller.RevokeSessionSuccess)
+	})
+	return router
+}
+
 func AddAdminActionRouteSet(router *chi.Mux, protected bool, urlExtension string, controller adminpanel.AdminActionController) *chi.Mux {
 	// Reassign for consistency
 	r := router
@@ -56,6 +76,74 @@ func AddAdminActionRouteSet(router *chi.Mux, protected bool, urlExtension string
 	return router
 }
 
+// Adds routes for inspecting and managing queued jobs in the admin panel
+func AddAdminJobRouteSet(router *chi.Mux, protected bool, urlExtension string, controller adminpanel.AdminJobController) *chi.Mux {
+	// Reassign for consistency
+	r := router
+	r.Group(func(mux chi.Router) {
+		// Set to use JWT authentication if protected
+		if protected {
+			mux.Use(auth.AuthenticateJWT)
+		}
+		// Read All
+		mux.Get(fmt.Sprintf("/admin/%s", urlExtension), controller.FindAll)
+		// Retry
+		mux.Post(fmt.Sprintf("/admin/%s/retry/{id}", urlExtension), controller.Retry)
+		mux.Get(fmt.Sprintf("/admin/%s/retry/success", urlExtension), controller.RetrySuccess)
+		// Cancel
+		mux.Post(fmt.Sprintf("/admin/%s/cancel/{id}", urlExtension), controller.Cancel)
+		mux.Get(fmt.Sprintf("/admin/%s/cancel/success", urlExtension), controller.CancelSuccess)
+		// Bulk purge (from table)
+		mux.Delete(fmt.Sprintf("/admin/%s/bulk-delete", urlExtension), controller.BulkDelete)
+
+		// View One
+		mux.Get(fmt.Sprintf("/admin/%s/{id}", urlExtension), controller.View)
+	})
+	return router
+}
+
+// Adds routes for searching the email delivery history in the admin panel
+func AddAdminEmailLogRouteSet(router *chi.Mux, protected bool, urlExtension string, controller adminpanel.AdminEmailLogController) *chi.Mux {
+	// Reassign for consistency
+	r := router
+	r.Group(func(mux chi.Router) {
+		// Set to use JWT authentication if protected
+		if protected {
+			mux.Use(auth.AuthenticateJWT)
+		}
+		// Read All
+		mux.Get(fmt.Sprintf("/admin/%s", urlExtension), controller.FindAll)
+		// Bulk delete (from table)
+		mux.Delete(fmt.Sprintf("/admin/%s/bulk-delete", urlExtension), controller.BulkDelete)
+
+		// View One
+		mux.Get(fmt.Sprintf("/admin/%s/{id}", urlExtension), controller.View)
+	})
+	return router
+}
+
+// Adds routes for viewing emails captured by the file email driver in the admin panel
+func AddAdminOutboxRouteSet(router *chi.Mux, protected bool, urlExtension string, controller adminpanel.AdminOutboxController) *chi.Mux {
+	// Reassign for consistency
+	r := router
+	r.Group(func(mux chi.Router) {
+		// Set to use JWT authentication if protected
+		if protected {
+			mux.Use(auth.AuthenticateJWT)
+		}
+		// Read All
+		mux.Get(fmt.Sprintf("/admin/%s", urlExtension), controller.FindAll)
+		// Bulk delete (from table)
+		mux.Delete(fmt.Sprintf("/admin/%s/bulk-delete", urlExtension), controller.BulkDelete)
+
+		// View One
+		mux.Get(fmt.Sprintf("/admin/%s/{id}", urlExtension), controller.View)
+		// Download as .eml
+		mux.Get(fmt.Sprintf("/admin/%s/{id}/raw", urlExtension), controller.Raw)
+	})
+	return router
+}
+
 // Adds routess for editing and creating admin auth policies for the admin panel
 func AddAdminPolicySet(router *chi.Mux, protected bool, urlExtension string, controller adminpanel.AdminAuthPolicyController) *chi.Mux {
 	// Reassign for consistency
@@ -103,6 +191,8 @@ func AddBasicAdminRoutes(router *chi.Mux, controller adminpanel.AdminCoreControl
 		mux.Get("/admin", controller.AdminRedirectBasedOnLoginStatus)
 		mux.Get("/admin/login", controller.Login)
 		mux.Post("/admin/login", controller.Login)
+		// Second step of the login for users with two factor authentication
+		mux.Post("/admin/login/2fa", controller.TwoFactorLogin)
 
 		// admin logout
 		mux.Get("/admin/logout", controller.Logout)
@@ -120,6 +210,9 @@ func AddBasicAdminRoutes(router *chi.Mux, controller adminpanel.AdminCoreControl
 			mux.Post("/admin/change-password", controller.ChangePassword)
 
 			mux.Get("/admin/change-password-success", controller.ChangePasswordSuccess)
+			// Two factor authentication setup
+			mux.Get("/admin/two-factor", controller.TwoFactorSetup)
+			mux.Post("/admin/two-factor", controller.TwoFactorSetup)
 
 		})
 
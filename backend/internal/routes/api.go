@@ -22,8 +22,11 @@ type Api interface {
 // Api that contains all controllers for route creation
 type api struct {
 	// Basic Controllers
-	User   core.UserController
-	Policy core.AuthPolicyController
+	User     core.UserController
+	Policy   core.AuthPolicyController
+	Job      core.JobController
+	EmailLog core.EmailLogController
+	Cache    core.CacheController
 	// Admin Controller
 	Admin adminpanel.AdminPanelController
 	// Module Controllers
@@ -36,6 +39,9 @@ func NewApi(
 	admin adminpanel.AdminPanelController,
 	user core.UserController,
 	policy core.AuthPolicyController,
+	job core.JobController,
+	emailLog core.EmailLogController,
+	cache core.CacheController,
 	moduleMap models.ModuleMap) Api {
-	return &api{Admin: admin, User: user, Policy: policy, ModuleMap: moduleMap}
+	return &api{Admin: admin, User: user, Policy: policy, Job: job, EmailLog: emailLog, Cache: cache, ModuleMap: moduleMap}
 }
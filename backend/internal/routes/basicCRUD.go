@@ -14,14 +14,17 @@ func AddBasicCrudApiRoutes(router *chi.Mux, urlExtension string, controller mode
 	router.Group(func(mux chi.Router) {
 		// Private routes
 		mux.Use(auth.AuthenticateJWT)
+		// ETags and 304 Not Modified responses for GET requests
+		mux.Use(conditionalGetMiddleware)
 		// @tag.name Private routes
 		// @tag.description Protected routes
 		// Route set
 		mux.Get(fmt.Sprintf("/api/%s", urlExtension), controller.FindAll)
 		mux.Get(fmt.Sprintf("/api/%s/{id}", urlExtension), controller.Find)
-		mux.Put(fmt.Sprintf("/api/%s/{id}", urlExtension), controller.Update)
+		// Updates and deletes are rejected if If-Match doesn't match the current ETag
+		mux.With(ifMatchMiddleware(controller.Find)).Put(fmt.Sprintf("/api/%s/{id}", urlExtension), controller.Update)
 		mux.Post(fmt.Sprintf("/api/%s", urlExtension), controller.Create)
-		mux.Delete(fmt.Sprintf("/api/%s/{id}", urlExtension), controller.Delete)
+		mux.With(ifMatchMiddleware(controller.Find)).Delete(fmt.Sprintf("/api/%s/{id}", urlExtension), controller.Delete)
 	})
 
 	return router
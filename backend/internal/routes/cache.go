@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"github.com/dmawardi/Go-Template/internal/auth"
+	"github.com/dmawardi/Go-Template/internal/controller/core"
+	"github.com/go-chi/chi/v5"
+)
+
+// Adds cache routes to a Chi mux router
+func AddCacheApiRoutes(router *chi.Mux, cache core.CacheController) *chi.Mux {
+	router.Group(func(mux chi.Router) {
+		// Private routes
+		mux.Use(auth.AuthenticateJWT)
+
+		// @tag.name Private routes
+		// @tag.description Protected routes
+		// Cache usage statistics
+		mux.Get("/api/cache/stats", cache.Stats)
+	})
+	return router
+}
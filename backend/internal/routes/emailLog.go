@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"github.com/dmawardi/Go-Template/internal/auth"
+	"github.com/dmawardi/Go-Template/internal/controller/core"
+	"github.com/go-chi/chi/v5"
+)
+
+// Adds email log routes to a Chi mux router
+func AddEmailLogApiRoutes(router *chi.Mux, emailLog core.EmailLogController) *chi.Mux {
+	router.Group(func(mux chi.Router) {
+		// Private routes
+		mux.Use(auth.AuthenticateJWT)
+
+		// @tag.name Private routes
+		// @tag.description Protected routes
+		// Email delivery history
+		mux.Get("/api/email-logs", emailLog.FindAll)
+		mux.Get("/api/email-logs/{id}", emailLog.Find)
+	})
+	return router
+}
@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"github.com/dmawardi/Go-Template/internal/auth"
+	"github.com/dmawardi/Go-Template/internal/controller/core"
+	"github.com/go-chi/chi/v5"
+)
+
+// Adds Job queue routes to a Chi mux router
+func AddJobApiRoutes(router *chi.Mux, job core.JobController) *chi.Mux {
+	router.Group(func(mux chi.Router) {
+		// Private routes
+		mux.Use(auth.AuthenticateJWT)
+
+		// @tag.name Private routes
+		// @tag.description Protected routes
+		// Jobs
+		mux.Get("/api/jobs", job.FindAll)
+		mux.Get("/api/jobs/{id}", job.Find)
+		// Re-queue a dead job
+		mux.Post("/api/jobs/retry/{id}", job.Retry)
+	})
+	return router
+}
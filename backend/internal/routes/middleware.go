@@ -1,7 +1,16 @@
 package routes
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/helpers/request"
 )
 
 // Middleware that adds CORS headers to every response
@@ -10,7 +19,9 @@ func corsMiddleware(next http.Handler) http.Handler {
 		// Set headers to allow cross-origin requests.
 		w.Header().Set("Access-Control-Allow-Origin", "*") // Replace "*" with allowed origins.
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match, If-None-Match, If-Modified-Since")
+		// Allow the frontend to read conditional request headers
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Last-Modified")
 
 		// Handle preflight requests (OPTIONS method).
 		if r.Method == http.MethodOptions {
@@ -22,3 +33,170 @@ func corsMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// Middleware that adds an ETag (hash of the response body) and Last-Modified (the record's updated_at)
+// to successful GET responses, and answers 304 Not Modified if the client's copy (If-None-Match or If-Modified-Since) is current.
+// Other methods are passed through.
+func conditionalGetMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Buffer response to hash it
+		response := newBufferedResponse()
+		next.ServeHTTP(response, r)
+		// Only successful responses are tagged
+		if response.status != http.StatusOK {
+			response.writeTo(w)
+			return
+		}
+
+		etag := contentETag(response.body.Bytes())
+		response.header.Set("ETag", etag)
+		// Clients must revalidate before using their copy
+		response.header.Set("Cache-Control", "private, no-cache")
+		lastModified := recordLastModified(response.body.Bytes())
+		if !lastModified.IsZero() {
+			response.header.Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+		}
+
+		if notModified(r, etag, lastModified) {
+			for key, values := range response.header {
+				w.Header()[key] = values
+			}
+			w.Header().Del("Content-Length")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		response.writeTo(w)
+	})
+}
+
+// Builds middleware that checks the If-Match header of a request against the ETag of the resource's current
+// representation (the response of the get handler for the same URL), answering 412 Precondition Failed on a mismatch
+// so concurrent edits aren't overwritten. The matched version is checked again by the update (see request.ExpectedVersion).
+// Requests without If-Match are passed through.
+func ifMatchMiddleware(get http.HandlerFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ifMatch := r.Header.Get("If-Match")
+			if ifMatch == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Load current representation
+			getRequest := r.Clone(r.Context())
+			getRequest.Method = http.MethodGet
+			getRequest.Body = http.NoBody
+			getRequest.ContentLength = 0
+			response := newBufferedResponse()
+			get(response, getRequest)
+
+			// Resource must exist and match one of the ETags
+			if response.status != http.StatusOK || !etagMatches(ifMatch, contentETag(response.body.Bytes()), false) {
+				http.Error(w, "Resource has been modified", http.StatusPreconditionFailed)
+				return
+			}
+			// Pass on the version that was matched, so the update only applies if the record is still unchanged
+			// (another request may change it before the handler runs). Any version is accepted with "*".
+			if strings.TrimSpace(ifMatch) != "*" {
+				r = request.WithExpectedVersion(r, recordLastModified(response.body.Bytes()))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Checks whether the client's cached copy is current.
+// If-Modified-Since is only used when If-None-Match isn't sent.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etagMatches(ifNoneMatch, etag, true)
+	}
+	if lastModified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	// HTTP dates are in whole seconds
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+// Checks whether an If-Match or If-None-Match header value ("*" or a list of ETags) matches the ETag.
+// Weak comparison ignores the W/ prefix (used for If-None-Match).
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Builds a strong ETag from a hash of the content
+func contentETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return strconv.Quote(hex.EncodeToString(sum[:16]))
+}
+
+// Returns the updated_at time of a single record response (zero for lists and other responses).
+// Lists aren't given a Last-Modified as deleted records don't change their latest update time.
+func recordLastModified(content []byte) time.Time {
+	var record struct {
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+	if err := json.Unmarshal(content, &record); err != nil {
+		return time.Time{}
+	}
+	return record.UpdatedAt
+}
+
+// Response writer that holds the response in memory
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: http.Header{}}
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(data []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(data)
+}
+
+// Writes the buffered response to w
+func (b *bufferedResponse) writeTo(w http.ResponseWriter) {
+	for key, values := range b.header {
+		w.Header()[key] = values
+	}
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	w.WriteHeader(b.status)
+	w.Write(b.body.Bytes())
+}
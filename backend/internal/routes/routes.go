@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/dmawardi/Go-Template/internal/config"
+	"github.com/dmawardi/Go-Template/internal/controller"
 	"github.com/dmawardi/Go-Template/internal/models"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
@@ -23,18 +24,34 @@ func (a api) Routes() http.Handler {
 	mux.Use(middleware.Logger)
 	mux.Use(corsMiddleware)
 
+	// Public keys used to verify tokens
+	mux.Get("/.well-known/jwks.json", controller.JWKS)
+
 	// Add user and group API routes
 	mux = AddUserApiRoutes(mux, a.User)
 	mux = AddAuthRBACApiRoutes(mux, a.Policy)
+	// Add job queue API routes
+	mux = AddJobApiRoutes(mux, a.Job)
+	// Add email log API routes
+	mux = AddEmailLogApiRoutes(mux, a.EmailLog)
+	// Add cache API routes
+	mux = AddCacheApiRoutes(mux, a.Cache)
 
 	// Add basic admin panel routes (home, login, etc)
 	mux = AddBasicAdminRoutes(mux, a.Admin.Base)
 	// Add admin user routes
 	mux = AddAdminRouteSet(mux, true, "users", a.Admin.User)
+	mux = AddAdminUserRouteSet(mux, true, "users", a.Admin.User)
 	// Add admin policy routes
 	mux = AddAdminPolicySet(mux, true, "policy", a.Admin.Auth)
 	// Add admin action routes
 	mux = AddAdminActionRouteSet(mux, true, "actions", a.Admin.Action)
+	// Add admin job routes
+	mux = AddAdminJobRouteSet(mux, true, "jobs", a.Admin.Job)
+	// Add admin email log routes
+	mux = AddAdminEmailLogRouteSet(mux, true, "email-logs", a.Admin.EmailLog)
+	// Add admin outbox routes
+	mux = AddAdminOutboxRouteSet(mux, true, "outbox", a.Admin.Outbox)
 
 	// Other schemas
 	for _, module := range a.ModuleMap {
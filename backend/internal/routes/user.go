@@ -15,8 +15,13 @@ func AddUserApiRoutes(router *chi.Mux, user core.UserController) *chi.Mux {
 		// @tag.description Unprotected routes
 		// Login
 		mux.Post("/api/users/login", user.Login)
+		// Complete a login with a two factor code
+		mux.Post("/api/users/login/2fa", user.VerifyTwoFactor)
+		// Exchange a refresh token for a new access token
+		mux.Post("/api/users/refresh", user.Refresh)
 		// Forgot password
 		mux.Post("/api/users/forgot-password", user.ResetPassword)
+		mux.Post("/api/users/reset-password/confirm", user.ConfirmResetPassword)
 		// Verify Email
 		mux.Get("/api/users/verify-email/{token}", user.EmailVerification)
 
@@ -26,23 +31,46 @@ func AddUserApiRoutes(router *chi.Mux, user core.UserController) *chi.Mux {
 		// Private routes
 		mux.Group(func(mux chi.Router) {
 			mux.Use(auth.AuthenticateJWT)
+			// ETags and 304 Not Modified responses for GET requests
+			mux.Use(conditionalGetMiddleware)
 
 			// @tag.name Private routes
 			// @tag.description Protected routes
 			// users
 			mux.Get("/api/users", user.FindAll)
 			mux.Get("/api/users/{id}", user.Find)
-			mux.Put("/api/users/{id}", user.Update)
-			mux.Delete("/api/users/{id}", user.Delete)
+			// Updates and deletes are rejected if If-Match doesn't match the current ETag
+			mux.With(ifMatchMiddleware(user.Find)).Put("/api/users/{id}", user.Update)
+			mux.With(ifMatchMiddleware(user.Find)).Delete("/api/users/{id}", user.Delete)
+			// Unlock account (after failed logins)
+			mux.Post("/api/users/{id}/unlock", user.Unlock)
 
 			// My profile
 			mux.Get("/api/me", user.GetMyUserDetails)
 			mux.Post("/api/me", controller.HealthCheck)
-			mux.Put("/api/me", user.UpdateMyProfile)
+			mux.With(ifMatchMiddleware(user.GetMyUserDetails)).Put("/api/me", user.UpdateMyProfile)
+
+			// Two factor authentication
+			mux.Post("/api/me/2fa/enroll", user.EnrollTwoFactor)
+			mux.Post("/api/me/2fa/confirm", user.ConfirmTwoFactor)
+			mux.Post("/api/me/2fa/disable", user.DisableTwoFactor)
+
+			// API keys
+			mux.Get("/api/me/api-keys", user.FindMyApiKeys)
+			mux.Post("/api/me/api-keys", user.CreateApiKey)
+			mux.Delete("/api/me/api-keys/{id}", user.RevokeApiKey)
+
+			// Sessions (logged in devices)
+			mux.Get("/api/me/sessions", user.FindMySessions)
+			mux.Delete("/api/me/sessions", user.RevokeMyOtherSessions)
+			mux.Delete("/api/me/sessions/{id}", user.RevokeMySession)
 
 			// Email verification
 			mux.Post("/api/users/send-verification-email", user.ResendVerificationEmail)
 
+			// Revoke the current token
+			mux.Post("/api/users/logout", user.Logout)
+
 		})
 
 	})
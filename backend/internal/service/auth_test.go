@@ -3,6 +3,7 @@ package service_test
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/dmawardi/Go-Template/internal/helpers"
 	"github.com/dmawardi/Go-Template/internal/helpers/utility"
@@ -246,7 +247,7 @@ func TestAuthPolicyService_FindRoleByUserId(t *testing.T) {
 	}
 
 	// Clean up
-	err = testModule.users.serv.Delete(int(createdUser.ID))
+	err = testModule.users.serv.Delete(int(createdUser.ID), time.Time{})
 	if err != nil {
 		t.Errorf("Error deleting user: %v", err)
 	}
@@ -311,7 +312,7 @@ func TestAuthPolicyService_AssignUserRole(t *testing.T) {
 	}
 
 	// Clean up
-	err = testModule.users.serv.Delete(int(createdUser.ID))
+	err = testModule.users.serv.Delete(int(createdUser.ID), time.Time{})
 	if err != nil {
 		t.Errorf("Error deleting user: %v", err)
 	}
@@ -376,7 +377,7 @@ func TestAuthPolicyService_CreateRole(t *testing.T) {
 	}
 
 	// Clean up
-	err = testModule.users.serv.Delete(int(createdUser.ID))
+	err = testModule.users.serv.Delete(int(createdUser.ID), time.Time{})
 	if err != nil {
 		t.Errorf("Error deleting user: %v", err)
 	}
@@ -467,7 +468,7 @@ func TestAuthPolicyService_CreateInheritance(t *testing.T) {
 		t.Errorf("Error deleting inheritance: %v", err)
 	}
 
-	err = testModule.users.serv.Delete(int(createdUser1.ID))
+	err = testModule.users.serv.Delete(int(createdUser1.ID), time.Time{})
 	if err != nil {
 		t.Errorf("Error deleting user: %v", err)
 	}
@@ -515,7 +516,7 @@ func TestAuthPolicyService_DeleteInheritance(t *testing.T) {
 	}
 
 	// Clean up
-	err = testModule.users.serv.Delete(int(createdUser.ID))
+	err = testModule.users.serv.Delete(int(createdUser.ID), time.Time{})
 	if err != nil {
 		t.Errorf("Error deleting user: %v", err)
 	}
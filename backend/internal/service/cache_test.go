@@ -0,0 +1,571 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/cache"
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers"
+	"github.com/dmawardi/Go-Template/internal/models"
+	schemamodels "github.com/dmawardi/Go-Template/internal/models/schemaModels"
+	"gorm.io/gorm"
+)
+
+func TestCacheMap_LRUEviction(t *testing.T) {
+	m := cache.NewCacheMap(2)
+
+	m.Store("a", 1)
+	m.Store("b", 2)
+	// Use "a" so "b" becomes the least recently used entry
+	var value int
+	if !m.Load("a", &value) {
+		t.Fatalf("expected a to be cached")
+	}
+	// Storing a third entry evicts "b"
+	m.Store("c", 3)
+
+	if m.Load("b", &value) {
+		t.Errorf("expected least recently used entry b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if !m.Load(key, &value) {
+			t.Errorf("expected %s to be cached", key)
+		}
+	}
+
+	// Updating an existing key doesn't evict
+	m.Store("a", 10)
+	if !m.Load("a", &value) || value != 10 {
+		t.Errorf("expected a to be updated to 10, got %v", value)
+	}
+
+	stats := m.Stats()
+	if stats.Entries != 2 || stats.MaxEntries != 2 || stats.Evictions != 1 {
+		t.Errorf("unexpected stats after eviction: %+v", stats)
+	}
+	// Hits: a, a, c, a. Misses: b
+	if stats.Hits != 4 || stats.Misses != 1 {
+		t.Errorf("expected 4 hits and 1 miss, got %d hits and %d misses", stats.Hits, stats.Misses)
+	}
+}
+
+func TestCacheMap_Expiry(t *testing.T) {
+	m := cache.NewCacheMap(10)
+
+	m.Store("short", 1, time.Millisecond)
+	m.Store("long", 2, time.Hour)
+	time.Sleep(5 * time.Millisecond)
+
+	// Expired entries are removed by the sweep without being loaded
+	if removed := m.DeleteExpired(); removed != 1 {
+		t.Errorf("expected 1 expired entry to be removed, got %d", removed)
+	}
+	stats := m.Stats()
+	if stats.Entries != 1 || stats.Expirations != 1 {
+		t.Errorf("unexpected stats after sweep: %+v", stats)
+	}
+
+	// Janitor sweeps in the background
+	m.Store("short", 1, time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m.StartJanitor(ctx, 5*time.Millisecond)
+	deadline := time.Now().Add(time.Second)
+	for m.Stats().Entries != 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if entries := m.Stats().Entries; entries != 1 {
+		t.Errorf("expected janitor to remove expired entry, %d entries remain", entries)
+	}
+}
+
+func TestCacheMap_ZeroValue(t *testing.T) {
+	// Zero value is usable
+	var m cache.CacheMap
+	m.Store("key", "value")
+	var value string
+	if !m.Load("key", &value) || value != "value" {
+		t.Errorf("expected value to be cached, got %v", value)
+	}
+	m.Delete("key")
+	if m.Load("key", &value) {
+		t.Errorf("expected key to be deleted")
+	}
+	if stats := m.Stats(); stats.MaxEntries != cache.DefaultMaxEntries {
+		t.Errorf("expected default max entries %d, got %d", cache.DefaultMaxEntries, stats.MaxEntries)
+	}
+}
+
+func TestCacheMap_LoadCopiesValue(t *testing.T) {
+	m := cache.NewCacheMap(10)
+	m.Store("post:1", &db.Post{Title: "Cached"})
+
+	// Pointers are loaded into values (as a copy)
+	var post db.Post
+	if !m.Load("post:1", &post) || post.Title != "Cached" {
+		t.Fatalf("expected post to be loaded, got %+v", post)
+	}
+	post.Title = "Changed"
+	var again db.Post
+	if !m.Load("post:1", &again) || again.Title != "Cached" {
+		t.Errorf("expected cached post to be unchanged, got %q", again.Title)
+	}
+
+	// A different type is a miss
+	var wrongType db.User
+	if m.Load("post:1", &wrongType) {
+		t.Errorf("expected load into a different type to miss")
+	}
+}
+
+func TestRedisCache(t *testing.T) {
+	server, err := helpers.StartRESPServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	// Two caches sharing a server (eg. two instances of the app)
+	settings := cache.RedisSettings{Addr: server.Addr(), Prefix: "test:"}
+	first, err := cache.NewRedisCache(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	second, err := cache.NewRedisCache(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	// Value stored by one instance can be loaded by the other
+	first.Store("post:1", &db.Post{Title: "Shared", Body: "Body"})
+	var post db.Post
+	if !second.Load("post:1", &post) {
+		t.Fatalf("expected post to be loaded from the shared cache")
+	}
+	if post.Title != "Shared" || post.Body != "Body" {
+		t.Errorf("expected loaded post to match stored post, got %+v", post)
+	}
+
+	// Updates and deletes are seen by the other instance
+	second.Store("post:1", &db.Post{Title: "Updated"})
+	if !first.Load("post:1", &post) || post.Title != "Updated" {
+		t.Errorf("expected updated post, got %q", post.Title)
+	}
+	first.Delete("post:1")
+	if second.Load("post:1", &post) {
+		t.Errorf("expected deleted post to miss")
+	}
+
+	// Expired values miss
+	first.Store("post:2", &db.Post{Title: "Short"}, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if first.Load("post:2", &post) {
+		t.Errorf("expected expired post to miss")
+	}
+
+	stats := second.Stats()
+	if stats.Driver != cache.RedisDriver || stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	// Connection errors are treated as misses
+	server.Close()
+	if first.Load("post:1", &post) {
+		t.Errorf("expected load to miss when the server is down")
+	}
+}
+
+func TestNewCache(t *testing.T) {
+	server, err := helpers.StartRESPServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	var tests = []struct {
+		title          string
+		settings       cache.Settings
+		expectedDriver string
+		expectError    bool
+	}{
+		{"Memory is the default driver", cache.Settings{}, cache.MemoryDriver, false},
+		{"Redis driver", cache.Settings{Driver: cache.RedisDriver, Redis: cache.RedisSettings{Addr: server.Addr()}}, cache.RedisDriver, false},
+		{"Unknown driver", cache.Settings{Driver: "unknown"}, "", true},
+	}
+	for _, v := range tests {
+		built, err := cache.New(context.Background(), v.settings)
+		if v.expectError {
+			if err == nil {
+				t.Errorf("In test '%s': expected error", v.title)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("In test '%s': unexpected error: %v", v.title, err)
+			continue
+		}
+		if driver := built.Stats().Driver; driver != v.expectedDriver {
+			t.Errorf("In test '%s': expected driver %s, got %s", v.title, v.expectedDriver, driver)
+		}
+	}
+}
+
+func TestGetOrLoad_SharesConcurrentLoads(t *testing.T) {
+	m := cache.NewCacheMap(10)
+	var calls int32
+	release := make(chan struct{})
+	loader := func() (*db.Post, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return &db.Post{Title: "Loaded"}, nil
+	}
+
+	// Concurrent misses for the same key
+	var wg sync.WaitGroup
+	results := make(chan *db.Post, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			post, err := cache.GetOrLoad(m, "post:1", time.Minute, loader)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			results <- post
+		}()
+	}
+	// Give the callers time to join the load before releasing it
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	if calls != 1 {
+		t.Errorf("expected loader to be called once, got %d", calls)
+	}
+	// Each caller gets its own copy
+	seen := map[*db.Post]bool{}
+	for post := range results {
+		if post.Title != "Loaded" {
+			t.Errorf("expected loaded post, got %q", post.Title)
+		}
+		if seen[post] {
+			t.Errorf("expected callers to get their own copy")
+		}
+		seen[post] = true
+	}
+
+	// Later calls are served from the cache
+	if _, err := cache.GetOrLoad(m, "post:1", time.Minute, loader); err != nil || calls != 1 {
+		t.Errorf("expected cached post to be returned without loading, got %d calls (err: %v)", calls, err)
+	}
+}
+
+func TestGetOrLoad_NotFound(t *testing.T) {
+	m := cache.NewCacheMap(10)
+	calls := 0
+	loader := func() (*db.Post, error) {
+		calls++
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	// Without negative caching, every call loads
+	for i := 0; i < 2; i++ {
+		if _, err := cache.GetOrLoad(m, "post:1", time.Minute, loader); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected not found error, got %v", err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 loads without negative caching, got %d", calls)
+	}
+
+	// With negative caching, not found is cached
+	calls = 0
+	for i := 0; i < 2; i++ {
+		if _, err := cache.GetOrLoad(m, "post:2", time.Minute, loader, cache.CacheNotFound(time.Minute)); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected not found error, got %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 load with negative caching, got %d", calls)
+	}
+
+	// Other errors aren't cached
+	calls = 0
+	failing := func() (*db.Post, error) {
+		calls++
+		return nil, errors.New("connection refused")
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := cache.GetOrLoad(m, "post:3", time.Minute, failing, cache.CacheNotFound(time.Minute)); err == nil {
+			t.Errorf("expected error")
+		}
+	}
+	if calls != 2 {
+		t.Errorf("expected errors not to be cached, got %d loads", calls)
+	}
+}
+
+func TestGetOrLoad_StaleWhileRevalidate(t *testing.T) {
+	server, err := helpers.StartRESPServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	redisCache, err := cache.NewRedisCache(cache.RedisSettings{Addr: server.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redisCache.Close()
+
+	for name, c := range map[string]cache.Cache{"memory": cache.NewCacheMap(10), "redis": redisCache} {
+		var version int32
+		loader := func() (*db.Post, error) {
+			current := atomic.AddInt32(&version, 1)
+			return &db.Post{Title: fmt.Sprintf("Version %d", current)}, nil
+		}
+		options := []cache.LoadOption{cache.StaleWhileRevalidate(time.Minute)}
+
+		if _, err := cache.GetOrLoad(c, "post:1", 10*time.Millisecond, loader, options...); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+
+		// Stale value is returned while it's reloaded in the background
+		post, err := cache.GetOrLoad(c, "post:1", 10*time.Millisecond, loader, options...)
+		if err != nil || post.Title != "Version 1" {
+			t.Errorf("%s: expected stale post to be returned, got %v (err: %v)", name, post, err)
+		}
+		// Wait for reload
+		deadline := time.Now().Add(time.Second)
+		for post.Title != "Version 2" && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+			if post, err = cache.GetOrLoad(c, "post:1", time.Minute, loader, options...); err != nil {
+				t.Fatalf("%s: unexpected error: %v", name, err)
+			}
+		}
+		if post.Title != "Version 2" {
+			t.Errorf("%s: expected post to be reloaded in the background, got %q", name, post.Title)
+		}
+
+		// Put replaces the cached value
+		cache.Put(c, "post:1", &db.Post{Title: "Updated"}, time.Minute, options...)
+		if post, err = cache.GetOrLoad(c, "post:1", time.Minute, loader, options...); err != nil || post.Title != "Updated" {
+			t.Errorf("%s: expected updated post, got %v (err: %v)", name, post, err)
+		}
+	}
+}
+
+func TestCache_InvalidateTag(t *testing.T) {
+	server, err := helpers.StartRESPServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	redisCache, err := cache.NewRedisCache(cache.RedisSettings{Addr: server.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redisCache.Close()
+
+	for name, c := range map[string]cache.Cache{"memory": cache.NewCacheMap(10), "redis": redisCache} {
+		c.StoreWithTags("post:1", "first", []string{"posts", "user:5"})
+		c.StoreWithTags("post:2", "second", []string{"posts", "user:6"})
+		c.Store("other", "untagged")
+
+		// Invalidating a tag removes only the values stored with it
+		c.InvalidateTag("user:5")
+		var value string
+		if c.Load("post:1", &value) {
+			t.Errorf("%s: expected post:1 to be invalidated", name)
+		}
+		if !c.Load("post:2", &value) || !c.Load("other", &value) {
+			t.Errorf("%s: expected values without the tag to be kept", name)
+		}
+
+		// Values stored again are removed by their new tags
+		c.StoreWithTags("post:2", "second", []string{"user:7"})
+		c.InvalidateTag("user:7", "unknown")
+		if c.Load("post:2", &value) {
+			t.Errorf("%s: expected post:2 to be invalidated", name)
+		}
+	}
+}
+
+func TestEntityTags(t *testing.T) {
+	var tests = []struct {
+		title    string
+		entity   interface{}
+		expected []string
+	}{
+		{"Belongs to relationship", &db.Post{ID: 1, UserID: 5}, []string{"posts", "post:1", "user:5"}},
+		{"Unsaved entity", db.Post{}, []string{"posts"}},
+		{"Not a struct", "post", []string{"posts"}},
+	}
+	for _, v := range tests {
+		tags := cache.EntityTags("post", v.entity)
+		if fmt.Sprint(tags) != fmt.Sprint(v.expected) {
+			t.Errorf("In test '%s': expected tags %v, got %v", v.title, v.expected, tags)
+		}
+	}
+}
+
+func TestUserService_UpdateInvalidatesRelatedCache(t *testing.T) {
+	// Create test user and post
+	createdUser, err := helpers.HashPassAndGenerateUserInDb(&db.User{
+		Username: "Tagged",
+		Email:    "tagged@ymail.com",
+		Password: "password",
+		Name:     "Tagged",
+	}, testModule.dbClient, t)
+	if err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+	post := &db.Post{Title: "Cached", Body: "Body", UserID: createdUser.ID}
+	if err := testModule.dbClient.Create(post).Error; err != nil {
+		t.Fatalf("failed to create test post: %v", err)
+	}
+
+	// Cache post
+	if _, err := testModule.posts.serv.FindById(int(post.ID)); err != nil {
+		t.Fatalf("failed to find post: %v", err)
+	}
+	// Change post outside of the service (cached post is now stale)
+	testModule.dbClient.Model(post).Update("title", "Changed")
+
+	// Updating the post's user invalidates the cached post
+	_, err = testModule.users.serv.Update(int(createdUser.ID), &models.UpdateUser{Name: "Renamed"}, time.Time{})
+	if err != nil {
+		t.Fatalf("failed to update user: %v", err)
+	}
+	found, err := testModule.posts.serv.FindById(int(post.ID))
+	if err != nil {
+		t.Fatalf("failed to find post: %v", err)
+	}
+	if found.Title != "Changed" {
+		t.Errorf("expected cached post to be invalidated by user update, got title %q", found.Title)
+	}
+
+	// Clean up
+	testModule.dbClient.Unscoped().Delete(post)
+	testModule.dbClient.Unscoped().Delete(createdUser)
+}
+
+func TestListKey(t *testing.T) {
+	conditions := []models.QueryConditionParameters{
+		{Condition: "title LIKE ?", Value: "%go%"},
+		{Condition: "body  LIKE ?", Value: "%go%"},
+	}
+	key := cache.ListKey("Post", 10, 0, "created_at DESC", conditions)
+
+	var tests = []struct {
+		title      string
+		key        string
+		expectSame bool
+	}{
+		{"Order case and whitespace are ignored", cache.ListKey("post", 10, 0, "created_at  desc", conditions), true},
+		{"Condition order is ignored", cache.ListKey("post", 10, 0, "created_at DESC", []models.QueryConditionParameters{conditions[1], conditions[0]}), true},
+		{"Different page", cache.ListKey("post", 10, 10, "created_at DESC", conditions), false},
+		{"Different condition value", cache.ListKey("post", 10, 0, "created_at DESC", []models.QueryConditionParameters{{Condition: "title LIKE ?", Value: "%rust%"}}), false},
+		{"Different schema", cache.ListKey("user", 10, 0, "created_at DESC", conditions), false},
+	}
+	for _, v := range tests {
+		if (v.key == key) != v.expectSame {
+			t.Errorf("In test '%s': expected same key to be %v (%s, %s)", v.title, v.expectSame, key, v.key)
+		}
+	}
+}
+
+func TestPostService_FindAllCached(t *testing.T) {
+	server, err := helpers.StartRESPServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	redisCache, err := cache.NewRedisCache(cache.RedisSettings{Addr: server.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redisCache.Close()
+
+	// Enable list caching
+	originalCache := app.Cache
+	app.ListCacheTTL = time.Minute
+	defer func() {
+		app.Cache = originalCache
+		app.ListCacheTTL = 0
+	}()
+
+	// Create test user and post
+	createdUser, err := helpers.HashPassAndGenerateUserInDb(&db.User{
+		Username: "Lister",
+		Email:    "lister@ymail.com",
+		Password: "password",
+		Name:     "Lister",
+	}, testModule.dbClient, t)
+	if err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+	defer testModule.dbClient.Unscoped().Delete(createdUser)
+	post := &db.Post{Title: "Listed", Body: "Body", UserID: createdUser.ID}
+	if err := testModule.dbClient.Create(post).Error; err != nil {
+		t.Fatalf("failed to create test post: %v", err)
+	}
+	defer testModule.dbClient.Unscoped().Where("title LIKE ?", "Listed%").Delete(&db.Post{})
+
+	conditions := []models.QueryConditionParameters{{Condition: "title LIKE ?", Value: "Listed%"}}
+	findTitles := func() []string {
+		found, err := testModule.posts.serv.FindAll(10, 0, "id", conditions)
+		if err != nil {
+			t.Fatalf("failed to find posts: %v", err)
+		}
+		var titles []string
+		for _, post := range *found.Data {
+			titles = append(titles, post.Title)
+		}
+		return titles
+	}
+
+	for name, c := range map[string]cache.Cache{"memory": cache.NewCacheMap(100), "redis": redisCache} {
+		app.Cache = c
+		testModule.dbClient.Model(post).Update("title", "Listed")
+		findTitles()
+
+		// Changes outside of the service are served from the cache until invalidated
+		testModule.dbClient.Model(post).Update("title", "Listed (changed)")
+		if titles := findTitles(); fmt.Sprint(titles) != "[Listed]" {
+			t.Errorf("%s: expected cached list, got %v", name, titles)
+		}
+
+		// Creating a post invalidates cached lists
+		created, err := testModule.posts.serv.Create(&schemamodels.CreatePost{Title: "Listed second", Body: "Body"})
+		if err != nil {
+			t.Fatalf("%s: failed to create post: %v", name, err)
+		}
+		if titles := findTitles(); fmt.Sprint(titles) != "[Listed (changed) Listed second]" {
+			t.Errorf("%s: expected list to be reloaded after create, got %v", name, titles)
+		}
+		if err := testModule.posts.serv.Delete(int(created.ID), time.Time{}); err != nil {
+			t.Fatalf("%s: failed to delete post: %v", name, err)
+		}
+
+		// Updating a related user invalidates cached lists containing the user's posts
+		findTitles()
+		testModule.dbClient.Model(post).Update("title", "Listed (user changed)")
+		if _, err := testModule.users.serv.Update(int(createdUser.ID), &models.UpdateUser{Name: "Renamed"}, time.Time{}); err != nil {
+			t.Fatalf("%s: failed to update user: %v", name, err)
+		}
+		if titles := findTitles(); fmt.Sprint(titles) != "[Listed (user changed)]" {
+			t.Errorf("%s: expected list to be reloaded after user update, got %v", name, titles)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"strconv"
 
 	"github.com/dmawardi/Go-Template/internal/auth"
+	"github.com/dmawardi/Go-Template/internal/cache"
 	"github.com/dmawardi/Go-Template/internal/db"
 	"github.com/dmawardi/Go-Template/internal/helpers"
 	webapi "github.com/dmawardi/Go-Template/internal/helpers/webApi"
@@ -117,6 +118,8 @@ func (s *actionService) Create(action *models.CreateAction) (*db.Action, error)
 	if err != nil {
 		return nil, fmt.Errorf("failed creating action: %w", err)
 	}
+	// Remove any cached not found result for the new ID
+	app.Cache.Delete(fmt.Sprintf("action:%d", created.ID))
 
 	return created, nil
 }
@@ -133,24 +136,10 @@ func (s *actionService) FindById(id int) (*db.Action, error) {
 	// Search cache
 	// Define a key with a naming convention
 	cacheKey := fmt.Sprintf("action:%d", id)
-	// Check if action is in cache
-	cachedPost, found := app.Cache.Load(cacheKey)
-	if found {
-		// If found, return cached action
-		return cachedPost.(*db.Action), nil
-	}
-
-	// Find action by id
-	action, err := s.repo.FindById(id)
-	// If error detected
-	if err != nil {
-		return nil, err
-	}
-
-	// Store action in cache
-	app.Cache.Store(cacheKey, action)
-
-	return action, nil
+	// Load action from cache, or from the database if not cached
+	return cache.GetOrLoad(app.Cache, cacheKey, cache.RecordTTL, func() (*db.Action, error) {
+		return s.repo.FindById(id)
+	}, cache.RecordOptions(cache.TagEntity("action"))...)
 }
 // Delete action in database
 func (s *actionService) Delete(id int) error {
@@ -160,9 +149,8 @@ func (s *actionService) Delete(id int) error {
 		fmt.Println("error in deleting action: ", err)
 		return err
 	}
-	// else
-	cacheKey := fmt.Sprintf("action:%d", id)
-	app.Cache.Delete(cacheKey)
+	// else, remove action (and cached records embedding it) from cache
+	app.Cache.InvalidateTag(cache.RecordTag("action", id))
 	return nil
 }
 // Deletes multiple actions in database
@@ -173,10 +161,9 @@ func (s *actionService) BulkDelete(ids []int) error {
 		fmt.Println("error in bulk deleting actions: ", err)
 		return err
 	}
-	// else
+	// else, remove actions (and cached records embedding them) from cache
 	for _, id := range ids {
-		cacheKey := fmt.Sprintf("action:%d", id)
-		app.Cache.Delete(cacheKey)
+		app.Cache.InvalidateTag(cache.RecordTag("action", id))
 	}
 	return nil
 }
@@ -199,7 +186,8 @@ func (s *actionService) Update(id int, action *models.UpdateAction) (*db.Action,
 
 	// Store updated action in cache
 	cacheKey := fmt.Sprintf("action:%d", id)
-	app.Cache.Store(cacheKey, updated)
+	app.Cache.InvalidateTag(cache.RecordTag("action", id))
+	cache.Put(app.Cache, cacheKey, updated, cache.RecordTTL, cache.RecordOptions(cache.TagEntity("action"))...)
 
 	return updated, nil
 }
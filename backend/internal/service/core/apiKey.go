@@ -0,0 +1,90 @@
+package coreservices
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/auth"
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers"
+	"github.com/dmawardi/Go-Template/internal/models"
+	"gorm.io/gorm"
+)
+
+// Returned when an API key is created with no scopes or an invalid scope
+var ErrInvalidApiKeyScope = errors.New("invalid API key scope")
+
+// Returned when an API key is created with an expiry in the past
+var ErrInvalidApiKeyExpiry = errors.New("API key expiry must be in the future")
+
+// Returned when an API key creates a key with scopes it doesn't have
+var ErrApiKeyScopeNotAllowed = errors.New("API key scopes must be within the scopes of the key creating it")
+
+// Returned when logging out with an API key (API keys are revoked instead)
+var ErrApiKeyLogout = errors.New("API keys can't log out, revoke the key instead")
+
+// Returned when revoking an API key the user doesn't have (or that's already revoked)
+var ErrApiKeyNotFound = errors.New("API key not found")
+
+// Creates an API key for a user, returning the key (only shown once)
+// callerScopes are the scopes of the API key creating the key (nil when created by a logged in user)
+func (s *userService) CreateApiKey(userID int, create *models.CreateApiKey, callerScopes []string) (*models.CreatedApiKey, error) {
+	if len(create.Scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidApiKeyScope)
+	}
+	for _, scope := range create.Scopes {
+		if err := auth.ValidateApiKeyScope(scope); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidApiKeyScope, err)
+		}
+		// Keys created with a key can't have wider scopes (eg. *:/api/posts/* from read:/api/posts/*)
+		if callerScopes != nil {
+			action, path, _ := strings.Cut(scope, ":")
+			if !auth.ScopesAllow(callerScopes, path, action) {
+				return nil, fmt.Errorf("%w: %s", ErrApiKeyScopeNotAllowed, scope)
+			}
+		}
+	}
+	if create.ExpiresAt != nil && !create.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidApiKeyExpiry
+	}
+
+	key, record, err := helpers.GenerateApiKey(uint(userID), create.Name, create.Scopes, create.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	err = s.repo.CreateApiKey(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store API key: %w", err)
+	}
+	return &models.CreatedApiKey{Key: key, ApiKey: record}, nil
+}
+
+// Finds a user's API keys (excluding revoked keys)
+func (s *userService) FindApiKeys(userID int) ([]db.ApiKey, error) {
+	return s.repo.FindApiKeys(uint(userID))
+}
+
+// Revokes one of a user's API keys (rejected from the next request)
+func (s *userService) RevokeApiKey(userID int, keyID int) error {
+	err := s.repo.RevokeApiKey(uint(userID), uint(keyID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrApiKeyNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	auth.ForgetApiKey(uint(keyID))
+	return nil
+}
+
+// Revokes all of a user's API keys (eg. after their password changes)
+func (s *userService) revokeUserApiKeys(userID uint) error {
+	err := s.repo.RevokeUserApiKeys(userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API keys: %w", err)
+	}
+	auth.ForgetUserApiKeys(userID)
+	return nil
+}
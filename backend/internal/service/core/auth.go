@@ -3,8 +3,10 @@ package coreservices
 import (
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/dmawardi/Go-Template/internal/auth"
 	adminpanel "github.com/dmawardi/Go-Template/internal/helpers/adminPanel"
 	"github.com/dmawardi/Go-Template/internal/models"
 	corerepositories "github.com/dmawardi/Go-Template/internal/repository/core"
@@ -120,16 +122,45 @@ func (s *authPolicyService) FindRoleByUserId(userId int) (string, error) {
 	return s.repo.FindRoleByUserId(fmt.Sprint(userId))
 }
 func (s *authPolicyService) CreateRole(userId, roleToApply string) (*bool, error) {
-	return s.repo.CreateRole(userId, roleToApply)
+	success, err := s.repo.CreateRole(userId, roleToApply)
+	if err != nil {
+		return nil, err
+	}
+	// The user is given the new role, so reject tokens issued with the previous role
+	if *success {
+		err = invalidateUserTokens(userId)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return success, nil
 }
 func (s *authPolicyService) AssignUserRole(userId, roleToApply string) (*bool, error) {
+	// Compare with current role (no role if not found)
+	currentRole, _ := s.repo.FindRoleByUserId(userId)
 	success, err := s.repo.AssignUserRole(userId, roleToApply)
 	if err != nil {
 		return nil, err
 	}
+	// Reject tokens issued with the previous role
+	if *success && currentRole != roleToApply {
+		err = invalidateUserTokens(userId)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return success, nil
 }
 
+// Rejects the user's tokens issued before now (user ID as used in policies)
+func invalidateUserTokens(userId string) error {
+	id, err := strconv.Atoi(userId)
+	if err != nil {
+		return err
+	}
+	return auth.InvalidateUserTokens(uint(id))
+}
+
 // Inheritance
 //
 
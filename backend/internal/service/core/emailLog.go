@@ -0,0 +1,92 @@
+package coreservices
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/models"
+	corerepositories "github.com/dmawardi/Go-Template/internal/repository/core"
+)
+
+type EmailLogService interface {
+	// Find a list of email logs matching the filter (eg. the delivery history of a user)
+	FindAll(limit int, offset int, order string, filter models.EmailLogFilter) (*models.BasicPaginatedResponse[db.EmailLog], error)
+	FindById(int) (*db.EmailLog, error)
+	// Permanently deletes email logs
+	BulkDelete([]int) error
+}
+
+type emailLogService struct {
+	repo corerepositories.EmailLogRepository
+}
+
+// Builds a new email log service with injected repository
+func NewEmailLogService(repo corerepositories.EmailLogRepository) EmailLogService {
+	return &emailLogService{repo: repo}
+}
+
+// Find a list of email logs in the database
+func (s *emailLogService) FindAll(limit int, offset int, order string, filter models.EmailLogFilter) (*models.BasicPaginatedResponse[db.EmailLog], error) {
+	emailLogs, err := s.repo.FindAll(limit, offset, order, emailLogConditions(filter))
+	if err != nil {
+		return nil, err
+	}
+	return emailLogs, nil
+}
+
+// Find email log in database by ID
+func (s *emailLogService) FindById(id int) (*db.EmailLog, error) {
+	// Find email log by id
+	emailLog, err := s.repo.FindById(id)
+	// If error detected
+	if err != nil {
+		return nil, err
+	}
+	return emailLog, nil
+}
+
+// Permanently deletes email logs by ID
+func (s *emailLogService) BulkDelete(ids []int) error {
+	err := s.repo.BulkDelete(ids)
+	if err != nil {
+		return fmt.Errorf("failed deleting email logs: %w", err)
+	}
+	return nil
+}
+
+// Builds the query conditions for a filter.
+// Combined as a single condition so that each filter narrows the results (rather than being OR'd)
+func emailLogConditions(filter models.EmailLogFilter) []models.QueryConditionParameters {
+	var clauses []string
+	values := map[string]interface{}{}
+
+	// Filters
+	if filter.UserID != 0 {
+		clauses = append(clauses, "user_id = @user_id")
+		values["user_id"] = filter.UserID
+	}
+	if filter.Recipient != "" {
+		clauses = append(clauses, "LOWER(recipient) = @recipient")
+		values["recipient"] = strings.ToLower(filter.Recipient)
+	}
+	if filter.Status != "" {
+		clauses = append(clauses, "status = @status")
+		values["status"] = filter.Status
+	}
+	if filter.Template != "" {
+		clauses = append(clauses, "template = @template")
+		values["template"] = filter.Template
+	}
+	// Search (matches recipient, subject, template or response)
+	if filter.Search != "" {
+		clauses = append(clauses, "(LOWER(recipient) LIKE @search OR LOWER(subject) LIKE @search OR LOWER(template) LIKE @search OR LOWER(response) LIKE @search)")
+		values["search"] = "%" + strings.ToLower(filter.Search) + "%"
+	}
+
+	// If no conditions, return empty
+	if len(clauses) == 0 {
+		return []models.QueryConditionParameters{}
+	}
+	return []models.QueryConditionParameters{{Condition: strings.Join(clauses, " AND "), Value: values}}
+}
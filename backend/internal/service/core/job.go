@@ -0,0 +1,78 @@
+package coreservices
+
+import (
+	"fmt"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/models"
+	"github.com/dmawardi/Go-Template/internal/queue"
+	corerepositories "github.com/dmawardi/Go-Template/internal/repository/core"
+)
+
+type JobService interface {
+	FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[db.Job], error)
+	FindById(int) (*db.Job, error)
+	// Moves a dead, failed or cancelled job back into the queue with a fresh set of attempts
+	Requeue(int) (*db.Job, error)
+	// Stops a pending job from being run
+	Cancel(int) (*db.Job, error)
+	// Permanently deletes jobs (used to purge old or unwanted jobs)
+	BulkDelete([]int) error
+}
+
+type jobService struct {
+	repo  corerepositories.JobRepository
+	queue *queue.Queue
+}
+
+// Builds a new job service with injected repository and job queue
+func NewJobService(repo corerepositories.JobRepository, jobQueue *queue.Queue) JobService {
+	return &jobService{repo: repo, queue: jobQueue}
+}
+
+// Find a list of jobs in the database
+func (s *jobService) FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[db.Job], error) {
+	jobs, err := s.repo.FindAll(limit, offset, order, conditions)
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// Find job in database by ID
+func (s *jobService) FindById(id int) (*db.Job, error) {
+	// Find job by id
+	job, err := s.repo.FindById(id)
+	// If error detected
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Moves a dead, failed or cancelled job back into the queue
+func (s *jobService) Requeue(id int) (*db.Job, error) {
+	requeued, err := s.queue.RequeueJob(uint(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed re-queueing job: %w", err)
+	}
+	return requeued, nil
+}
+
+// Stops a pending job from being run
+func (s *jobService) Cancel(id int) (*db.Job, error) {
+	cancelled, err := s.queue.CancelJob(uint(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed cancelling job: %w", err)
+	}
+	return cancelled, nil
+}
+
+// Permanently deletes jobs by ID
+func (s *jobService) BulkDelete(ids []int) error {
+	err := s.repo.BulkDelete(ids)
+	if err != nil {
+		return fmt.Errorf("failed purging jobs: %w", err)
+	}
+	return nil
+}
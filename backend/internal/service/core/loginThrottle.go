@@ -0,0 +1,248 @@
+package coreservices
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/models"
+	"github.com/dmawardi/Go-Template/internal/queue"
+)
+
+// Defaults for login throttling (see loginThrottleSettingsFromEnv)
+const (
+	defaultLoginMaxAttempts      = 5
+	defaultLoginMaxAttemptsPerIP = 50
+	defaultLoginLockoutDuration  = 15 * time.Minute
+)
+
+// Failed logins after this many are delayed, starting at a second and doubling each time (up to maxLoginDelay)
+const loginDelayAfter = 2
+const maxLoginDelay = time.Minute
+
+// Returned when logins for an account or IP address are delayed or locked after failed attempts
+var ErrLoginThrottled = errors.New("too many failed login attempts")
+
+// Returned (wrapping ErrLoginThrottled) with the time until another login can be attempted
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrLoginThrottled, e.RetryAfter)
+}
+func (e *LoginThrottledError) Unwrap() error {
+	return ErrLoginThrottled
+}
+
+// Limits on failed logins
+type loginThrottleSettings struct {
+	// Failed attempts before an account (email) is locked
+	MaxAttempts int
+	// Failed attempts before an IP address is locked
+	MaxAttemptsPerIP int
+	// How long accounts and IP addresses are locked. Failed attempts older than this are forgotten
+	LockoutDuration time.Duration
+}
+
+// Builds login throttle settings from the LOGIN_MAX_ATTEMPTS, LOGIN_MAX_ATTEMPTS_PER_IP and LOGIN_LOCKOUT_DURATION (eg. "15m")
+// environment variables. Defaults are used for missing or invalid values.
+func loginThrottleSettingsFromEnv() loginThrottleSettings {
+	settings := loginThrottleSettings{
+		MaxAttempts:      defaultLoginMaxAttempts,
+		MaxAttemptsPerIP: defaultLoginMaxAttemptsPerIP,
+		LockoutDuration:  defaultLoginLockoutDuration,
+	}
+	if attempts, err := strconv.Atoi(os.Getenv("LOGIN_MAX_ATTEMPTS")); err == nil && attempts > 0 {
+		settings.MaxAttempts = attempts
+	}
+	if attempts, err := strconv.Atoi(os.Getenv("LOGIN_MAX_ATTEMPTS_PER_IP")); err == nil && attempts > 0 {
+		settings.MaxAttemptsPerIP = attempts
+	}
+	if lockout, err := time.ParseDuration(os.Getenv("LOGIN_LOCKOUT_DURATION")); err == nil && lockout > 0 {
+		settings.LockoutDuration = lockout
+	}
+	return settings
+}
+
+// Returns a LoginThrottledError if the login's account or IP address is locked, or must wait after failed attempts
+func (s *userService) checkLoginThrottle(login *models.Login) error {
+	return s.checkThrottle(loginThrottleKeys(login)...)
+}
+
+// Returns a LoginThrottledError if any of the throttle keys are locked, or must wait after failed attempts
+func (s *userService) checkThrottle(keys ...string) error {
+	throttles, err := s.repo.FindLoginThrottles(keys...)
+	if err != nil {
+		return fmt.Errorf("failed to check login throttle: %w", err)
+	}
+
+	// Wait for the longest delay or lock
+	now := time.Now()
+	var retryAfter time.Duration
+	for _, throttle := range throttles {
+		if wait := loginWait(throttle, now); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+	if retryAfter > 0 {
+		// Rounded up to whole seconds (for Retry-After headers)
+		return &LoginThrottledError{RetryAfter: retryAfter.Truncate(time.Second) + time.Second}
+	}
+	return nil
+}
+
+// Counts a failed login against its account and IP address, locking them once they reach their limits
+// user is the account's user (nil for unknown emails), emailed when their account is locked
+func (s *userService) recordLoginFailure(login *models.Login, user *models.UserWithRole) {
+	settings := loginThrottleSettingsFromEnv()
+	now := time.Now()
+	limits := map[string]int{accountThrottleKey(login.Email): settings.MaxAttempts}
+	if login.IPAddress != "" {
+		limits[ipThrottleKey(login.IPAddress)] = settings.MaxAttemptsPerIP
+	}
+
+	for key, maxAttempts := range limits {
+		throttle, err := s.repo.RecordLoginFailure(key, now.Add(-settings.LockoutDuration))
+		if err != nil {
+			fmt.Println("error in recording failed login: ", err)
+			continue
+		}
+		if throttle.Failures < maxAttempts {
+			continue
+		}
+
+		fmt.Printf("Too many failed logins for %s. Locking for %s\n", key, settings.LockoutDuration)
+		err = s.repo.LockLogin(key, now.Add(settings.LockoutDuration))
+		if err != nil {
+			fmt.Println("error in locking login: ", err)
+			continue
+		}
+		// Let the user know (in case it wasn't them)
+		if user != nil && key == accountThrottleKey(login.Email) {
+			err = s.sendAccountLockedEmail(user, settings.LockoutDuration)
+			if err != nil {
+				fmt.Println("error in sending account locked email: ", err)
+			}
+		}
+	}
+}
+
+// Resets the failed attempts of a throttle key (eg. an account once it's logged in)
+func (s *userService) clearThrottle(key string) {
+	err := s.repo.ClearLoginThrottle(key)
+	if err != nil {
+		fmt.Println("error in clearing failed logins: ", err)
+	}
+}
+
+// Finds the failed logins of a user's account (nil if there are none)
+func (s *userService) FindLoginThrottle(id int) (*db.LoginThrottle, error) {
+	user, err := s.FindById(id)
+	if err != nil {
+		return nil, err
+	}
+	throttles, err := s.repo.FindLoginThrottles(accountThrottleKey(user.Email))
+	if err != nil || len(throttles) == 0 {
+		return nil, err
+	}
+	return &throttles[0], nil
+}
+
+// Unlocks a user's account, clearing its failed logins
+func (s *userService) UnlockUser(id int) error {
+	user, err := s.FindById(id)
+	if err != nil {
+		return err
+	}
+	err = s.repo.ClearLoginThrottle(accountThrottleKey(user.Email))
+	if err != nil {
+		return fmt.Errorf("failed to unlock user: %w", err)
+	}
+	return nil
+}
+
+// Emails a user when their account is locked after failed logins
+func (s *userService) sendAccountLockedEmail(user *models.UserWithRole, lockout time.Duration) error {
+	// Build data for template
+	data := struct {
+		Name string
+		// Minutes until the account is unlocked
+		LockedFor int
+	}{
+		Name:      user.Name,
+		LockedFor: int(lockout.Minutes()),
+	}
+
+	// Build email from template in the user's language
+	rendered, err := app.EmailTemplates.Render("account-locked", user.Locale, data)
+	if err != nil {
+		return err
+	}
+
+	// Create payload containing details for email job
+	payload := queue.EmailJobPayload{
+		Recipient: user.Email,
+		Subject:   rendered.Subject,
+		Body:      rendered.HTML,
+		Template:  "account-locked",
+		UserID:    user.ID,
+	}
+	// Marshal payload
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	// Add job to queue (only one email per lockout)
+	err = s.queue.AddJob(queue.EmailJobType, string(payloadBytes), queue.Priority(queue.PriorityHigh), queue.Unique(fmt.Sprintf("account-locked:%d", user.ID), lockout))
+	if err != nil && !errors.Is(err, queue.ErrDuplicateJob) {
+		return errors.New("error adding job to queue")
+	}
+	return nil
+}
+
+// Returns how long a throttle's key must wait before another login (zero if it can log in)
+func loginWait(throttle db.LoginThrottle, now time.Time) time.Duration {
+	// Locked
+	if throttle.LockedUntil != nil && throttle.LockedUntil.After(now) {
+		return throttle.LockedUntil.Sub(now)
+	}
+	// Delayed after recent failures
+	if next := throttle.LastFailureAt.Add(loginDelay(throttle.Failures)); next.After(now) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+// Returns the delay before another login after a number of failed attempts
+func loginDelay(failures int) time.Duration {
+	doublings := failures - loginDelayAfter - 1
+	if doublings < 0 {
+		return 0
+	}
+	// A minute is reached after 6 doublings
+	if doublings >= 6 {
+		return maxLoginDelay
+	}
+	return time.Second << doublings
+}
+
+// Throttle keys of a login (the account's email and the IP address, if known)
+func loginThrottleKeys(login *models.Login) []string {
+	keys := []string{accountThrottleKey(login.Email)}
+	if login.IPAddress != "" {
+		keys = append(keys, ipThrottleKey(login.IPAddress))
+	}
+	return keys
+}
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
@@ -0,0 +1,180 @@
+package coreservices
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/auth"
+	"github.com/dmawardi/Go-Template/internal/cache"
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers/utility"
+	"github.com/dmawardi/Go-Template/internal/models"
+	"gorm.io/gorm"
+)
+
+// Session types
+const (
+	// Logins with access and refresh tokens (API)
+	sessionTypeApi = "api"
+	// Cookie sessions (Admin Panel)
+	sessionTypeAdmin = "admin"
+)
+
+// Reasons recorded for failed logins
+const (
+	loginFailureInvalidCredentials   = "invalid credentials"
+	loginFailureThrottled            = "too many attempts"
+	loginFailureInvalidTwoFactorCode = "invalid two factor code"
+)
+
+// Number of login attempts shown in a user's login history
+const loginHistoryLimit = 50
+
+// Returned when a session is unknown, revoked, expired or belongs to another user
+var ErrSessionNotFound = errors.New("session not found")
+
+// Returned when revoking other sessions with a token that isn't part of a session (eg. an API key)
+var ErrNoCurrentSession = errors.New("other sessions can only be revoked from a login session")
+
+// Finds a user's active sessions, marking the session with currentTokenID (if set) as current
+func (s *userService) FindSessions(userID int, currentTokenID string) ([]models.UserSession, error) {
+	sessions, err := s.repo.FindSessions(uint(userID))
+	if err != nil {
+		return nil, err
+	}
+	userSessions := make([]models.UserSession, 0, len(sessions))
+	for _, session := range sessions {
+		userSessions = append(userSessions, models.UserSession{Session: session, Current: currentTokenID != "" && session.TokenID == currentTokenID})
+	}
+	return userSessions, nil
+}
+
+// Revokes one of a user's sessions. Its tokens are rejected from the next request
+func (s *userService) RevokeSession(userID int, id int) error {
+	session, err := s.repo.FindSession(uint(userID), uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return s.endSession(session.TokenID)
+}
+
+// Revokes all of a user's sessions except the session with currentTokenID
+func (s *userService) RevokeOtherSessions(userID int, currentTokenID string) error {
+	// Without a current session (eg. API keys) every session would be revoked
+	if currentTokenID == "" {
+		return ErrNoCurrentSession
+	}
+	return s.revokeUserSessions(uint(userID), currentTokenID)
+}
+
+// Finds a user's most recent login attempts
+func (s *userService) FindLoginEvents(userID int) ([]db.LoginEvent, error) {
+	return s.repo.FindLoginEvents(uint(userID), loginHistoryLimit)
+}
+
+// Starts a session for a user, returning it with a new token ID
+func (s *userService) startSession(userID uint, sessionType string, twoFactor bool, ipAddress, userAgent string) (*db.Session, error) {
+	tokenID, err := utility.GenerateRandomString(24)
+	if err != nil {
+		return nil, err
+	}
+	ttl := auth.SessionTokenTTL
+	if sessionType == sessionTypeApi {
+		ttl = auth.RefreshTokenTTL()
+	}
+	now := time.Now()
+	session := &db.Session{
+		UserID:       userID,
+		TokenID:      tokenID,
+		Type:         sessionType,
+		IPAddress:    ipAddress,
+		UserAgent:    userAgent,
+		TwoFactor:    twoFactor,
+		LastActiveAt: now,
+		ExpiresAt:    now.Add(ttl),
+	}
+	err = s.repo.CreateSession(session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store session: %w", err)
+	}
+	return session, nil
+}
+
+// Starts a session for a user who logged in, recording the login
+func (s *userService) startLoginSession(user *models.UserWithRole, sessionType string, twoFactor bool, ipAddress, userAgent string) (*db.Session, error) {
+	session, err := s.startSession(user.ID, sessionType, twoFactor, ipAddress, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	s.recordLoginEvent(&db.LoginEvent{
+		UserID:    &user.ID,
+		Email:     user.Email,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		Success:   true,
+		TokenID:   session.TokenID,
+	})
+	return session, nil
+}
+
+// Returns a token for a new cookie session (Admin Panel)
+func (s *userService) issueSessionToken(user *models.UserWithRole, twoFactor bool, ipAddress, userAgent string) (string, error) {
+	session, err := s.startLoginSession(user, sessionTypeAdmin, twoFactor, ipAddress, userAgent)
+	if err != nil {
+		return "", err
+	}
+	tokenString, err := auth.GenerateJWTWithTTL(int(user.ID), user.Email, user.Role, auth.SessionTokenTTL, sessionTokenOptions(session.TokenID, twoFactor)...)
+	if err != nil {
+		return "", fmt.Errorf("failed to create JWT: %w", err)
+	}
+	return tokenString, nil
+}
+
+// Revokes a session and its refresh tokens
+func (s *userService) endSession(tokenID string) error {
+	err := s.repo.RevokeSession(tokenID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	auth.ForgetSession(tokenID)
+	return nil
+}
+
+// Revokes all of a user's sessions (except the session with exceptTokenID, if set)
+func (s *userService) revokeUserSessions(userID uint, exceptTokenID string) error {
+	err := s.repo.RevokeUserSessions(userID, exceptTokenID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	// Cached sessions are tagged with their user
+	app.Cache.InvalidateTag(cache.RecordTag("user", userID))
+	return nil
+}
+
+// Records a failed login (userID isn't set for unknown emails)
+func (s *userService) recordFailedLogin(login *models.Login, userID *uint, reason string) {
+	s.recordLoginEvent(&db.LoginEvent{
+		UserID:    userID,
+		Email:     login.Email,
+		IPAddress: login.IPAddress,
+		UserAgent: login.UserAgent,
+		Reason:    reason,
+	})
+}
+
+// Adds a login attempt to the login history (errors are logged, so they don't affect the login)
+func (s *userService) recordLoginEvent(event *db.LoginEvent) {
+	err := s.repo.CreateLoginEvent(event)
+	if err != nil {
+		fmt.Println("error in recording login event: ", err)
+	}
+}
+
+// Token options for tokens issued in a session
+func sessionTokenOptions(tokenID string, twoFactor bool) []auth.TokenOption {
+	return append(twoFactorTokenOptions(twoFactor), auth.WithSession(tokenID))
+}
@@ -0,0 +1,328 @@
+package coreservices
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/auth"
+	"github.com/dmawardi/Go-Template/internal/cache"
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers"
+	"github.com/dmawardi/Go-Template/internal/models"
+	corerepositories "github.com/dmawardi/Go-Template/internal/repository/core"
+)
+
+// Number of recovery codes generated when two factor authentication is enabled
+const recoveryCodeCount = 10
+
+// Two factor tokens are revoked after this many invalid codes (the user must log in again)
+const maxTwoFactorAttempts = 5
+
+// Shown in authenticator apps if TWO_FACTOR_ISSUER isn't set
+const defaultTwoFactorIssuer = "Go Template"
+
+// Returned when a two factor code (or recovery code) is invalid, or the two factor token is invalid or expired
+var ErrInvalidTwoFactorCode = errors.New("invalid two factor code")
+
+// Returned when enrolling or confirming while two factor authentication is already enabled
+var ErrTwoFactorAlreadyEnabled = errors.New("two factor authentication already enabled")
+
+// Returned when confirming before enrolling
+var ErrTwoFactorNotEnrolled = errors.New("two factor authentication not set up")
+
+// Returned when disabling two factor authentication for a user without it
+var ErrTwoFactorNotEnabled = errors.New("two factor authentication not enabled")
+
+// Completes a login with a code, returning an access token and refresh token (with the two factor claim)
+func (s *userService) VerifyTwoFactorLogin(login *models.TwoFactorLogin) (*models.LoginResponse, error) {
+	user, err := s.completeTwoFactorLogin(login)
+	if err != nil {
+		return nil, err
+	}
+	return s.issueLoginTokens(user, true, login.IPAddress, login.UserAgent)
+}
+
+// Completes a login with a code, returning a session token (with the two factor claim)
+func (s *userService) VerifyTwoFactorSession(login *models.TwoFactorLogin) (string, error) {
+	user, err := s.completeTwoFactorLogin(login)
+	if err != nil {
+		return "", err
+	}
+	return s.issueSessionToken(user, true, login.IPAddress, login.UserAgent)
+}
+
+// Returns a secret to add to the user's authenticator app
+// The secret is reused until it's confirmed, so pages showing it can be reloaded
+func (s *userService) EnrollTwoFactor(id int) (*models.TwoFactorEnrollment, error) {
+	user, err := s.repo.FindById(id)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret := user.TwoFactorSecret
+	if secret == "" {
+		secret, err = helpers.GenerateTOTPSecret()
+		if err != nil {
+			return nil, err
+		}
+		err = s.repo.SetTwoFactorSecret(user.ID, secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store two factor secret: %w", err)
+		}
+	}
+
+	return &models.TwoFactorEnrollment{
+		Secret: secret,
+		URI:    helpers.TOTPURI(twoFactorIssuer(), user.Email, secret),
+	}, nil
+}
+
+// Enables two factor authentication with a code from the enrolled secret, returning recovery codes
+func (s *userService) ConfirmTwoFactor(id int, code string) (*models.TwoFactorRecoveryCodes, error) {
+	user, err := s.repo.FindById(id)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if user.TwoFactorSecret == "" {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+
+	err = s.checkThrottle(userTwoFactorThrottleKey(user.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the authenticator app was set up
+	step, ok := helpers.ValidateTOTP(user.TwoFactorSecret, code, time.Now())
+	if !ok {
+		s.recordFailedTwoFactorCode(user.ID)
+		return nil, ErrInvalidTwoFactorCode
+	}
+	// The code can't be used again to log in
+	err = s.repo.UseTwoFactorStep(user.ID, step)
+	if errors.Is(err, corerepositories.ErrTwoFactorCodeUsed) {
+		s.recordFailedTwoFactorCode(user.ID)
+		return nil, ErrInvalidTwoFactorCode
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.clearThrottle(userTwoFactorThrottleKey(user.ID))
+
+	codes, hashes, err := helpers.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	err = s.repo.EnableTwoFactor(user.ID, hashes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enable two factor authentication: %w", err)
+	}
+	app.Cache.InvalidateTag(cache.RecordTag("user", user.ID))
+
+	return &models.TwoFactorRecoveryCodes{RecoveryCodes: codes}, nil
+}
+
+// Disables two factor authentication (requires a code or recovery code)
+// Users with a role that requires two factor authentication are logged out of all sessions
+func (s *userService) DisableTwoFactor(id int, code string) error {
+	user, err := s.FindById(id)
+	if err != nil {
+		return err
+	}
+	if !user.TwoFactorEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+	err = s.checkThrottle(userTwoFactorThrottleKey(user.ID))
+	if err != nil {
+		return err
+	}
+	err = s.verifyTwoFactorCode(user.ID, code)
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		s.recordFailedTwoFactorCode(user.ID)
+	}
+	if err != nil {
+		return err
+	}
+	s.clearThrottle(userTwoFactorThrottleKey(user.ID))
+
+	err = s.repo.DisableTwoFactor(user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to disable two factor authentication: %w", err)
+	}
+	app.Cache.InvalidateTag(cache.RecordTag("user", user.ID))
+
+	// Tokens with the two factor claim would otherwise keep access to the admin panel
+	if auth.TwoFactorRequired(user.Role) {
+		err = s.revokeUserSessions(user.ID, "")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Checks the code of a two factor login, returning the user once complete (the two factor token can't be used again)
+func (s *userService) completeTwoFactorLogin(login *models.TwoFactorLogin) (*models.UserWithRole, error) {
+	claims, err := auth.ParseTwoFactorPendingToken(login.TwoFactorToken)
+	if err != nil {
+		return nil, ErrInvalidTwoFactorCode
+	}
+	userID, err := strconv.Atoi(claims.UserID)
+	if err != nil {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	failedUserID := uint(userID)
+
+	// Invalid codes count against the account and IP address, like wrong passwords
+	throttleLogin := &models.Login{Email: claims.Email, IPAddress: login.IPAddress}
+	err = s.checkLoginThrottle(throttleLogin)
+	if err != nil {
+		s.recordLoginEvent(&db.LoginEvent{
+			UserID:    &failedUserID,
+			Email:     claims.Email,
+			IPAddress: login.IPAddress,
+			UserAgent: login.UserAgent,
+			Reason:    loginFailureThrottled,
+		})
+		return nil, err
+	}
+
+	err = s.verifyTwoFactorCode(uint(userID), login.Code)
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		s.recordFailedTwoFactorAttempt(claims, throttleLogin, userID)
+		s.recordLoginEvent(&db.LoginEvent{
+			UserID:    &failedUserID,
+			Email:     claims.Email,
+			IPAddress: login.IPAddress,
+			UserAgent: login.UserAgent,
+			Reason:    loginFailureInvalidTwoFactorCode,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = auth.RevokeToken(claims)
+	if err != nil {
+		return nil, err
+	}
+	// Reset the account's failed attempts
+	s.clearThrottle(accountThrottleKey(claims.Email))
+
+	// Find user (with current role)
+	return s.FindById(userID)
+}
+
+// Checks a code from the user's authenticator app or one of their recovery codes (which is then used up)
+func (s *userService) verifyTwoFactorCode(userID uint, code string) error {
+	user, err := s.repo.FindById(int(userID))
+	if err != nil || !user.TwoFactorEnabled {
+		return ErrInvalidTwoFactorCode
+	}
+
+	// Authenticator app code (each code can only be used once)
+	if step, ok := helpers.ValidateTOTP(user.TwoFactorSecret, code, time.Now()); ok {
+		err = s.repo.UseTwoFactorStep(user.ID, step)
+		if errors.Is(err, corerepositories.ErrTwoFactorCodeUsed) {
+			return ErrInvalidTwoFactorCode
+		}
+		return err
+	}
+	// Recovery code
+	err = s.repo.UseRecoveryCode(user.ID, helpers.HashRecoveryCode(code))
+	if errors.Is(err, corerepositories.ErrRecoveryCodeUsed) {
+		return ErrInvalidTwoFactorCode
+	}
+	return err
+}
+
+// Counts an invalid code against the login throttle and the two factor token, revoking the token once the limit is reached
+func (s *userService) recordFailedTwoFactorAttempt(claims *auth.AuthToken, login *models.Login, userID int) {
+	// The user is emailed if their account is locked
+	user, _ := s.FindById(userID)
+	s.recordLoginFailure(login, user)
+
+	// Counted in a single statement (safe for concurrent attempts)
+	throttle, err := s.repo.RecordLoginFailure(twoFactorThrottleKey(claims.ID), time.Now().Add(-auth.TwoFactorPendingTokenTTL))
+	if err != nil {
+		fmt.Println("error in recording invalid two factor code: ", err)
+		return
+	}
+	if throttle.Failures >= maxTwoFactorAttempts {
+		fmt.Printf("Too many invalid two factor codes for user %s. Revoking two factor token\n", claims.UserID)
+		err := auth.RevokeToken(claims)
+		if err != nil {
+			fmt.Println("error in revoking two factor token: ", err)
+		}
+	}
+}
+
+// Counts an invalid code sent by a logged in user (to enable or disable two factor authentication), locking
+// further codes once the limit is reached
+func (s *userService) recordFailedTwoFactorCode(userID uint) {
+	settings := loginThrottleSettingsFromEnv()
+	now := time.Now()
+	key := userTwoFactorThrottleKey(userID)
+	throttle, err := s.repo.RecordLoginFailure(key, now.Add(-settings.LockoutDuration))
+	if err != nil {
+		fmt.Println("error in recording invalid two factor code: ", err)
+		return
+	}
+	if throttle.Failures < maxTwoFactorAttempts {
+		return
+	}
+
+	fmt.Printf("Too many invalid two factor codes for user %d. Locking for %s\n", userID, settings.LockoutDuration)
+	err = s.repo.LockLogin(key, now.Add(settings.LockoutDuration))
+	if err != nil {
+		fmt.Println("error in locking two factor codes: ", err)
+	}
+}
+
+// Throttle key counting the invalid codes of a two factor token (by its ID)
+func twoFactorThrottleKey(tokenID string) string {
+	return "two-factor:" + tokenID
+}
+
+// Throttle key counting the invalid codes sent by a logged in user
+func userTwoFactorThrottleKey(userID uint) string {
+	return twoFactorThrottleKey(fmt.Sprintf("user:%d", userID))
+}
+
+// Builds a login response with a two factor token (used to complete the login with a code)
+func buildTwoFactorPendingResponse(user *models.UserWithRole) (*models.LoginResponse, error) {
+	tokenString, err := auth.GenerateTwoFactorPendingToken(int(user.ID), user.Email, user.Role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWT: %w", err)
+	}
+	return &models.LoginResponse{
+		TwoFactorRequired: true,
+		TwoFactorToken:    tokenString,
+		ExpiresIn:         int(auth.TwoFactorPendingTokenTTL.Seconds()),
+	}, nil
+}
+
+// Token options for tokens issued after two factor authentication
+func twoFactorTokenOptions(twoFactor bool) []auth.TokenOption {
+	if !twoFactor {
+		return nil
+	}
+	return []auth.TokenOption{auth.WithTwoFactor()}
+}
+
+// Name shown in authenticator apps, read from TWO_FACTOR_ISSUER
+func twoFactorIssuer() string {
+	if issuer := os.Getenv("TWO_FACTOR_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return defaultTwoFactorIssuer
+}
@@ -5,37 +5,101 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
+	"net/url"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/dmawardi/Go-Template/internal/auth"
+	"github.com/dmawardi/Go-Template/internal/cache"
 	"github.com/dmawardi/Go-Template/internal/db"
 	"github.com/dmawardi/Go-Template/internal/helpers"
 	"github.com/dmawardi/Go-Template/internal/helpers/utility"
-	webapi "github.com/dmawardi/Go-Template/internal/helpers/webApi"
 	"github.com/dmawardi/Go-Template/internal/models"
 	"github.com/dmawardi/Go-Template/internal/queue"
 	corerepositories "github.com/dmawardi/Go-Template/internal/repository/core"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// Repeat verification email requests within this window are skipped
+const verificationEmailWindow = 5 * time.Minute
+
+// Password reset links expire after this duration
+const passwordResetTokenTTL = time.Hour
+
+// Returned when a password reset token is unknown, used or expired
+var ErrInvalidPasswordResetToken = errors.New("invalid or expired password reset token")
+
+// Returned when a refresh token is unknown, revoked or expired
+var ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+
+// Returned when logging in with an unknown email or incorrect password (the same error, so it isn't revealed whether an account exists)
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Returned when a refresh token is used more than once (its family is revoked)
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
 type UserService interface {
 	FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[models.UserWithRole], error)
 	FindById(int) (*models.UserWithRole, error)
 	FindByEmail(string) (*models.UserWithRole, error)
 	Create(user *models.CreateUser) (*models.UserWithRole, error)
-	Update(int, *models.UpdateUser) (*models.UserWithRole, error)
-	Delete(int) error
+	Update(int, *models.UpdateUser, time.Time) (*models.UserWithRole, error)
+	Delete(int, time.Time) error
 	BulkDelete([]int) error
 	CheckPasswordMatch(id int, password []byte) bool
 	// Login
-	LoginUser(login *models.Login) (string, error)
-	// Takes an email and if the email is found in the database, will reset the password and send an email to the user with the new password
+	// Returns an access token and refresh token
+	LoginUser(login *models.Login) (*models.LoginResponse, error)
+	// Returns a token for cookie sessions (Admin Panel), which isn't refreshed
+	LoginUserSession(login *models.Login) (*models.LoginResponse, error)
+	// Returns a token for a new session of a user (eg. after their password changes)
+	StartSession(id int, twoFactor bool, ipAddress, userAgent string) (string, error)
+	// Exchanges a refresh token for a new access token and refresh token
+	RefreshAccessToken(refreshToken string) (*models.LoginResponse, error)
+	// Revokes the access token and its session (and the refresh token's session if provided)
+	Logout(token *auth.AuthToken, refreshToken string) error
+	// Sessions
+	// Finds a user's active sessions, marking the session with currentTokenID (if set) as current
+	FindSessions(userID int, currentTokenID string) ([]models.UserSession, error)
+	// Revokes one of a user's sessions
+	RevokeSession(userID int, id int) error
+	// Revokes all of a user's sessions except the session with currentTokenID
+	RevokeOtherSessions(userID int, currentTokenID string) error
+	// Finds a user's most recent login attempts
+	FindLoginEvents(userID int) ([]db.LoginEvent, error)
+	// Takes an email and if the email is found in the database, will send an email to the user with a password reset link
 	ResetPasswordAndSendEmail(email string) error
+	// Sets a new password using the token from a password reset email
+	ConfirmPasswordReset(token string, newPassword string) error
 	// Verifies user email in database
 	VerifyEmailCode(token string) error
 	// Sends verification email for user
 	ResendVerificationEmail(id int) error
+	// Two factor authentication
+	// Completes a login (started with LoginUser) with a code, returning an access token and refresh token
+	VerifyTwoFactorLogin(login *models.TwoFactorLogin) (*models.LoginResponse, error)
+	// Completes a login (started with LoginUserSession) with a code, returning a session token
+	VerifyTwoFactorSession(login *models.TwoFactorLogin) (string, error)
+	// Returns a secret to add to the user's authenticator app (enabled once a code is confirmed)
+	EnrollTwoFactor(id int) (*models.TwoFactorEnrollment, error)
+	// Enables two factor authentication with a code from the enrolled secret, returning recovery codes
+	ConfirmTwoFactor(id int, code string) (*models.TwoFactorRecoveryCodes, error)
+	// Disables two factor authentication (requires a code or recovery code)
+	DisableTwoFactor(id int, code string) error
+	// API keys
+	// Creates an API key for a user, returning the key (only shown once)
+	// callerScopes are the scopes of the API key creating the key (nil when created by a logged in user)
+	CreateApiKey(userID int, create *models.CreateApiKey, callerScopes []string) (*models.CreatedApiKey, error)
+	// Finds a user's API keys (excluding revoked keys)
+	FindApiKeys(userID int) ([]db.ApiKey, error)
+	// Revokes one of a user's API keys
+	RevokeApiKey(userID int, keyID int) error
+	// Login throttling
+	// Finds the failed logins of a user's account (nil if there are none)
+	FindLoginThrottle(id int) (*db.LoginThrottle, error)
+	// Unlocks a user's account, clearing its failed logins
+	UnlockUser(id int) error
 }
 
 type userService struct {
@@ -79,6 +143,7 @@ func (s *userService) Create(user *models.CreateUser) (*models.UserWithRole, err
 		Name:     user.Name,
 		Email:    user.Email,
 		Verified: &user.Verified,
+		Locale:   user.Locale,
 	}
 
 	// Create above user in database
@@ -96,6 +161,9 @@ func (s *userService) Create(user *models.CreateUser) (*models.UserWithRole, err
 		return nil, fmt.Errorf("failed creating user: %w", err)
 	}
 
+	// Remove any cached not found result for the new ID
+	app.Cache.Delete(fmt.Sprintf("user:%d", created.ID))
+
 	// Combine user and role data
 	userToReturn := BuildUserWithRole(created, user.Role)
 
@@ -130,30 +198,18 @@ func (s *userService) FindAll(limit int, offset int, order string, conditions []
 func (s *userService) FindById(userId int) (*models.UserWithRole, error) {
 	// Define a key with a naming convention
 	cacheKey := fmt.Sprintf("user:%d", userId)
-	// Attempt to load the user from the cache first
-	cachedUser, found := app.Cache.Load(cacheKey)
-	if found {
-		// If found and not expired, return the cached user
-		return cachedUser.(*models.UserWithRole), nil
-	}
-	// Find user by id
-	user, err := s.repo.FindById(userId)
-	// If error detected
-	if err != nil {
-		return nil, err
-	}
-
-	// Get user role and attach to user
-	fullUser, err := findRoleAndAttach(user, s.auth)
-	if err != nil {
-		return nil, err
-	}
-
-	// Cache the full user with a TTL before returning
-	// Assuming you have defined a duration for the TTL
-	app.Cache.Store(cacheKey, fullUser)
+	// Load the user from the cache, or from the database (with role attached) if not cached
+	return cache.GetOrLoad(app.Cache, cacheKey, cache.RecordTTL, func() (*models.UserWithRole, error) {
+		// Find user by id
+		user, err := s.repo.FindById(userId)
+		// If error detected
+		if err != nil {
+			return nil, err
+		}
 
-	return fullUser, nil
+		// Get user role and attach to user
+		return findRoleAndAttach(user, s.auth)
+	}, userCacheOptions(userId)...)
 }
 
 // Find user in database by email
@@ -174,8 +230,8 @@ func (s *userService) FindByEmail(email string) (*models.UserWithRole, error) {
 }
 
 // Delete user in database
-func (s *userService) Delete(id int) error {
-	err := s.repo.Delete(id)
+func (s *userService) Delete(id int, version time.Time) error {
+	err := s.repo.Delete(id, version)
 	// If error detected
 	if err != nil {
 		fmt.Println("error in deleting user: ", err)
@@ -193,11 +249,8 @@ func (s *userService) Delete(id int) error {
 		return err
 	}
 
-	// If all successful, delete user from cache
-	// Define a key with a naming convention
-	cacheKey := fmt.Sprintf("user:%d", id)
-	// Delete record in cache
-	app.Cache.Delete(cacheKey)
+	// If all successful, delete user (and cached records embedding the user) from cache
+	app.Cache.InvalidateTag(cache.RecordTag("user", id))
 
 	// else
 	return nil
@@ -213,10 +266,8 @@ func (s *userService) BulkDelete(ids []int) error {
 	}
 	// Iterate through ids and delete all user roles and cache records
 	for _, id := range ids {
-		// Define a key with a naming convention
-		cacheKey := fmt.Sprintf("user:%d", id)
-		// Delete record in cache
-		app.Cache.Delete(cacheKey)
+		// Delete user (and cached records embedding the user) from cache
+		app.Cache.InvalidateTag(cache.RecordTag("user", id))
 
 		// Delete all user roles
 		success, err := s.auth.DeleteRolesForUser(fmt.Sprint(id))
@@ -235,10 +286,11 @@ func (s *userService) BulkDelete(ids []int) error {
 }
 
 // Updates user in database
-func (s *userService) Update(id int, user *models.UpdateUser) (*models.UserWithRole, error) {
+// If version is set (the updated_at last read), the update only applies if the user hasn't changed since (models.ErrRecordModified)
+func (s *userService) Update(id int, user *models.UpdateUser, version time.Time) (*models.UserWithRole, error) {
 
 	// Create db User type from incoming DTO
-	toUpdate := &db.User{Name: user.Name, Username: user.Username, Email: user.Email, Verified: &user.Verified}
+	toUpdate := &db.User{Name: user.Name, Username: user.Username, Email: user.Email, Verified: &user.Verified, Locale: user.Locale}
 
 	// If the user password is not empty
 	if user.Password != "" {
@@ -251,13 +303,17 @@ func (s *userService) Update(id int, user *models.UpdateUser) (*models.UserWithR
 		toUpdate.Password = string(hashedPassword)
 	}
 	// Update using repo
-	updated, err := s.repo.Update(id, toUpdate)
+	updated, err := s.repo.Update(id, toUpdate, version)
 	if err != nil {
 		return nil, err
 	}
 
 	// Assign user role (if role update found)
+	roleChanged := false
 	if user.Role != "" {
+		// Compare with current role (no role if not found)
+		currentRole, _ := s.auth.FindRoleByUserId(fmt.Sprint(id))
+		roleChanged = currentRole != user.Role
 		// Update user role in policy table
 		success, err := s.auth.AssignUserRole(fmt.Sprint(updated.ID), user.Role)
 		if err != nil {
@@ -268,20 +324,41 @@ func (s *userService) Update(id int, user *models.UpdateUser) (*models.UserWithR
 		}
 	}
 
+	// Reject tokens issued before a password or role change
+	if user.Password != "" || roleChanged {
+		err = auth.InvalidateUserTokens(updated.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// A new password also logs out all sessions (refresh tokens can't be used) and revokes API keys
+	if user.Password != "" {
+		err = s.revokeUserSessions(updated.ID, "")
+		if err != nil {
+			fmt.Println("error in revoking sessions: ", err)
+		}
+		err = s.revokeUserApiKeys(updated.ID)
+		if err != nil {
+			fmt.Println("error in revoking API keys: ", err)
+		}
+	}
+
 	// Get user role and attach to user
 	fullUser, err := findRoleAndAttach(updated, s.auth)
 	if err != nil {
 		return nil, err
 	}
 
-	// Cache the full user with a TTL before returning
+	// Remove cached records embedding the user, then cache the full user with a TTL before returning
+	app.Cache.InvalidateTag(cache.RecordTag("user", id))
 	cacheKey := fmt.Sprintf("user:%d", id)
-	app.Cache.Store(cacheKey, fullUser, 10*time.Minute)
+	cache.Put(app.Cache, cacheKey, fullUser, cache.RecordTTL, userCacheOptions(id)...)
 
 	return fullUser, nil
 }
 
-// Takes an email and if the email is found in the database, will reset the password and send an email to the user with the new password
+// Takes an email and if the email is found in the database, will send an email to the user with a password reset link
+// The link contains a single use token (only its hash is stored) that replaces any previously sent token
 func (s *userService) ResetPasswordAndSendEmail(userEmail string) error {
 	// Check if user exists in db
 	foundUser, err := s.repo.FindByEmail(userEmail)
@@ -290,43 +367,52 @@ func (s *userService) ResetPasswordAndSendEmail(userEmail string) error {
 		return err
 	}
 	// Else
-	// Generate random password
-	randomPassword, err := utility.GenerateRandomString(10)
+	// Generate reset token
+	token, resetToken, err := helpers.GeneratePasswordResetToken(foundUser.ID, passwordResetTokenTTL)
 	if err != nil {
 		return err
 	}
-	// Update found user's password
-	s.repo.Update(int(foundUser.ID), &db.User{Password: randomPassword})
 
 	// Build data for template
 	data := struct {
-		Name        string
-		NewPassword string
+		Name     string
+		ResetUrl template.URL
+		// Minutes until the link expires
+		ExpiresIn int
 	}{
-		Name:        foundUser.Name,
-		NewPassword: randomPassword,
+		Name:      foundUser.Name,
+		ResetUrl:  template.URL(passwordResetUrl(token)),
+		ExpiresIn: int(passwordResetTokenTTL.Minutes()),
 	}
 
-	// Build HTML email template from file using injected data
-	emailString, err := webapi.LoadTemplate(webapi.BuildPathFromWorkingDirectory("internal/email/templates/password-reset.tmpl"), data)
+	// Build email from template in the user's language
+	rendered, err := app.EmailTemplates.Render("password-reset", foundUser.Locale, data)
 	if err != nil {
-		fmt.Printf("error in loading template: %v", err)
+		fmt.Printf("error in rendering template: %v", err)
 		return err
 	}
 
+	// Store token (invalidating previously sent tokens)
+	err = s.repo.CreatePasswordResetToken(resetToken)
+	if err != nil {
+		return fmt.Errorf("failed to store password reset token: %w", err)
+	}
+
 	// Create payload containing details for email job
 	payload := queue.EmailJobPayload{
 		Recipient: foundUser.Email,
-		Subject:   "Password Reset Request",
-		Body:      emailString,
+		Subject:   rendered.Subject,
+		Body:      rendered.HTML,
+		Template:  "password-reset",
+		UserID:    foundUser.ID,
 	}
 	// Marshal payload
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
 		return err
 	}
-	// Add job to queue
-	err = s.queue.AddJob("email", string(payloadBytes))
+	// Add job to queue (ahead of bulk emails)
+	err = s.queue.AddJob(queue.EmailJobType, string(payloadBytes), queue.Priority(queue.PriorityHigh))
 	if err != nil {
 		return errors.New("error adding job to queue")
 	}
@@ -335,33 +421,287 @@ func (s *userService) ResetPasswordAndSendEmail(userEmail string) error {
 	return nil
 }
 
-func (s *userService) LoginUser(login *models.Login) (token string, err error) {
-	// Init token string
-	tokenString := ""
+// Sets a new password using the token from a password reset email
+// Returns ErrInvalidPasswordResetToken if the token is unknown, used or expired
+func (s *userService) ConfirmPasswordReset(token string, newPassword string) error {
+	// Find token by hash
+	resetToken, err := s.repo.FindPasswordResetToken(helpers.HashToken(token))
+	if err != nil {
+		return ErrInvalidPasswordResetToken
+	}
+	// Has the token been used or expired?
+	if resetToken.UsedAt != nil || resetToken.ExpiresAt.Before(time.Now()) {
+		return ErrInvalidPasswordResetToken
+	}
+
+	// Build hashed password from new password
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt password: %w", err)
+	}
+
+	// Mark token as used and update password
+	err = s.repo.ResetPasswordWithToken(resetToken, string(hashedPassword))
+	if errors.Is(err, corerepositories.ErrPasswordResetTokenUsed) {
+		return ErrInvalidPasswordResetToken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reset password: %w", err)
+	}
+	app.Cache.InvalidateTag(cache.RecordTag("user", resetToken.UserID))
+
+	// Log out all sessions (rejecting existing access and refresh tokens)
+	err = auth.InvalidateUserTokens(resetToken.UserID)
+	if err != nil {
+		fmt.Println("error in invalidating tokens: ", err)
+	}
+	err = s.revokeUserSessions(resetToken.UserID, "")
+	if err != nil {
+		fmt.Println("error in revoking sessions: ", err)
+	}
+	// API keys could have been created by whoever knew the old password
+	err = s.revokeUserApiKeys(resetToken.UserID)
+	if err != nil {
+		fmt.Println("error in revoking API keys: ", err)
+	}
+	// The new password can be used straight away (if the account was locked)
+	err = s.UnlockUser(int(resetToken.UserID))
+	if err != nil {
+		fmt.Println("error in unlocking user: ", err)
+	}
+
+	// Return no error found
+	return nil
+}
+
+// Builds the link emailed to reset a password
+// Uses PASSWORD_RESET_URL (eg. the frontend's reset page) or defaults to /reset-password on the server
+func passwordResetUrl(token string) string {
+	resetUrl := os.Getenv("PASSWORD_RESET_URL")
+	if resetUrl == "" {
+		// SERVER_PORT prefixed with :
+		resetUrl = fmt.Sprintf("http://%s%s/reset-password", os.Getenv("SERVER_BASE_URL"), os.Getenv("SERVER_PORT"))
+	}
+	return resetUrl + "?token=" + url.QueryEscape(token)
+}
+
+// Logs in a user, returning a short lived access token and a refresh token (starting a new session)
+func (s *userService) LoginUser(login *models.Login) (*models.LoginResponse, error) {
+	found, err := s.authenticate(login)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("User logging in: ", found.Email)
+
+	// Users with two factor authentication complete the login with a code
+	if found.TwoFactorEnabled {
+		return buildTwoFactorPendingResponse(found)
+	}
+	// Reset the account's failed attempts
+	s.clearThrottle(accountThrottleKey(found.Email))
+	return s.issueLoginTokens(found, false, login.IPAddress, login.UserAgent)
+}
+
+// Logs in a user for a cookie session (Admin Panel), returning a token valid for the session
+func (s *userService) LoginUserSession(login *models.Login) (*models.LoginResponse, error) {
+	found, err := s.authenticate(login)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("User logging in: ", found.Email)
+
+	// Users with two factor authentication complete the login with a code
+	if found.TwoFactorEnabled {
+		return buildTwoFactorPendingResponse(found)
+	}
+	// Reset the account's failed attempts
+	s.clearThrottle(accountThrottleKey(found.Email))
+	tokenString, err := s.issueSessionToken(found, false, login.IPAddress, login.UserAgent)
+	if err != nil {
+		return nil, err
+	}
+	return &models.LoginResponse{Token: tokenString, ExpiresIn: int(auth.SessionTokenTTL.Seconds())}, nil
+}
+
+// Returns a token for a new session of a user (with their current role), replacing the current session
+// twoFactor should only be set if the user completed two factor authentication in the current session
+func (s *userService) StartSession(id int, twoFactor bool, ipAddress, userAgent string) (string, error) {
+	user, err := s.FindById(id)
+	if err != nil {
+		return "", err
+	}
+	session, err := s.startSession(user.ID, sessionTypeAdmin, twoFactor, ipAddress, userAgent)
+	if err != nil {
+		return "", err
+	}
+	return auth.GenerateJWTWithTTL(int(user.ID), user.Email, user.Role, auth.SessionTokenTTL, sessionTokenOptions(session.TokenID, twoFactor)...)
+}
+
+// Exchanges a refresh token for a new access token and refresh token (rotation)
+// If a token is used more than once, every token in its family is revoked and ErrRefreshTokenReused is returned
+func (s *userService) RefreshAccessToken(refreshToken string) (*models.LoginResponse, error) {
+	// Find token by hash
+	found, err := s.repo.FindRefreshToken(helpers.HashToken(refreshToken))
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if found.RevokedAt != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	// Has the token already been exchanged?
+	if found.UsedAt != nil {
+		return nil, s.revokeReusedRefreshToken(found)
+	}
+	if found.ExpiresAt.Before(time.Now()) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// Find user (with current role)
+	user, err := s.FindById(int(found.UserID))
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// Replace token with a new token in the same family
+	newRefreshToken, record, err := helpers.GenerateRefreshToken(found.UserID, found.FamilyID, auth.RefreshTokenTTL())
+	if err != nil {
+		return nil, err
+	}
+	record.TwoFactor = found.TwoFactor
+	err = s.repo.RotateRefreshToken(found, record)
+	// If used by a concurrent request
+	if errors.Is(err, corerepositories.ErrRefreshTokenUsed) {
+		return nil, s.revokeReusedRefreshToken(found)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	// The session lasts as long as its refresh token (the family ID is the session's token ID)
+	err = s.repo.ExtendSession(found.FamilyID, record.ExpiresAt)
+	if err != nil {
+		fmt.Println("error in extending session: ", err)
+	}
+
+	return buildLoginResponse(user, newRefreshToken, found.FamilyID, found.TwoFactor)
+}
+
+// Revokes the access token so it's rejected until it expires, and ends its session
+// If a refresh token is provided, its session is also ended so it can't be used to get new access tokens
+func (s *userService) Logout(token *auth.AuthToken, refreshToken string) error {
+	// API keys have no token to revoke
+	if token.ApiKeyID != 0 {
+		return ErrApiKeyLogout
+	}
+	err := auth.RevokeToken(token)
+	if err != nil {
+		return err
+	}
+	if token.SessionID != "" {
+		err = s.endSession(token.SessionID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+	// Find refresh token by hash (ignoring unknown tokens and tokens of other users)
+	found, err := s.repo.FindRefreshToken(helpers.HashToken(refreshToken))
+	if err != nil || fmt.Sprint(found.UserID) != token.UserID {
+		return nil
+	}
+	return s.endSession(found.FamilyID)
+}
+
+// Revokes the session (and token family) of a reused refresh token, returning ErrRefreshTokenReused
+func (s *userService) revokeReusedRefreshToken(token *db.RefreshToken) error {
+	fmt.Printf("Refresh token reused for user %d. Revoking session\n", token.UserID)
+	err := s.endSession(token.FamilyID)
+	if err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// Finds a user by email and checks the password matches
+// Failed attempts are throttled per account and IP address (returning a LoginThrottledError)
+func (s *userService) authenticate(login *models.Login) (*models.UserWithRole, error) {
+	err := s.checkLoginThrottle(login)
+	if err != nil {
+		// Recorded in the account's login history (if found)
+		var userID *uint
+		if user, findErr := s.repo.FindByEmail(login.Email); findErr == nil {
+			userID = &user.ID
+		}
+		s.recordFailedLogin(login, userID, loginFailureThrottled)
+		return nil, err
+	}
 
 	// Find user by email
 	found, err := s.FindByEmail(login.Email)
 	if err != nil {
-		return "", errors.New("invalid credentials")
+		// Compare anyway, so unknown emails take as long as incorrect passwords
+		bcrypt.CompareHashAndPassword(unknownUserPasswordHash(), []byte(login.Password))
+		s.recordLoginFailure(login, nil)
+		s.recordFailedLogin(login, nil, loginFailureInvalidCredentials)
+		return nil, ErrInvalidCredentials
 	}
 
 	// If user is found
 	// Compare stored (hashed) password with input password
 	err = bcrypt.CompareHashAndPassword([]byte(found.Password), []byte(login.Password))
 	if err != nil {
-		return "", errors.New("incorrect username/password")
+		s.recordLoginFailure(login, found)
+		s.recordFailedLogin(login, &found.ID, loginFailureInvalidCredentials)
+		return nil, ErrInvalidCredentials
 	}
+	return found, nil
+}
 
-	// If match found provide the token string for the user
-	if err == nil {
-		fmt.Println("User logging in: ", found.Email)
-		// Set login status to true
-		tokenString, err = auth.GenerateJWT(int(found.ID), found.Email, found.Role)
-		if err != nil {
-			fmt.Println("Failed to create JWT")
-		}
+// Hash compared against when logging in with an unknown email
+var unknownUserHash struct {
+	once sync.Once
+	hash []byte
+}
+
+func unknownUserPasswordHash() []byte {
+	unknownUserHash.once.Do(func() {
+		unknownUserHash.hash, _ = bcrypt.GenerateFromPassword([]byte("unknown user"), bcrypt.DefaultCost)
+	})
+	return unknownUserHash.hash
+}
+
+// Starts a session for the user, creating a refresh token (starting the session's token family) and an access token
+func (s *userService) issueLoginTokens(user *models.UserWithRole, twoFactor bool, ipAddress, userAgent string) (*models.LoginResponse, error) {
+	session, err := s.startLoginSession(user, sessionTypeApi, twoFactor, ipAddress, userAgent)
+	if err != nil {
+		return nil, err
 	}
-	return tokenString, nil
+	refreshToken, record, err := helpers.GenerateRefreshToken(user.ID, session.TokenID, auth.RefreshTokenTTL())
+	if err != nil {
+		return nil, err
+	}
+	record.TwoFactor = twoFactor
+	err = s.repo.CreateRefreshToken(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return buildLoginResponse(user, refreshToken, session.TokenID, twoFactor)
+}
+
+// Builds a login response with a new access token for the user in a session
+func buildLoginResponse(user *models.UserWithRole, refreshToken string, sessionTokenID string, twoFactor bool) (*models.LoginResponse, error) {
+	tokenString, err := auth.GenerateJWTWithTTL(int(user.ID), user.Email, user.Role, auth.AccessTokenTTL(), sessionTokenOptions(sessionTokenID, twoFactor)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWT: %w", err)
+	}
+	return &models.LoginResponse{
+		Token:        tokenString,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(auth.AccessTokenTTL().Seconds()),
+	}, nil
 }
 
 func (s *userService) CheckPasswordMatch(id int, password []byte) bool {
@@ -405,16 +745,18 @@ func (s *userService) VerifyEmailCode(token string) error {
 	user.VerificationCode = ""
 
 	// Update user in database
-	_, err = s.repo.Update(int(user.ID), user)
+	_, err = s.repo.Update(int(user.ID), user, time.Time{})
 	if err != nil {
 		return err
 	}
+	app.Cache.InvalidateTag(cache.RecordTag("user", user.ID))
 
 	// Return no error found
 	return nil
 }
 
 // Sends verification email for user
+// Repeat requests within the verification email window are skipped (the previously sent code remains valid)
 func (s *userService) ResendVerificationEmail(id int) error {
 	// Find user by id
 	user, err := s.repo.FindById(id)
@@ -427,15 +769,10 @@ func (s *userService) ResendVerificationEmail(id int) error {
 		return err
 	}
 
-	// Update user in database
-	_, err = s.repo.Update(int(user.ID), userUpdate)
-	if err != nil {
-		return err
-	}
 	// Build data for email template (SERVER_PORT prefixed with :)
 	baseUrl := fmt.Sprintf("%s%s", os.Getenv("SERVER_BASE_URL"), os.Getenv("SERVER_PORT"))
 	// Build URL for verification
-	tokenUrl := template.URL("http://" + baseUrl + "/api/users/verify-email/" + user.VerificationCode)
+	tokenUrl := template.URL("http://" + baseUrl + "/api/users/verify-email/" + userUpdate.VerificationCode)
 	data := struct {
 		Name     string
 		TokenUrl template.URL
@@ -444,34 +781,52 @@ func (s *userService) ResendVerificationEmail(id int) error {
 		TokenUrl: tokenUrl,
 	}
 
-	// Build HTML email template from file using injected data
-	emailString, err := webapi.LoadTemplate(webapi.BuildPathFromWorkingDirectory("/internal/email/templates/email-verification.tmpl"), data)
+	// Build email from template in the user's language
+	rendered, err := app.EmailTemplates.Render("email-verification", user.Locale, data)
 	if err != nil {
-		fmt.Printf("error in loading template: %v", err)
+		fmt.Printf("error in rendering template: %v", err)
 		return err
 	}
 
 	// Create payload containing details for email job
 	payload := queue.EmailJobPayload{
 		Recipient: user.Email,
-		Subject:   "Please Verify your Email",
-		Body:      emailString,
+		Subject:   rendered.Subject,
+		Body:      rendered.HTML,
+		Template:  "email-verification",
+		UserID:    user.ID,
 	}
 	// Marshal payload
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
 		return err
 	}
-	// Add job to queue
-	s.queue.AddJob("email", string(payloadBytes))
+	// Add job to queue (only one verification email per user within the window)
+	err = s.queue.AddJob(queue.EmailJobType, string(payloadBytes), queue.Unique(fmt.Sprintf("verify-email:%d", user.ID), verificationEmailWindow))
+	// If an email was recently queued, keep its code
+	if errors.Is(err, queue.ErrDuplicateJob) {
+		return nil
+	}
 	if err != nil {
 		return errors.New("error adding job to queue")
 	}
 
+	// Update user in database with the emailed code
+	_, err = s.repo.Update(int(user.ID), userUpdate, time.Time{})
+	if err != nil {
+		return err
+	}
+	app.Cache.InvalidateTag(cache.RecordTag("user", user.ID))
+
 	// Return no error found
 	return nil
 }
 
+// Cache options for a user (tagged so the user is removed from the cache along with records embedding the user)
+func userCacheOptions(id int) []cache.LoadOption {
+	return cache.RecordOptions(cache.Tags(cache.SchemaTag("user"), cache.RecordTag("user", id)))
+}
+
 // Helper function to find user role and attach to user
 func findRoleAndAttach(user *db.User, auth corerepositories.AuthPolicyRepository) (*models.UserWithRole, error) {
 	fullUser := &models.UserWithRole{}
@@ -499,12 +854,15 @@ func BuildUserWithRole(user *db.User, role string) *models.UserWithRole {
 		Password: user.Password,
 		Name:     user.Name,
 		Email:    user.Email,
+		Locale:   user.Locale,
 		// Authorization
 		Role: role,
 		// Verification
 		Verified:               user.Verified,
 		VerificationCode:       user.VerificationCode,
 		VerificationCodeExpiry: user.VerificationCodeExpiry,
+		// Two factor authentication
+		TwoFactorEnabled: user.TwoFactorEnabled,
 		// Timestamps
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
@@ -0,0 +1,106 @@
+package service_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/email"
+	"github.com/dmawardi/Go-Template/internal/models"
+	"github.com/dmawardi/Go-Template/internal/queue"
+)
+
+// Email service that rejects every message
+type rejectingEmail struct{}
+
+func (e *rejectingEmail) Send(message *email.Message) error {
+	return errors.New("550 mailbox unavailable")
+}
+func (e *rejectingEmail) SendEmail(recipient, subject, body string) error {
+	return e.Send(nil)
+}
+
+func TestQueue_ProcessEmailJobLogsDelivery(t *testing.T) {
+	// Queue that fails to send
+	failingQueue := queue.NewQueue(testModule.dbClient, &rejectingEmail{})
+
+	job := &db.Job{ID: 987654, JobType: queue.EmailJobType}
+	payload := queue.EmailJobPayload{Recipient: "log@example.com", Subject: "Password Reset Request", Body: "<p>Hi</p>", Template: "password-reset", UserID: 77}
+
+	// First attempt fails
+	if err := failingQueue.ProcessEmailJob(job, payload); err == nil {
+		t.Fatal("expected error sending email")
+	}
+	var emailLog db.EmailLog
+	if err := testModule.dbClient.Where("job_id = ?", job.ID).First(&emailLog).Error; err != nil {
+		t.Fatalf("expected email log to be recorded: %v", err)
+	}
+	if emailLog.Status != db.EmailStatusFailed || emailLog.Attempts != 1 || !strings.Contains(emailLog.Response, "550") || !emailLog.SentAt.IsZero() {
+		t.Errorf("expected failed attempt to be logged, got %+v", emailLog)
+	}
+	if emailLog.UserID != 77 || emailLog.Template != "password-reset" || emailLog.Recipient != "log@example.com" {
+		t.Errorf("expected payload details to be logged, got %+v", emailLog)
+	}
+
+	// Retry succeeds and updates the same log
+	if err := testModule.jobs.queue.ProcessEmailJob(job, payload); err != nil {
+		t.Fatalf("failed to send email: %v", err)
+	}
+	var logs []db.EmailLog
+	testModule.dbClient.Where("job_id = ?", job.ID).Find(&logs)
+	if len(logs) != 1 {
+		t.Fatalf("expected 1 email log for job, got %d", len(logs))
+	}
+	if logs[0].Status != db.EmailStatusSent || logs[0].Attempts != 2 || logs[0].SentAt.IsZero() {
+		t.Errorf("expected sent email to be logged, got %+v", logs[0])
+	}
+
+	// Each queue runs the email handler with its own mail service
+	payloadJSON := `{"recipient":"queues@example.com","subject":"Queues","body":"<p>Hi</p>"}`
+	if err := failingQueue.ProcessJob(queue.EmailJobType, payloadJSON); err == nil {
+		t.Error("expected error sending email with failing queue")
+	}
+	if err := testModule.jobs.queue.ProcessJob(queue.EmailJobType, payloadJSON); err != nil {
+		t.Errorf("expected test queue to send email with its own mail service, got %v", err)
+	}
+
+	// Clean up
+	testModule.dbClient.Unscoped().Where("job_id = ?", job.ID).Delete(&db.EmailLog{})
+	testModule.dbClient.Unscoped().Where("recipient = ?", "queues@example.com").Delete(&db.EmailLog{})
+}
+
+func TestEmailLogService_FindAll(t *testing.T) {
+	emailLogs := []db.EmailLog{
+		{UserID: 501, Recipient: "Jane@example.com", Subject: "Password Reset Request", Template: "password-reset", Status: db.EmailStatusSent},
+		{UserID: 501, Recipient: "jane@example.com", Subject: "Please Verify your Email", Template: "email-verification", Status: db.EmailStatusFailed},
+		{UserID: 502, Recipient: "john@example.com", Subject: "Password Reset Request", Template: "password-reset", Status: db.EmailStatusSent},
+	}
+	if err := testModule.dbClient.Create(&emailLogs).Error; err != nil {
+		t.Fatalf("failed to create test email logs: %v", err)
+	}
+
+	var tests = []struct {
+		testName      string
+		filter        models.EmailLogFilter
+		expectedCount int
+	}{
+		{"User's emails", models.EmailLogFilter{UserID: 501}, 2},
+		{"User's failed emails", models.EmailLogFilter{UserID: 501, Status: db.EmailStatusFailed}, 1},
+		{"Search within user's emails", models.EmailLogFilter{UserID: 501, Search: "RESET"}, 1},
+		{"Recipient (not case sensitive)", models.EmailLogFilter{Recipient: "JANE@example.com"}, 2},
+		{"Template", models.EmailLogFilter{Template: "password-reset", Search: "example.com"}, 2},
+	}
+	for _, v := range tests {
+		found, err := testModule.emailLogs.serv.FindAll(10, 0, "id", v.filter)
+		if err != nil {
+			t.Fatalf("%v: failed to find email logs: %v", v.testName, err)
+		}
+		if len(*found.Data) != v.expectedCount || found.Meta.GetMetaData().Total_Records != int64(v.expectedCount) {
+			t.Errorf("%v: expected %d email logs, got %d", v.testName, v.expectedCount, len(*found.Data))
+		}
+	}
+
+	// Clean up
+	testModule.dbClient.Unscoped().Delete(&emailLogs)
+}
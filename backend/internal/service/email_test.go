@@ -0,0 +1,388 @@
+package service_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/dmawardi/Go-Template/internal/email"
+)
+
+func TestMessage_Bytes(t *testing.T) {
+	msg := &email.Message{
+		To:      []string{"Jane Doe <jane@example.com>"},
+		Cc:      []string{"cc@example.com"},
+		Bcc:     []string{"hidden@example.com"},
+		ReplyTo: "support@example.com",
+		Subject: "Welcome ✓\r\nBcc: injected@example.com",
+		HTML:    `<p>Hello <strong>Jane</strong></p><p><a href="https://example.com/login">Log in</a></p>`,
+	}
+	msg.Attach("report.txt", []byte("report contents"))
+	cid := msg.Embed("logo.png", []byte("\x89PNG\r\n\x1a\n"))
+	if cid != "cid:logo.png" {
+		t.Errorf("expected cid:logo.png, got %q", cid)
+	}
+
+	// Recipients include Bcc
+	recipients, err := msg.Recipients()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(recipients, ",") != "jane@example.com,cc@example.com,hidden@example.com" {
+		t.Errorf("unexpected recipients: %v", recipients)
+	}
+
+	raw, err := msg.Bytes("noreply@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+
+	// Headers
+	if parsed.Header.Get("From") != "<noreply@example.com>" {
+		t.Errorf("unexpected From: %q", parsed.Header.Get("From"))
+	}
+	if parsed.Header.Get("To") != `"Jane Doe" <jane@example.com>` {
+		t.Errorf("unexpected To: %q", parsed.Header.Get("To"))
+	}
+	if parsed.Header.Get("Reply-To") != "<support@example.com>" {
+		t.Errorf("unexpected Reply-To: %q", parsed.Header.Get("Reply-To"))
+	}
+	if parsed.Header.Get("Bcc") != "" || bytes.Contains(raw, []byte("hidden@example.com")) {
+		t.Errorf("Bcc recipients should not be in the message")
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != "Welcome ✓ Bcc: injected@example.com" {
+		t.Errorf("unexpected Subject: %q (%v)", subject, err)
+	}
+	if parsed.Header.Get("Message-ID") == "" || parsed.Header.Get("Date") == "" {
+		t.Errorf("expected Message-ID and Date headers")
+	}
+
+	// Structure: mixed > related > alternative
+	parts := readParts(t, parsed.Header.Get("Content-Type"), parsed.Body)
+	if len(parts) != 2 || parts[1].filename != "report.txt" || parts[1].disposition != "attachment" || parts[1].body != "report contents" {
+		t.Fatalf("unexpected mixed parts: %+v", parts)
+	}
+	related := readParts(t, parts[0].contentType, strings.NewReader(parts[0].body))
+	if len(related) != 2 || related[1].contentID != "<logo.png>" || related[1].disposition != "inline" {
+		t.Fatalf("unexpected related parts: %+v", related)
+	}
+	alternative := readParts(t, related[0].contentType, strings.NewReader(related[0].body))
+	if len(alternative) != 2 {
+		t.Fatalf("expected text and HTML parts, got %+v", alternative)
+	}
+	// Line breaks are sent as CRLF
+	if alternative[0].body != "Hello Jane\r\n\r\nLog in (https://example.com/login)" {
+		t.Errorf("unexpected text part: %q", alternative[0].body)
+	}
+	if alternative[1].body != msg.HTML {
+		t.Errorf("unexpected HTML part: %q", alternative[1].body)
+	}
+
+	// A message without attachments is multipart/alternative
+	raw, err = (&email.Message{To: []string{"jane@example.com"}, Subject: "Hi", HTML: "<p>Hi</p>"}).Bytes("noreply@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ = mail.ReadMessage(bytes.NewReader(raw))
+	if mediaType, _, _ := mime.ParseMediaType(parsed.Header.Get("Content-Type")); mediaType != "multipart/alternative" {
+		t.Errorf("expected multipart/alternative, got %q", mediaType)
+	}
+
+	// Invalid recipients are rejected
+	if _, err := (&email.Message{To: []string{"not an address"}}).Bytes("noreply@example.com"); err == nil {
+		t.Errorf("expected error for invalid recipient")
+	}
+	if _, err := (&email.Message{}).Bytes("noreply@example.com"); err == nil {
+		t.Errorf("expected error for message without recipients")
+	}
+}
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		html string
+		want string
+	}{
+		{"<html><head><style>p { color: red; }</style></head><body><h2>Title</h2><p>Line one<br>Line two</p></body></html>", "Title\n\nLine one\nLine two"},
+		{`<ul><li>One</li><li>Two</li></ul>`, "- One\n- Two"},
+		{`<a href="https://example.com">https://example.com</a>`, "https://example.com"},
+		{"<p>Fish &amp; chips</p>", "Fish & chips"},
+	}
+	for _, v := range tests {
+		if got := email.HTMLToText(v.html); got != v.want {
+			t.Errorf("HTMLToText(%q) = %q, want %q", v.html, got, v.want)
+		}
+	}
+}
+
+// Decoded MIME part
+type mimePart struct {
+	contentType, disposition, filename, contentID, body string
+}
+
+// Reads the decoded parts of a multipart body
+func readParts(t *testing.T, contentType string, body io.Reader) []mimePart {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		t.Fatalf("expected multipart content type, got %q", contentType)
+	}
+	var parts []mimePart
+	reader := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			return parts
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var content []byte
+		switch part.Header.Get("Content-Transfer-Encoding") {
+		case "quoted-printable":
+			content, err = io.ReadAll(quotedprintable.NewReader(part))
+		case "base64":
+			encoded, _ := io.ReadAll(part)
+			content, err = base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", ""))
+		default:
+			content, err = io.ReadAll(part)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		disposition, dispositionParams, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+		parts = append(parts, mimePart{
+			contentType: part.Header.Get("Content-Type"),
+			disposition: disposition,
+			filename:    dispositionParams["filename"],
+			contentID:   part.Header.Get("Content-ID"),
+			body:        string(content),
+		})
+	}
+}
+
+func TestFileEmail(t *testing.T) {
+	outbox, err := email.NewFileEmail(t.TempDir(), "noreply@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Send messages
+	if err := outbox.SendEmail("first@example.com", "First", "<p>First message</p>"); err != nil {
+		t.Fatal(err)
+	}
+	msg := &email.Message{To: []string{"second@example.com"}, Bcc: []string{"hidden@example.com"}, Subject: "Second ✓", HTML: "<p>Second message</p>"}
+	msg.Attach("notes.txt", []byte("notes"))
+	if err := outbox.Send(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	// Listed newest first
+	messages, err := outbox.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || messages[0].Subject != "Second ✓" || messages[1].Subject != "First" {
+		t.Fatalf("unexpected messages: %+v", messages)
+	}
+
+	// Find parses the body and attachments
+	found, err := outbox.Find(messages[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.HTML != "<p>Second message</p>" || found.Text != "Second message" {
+		t.Errorf("unexpected bodies: %q, %q", found.HTML, found.Text)
+	}
+	if found.Recipients != "second@example.com, hidden@example.com" {
+		t.Errorf("unexpected recipients: %q", found.Recipients)
+	}
+	if len(found.Attachments) != 1 || found.Attachments[0].Filename != "notes.txt" || string(found.Attachments[0].Data) != "notes" {
+		t.Errorf("unexpected attachments: %+v", found.Attachments)
+	}
+
+	// IDs outside the outbox are rejected
+	if _, err := outbox.Find("../outbox"); err == nil {
+		t.Errorf("expected error for invalid ID")
+	}
+
+	// Delete
+	if err := outbox.Delete(messages[0].ID, messages[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if messages, _ := outbox.List(); len(messages) != 0 {
+		t.Errorf("expected empty outbox, got %d messages", len(messages))
+	}
+}
+
+func TestTemplateRegistry(t *testing.T) {
+	registry, err := email.LoadTemplates()
+	if err != nil {
+		t.Fatalf("failed to load email templates: %v", err)
+	}
+	data := map[string]interface{}{
+		"Name":      "Jane",
+		"ResetUrl":  template.URL("https://example.com/reset-password?token=s3cret"),
+		"ExpiresIn": 60,
+	}
+
+	var tests = []struct {
+		testName        string
+		locale          string
+		expectedLocale  string
+		expectedSubject string
+		expectedContent []string
+	}{
+		{"Default locale", "", "en", "Password Reset Request", []string{"Dear Jane", `href="https://example.com/reset-password?token=s3cret"`, "expires in 60 minutes", "Best Regards", "Go Template Inc."}},
+		{"Regional locale uses language", "es_MX", "es", "Solicitud de restablecimiento de contraseña", []string{"Jane", "token=s3cret", "caduca en 60 minutos", "Saludos cordiales", "Go Template Inc."}},
+		{"Unknown locale uses default", "fr", "en", "Password Reset Request", []string{"Dear Jane", "Best Regards"}},
+	}
+	for _, v := range tests {
+		rendered, err := registry.Render("password-reset", v.locale, data)
+		if err != nil {
+			t.Fatalf("%v: failed to render email: %v", v.testName, err)
+		}
+		if rendered.Subject != v.expectedSubject {
+			t.Errorf("%v: expected subject %q, got %q", v.testName, v.expectedSubject, rendered.Subject)
+		}
+		if rendered.Locale != v.expectedLocale || !strings.Contains(rendered.HTML, `lang="`+v.expectedLocale+`"`) {
+			t.Errorf("%v: expected locale %q, got %q", v.testName, v.expectedLocale, rendered.Locale)
+		}
+		for _, content := range v.expectedContent {
+			if !strings.Contains(rendered.HTML, content) {
+				t.Errorf("%v: expected body to contain %q", v.testName, content)
+			}
+		}
+	}
+
+	// Unknown templates
+	if _, err := registry.Render("missing", "", data); err == nil {
+		t.Error("expected error rendering unknown template")
+	}
+
+	// Subjects are plain text
+	fsys := fstest.MapFS{
+		"layouts/base.gohtml":   {Data: []byte(`{{define "layout"}}<html lang="{{.Locale}}">{{template "content" .Data}}</html>{{end}}`)},
+		"emails/welcome.gohtml": {Data: []byte(`{{define "subject"}}  Welcome to {{.}}  {{end}}{{define "content"}}<p>{{.}}</p>{{end}}`)},
+	}
+	custom, err := email.NewTemplateRegistry(fsys, "en")
+	if err != nil {
+		t.Fatalf("failed to load email templates: %v", err)
+	}
+	rendered, err := custom.Render("welcome", "", "O'Brien & Co")
+	if err != nil {
+		t.Fatalf("failed to render email: %v", err)
+	}
+	if rendered.Subject != "Welcome to O'Brien & Co" {
+		t.Errorf("expected unescaped subject, got %q", rendered.Subject)
+	}
+	if !strings.Contains(rendered.HTML, "O&#39;Brien &amp; Co") {
+		t.Errorf("expected escaped body, got %q", rendered.HTML)
+	}
+
+	// Emails must define their content
+	fsys["emails/broken.gohtml"] = &fstest.MapFile{Data: []byte(`{{define "subject"}}Broken{{end}}`)}
+	if _, err := email.NewTemplateRegistry(fsys, "en"); err == nil {
+		t.Error("expected error loading template without content")
+	}
+}
+
+// Starts a minimal SMTP server that accepts messages (rejecting recipients at reject.example.com)
+// and returns its address and the received messages
+func startSMTPServer(t *testing.T) (string, chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start SMTP server: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	received := make(chan string, 10)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				text := textproto.NewConn(conn)
+				text.PrintfLine("220 localhost ESMTP")
+				for {
+					line, err := text.ReadLine()
+					if err != nil {
+						return
+					}
+					command := strings.ToUpper(strings.Fields(line + " ")[0])
+					switch {
+					case command == "EHLO" || command == "HELO":
+						text.PrintfLine("250 localhost")
+					case command == "RCPT" && strings.Contains(line, "reject.example.com"):
+						text.PrintfLine("550 5.1.1 Mailbox unavailable")
+					case command == "DATA":
+						text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+						data, err := text.ReadDotBytes()
+						if err != nil {
+							return
+						}
+						received <- string(data)
+						text.PrintfLine("250 2.0.0 Ok: queued as ABC123")
+					case command == "QUIT":
+						text.PrintfLine("221 Bye")
+						return
+					default:
+						text.PrintfLine("250 OK")
+					}
+				}
+			}(conn)
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestSMTPEmail_SendWithResponse(t *testing.T) {
+	address, received := startSMTPServer(t)
+	host, port, _ := net.SplitHostPort(address)
+	t.Setenv("SMTP_HOST", host)
+	t.Setenv("SMTP_PORT", port)
+	t.Setenv("SMTP_USERNAME", "sender@example.com")
+	sender, ok := email.NewSMTPEmail().(email.ResponseSender)
+	if !ok {
+		t.Fatal("expected SMTP email to report responses")
+	}
+
+	// Accepted message returns the server's reply
+	response, err := sender.SendWithResponse(&email.Message{To: []string{"jane@example.com"}, Subject: "Hello", HTML: "<p>Hi</p>"})
+	if err != nil {
+		t.Fatalf("failed to send email: %v", err)
+	}
+	if response != "250 2.0.0 Ok: queued as ABC123" {
+		t.Errorf("expected server reply, got %q", response)
+	}
+	select {
+	case data := <-received:
+		if !strings.Contains(data, "Subject: Hello") {
+			t.Errorf("expected message to be received, got %q", data)
+		}
+	default:
+		t.Error("expected message to be received")
+	}
+
+	// Rejected recipient returns the server's error
+	_, err = sender.SendWithResponse(&email.Message{To: []string{"jane@reject.example.com"}, Subject: "Hello", HTML: "<p>Hi</p>"})
+	if err == nil || !strings.Contains(err.Error(), "550") || !strings.Contains(err.Error(), "Mailbox unavailable") {
+		t.Errorf("expected rejection error, got %v", err)
+	}
+}
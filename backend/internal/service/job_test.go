@@ -0,0 +1,547 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/queue"
+)
+
+func TestJobService_MarkJobAsFailed(t *testing.T) {
+	// Create job with a low number of attempts (due before any other pending job)
+	job := &db.Job{JobType: "email", Payload: "{}", MaxAttempts: 2, NextRunAt: time.Now().Add(-24 * time.Hour)}
+	if err := testModule.dbClient.Create(job).Error; err != nil {
+		t.Fatalf("failed to create test job: %v", err)
+	}
+
+	// First failed attempt should schedule a retry
+	claimed, err := testModule.jobs.queue.ClaimJob("test-worker")
+	if err != nil || claimed.ID != job.ID {
+		t.Fatalf("failed to claim test job: %v", err)
+	}
+	before := time.Now()
+	err = testModule.jobs.queue.MarkJobAsFailed(claimed, errors.New("smtp unavailable"))
+	if err != nil {
+		t.Fatalf("failed to mark job as failed: %v", err)
+	}
+	found, err := testModule.jobs.serv.FindById(int(job.ID))
+	if err != nil {
+		t.Fatalf("failed to find job: %v", err)
+	}
+	if found.Status != db.JobStatusPending || found.Attempts != 1 || found.LastError != "smtp unavailable" || found.LockedBy != "" {
+		t.Errorf("unexpected job state after first failure: status %q, attempts %d, last error %q, locked by %q", found.Status, found.Attempts, found.LastError, found.LockedBy)
+	}
+	if found.NextRunAt.Before(before.Add(queue.Backoff(1))) {
+		t.Errorf("expected next run to be delayed by at least %v, got %v", queue.Backoff(1), found.NextRunAt.Sub(before))
+	}
+
+	// Second failed attempt exhausts attempts (make job due again first)
+	testModule.dbClient.Model(job).Update("next_run_at", time.Now().Add(-24*time.Hour))
+	claimed, err = testModule.jobs.queue.ClaimJob("test-worker")
+	if err != nil || claimed.ID != job.ID {
+		t.Fatalf("failed to claim test job: %v", err)
+	}
+	err = testModule.jobs.queue.MarkJobAsFailed(claimed, errors.New("smtp unavailable"))
+	if err != nil {
+		t.Fatalf("failed to mark job as failed: %v", err)
+	}
+	found, err = testModule.jobs.serv.FindById(int(job.ID))
+	if err != nil {
+		t.Fatalf("failed to find job: %v", err)
+	}
+	if found.Status != db.JobStatusDead || found.Attempts != 2 {
+		t.Errorf("expected job status %q after 2 attempts, got %q after %d", db.JobStatusDead, found.Status, found.Attempts)
+	}
+
+	// Clean up
+	testModule.dbClient.Unscoped().Delete(job)
+}
+
+func TestQueue_ClaimJob(t *testing.T) {
+	// Create job (due before any other pending job)
+	job := &db.Job{JobType: "email", Payload: "{}", NextRunAt: time.Now().Add(-24 * time.Hour)}
+	if err := testModule.dbClient.Create(job).Error; err != nil {
+		t.Fatalf("failed to create test job: %v", err)
+	}
+
+	// First worker claims the job
+	first, err := testModule.jobs.queue.ClaimJob("worker-a")
+	if err != nil || first.ID != job.ID {
+		t.Fatalf("failed to claim test job: %v", err)
+	}
+	if first.Status != db.JobStatusRunning || first.LockedBy != "worker-a" || first.Attempts != 1 {
+		t.Errorf("unexpected claimed job state: status %q, locked by %q, attempts %d", first.Status, first.LockedBy, first.Attempts)
+	}
+
+	// Second worker can't claim the same job while the lease is held
+	second, err := testModule.jobs.queue.ClaimJob("worker-b")
+	if err == nil && second.ID == job.ID {
+		t.Errorf("expected job %d to be skipped while leased", job.ID)
+	}
+	if err == nil {
+		// Release any other job claimed during the test
+		testModule.dbClient.Model(second).Updates(map[string]interface{}{"status": db.JobStatusPending, "attempts": second.Attempts - 1, "locked_by": "", "locked_until": nil})
+	}
+
+	// Expire the lease (simulates a crashed worker)
+	testModule.dbClient.Model(job).Update("locked_until", time.Now().Add(-time.Minute))
+	// Second worker reclaims the job
+	reclaimed, err := testModule.jobs.queue.ClaimJob("worker-b")
+	if err != nil || reclaimed.ID != job.ID {
+		t.Fatalf("failed to reclaim job with expired lease: %v", err)
+	}
+	if reclaimed.LockedBy != "worker-b" || reclaimed.Attempts != 2 {
+		t.Errorf("unexpected reclaimed job state: locked by %q, attempts %d", reclaimed.LockedBy, reclaimed.Attempts)
+	}
+
+	// First worker can no longer complete the job
+	if err := testModule.jobs.queue.MarkJobAsProcessed(first); !errors.Is(err, queue.ErrLeaseLost) {
+		t.Errorf("expected lease lost error, got %v", err)
+	}
+	// Second worker completes the job
+	if err := testModule.jobs.queue.MarkJobAsProcessed(reclaimed); err != nil {
+		t.Errorf("failed to mark job as processed: %v", err)
+	}
+
+	// Clean up
+	testModule.dbClient.Unscoped().Delete(job)
+}
+
+func TestQueue_ClaimJobPriority(t *testing.T) {
+	// Create a low and a high priority job (low priority job is due first, both ahead of any other job)
+	low := &db.Job{JobType: "email", Payload: "{}", Priority: 1000, NextRunAt: time.Now().Add(-48 * time.Hour)}
+	high := &db.Job{JobType: "email", Payload: "{}", Priority: 1001, NextRunAt: time.Now().Add(-24 * time.Hour)}
+	for _, job := range []*db.Job{low, high} {
+		if err := testModule.dbClient.Create(job).Error; err != nil {
+			t.Fatalf("failed to create test job: %v", err)
+		}
+	}
+
+	// High priority job is claimed first, despite being due later
+	for _, want := range []*db.Job{high, low} {
+		claimed, err := testModule.jobs.queue.ClaimJob("test-worker")
+		if err != nil {
+			t.Fatalf("failed to claim job: %v", err)
+		}
+		if claimed.ID != want.ID {
+			t.Errorf("expected job %d (priority %d) to be claimed, got job %d (priority %d)", want.ID, want.Priority, claimed.ID, claimed.Priority)
+		}
+	}
+
+	// Clean up
+	testModule.dbClient.Unscoped().Delete(&[]db.Job{*low, *high})
+}
+
+func TestQueue_AddJobUnique(t *testing.T) {
+	jobType := "test-unique"
+	key := "verify-email:42"
+
+	// First job is added
+	if err := testModule.jobs.queue.AddJob(jobType, "{}", queue.Delay(time.Hour), queue.Unique(key, time.Minute)); err != nil {
+		t.Fatalf("failed to add unique job: %v", err)
+	}
+	// Second job with the same key is skipped
+	err := testModule.jobs.queue.AddJob(jobType, "{}", queue.Delay(time.Hour), queue.Unique(key, time.Minute))
+	if !errors.Is(err, queue.ErrDuplicateJob) {
+		t.Errorf("expected duplicate job error, got %v", err)
+	}
+	// A different key is added
+	if err := testModule.jobs.queue.AddJob(jobType, "{}", queue.Delay(time.Hour), queue.Unique("verify-email:43", time.Minute)); err != nil {
+		t.Errorf("failed to add unique job with different key: %v", err)
+	}
+
+	// Once the first job is cancelled, the key can be used again
+	var first db.Job
+	testModule.dbClient.Where("job_type = ? AND unique_key = ?", jobType, key).First(&first)
+	if _, err := testModule.jobs.serv.Cancel(int(first.ID)); err != nil {
+		t.Fatalf("failed to cancel job: %v", err)
+	}
+	if err := testModule.jobs.queue.AddJob(jobType, "{}", queue.Delay(time.Hour), queue.Unique(key, time.Minute)); err != nil {
+		t.Errorf("failed to add unique job after cancelling the original: %v", err)
+	}
+
+	// Check number of jobs stored
+	var count int64
+	testModule.dbClient.Model(&db.Job{}).Where("job_type = ?", jobType).Count(&count)
+	if count != 3 {
+		t.Errorf("expected 3 jobs to be stored, got %d", count)
+	}
+
+	// Clean up
+	testModule.dbClient.Unscoped().Where("job_type = ?", jobType).Delete(&db.Job{})
+}
+
+func TestQueue_RateLimit(t *testing.T) {
+	jobType := "test-throttled"
+	// Allow 1 job per hour
+	testModule.jobs.queue.SetRateLimit(jobType, 1, time.Hour)
+	defer testModule.jobs.queue.SetRateLimit(jobType, 0, 0)
+
+	// Create two jobs of the throttled type (ahead of any other job)
+	first := &db.Job{JobType: jobType, Payload: "{}", Priority: 1000, NextRunAt: time.Now().Add(-48 * time.Hour)}
+	second := &db.Job{JobType: jobType, Payload: "{}", Priority: 1000, NextRunAt: time.Now().Add(-24 * time.Hour)}
+	for _, job := range []*db.Job{first, second} {
+		if err := testModule.dbClient.Create(job).Error; err != nil {
+			t.Fatalf("failed to create test job: %v", err)
+		}
+	}
+
+	// First job is claimed
+	claimed, err := testModule.jobs.queue.ClaimJob("test-worker")
+	if err != nil || claimed.ID != first.ID {
+		t.Fatalf("failed to claim first throttled job: %v", err)
+	}
+	if claimed.StartedAt.IsZero() {
+		t.Errorf("expected claimed job to record its start time")
+	}
+
+	// Second job is held back until the rate allows
+	other, err := testModule.jobs.queue.ClaimJob("test-worker")
+	if err == nil {
+		if other.ID == second.ID {
+			t.Errorf("expected job %d to be held back by the rate limit", second.ID)
+		}
+		// Release any other job claimed during the test
+		testModule.dbClient.Model(other).Updates(map[string]interface{}{"status": db.JobStatusPending, "attempts": other.Attempts - 1, "locked_by": "", "locked_until": nil})
+	}
+
+	// Once the rate limit is lifted, the second job is claimed
+	testModule.jobs.queue.SetRateLimit(jobType, 0, 0)
+	claimed, err = testModule.jobs.queue.ClaimJob("test-worker")
+	if err != nil || claimed.ID != second.ID {
+		t.Errorf("expected job %d to be claimed once the rate limit was lifted: %v", second.ID, err)
+	}
+
+	// Clean up
+	testModule.dbClient.Unscoped().Delete(&[]db.Job{*first, *second})
+}
+
+func TestParseRateLimits(t *testing.T) {
+	var tests = []struct {
+		value     string
+		want      map[string]queue.RateLimit
+		expectErr bool
+	}{
+		{"email=60/1m", map[string]queue.RateLimit{"email": {Limit: 60, Per: time.Minute}}, false},
+		{"email=60/1m, webhook=10/1s", map[string]queue.RateLimit{"email": {Limit: 60, Per: time.Minute}, "webhook": {Limit: 10, Per: time.Second}}, false},
+		{"email", nil, true},
+		{"email=60", nil, true},
+		{"email=0/1m", nil, true},
+		{"email=60/soon", nil, true},
+	}
+	for _, v := range tests {
+		got, err := queue.ParseRateLimits(v.value)
+		if v.expectErr {
+			if err == nil {
+				t.Errorf("ParseRateLimits(%q): expected error", v.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseRateLimits(%q): unexpected error: %v", v.value, err)
+			continue
+		}
+		if len(got) != len(v.want) {
+			t.Errorf("ParseRateLimits(%q) = %v, want %v", v.value, got, v.want)
+			continue
+		}
+		for jobType, limit := range v.want {
+			if got[jobType] != limit {
+				t.Errorf("ParseRateLimits(%q)[%s] = %v, want %v", v.value, jobType, got[jobType], limit)
+			}
+		}
+	}
+}
+
+func TestJobService_Requeue(t *testing.T) {
+	// Create a dead and a pending job
+	dead := &db.Job{JobType: "email", Payload: "{}", Status: db.JobStatusDead, Attempts: 5, LastError: "timeout"}
+	pending := &db.Job{JobType: "email", Payload: "{}"}
+	for _, job := range []*db.Job{dead, pending} {
+		if err := testModule.dbClient.Create(job).Error; err != nil {
+			t.Fatalf("failed to create test job: %v", err)
+		}
+	}
+
+	// Re-queue dead job
+	requeued, err := testModule.jobs.serv.Requeue(int(dead.ID))
+	if err != nil {
+		t.Fatalf("failed to re-queue dead job: %v", err)
+	}
+	if requeued.Status != db.JobStatusPending || requeued.Attempts != 0 {
+		t.Errorf("unexpected job state after re-queue: status %q, attempts %d", requeued.Status, requeued.Attempts)
+	}
+
+	// Pending jobs cannot be re-queued
+	if _, err := testModule.jobs.serv.Requeue(int(pending.ID)); err == nil {
+		t.Errorf("expected error when re-queueing a pending job")
+	}
+
+	// Clean up
+	testModule.dbClient.Unscoped().Delete(&[]db.Job{*dead, *pending})
+}
+
+func TestJobService_Cancel(t *testing.T) {
+	// Create a delayed pending job and a running job
+	pending := &db.Job{JobType: "email", Payload: "{}", NextRunAt: time.Now().Add(time.Hour)}
+	running := &db.Job{JobType: "email", Payload: "{}", Status: db.JobStatusRunning, LockedBy: "worker-a", LockedUntil: time.Now().Add(time.Minute)}
+	for _, job := range []*db.Job{pending, running} {
+		if err := testModule.dbClient.Create(job).Error; err != nil {
+			t.Fatalf("failed to create test job: %v", err)
+		}
+	}
+
+	// Cancel pending job
+	cancelled, err := testModule.jobs.serv.Cancel(int(pending.ID))
+	if err != nil {
+		t.Fatalf("failed to cancel pending job: %v", err)
+	}
+	found, err := testModule.jobs.serv.FindById(int(pending.ID))
+	if err != nil {
+		t.Fatalf("failed to find job: %v", err)
+	}
+	if cancelled.Status != db.JobStatusCancelled || found.Status != db.JobStatusCancelled {
+		t.Errorf("expected job status %q after cancel, got %q", db.JobStatusCancelled, found.Status)
+	}
+
+	// Running jobs cannot be cancelled
+	if _, err := testModule.jobs.serv.Cancel(int(running.ID)); err == nil {
+		t.Errorf("expected error when cancelling a running job")
+	}
+
+	// Cancelled jobs can be re-queued
+	requeued, err := testModule.jobs.serv.Requeue(int(pending.ID))
+	if err != nil {
+		t.Fatalf("failed to re-queue cancelled job: %v", err)
+	}
+	if requeued.Status != db.JobStatusPending {
+		t.Errorf("expected job status %q after re-queue, got %q", db.JobStatusPending, requeued.Status)
+	}
+
+	// Clean up
+	testModule.dbClient.Unscoped().Delete(&[]db.Job{*pending, *running})
+}
+
+func TestJobService_BulkDelete(t *testing.T) {
+	// Create a processed, a dead and a running job
+	processed := &db.Job{JobType: "email", Payload: "{}", Status: db.JobStatusProcessed, Processed: true}
+	dead := &db.Job{JobType: "email", Payload: "{}", Status: db.JobStatusDead}
+	running := &db.Job{JobType: "email", Payload: "{}", Status: db.JobStatusRunning, LockedBy: "worker-a", LockedUntil: time.Now().Add(time.Minute)}
+	for _, job := range []*db.Job{processed, dead, running} {
+		if err := testModule.dbClient.Create(job).Error; err != nil {
+			t.Fatalf("failed to create test job: %v", err)
+		}
+	}
+
+	// Purge all three
+	err := testModule.jobs.serv.BulkDelete([]int{int(processed.ID), int(dead.ID), int(running.ID)})
+	if err != nil {
+		t.Fatalf("failed to purge jobs: %v", err)
+	}
+
+	// Processed and dead jobs are permanently deleted
+	var remaining int64
+	testModule.dbClient.Unscoped().Model(&db.Job{}).Where("id IN ?", []uint{processed.ID, dead.ID}).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("expected purged jobs to be permanently deleted, %d remain", remaining)
+	}
+	// Running job is left for its worker
+	if _, err := testModule.jobs.serv.FindById(int(running.ID)); err != nil {
+		t.Errorf("expected running job to be skipped by purge: %v", err)
+	}
+
+	// Clean up
+	testModule.dbClient.Unscoped().Delete(running)
+}
+
+func TestBackoff(t *testing.T) {
+	var tests = []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, queue.BaseBackoff},
+		{2, queue.BaseBackoff * 2},
+		{3, queue.BaseBackoff * 4},
+		{100, queue.MaxBackoff},
+	}
+	for _, v := range tests {
+		if got := queue.Backoff(v.attempts); got != v.want {
+			t.Errorf("Backoff(%d) = %v, want %v", v.attempts, got, v.want)
+		}
+	}
+}
+
+func TestQueue_ProcessJob(t *testing.T) {
+	type thumbnailPayload struct {
+		PostID int    `json:"post_id"`
+		Size   string `json:"size"`
+	}
+	// Register a typed handler
+	var received thumbnailPayload
+	queue.Register("test-thumbnail", func(payload thumbnailPayload) error {
+		received = payload
+		return nil
+	})
+	defer queue.Deregister("test-thumbnail")
+
+	var tests = []struct {
+		title         string
+		jobType       string
+		payload       string
+		expectErr     bool
+		expectedFinal string
+	}{
+		{"Registered type is decoded and processed", "test-thumbnail", `{"post_id":4,"size":"small"}`, false, ""},
+		{"Fail: Payload can't be decoded", "test-thumbnail", `not json`, true, db.JobStatusFailed},
+		{"Fail: Unknown job type", "test-unknown", `{}`, true, db.JobStatusFailed},
+	}
+	for _, v := range tests {
+		err := testModule.jobs.queue.ProcessJob(v.jobType, v.payload)
+		if (err != nil) != v.expectErr {
+			t.Errorf("In test '%s': expected error %v, got %v", v.title, v.expectErr, err)
+			continue
+		}
+		if err == nil {
+			continue
+		}
+
+		// Failing the job should skip retries
+		job := &db.Job{JobType: v.jobType, Payload: v.payload}
+		if err := testModule.dbClient.Create(job).Error; err != nil {
+			t.Fatalf("failed to create test job: %v", err)
+		}
+		if err := testModule.jobs.queue.MarkJobAsFailed(job, err); err != nil {
+			t.Fatalf("failed to mark job as failed: %v", err)
+		}
+		if job.Status != v.expectedFinal {
+			t.Errorf("In test '%s': expected job status %q, got %q", v.title, v.expectedFinal, job.Status)
+		}
+		testModule.dbClient.Unscoped().Delete(job)
+	}
+
+	// Check payload was decoded
+	if received.PostID != 4 || received.Size != "small" {
+		t.Errorf("expected decoded payload {4 small}, got %v", received)
+	}
+}
+
+func TestQueue_StartAndWait(t *testing.T) {
+	// Register a handler that blocks until released
+	started := make(chan struct{})
+	release := make(chan struct{})
+	queue.Register("test-slow", func(_ struct{}) error {
+		close(started)
+		<-release
+		return nil
+	})
+	defer queue.Deregister("test-slow")
+
+	// Add job (due before any other pending job)
+	job := &db.Job{JobType: "test-slow", Payload: "{}", NextRunAt: time.Now().Add(-48 * time.Hour)}
+	if err := testModule.dbClient.Create(job).Error; err != nil {
+		t.Fatalf("failed to create test job: %v", err)
+	}
+
+	// Start a single worker
+	ctx, cancel := context.WithCancel(context.Background())
+	testModule.jobs.queue.Start(ctx, queue.Settings{Workers: 1})
+
+	// Wait for the job to start then begin shutdown
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("worker did not start job")
+	}
+	cancel()
+
+	// Workers should not stop while the current job is running
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer waitCancel()
+	if err := testModule.jobs.queue.Wait(waitCtx); err == nil {
+		t.Errorf("expected worker to still be running its current job")
+	}
+
+	// Finish the job and wait for the worker to stop
+	close(release)
+	waitCtx, waitCancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer waitCancel()
+	if err := testModule.jobs.queue.Wait(waitCtx); err != nil {
+		t.Fatalf("failed waiting for workers to stop: %v", err)
+	}
+
+	// Current job was completed
+	found, err := testModule.jobs.serv.FindById(int(job.ID))
+	if err != nil {
+		t.Fatalf("failed to find job: %v", err)
+	}
+	if found.Status != db.JobStatusProcessed {
+		t.Errorf("expected job status %q, got %q", db.JobStatusProcessed, found.Status)
+	}
+
+	// Clean up
+	testModule.dbClient.Unscoped().Delete(job)
+}
+
+func TestQueue_Heartbeat(t *testing.T) {
+	// Register a handler that runs for several lease timeouts
+	started := make(chan struct{})
+	release := make(chan struct{})
+	queue.Register("test-long", func(_ struct{}) error {
+		close(started)
+		<-release
+		return nil
+	})
+	defer queue.Deregister("test-long")
+
+	// Add job (due before any other pending job)
+	job := &db.Job{JobType: "test-long", Payload: "{}", NextRunAt: time.Now().Add(-72 * time.Hour)}
+	if err := testModule.dbClient.Create(job).Error; err != nil {
+		t.Fatalf("failed to create test job: %v", err)
+	}
+
+	// Start a single worker with a short lease (on a separate queue so the test queue's lease isn't changed)
+	shortLeaseQueue := queue.NewQueue(testModule.dbClient, &rejectingEmail{})
+	ctx, cancel := context.WithCancel(context.Background())
+	shortLeaseQueue.Start(ctx, queue.Settings{Workers: 1, LeaseTimeout: 300 * time.Millisecond})
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("worker did not start job")
+	}
+	cancel()
+
+	// Another worker can't reclaim the job after the original lease has expired
+	time.Sleep(time.Second)
+	other, err := testModule.jobs.queue.ClaimJob("worker-b")
+	if err == nil && other.ID == job.ID {
+		t.Errorf("expected job %d to keep its lease while running", job.ID)
+	}
+	if err == nil && other.ID != job.ID {
+		// Release any other job claimed during the test
+		testModule.dbClient.Model(other).Updates(map[string]interface{}{"status": db.JobStatusPending, "attempts": other.Attempts - 1, "locked_by": "", "locked_until": nil})
+	}
+
+	// Finish the job and wait for the worker to stop
+	close(release)
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer waitCancel()
+	if err := shortLeaseQueue.Wait(waitCtx); err != nil {
+		t.Fatalf("failed waiting for workers to stop: %v", err)
+	}
+
+	// Job was completed by the original worker (in a single attempt)
+	found, err := testModule.jobs.serv.FindById(int(job.ID))
+	if err != nil {
+		t.Fatalf("failed to find job: %v", err)
+	}
+	if found.Status != db.JobStatusProcessed || found.Attempts != 1 || found.LockedBy != "" {
+		t.Errorf("expected job to be processed once and released, got status %q, attempts %d, locked by %q", found.Status, found.Attempts, found.LockedBy)
+	}
+
+	// Clean up
+	testModule.dbClient.Unscoped().Delete(job)
+}
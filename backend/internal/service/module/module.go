@@ -2,7 +2,11 @@ package moduleservices
 
 import (
 	"fmt"
+	"reflect"
+	"strings"
+	"time"
 
+	"github.com/dmawardi/Go-Template/internal/cache"
 	"github.com/dmawardi/Go-Template/internal/config"
 	"github.com/dmawardi/Go-Template/internal/models"
 	"github.com/dmawardi/Go-Template/internal/repository"
@@ -14,14 +18,34 @@ func SetAppConfig(appConfig *config.AppConfig) {
 	app = appConfig
 }
 
+// Finds a list of entities through the cache if list caching is enabled (app.ListCacheTTL).
+// Lists are tagged with the schema's list tag and the tags of each entity (so they're removed when a related record changes).
+func findAllCached[dbSchema any](schemaName string, limit int, offset int, order string, conditions []models.QueryConditionParameters, find func() (*models.BasicPaginatedResponse[dbSchema], error)) (*models.BasicPaginatedResponse[dbSchema], error) {
+	if app.ListCacheTTL <= 0 {
+		return find()
+	}
+	cacheKey := cache.ListKey(schemaName, limit, offset, order, conditions)
+	return cache.GetOrLoad(app.Cache, cacheKey, app.ListCacheTTL, find,
+		cache.Tags(cache.ListTag(schemaName)),
+		cache.TagWith(func(value interface{}) []string {
+			var tags []string
+			if response, ok := value.(*models.BasicPaginatedResponse[dbSchema]); ok && response.Data != nil {
+				for i := range *response.Data {
+					tags = append(tags, cache.EntityTags(schemaName, &(*response.Data)[i])...)
+				}
+			}
+			return tags
+		}),
+	)
+}
 
 // BasicModuleService is an interface for basic service CRUD operations
 type BasicModuleService[dbSchema, create, update any] interface {
 	FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[dbSchema], error)
 	FindById(int) (*dbSchema, error)
 	Create(entity *create) (*dbSchema, error)
-	Update(int, *update) (*dbSchema, error)
-	Delete(int) error
+	Update(int, *update, time.Time) (*dbSchema, error)
+	Delete(int, time.Time) error
 	BulkDelete([]int) error
 }
 // A generic struct for basic service
@@ -36,6 +60,8 @@ type BasicServiceStruct[dbSchema, createDTO, updateDTO any] struct {
 func newBasicModuleService[dbSchema, createDTO, updateDTO any](repo repository.BasicModuleRepository[dbSchema]) BasicModuleService[dbSchema, createDTO, updateDTO] {
 	return &BasicServiceStruct[dbSchema, createDTO, updateDTO]{
 		Repo: repo,
+		// Schema name from the db schema type (eg. db.Post = post)
+		schemaName: strings.ToLower(reflect.TypeOf(new(dbSchema)).Elem().Name()),
 	}
 }
 
@@ -52,52 +78,40 @@ func (s *BasicServiceStruct[dbSchema, createDTO, updateDTO]) Create(create *crea
 	if err != nil {
 		return nil, fmt.Errorf("failed creation of %s: %w", s.schemaName, err)
 	}
+	// Remove any cached not found result for the new ID and cached lists
+	if entity, ok := any(created).(interface{ GetID() string }); ok {
+		app.Cache.Delete(fmt.Sprintf("%s:%s", s.schemaName, entity.GetID()))
+	}
+	app.Cache.InvalidateTag(cache.ListTag(s.schemaName))
 
 	return created, nil
 }
 // Find all entities in database
 func (s *BasicServiceStruct[dbSchema, createDTO, updateDTO]) FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[dbSchema], error) {
-	entities, err := s.Repo.FindAll(limit, offset, order, conditions)
-	if err != nil {
-		return nil, err
-	}
-	return entities, nil
+	return findAllCached(s.schemaName, limit, offset, order, conditions, func() (*models.BasicPaginatedResponse[dbSchema], error) {
+		return s.Repo.FindAll(limit, offset, order, conditions)
+	})
 }
 // Find entity by id
 func (s *BasicServiceStruct[dbSchema, createDTO, updateDTO]) FindById(id int) (*dbSchema, error) {
 	// Search cache
 	// Define a key with a naming convention
 	cacheKey := fmt.Sprintf("%s:%d", s.schemaName, id)
-	// Check if entity is in cache
-	cachedPost, found := app.Cache.Load(cacheKey)
-	if found {
-		// If found, return cached post
-		return cachedPost.(*dbSchema), nil
-	}
-
-	// Find entity by id
-	entity, err := s.Repo.FindById(id)
-	// If error detected
-	if err != nil {
-		return nil, err
-	}
-
-	// Store entity in cache
-	app.Cache.Store(cacheKey, entity)
-
-	return entity, nil
+	// Load entity from cache, or from the database if not cached
+	return cache.GetOrLoad(app.Cache, cacheKey, cache.RecordTTL, func() (*dbSchema, error) {
+		return s.Repo.FindById(id)
+	}, cache.RecordOptions(cache.TagEntity(s.schemaName))...)
 }
 // Delete entity in database
-func (s *BasicServiceStruct[dbSchema, createDTO, updateDTO]) Delete(id int) error {
-	err := s.Repo.Delete(id)
+func (s *BasicServiceStruct[dbSchema, createDTO, updateDTO]) Delete(id int, version time.Time) error {
+	err := s.Repo.Delete(id, version)
 	// If error detected
 	if err != nil {
 		fmt.Printf("error in deleting %s: %s", s.schemaName, err)
 		return err
 	}
-	// else
-	cacheKey := fmt.Sprintf("%s:%d", s.schemaName, id)
-	app.Cache.Delete(cacheKey)
+	// else, remove entity (and cached records embedding it) and cached lists from cache
+	app.Cache.InvalidateTag(cache.RecordTag(s.schemaName, id), cache.ListTag(s.schemaName))
 	return nil
 }
 // Deletes multiple entities in database
@@ -108,27 +122,29 @@ func (s *BasicServiceStruct[dbSchema, createDTO, updateDTO]) BulkDelete(ids []in
 		fmt.Printf("error in bulk deleting %s: %s", s.schemaName, err)
 		return err
 	}
-	// else
+	// else, remove entities (and cached records embedding them) and cached lists from cache
 	for _, id := range ids {
-		cacheKey := fmt.Sprintf("%s:%d", s.schemaName, id)
-		app.Cache.Delete(cacheKey)
+		app.Cache.InvalidateTag(cache.RecordTag(s.schemaName, id))
 	}
+	app.Cache.InvalidateTag(cache.ListTag(s.schemaName))
 	return nil
 }
 // Updates entity in database
-func (s *BasicServiceStruct[dbSchema, createDTO, updateDTO]) Update(id int, update *updateDTO) (*dbSchema, error) {
+// If version is set (the updated_at last read), the update only applies if the entity hasn't changed since (models.ErrRecordModified)
+func (s *BasicServiceStruct[dbSchema, createDTO, updateDTO]) Update(id int, update *updateDTO, version time.Time) (*dbSchema, error) {
 	// Create entity type from incoming DTO
 	toUpdate := s.mapUpdateToDbSchema(update)
 
 	// Update using Repo
-	updated, err := s.Repo.Update(id, toUpdate)
+	updated, err := s.Repo.Update(id, toUpdate, version)
 	if err != nil {
 		return nil, err
 	}
 
-	// Store updated entity in cache
+	// Remove cached records embedding the entity and cached lists, then store updated entity in cache
+	app.Cache.InvalidateTag(cache.RecordTag(s.schemaName, id), cache.ListTag(s.schemaName))
 	cacheKey := fmt.Sprintf("%s:%d", s.schemaName, id)
-	app.Cache.Store(cacheKey, updated)
+	cache.Put(app.Cache, cacheKey, updated, cache.RecordTTL, cache.RecordOptions(cache.TagEntity(s.schemaName))...)
 
 	return updated, nil
 }
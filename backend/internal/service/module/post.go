@@ -2,7 +2,9 @@ package moduleservices
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/dmawardi/Go-Template/internal/cache"
 	"github.com/dmawardi/Go-Template/internal/db"
 	"github.com/dmawardi/Go-Template/internal/models"
 	schemamodels "github.com/dmawardi/Go-Template/internal/models/schemaModels"
@@ -13,8 +15,8 @@ type PostService interface {
 	FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[db.Post], error)
 	FindById(int) (*db.Post, error)
 	Create(post *schemamodels.CreatePost) (*db.Post, error)
-	Update(int, *schemamodels.UpdatePost) (*db.Post, error)
-	Delete(int) error
+	Update(int, *schemamodels.UpdatePost, time.Time) (*db.Post, error)
+	Delete(int, time.Time) error
 	BulkDelete([]int) error
 }
 
@@ -40,17 +42,18 @@ func (s *postService) Create(post *schemamodels.CreatePost) (*db.Post, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed creating post: %w", err)
 	}
+	// Remove any cached not found result for the new ID and cached lists
+	app.Cache.Delete(fmt.Sprintf("post:%d", created.ID))
+	app.Cache.InvalidateTag(cache.ListTag("post"))
 
 	return created, nil
 }
 
 // Find a list of posts in the database
 func (s *postService) FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[db.Post], error) {
-	posts, err := s.repo.FindAll(limit, offset, order, conditions)
-	if err != nil {
-		return nil, err
-	}
-	return posts, nil
+	return findAllCached("post", limit, offset, order, conditions, func() (*models.BasicPaginatedResponse[db.Post], error) {
+		return s.repo.FindAll(limit, offset, order, conditions)
+	})
 }
 
 // Find post in database by ID
@@ -58,37 +61,22 @@ func (s *postService) FindById(id int) (*db.Post, error) {
 	// Search cache
 	// Define a key with a naming convention
 	cacheKey := fmt.Sprintf("post:%d", id)
-	// Check if post is in cache
-	cachedPost, found := app.Cache.Load(cacheKey)
-	if found {
-		// If found, return cached post
-		return cachedPost.(*db.Post), nil
-	}
-
-	// Find post by id
-	post, err := s.repo.FindById(id)
-	// If error detected
-	if err != nil {
-		return nil, err
-	}
-
-	// Store post in cache
-	app.Cache.Store(cacheKey, post)
-
-	return post, nil
+	// Load post from cache, or from the database if not cached
+	return cache.GetOrLoad(app.Cache, cacheKey, cache.RecordTTL, func() (*db.Post, error) {
+		return s.repo.FindById(id)
+	}, cache.RecordOptions(cache.TagEntity("post"))...)
 }
 
 // Delete post in database
-func (s *postService) Delete(id int) error {
-	err := s.repo.Delete(id)
+func (s *postService) Delete(id int, version time.Time) error {
+	err := s.repo.Delete(id, version)
 	// If error detected
 	if err != nil {
 		fmt.Println("error in deleting post: ", err)
 		return err
 	}
-	// else
-	cacheKey := fmt.Sprintf("post:%d", id)
-	app.Cache.Delete(cacheKey)
+	// else, remove post (and cached records embedding it) and cached lists from cache
+	app.Cache.InvalidateTag(cache.RecordTag("post", id), cache.ListTag("post"))
 	return nil
 }
 
@@ -100,16 +88,17 @@ func (s *postService) BulkDelete(ids []int) error {
 		fmt.Println("error in bulk deleting users: ", err)
 		return err
 	}
-	// else
+	// else, remove posts (and cached records embedding them) and cached lists from cache
 	for _, id := range ids {
-		cacheKey := fmt.Sprintf("post:%d", id)
-		app.Cache.Delete(cacheKey)
+		app.Cache.InvalidateTag(cache.RecordTag("post", id))
 	}
+	app.Cache.InvalidateTag(cache.ListTag("post"))
 	return nil
 }
 
 // Updates post in database
-func (s *postService) Update(id int, post *schemamodels.UpdatePost) (*db.Post, error) {
+// If version is set (the updated_at last read), the update only applies if the post hasn't changed since (models.ErrRecordModified)
+func (s *postService) Update(id int, post *schemamodels.UpdatePost, version time.Time) (*db.Post, error) {
 	// Create db Post type from incoming DTO
 	toUpdate := &db.Post{
 		Title: post.Title,
@@ -118,14 +107,15 @@ func (s *postService) Update(id int, post *schemamodels.UpdatePost) (*db.Post, e
 	}
 
 	// Update using repo
-	updated, err := s.repo.Update(id, toUpdate)
+	updated, err := s.repo.Update(id, toUpdate, version)
 	if err != nil {
 		return nil, err
 	}
 
-	// Store updated post in cache
+	// Remove cached records embedding the post and cached lists, then store updated post in cache
+	app.Cache.InvalidateTag(cache.RecordTag("post", id), cache.ListTag("post"))
 	cacheKey := fmt.Sprintf("post:%d", id)
-	app.Cache.Store(cacheKey, updated)
+	cache.Put(app.Cache, cacheKey, updated, cache.RecordTTL, cache.RecordOptions(cache.TagEntity("post"))...)
 
 	return updated, nil
 }
@@ -0,0 +1,128 @@
+package service_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/queue"
+)
+
+func TestParseCron(t *testing.T) {
+	// Wednesday 15 May 2024 10:07
+	from := time.Date(2024, time.May, 15, 10, 7, 30, 0, time.UTC)
+
+	var tests = []struct {
+		expression string
+		expectErr  bool
+		want       time.Time
+	}{
+		{"* * * * *", false, time.Date(2024, time.May, 15, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", false, time.Date(2024, time.May, 15, 10, 15, 0, 0, time.UTC)},
+		{"0 * * * *", false, time.Date(2024, time.May, 15, 11, 0, 0, 0, time.UTC)},
+		{"30 3 * * *", false, time.Date(2024, time.May, 16, 3, 30, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", false, time.Date(2024, time.May, 16, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", false, time.Date(2024, time.May, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", false, time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)},
+		// Day of month OR day of week when both are restricted (1st of month or a Friday)
+		{"0 0 1 * 5", false, time.Date(2024, time.May, 17, 0, 0, 0, 0, time.UTC)},
+		{"@daily", false, time.Date(2024, time.May, 16, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", false, time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		// Invalid expressions
+		{"* * * *", true, time.Time{}},
+		{"60 * * * *", true, time.Time{}},
+		{"* 24 * * *", true, time.Time{}},
+		{"*/0 * * * *", true, time.Time{}},
+		{"5-1 * * * *", true, time.Time{}},
+		{"a * * * *", true, time.Time{}},
+	}
+	for _, v := range tests {
+		schedule, err := queue.ParseCron(v.expression)
+		if (err != nil) != v.expectErr {
+			t.Errorf("ParseCron(%q): expected error %v, got %v", v.expression, v.expectErr, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got := schedule.Next(from); !got.Equal(v.want) {
+			t.Errorf("ParseCron(%q).Next() = %v, want %v", v.expression, got, v.want)
+		}
+	}
+}
+
+func TestQueue_AddJobDelayed(t *testing.T) {
+	// Add a job scheduled for the future
+	err := testModule.jobs.queue.AddJob("test-delayed", "{}", queue.Delay(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to add delayed job: %v", err)
+	}
+	var job db.Job
+	testModule.dbClient.Where("job_type = ?", "test-delayed").First(&job)
+	if job.NextRunAt.Before(time.Now().Add(59 * time.Minute)) {
+		t.Errorf("expected job to be delayed by an hour, next run at %v", job.NextRunAt)
+	}
+
+	// Delayed job is not claimable until due
+	for {
+		claimed, err := testModule.jobs.queue.ClaimJob("test-worker")
+		if err != nil {
+			break
+		}
+		if claimed.ID == job.ID {
+			t.Errorf("expected delayed job %d not to be claimed before it is due", job.ID)
+		}
+		// Return any other claimed job to the queue
+		testModule.dbClient.Model(claimed).Updates(map[string]interface{}{"status": db.JobStatusProcessed, "locked_by": ""})
+	}
+
+	// Clean up
+	testModule.dbClient.Unscoped().Delete(&job)
+}
+
+func TestQueue_EnqueueDueSchedules(t *testing.T) {
+	// Create schedule
+	err := testModule.jobs.queue.Schedule("test-schedule", "0 * * * *", "test-scheduled", `{"size":"small"}`)
+	if err != nil {
+		t.Fatalf("failed to create schedule: %v", err)
+	}
+	var schedule db.JobSchedule
+	testModule.dbClient.Where("name = ?", "test-schedule").First(&schedule)
+	if !schedule.NextRunAt.After(time.Now()) {
+		t.Errorf("expected next run to be in the future, got %v", schedule.NextRunAt)
+	}
+
+	// Not due yet
+	fired, err := testModule.jobs.queue.EnqueueDueSchedules()
+	if err != nil || fired != 0 {
+		t.Errorf("expected no schedules to fire, got %d (err: %v)", fired, err)
+	}
+
+	// Make schedule due
+	testModule.dbClient.Model(&schedule).Update("next_run_at", time.Now().Add(-time.Minute))
+	fired, err = testModule.jobs.queue.EnqueueDueSchedules()
+	if err != nil || fired != 1 {
+		t.Errorf("expected 1 schedule to fire, got %d (err: %v)", fired, err)
+	}
+	// Checking again (eg. from another instance) doesn't fire the run twice
+	fired, err = testModule.jobs.queue.EnqueueDueSchedules()
+	if err != nil || fired != 0 {
+		t.Errorf("expected run to only fire once, got %d (err: %v)", fired, err)
+	}
+
+	// Check a single job was added with the schedule's payload
+	var jobs []db.Job
+	testModule.dbClient.Where("job_type = ?", "test-scheduled").Find(&jobs)
+	if len(jobs) != 1 || jobs[0].Payload != `{"size":"small"}` {
+		t.Errorf("expected 1 scheduled job with payload, got %v", jobs)
+	}
+	// Check schedule was moved on
+	testModule.dbClient.First(&schedule, schedule.ID)
+	if schedule.RunCount != 1 || !schedule.NextRunAt.After(time.Now()) {
+		t.Errorf("expected schedule to move to next run, got run count %d, next run %v", schedule.RunCount, schedule.NextRunAt)
+	}
+
+	// Clean up
+	testModule.dbClient.Unscoped().Delete(&jobs)
+	testModule.jobs.queue.Unschedule("test-schedule")
+}
@@ -1,6 +1,8 @@
 package service
 
 import (
+	"time"
+
 	"github.com/dmawardi/Go-Template/internal/config"
 	"github.com/dmawardi/Go-Template/internal/models"
 	coreservices "github.com/dmawardi/Go-Template/internal/service/core"
@@ -24,7 +26,7 @@ type BasicModuleService[dbSchema, create, update any] interface {
 	FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[dbSchema], error)
 	FindById(int) (*dbSchema, error)
 	Create(entity *create) (*dbSchema, error)
-	Update(int, *update) (*dbSchema, error)
-	Delete(int) error
+	Update(int, *update, time.Time) (*dbSchema, error)
+	Delete(int, time.Time) error
 	BulkDelete([]int) error
 }
\ No newline at end of file
@@ -8,6 +8,7 @@ import (
 	"github.com/dmawardi/Go-Template/internal/auth"
 	"github.com/dmawardi/Go-Template/internal/cache"
 	"github.com/dmawardi/Go-Template/internal/config"
+	"github.com/dmawardi/Go-Template/internal/email"
 	"github.com/dmawardi/Go-Template/internal/helpers"
 	webapi "github.com/dmawardi/Go-Template/internal/helpers/webApi"
 	"github.com/dmawardi/Go-Template/internal/queue"
@@ -25,10 +26,12 @@ var testModule repositoryTestModule
 var app config.AppConfig
 
 type repositoryTestModule struct {
-	dbClient *gorm.DB
-	users    userModule
-	auth     authModule
-	posts    postModule
+	dbClient  *gorm.DB
+	users     userModule
+	auth      authModule
+	posts     postModule
+	jobs      jobModule
+	emailLogs emailLogModule
 }
 
 // Module structures
@@ -41,6 +44,17 @@ type authModule struct {
 	serv coreservices.AuthPolicyService
 }
 
+type jobModule struct {
+	queue *queue.Queue
+	repo  corerepositories.JobRepository
+	serv  coreservices.JobService
+}
+
+type emailLogModule struct {
+	repo corerepositories.EmailLogRepository
+	serv coreservices.EmailLogService
+}
+
 type postModule struct {
 	repo modulerepositories.PostRepository
 	serv moduleservices.PostService
@@ -70,6 +84,15 @@ func TestMain(m *testing.M) {
 	// Setup new cache
 	app.Cache = &cache.CacheMap{}
 
+	// Sign tokens with a test secret
+	auth.SetKeyRing(auth.NewHMACKeyRing([]byte("test-secret")))
+
+	// Parse email templates
+	app.EmailTemplates, err = email.LoadTemplates()
+	if err != nil {
+		fmt.Println("Error parsing email templates: ", err)
+	}
+
 	// Set app config in repository
 	repository.SetAppConfig(&app)
 	service.SetAppConfig(&app)
@@ -105,6 +128,13 @@ func (t *repositoryTestModule) TestServSetup(client *gorm.DB) {
 	// Users
 	t.users.repo = corerepositories.NewUserRepository(client)
 	t.users.serv = coreservices.NewUserService(t.users.repo, t.auth.repo, jobQueue)
+	// Jobs
+	t.jobs.queue = jobQueue
+	t.jobs.repo = corerepositories.NewJobRepository(client)
+	t.jobs.serv = coreservices.NewJobService(t.jobs.repo, jobQueue)
+	// Email logs
+	t.emailLogs.repo = corerepositories.NewEmailLogRepository(client)
+	t.emailLogs.serv = coreservices.NewEmailLogService(t.emailLogs.repo)
 	// Posts
 	t.posts.repo = modulerepositories.NewPostRepository(client)
 	t.posts.serv = moduleservices.NewPostService(t.posts.repo)
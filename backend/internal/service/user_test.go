@@ -1,11 +1,20 @@
 package service_test
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/dmawardi/Go-Template/internal/auth"
 	"github.com/dmawardi/Go-Template/internal/db"
 	"github.com/dmawardi/Go-Template/internal/helpers"
 	"github.com/dmawardi/Go-Template/internal/models"
+	"github.com/dmawardi/Go-Template/internal/queue"
+	coreservices "github.com/dmawardi/Go-Template/internal/service/core"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -151,7 +160,7 @@ func TestUserService_Delete(t *testing.T) {
 
 	// Test function
 	// Delete the created user
-	err = testModule.users.serv.Delete(int(createdUser.ID))
+	err = testModule.users.serv.Delete(int(createdUser.ID), time.Time{})
 	if err != nil {
 		t.Fatalf("failed to delete created user: %v", err)
 	}
@@ -227,7 +236,7 @@ func TestUserService_Update(t *testing.T) {
 		Name:     "Crazy"}
 
 	// Update the created user
-	updatedUser, err := testModule.users.serv.Update(int(createdUser.ID), userToUpdate)
+	updatedUser, err := testModule.users.serv.Update(int(createdUser.ID), userToUpdate, time.Time{})
 	if err != nil {
 		t.Fatalf("failed to update created user in service: %v", err)
 	}
@@ -313,8 +322,87 @@ func TestUserService_ResetPasswordAndSendEmail(t *testing.T) {
 	if err != nil {
 		t.Fatalf("failed to reset password and send email: %v", err)
 	}
+	// Request a second link
+	err = testModule.users.serv.ResetPasswordAndSendEmail(createdUser.Email)
+	if err != nil {
+		t.Fatalf("failed to reset password and send email: %v", err)
+	}
 
-	// Clean up: Delete created user
+	// The password is unchanged until the link is used
+	if !testModule.users.serv.CheckPasswordMatch(int(createdUser.ID), []byte("password")) {
+		t.Error("expected password to be unchanged")
+	}
+	// Only the latest token is usable
+	var tokens []db.PasswordResetToken
+	testModule.dbClient.Where("user_id = ?", createdUser.ID).Order("id").Find(&tokens)
+	if len(tokens) != 2 {
+		t.Fatalf("expected 2 password reset tokens, got %d", len(tokens))
+	}
+	if tokens[0].UsedAt == nil || tokens[1].UsedAt != nil {
+		t.Errorf("expected only the latest token to be unused")
+	}
+	if len(tokens[1].TokenHash) != 64 || !tokens[1].ExpiresAt.After(time.Now()) {
+		t.Errorf("expected a hashed token with an expiry in the future, got %q expiring %v", tokens[1].TokenHash, tokens[1].ExpiresAt)
+	}
+
+	// Clean up: Delete created user and tokens
+	testModule.dbClient.Where("user_id = ?", createdUser.ID).Delete(&db.PasswordResetToken{})
+	result := testModule.dbClient.Delete(createdUser)
+	if result.Error != nil {
+		t.Fatalf("failed to delete created user: %v", result.Error)
+	}
+}
+
+func TestUserService_ConfirmPasswordReset(t *testing.T) {
+	// Create test user
+	createdUser, err := helpers.HashPassAndGenerateUserInDb(&db.User{
+		Username: "Jabar",
+		Email:    "reset-confirm@ymail.com",
+		Password: "password",
+		Name:     "Crimson",
+	}, testModule.dbClient, t)
+	if err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+	// Create tokens (valid and expired)
+	token, resetToken, err := helpers.GeneratePasswordResetToken(createdUser.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to generate password reset token: %v", err)
+	}
+	expiredToken, expiredResetToken, err := helpers.GeneratePasswordResetToken(createdUser.ID, -time.Minute)
+	if err != nil {
+		t.Fatalf("failed to generate password reset token: %v", err)
+	}
+	testModule.dbClient.Create([]*db.PasswordResetToken{resetToken, expiredResetToken})
+
+	var tests = []struct {
+		testName    string
+		token       string
+		password    string
+		expectError bool
+	}{
+		{"Unknown token", "not-a-token", "new-password", true},
+		{"Expired token", expiredToken, "new-password", true},
+		{"Valid token", token, "new-password", false},
+		{"Used token", token, "another-password", true},
+	}
+	for _, v := range tests {
+		err := testModule.users.serv.ConfirmPasswordReset(v.token, v.password)
+		if v.expectError && !errors.Is(err, coreservices.ErrInvalidPasswordResetToken) {
+			t.Errorf("%v: expected invalid token error, got %v", v.testName, err)
+		}
+		if !v.expectError && err != nil {
+			t.Errorf("%v: failed to reset password: %v", v.testName, err)
+		}
+	}
+
+	// Check password has been updated (and hashed)
+	if !testModule.users.serv.CheckPasswordMatch(int(createdUser.ID), []byte("new-password")) {
+		t.Error("expected password to be updated")
+	}
+
+	// Clean up: Delete created user and tokens
+	testModule.dbClient.Where("user_id = ?", createdUser.ID).Delete(&db.PasswordResetToken{})
 	result := testModule.dbClient.Delete(createdUser)
 	if result.Error != nil {
 		t.Fatalf("failed to delete created user: %v", result.Error)
@@ -336,23 +424,115 @@ func TestUserService_LoginUser(t *testing.T) {
 	}
 
 	// Test function
-	token, err := testModule.users.serv.LoginUser(&models.Login{Email: createdUser.Email, Password: password})
+	loginResponse, err := testModule.users.serv.LoginUser(&models.Login{Email: createdUser.Email, Password: password})
 	if err != nil {
 		t.Fatalf("failed to login user: %v", err)
 	}
 
-	// Verify that the token is not empty
-	if token == "" {
-		t.Error("token should not be empty")
+	// Verify that the tokens are not empty
+	if loginResponse.Token == "" || loginResponse.RefreshToken == "" {
+		t.Error("tokens should not be empty")
+	}
+	if loginResponse.ExpiresIn != int(auth.AccessTokenTTL().Seconds()) {
+		t.Errorf("expected access token to expire in %v, got %ds", auth.AccessTokenTTL(), loginResponse.ExpiresIn)
+	}
+	// Only the refresh token's hash is stored
+	var stored db.RefreshToken
+	testModule.dbClient.Where("user_id = ?", createdUser.ID).First(&stored)
+	if stored.TokenHash != helpers.HashToken(loginResponse.RefreshToken) || stored.FamilyID == "" {
+		t.Errorf("expected hashed refresh token to be stored, got %+v", stored)
 	}
 
-	// Clean up: Delete created user
+	// Incorrect password
+	_, err = testModule.users.serv.LoginUser(&models.Login{Email: createdUser.Email, Password: "wrong-password"})
+	if err == nil {
+		t.Error("expected error logging in with incorrect password")
+	}
+
+	// Clean up: Delete created user and tokens
+	testModule.dbClient.Where("user_id = ?", createdUser.ID).Delete(&db.RefreshToken{})
 	result := testModule.dbClient.Delete(createdUser)
 	if result.Error != nil {
 		t.Fatalf("failed to delete created user: %v", result.Error)
 	}
 }
 
+func TestUserService_RefreshAccessToken(t *testing.T) {
+	// Create test user
+	createdUser, err := testModule.users.serv.Create(&models.CreateUser{
+		Username: "Jabar",
+		Email:    "refresh-rotation@ymail.com",
+		Password: "password",
+		Name:     "Crimson",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+	login := &models.Login{Email: createdUser.Email, Password: "password"}
+	loginResponse, err := testModule.users.serv.LoginUser(login)
+	if err != nil {
+		t.Fatalf("failed to login user: %v", err)
+	}
+
+	// Exchange token for a new access and refresh token
+	refreshed, err := testModule.users.serv.RefreshAccessToken(loginResponse.RefreshToken)
+	if err != nil {
+		t.Fatalf("failed to refresh access token: %v", err)
+	}
+	if refreshed.Token == "" || refreshed.RefreshToken == "" || refreshed.RefreshToken == loginResponse.RefreshToken {
+		t.Fatalf("expected new tokens, got %+v", refreshed)
+	}
+	// Access token contains the user's details
+	req := httptest.NewRequest("GET", "/api/me", nil)
+	req.Header.Set("Authorization", "Bearer "+refreshed.Token)
+	claims, err := auth.ValidateAndParseToken(req)
+	if err != nil || claims.UserID != fmt.Sprint(createdUser.ID) || claims.Role != "user" {
+		t.Errorf("expected access token for user %d, got %+v (%v)", createdUser.ID, claims, err)
+	}
+
+	// Tokens from another login aren't affected by reuse
+	otherLogin, err := testModule.users.serv.LoginUser(login)
+	if err != nil {
+		t.Fatalf("failed to login user: %v", err)
+	}
+
+	// Reusing the original token revokes the family (including the refreshed token)
+	_, err = testModule.users.serv.RefreshAccessToken(loginResponse.RefreshToken)
+	if !errors.Is(err, coreservices.ErrRefreshTokenReused) {
+		t.Errorf("expected reused token error, got %v", err)
+	}
+	_, err = testModule.users.serv.RefreshAccessToken(refreshed.RefreshToken)
+	if !errors.Is(err, coreservices.ErrInvalidRefreshToken) {
+		t.Errorf("expected revoked token to be invalid, got %v", err)
+	}
+	_, err = testModule.users.serv.RefreshAccessToken(otherLogin.RefreshToken)
+	if err != nil {
+		t.Errorf("expected token from another login to be valid, got %v", err)
+	}
+
+	// Unknown and expired tokens
+	_, err = testModule.users.serv.RefreshAccessToken("not-a-token")
+	if !errors.Is(err, coreservices.ErrInvalidRefreshToken) {
+		t.Errorf("expected unknown token to be invalid, got %v", err)
+	}
+	expiredToken, expired, err := helpers.GenerateRefreshToken(createdUser.ID, "", -time.Minute)
+	if err != nil {
+		t.Fatalf("failed to generate refresh token: %v", err)
+	}
+	testModule.dbClient.Create(expired)
+	_, err = testModule.users.serv.RefreshAccessToken(expiredToken)
+	if !errors.Is(err, coreservices.ErrInvalidRefreshToken) {
+		t.Errorf("expected expired token to be invalid, got %v", err)
+	}
+
+	// Clean up: Delete created user and tokens
+	testModule.dbClient.Where("user_id = ?", createdUser.ID).Delete(&db.RefreshToken{})
+	err = testModule.users.serv.Delete(int(createdUser.ID), time.Time{})
+	if err != nil {
+		t.Fatalf("failed to delete created user: %v", err)
+	}
+}
+
 func TestUserService_CheckPasswordMatch(t *testing.T) {
 	// Create test user
 	createdUser, err := helpers.HashPassAndGenerateUserInDb(&db.User{
@@ -438,10 +618,416 @@ func TestUserService_ResendVerificationEmail(t *testing.T) {
 	if err != nil {
 		t.Fatalf("failed to resend email verification: %v", err)
 	}
+	// Grab emailed verification code
+	sent := db.User{}
+	testModule.dbClient.First(&sent, createdUser.ID)
 
-	// Clean up: Delete created user
+	// Resending within the window collapses to the first email
+	err = testModule.users.serv.ResendVerificationEmail(int(createdUser.ID))
+	if err != nil {
+		t.Fatalf("failed to resend email verification: %v", err)
+	}
+	var jobCount int64
+	uniqueKey := fmt.Sprintf("verify-email:%d", createdUser.ID)
+	testModule.dbClient.Model(&db.Job{}).Where("unique_key = ?", uniqueKey).Count(&jobCount)
+	if jobCount != 1 {
+		t.Errorf("expected 1 verification email job, got %d", jobCount)
+	}
+	// Emailed code remains valid
+	current := db.User{}
+	testModule.dbClient.First(&current, createdUser.ID)
+	if current.VerificationCode == "" || current.VerificationCode != sent.VerificationCode {
+		t.Errorf("expected verification code %q to be kept, got %q", sent.VerificationCode, current.VerificationCode)
+	}
+
+	// Clean up: Delete created user and jobs
+	testModule.dbClient.Unscoped().Where("unique_key = ?", uniqueKey).Delete(&db.Job{})
+	result := testModule.dbClient.Delete(createdUser)
+	if result.Error != nil {
+		t.Fatalf("failed to delete created user: %v", result.Error)
+	}
+}
+
+func TestUserService_ResendVerificationEmailInUserLocale(t *testing.T) {
+	// Create test user preferring Spanish
+	createdUser, err := helpers.HashPassAndGenerateUserInDb(&db.User{
+		Username: "Jabar",
+		Email:    "locale-tadow@ymail.com",
+		Password: "password",
+		Name:     "Carmen",
+		Locale:   "es-MX",
+	}, testModule.dbClient, t)
+	if err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+
+	err = testModule.users.serv.ResendVerificationEmail(int(createdUser.ID))
+	if err != nil {
+		t.Fatalf("failed to resend email verification: %v", err)
+	}
+
+	// Email uses the Spanish variant
+	uniqueKey := fmt.Sprintf("verify-email:%d", createdUser.ID)
+	job := db.Job{}
+	testModule.dbClient.Where("unique_key = ?", uniqueKey).First(&job)
+	var payload queue.EmailJobPayload
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		t.Fatalf("failed to decode email payload: %v", err)
+	}
+	if payload.Subject != "Por favor verifica tu correo electrónico" {
+		t.Errorf("expected Spanish subject, got %q", payload.Subject)
+	}
+	if !strings.Contains(payload.Body, "Hola Carmen") || !strings.Contains(payload.Body, `lang="es"`) {
+		t.Errorf("expected Spanish body, got %q", payload.Body)
+	}
+
+	// Clean up: Delete created user and jobs
+	testModule.dbClient.Unscoped().Where("unique_key = ?", uniqueKey).Delete(&db.Job{})
 	result := testModule.dbClient.Delete(createdUser)
 	if result.Error != nil {
 		t.Fatalf("failed to delete created user: %v", result.Error)
 	}
 }
+
+func TestUserService_TokenRevocation(t *testing.T) {
+	// Create test user
+	createdUser, err := testModule.users.serv.Create(&models.CreateUser{
+		Username: "Jabar",
+		Email:    "token-revocation@ymail.com",
+		Password: "password",
+		Name:     "Crimson",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+	// Returns the claims of a new token for the user
+	newToken := func() string {
+		token, err := auth.GenerateJWT(int(createdUser.ID), createdUser.Email, createdUser.Role)
+		if err != nil {
+			t.Fatalf("failed to generate token: %v", err)
+		}
+		return token
+	}
+	// Validates a token as used in requests
+	validate := func(token string) (*auth.AuthToken, error) {
+		req := httptest.NewRequest("GET", "/api/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return auth.ValidateAndParseToken(req)
+	}
+
+	// Tokens have an ID and issue time
+	token := newToken()
+	claims, err := validate(token)
+	if err != nil {
+		t.Fatalf("expected token to be valid: %v", err)
+	}
+	if claims.ID == "" || claims.IssuedAt == nil {
+		t.Errorf("expected token to have an ID and issue time, got %+v", claims.RegisteredClaims)
+	}
+
+	// Logging out revokes the token (and only that token)
+	otherToken := newToken()
+	err = testModule.users.serv.Logout(claims, "")
+	if err != nil {
+		t.Fatalf("failed to logout: %v", err)
+	}
+	if _, err := validate(token); !errors.Is(err, auth.ErrTokenRevoked) {
+		t.Errorf("expected logged out token to be revoked, got %v", err)
+	}
+	if _, err := validate(otherToken); err != nil {
+		t.Errorf("expected other token to be valid: %v", err)
+	}
+
+	var tests = []struct {
+		testName string
+		change   func() error
+	}{
+		{"Password change", func() error {
+			_, err := testModule.users.serv.Update(int(createdUser.ID), &models.UpdateUser{Password: "new-password"}, time.Time{})
+			return err
+		}},
+		{"Role change", func() error {
+			_, err := testModule.users.serv.Update(int(createdUser.ID), &models.UpdateUser{Role: "admin"}, time.Time{})
+			return err
+		}},
+		{"Role assignment", func() error {
+			_, err := testModule.auth.serv.AssignUserRole(fmt.Sprint(createdUser.ID), "user")
+			return err
+		}},
+		{"Deleted user", func() error {
+			return testModule.users.serv.Delete(int(createdUser.ID), time.Time{})
+		}},
+	}
+	for _, v := range tests {
+		token := newToken()
+		if err := v.change(); err != nil {
+			t.Fatalf("%v: failed to make change: %v", v.testName, err)
+		}
+		if _, err := validate(token); !errors.Is(err, auth.ErrTokenRevoked) {
+			t.Errorf("%v: expected existing token to be revoked, got %v", v.testName, err)
+		}
+		// New tokens are accepted (unless the user is deleted)
+		if _, err := validate(newToken()); err != nil && v.testName != "Deleted user" {
+			t.Errorf("%v: expected new token to be valid: %v", v.testName, err)
+		}
+	}
+}
+
+func TestUserService_ApiKeysRevokedOnPasswordChange(t *testing.T) {
+	// Create test user
+	createdUser, err := testModule.users.serv.Create(&models.CreateUser{
+		Username: "Jabar",
+		Email:    "api-key-password@ymail.com",
+		Password: "password",
+		Name:     "Crimson",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+	userId := int(createdUser.ID)
+	// Returns a new API key for the user (used once, so it's cached)
+	newKey := func() string {
+		created, err := testModule.users.serv.CreateApiKey(userId, &models.CreateApiKey{Name: "Deploy", Scopes: []string{"read:/api/me"}}, nil)
+		if err != nil {
+			t.Fatalf("failed to create API key: %v", err)
+		}
+		if _, err := validateApiKey(created.Key); err != nil {
+			t.Fatalf("expected new API key to be valid: %v", err)
+		}
+		return created.Key
+	}
+
+	var tests = []struct {
+		testName string
+		change   func() error
+	}{
+		{"Password change", func() error {
+			_, err := testModule.users.serv.Update(userId, &models.UpdateUser{Password: "new-password"}, time.Time{})
+			return err
+		}},
+		{"Password reset", func() error {
+			token, resetToken, err := helpers.GeneratePasswordResetToken(createdUser.ID, time.Hour)
+			if err != nil {
+				return err
+			}
+			testModule.dbClient.Create(resetToken)
+			return testModule.users.serv.ConfirmPasswordReset(token, "another-password")
+		}},
+	}
+	for _, v := range tests {
+		key := newKey()
+		if err := v.change(); err != nil {
+			t.Fatalf("%v: failed to make change: %v", v.testName, err)
+		}
+		if _, err := validateApiKey(key); err == nil {
+			t.Errorf("%v: expected existing API key to be revoked", v.testName)
+		}
+		if keys, err := testModule.users.serv.FindApiKeys(userId); err != nil || len(keys) != 0 {
+			t.Errorf("%v: expected no active API keys, got %v (%v)", v.testName, len(keys), err)
+		}
+	}
+
+	// Clean up: Delete created user, keys and tokens
+	testModule.dbClient.Where("user_id = ?", createdUser.ID).Delete(&db.ApiKey{})
+	testModule.dbClient.Where("user_id = ?", createdUser.ID).Delete(&db.PasswordResetToken{})
+	err = testModule.users.serv.Delete(userId, time.Time{})
+	if err != nil {
+		t.Fatalf("failed to delete created user: %v", err)
+	}
+}
+
+// Validates an API key as used in requests
+func validateApiKey(key string) (*auth.AuthToken, error) {
+	req := httptest.NewRequest("GET", "/api/me", nil)
+	req.Header.Set("Authorization", "ApiKey "+key)
+	return auth.ValidateAndParseToken(req)
+}
+
+func TestUserService_TwoFactor(t *testing.T) {
+	// Create test user
+	createdUser, err := testModule.users.serv.Create(&models.CreateUser{
+		Username: "Jabar",
+		Email:    "two-factor@ymail.com",
+		Password: "password",
+		Name:     "Crimson",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+	userId := int(createdUser.ID)
+	login := &models.Login{Email: createdUser.Email, Password: "password"}
+	// Validates a token as used in requests
+	validate := func(token string) (*auth.AuthToken, error) {
+		req := httptest.NewRequest("GET", "/api/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return auth.ValidateAndParseToken(req)
+	}
+
+	// Enrol (the secret is reused until confirmed)
+	enrollment, err := testModule.users.serv.EnrollTwoFactor(userId)
+	if err != nil {
+		t.Fatalf("failed to enrol: %v", err)
+	}
+	if !strings.HasPrefix(enrollment.URI, "otpauth://totp/") || !strings.Contains(enrollment.URI, enrollment.Secret) {
+		t.Errorf("expected otpauth URI with secret, got %s", enrollment.URI)
+	}
+	again, err := testModule.users.serv.EnrollTwoFactor(userId)
+	if err != nil || again.Secret != enrollment.Secret {
+		t.Errorf("expected pending secret to be reused, got %+v (%v)", again, err)
+	}
+	// Not enabled until confirmed
+	loginResponse, err := testModule.users.serv.LoginUser(login)
+	if err != nil || loginResponse.TwoFactorRequired {
+		t.Fatalf("expected login without two factor before confirmation, got %+v (%v)", loginResponse, err)
+	}
+
+	// Confirm
+	_, err = testModule.users.serv.ConfirmTwoFactor(userId, "000000")
+	if !errors.Is(err, coreservices.ErrInvalidTwoFactorCode) {
+		t.Errorf("expected invalid code error, got %v", err)
+	}
+	code, _ := helpers.TOTPCode(enrollment.Secret, time.Now())
+	recoveryCodes, err := testModule.users.serv.ConfirmTwoFactor(userId, code)
+	if err != nil {
+		t.Fatalf("failed to confirm two factor: %v", err)
+	}
+	if len(recoveryCodes.RecoveryCodes) != 10 {
+		t.Errorf("expected 10 recovery codes, got %d", len(recoveryCodes.RecoveryCodes))
+	}
+	found, _ := testModule.users.serv.FindById(userId)
+	if !found.TwoFactorEnabled {
+		t.Error("expected two factor to be enabled")
+	}
+
+	// Login requires a code, and the two factor token can't be used to authenticate
+	loginResponse, err = testModule.users.serv.LoginUser(login)
+	if err != nil {
+		t.Fatalf("failed to login user: %v", err)
+	}
+	if !loginResponse.TwoFactorRequired || loginResponse.TwoFactorToken == "" || loginResponse.Token != "" || loginResponse.RefreshToken != "" {
+		t.Fatalf("expected two factor token only, got %+v", loginResponse)
+	}
+	if _, err := validate(loginResponse.TwoFactorToken); err == nil {
+		t.Error("expected two factor token to be rejected for authentication")
+	}
+	// The code used to confirm can't be reused
+	_, err = testModule.users.serv.VerifyTwoFactorLogin(&models.TwoFactorLogin{TwoFactorToken: loginResponse.TwoFactorToken, Code: code})
+	if !errors.Is(err, coreservices.ErrInvalidTwoFactorCode) {
+		t.Errorf("expected reused code to be rejected, got %v", err)
+	}
+	// Next code completes the login (the access token has the two factor claim)
+	nextCode, _ := helpers.TOTPCode(enrollment.Secret, time.Now().Add(30*time.Second))
+	completed, err := testModule.users.serv.VerifyTwoFactorLogin(&models.TwoFactorLogin{TwoFactorToken: loginResponse.TwoFactorToken, Code: nextCode})
+	if err != nil {
+		t.Fatalf("failed to complete two factor login: %v", err)
+	}
+	claims, err := validate(completed.Token)
+	if err != nil || !claims.TwoFactor {
+		t.Errorf("expected access token with two factor claim, got %+v (%v)", claims, err)
+	}
+	// Refreshed tokens keep the claim
+	refreshed, err := testModule.users.serv.RefreshAccessToken(completed.RefreshToken)
+	if err != nil {
+		t.Fatalf("failed to refresh access token: %v", err)
+	}
+	if claims, err := validate(refreshed.Token); err != nil || !claims.TwoFactor {
+		t.Errorf("expected refreshed token with two factor claim, got %+v (%v)", claims, err)
+	}
+	// The two factor token can only be used once
+	_, err = testModule.users.serv.VerifyTwoFactorLogin(&models.TwoFactorLogin{TwoFactorToken: loginResponse.TwoFactorToken, Code: recoveryCodes.RecoveryCodes[0]})
+	if !errors.Is(err, coreservices.ErrInvalidTwoFactorCode) {
+		t.Errorf("expected used two factor token to be rejected, got %v", err)
+	}
+
+	// Recovery codes can be used once
+	for i, expectSuccess := range []bool{true, false} {
+		pending, err := testModule.users.serv.LoginUser(login)
+		if err != nil {
+			t.Fatalf("failed to login user: %v", err)
+		}
+		_, err = testModule.users.serv.VerifyTwoFactorLogin(&models.TwoFactorLogin{TwoFactorToken: pending.TwoFactorToken, Code: recoveryCodes.RecoveryCodes[1]})
+		if (err == nil) != expectSuccess {
+			t.Errorf("recovery code attempt %d: expected success %v, got %v", i+1, expectSuccess, err)
+		}
+	}
+
+	// Two factor tokens are revoked after too many invalid codes
+	pending, err := testModule.users.serv.LoginUser(login)
+	if err != nil {
+		t.Fatalf("failed to login user: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		// Clear the account's failed logins, so only the token's limit applies
+		testModule.dbClient.Where("key = ?", "account:"+createdUser.Email).Delete(&db.LoginThrottle{})
+		testModule.users.serv.VerifyTwoFactorLogin(&models.TwoFactorLogin{TwoFactorToken: pending.TwoFactorToken, Code: "000000"})
+	}
+	_, err = testModule.users.serv.VerifyTwoFactorLogin(&models.TwoFactorLogin{TwoFactorToken: pending.TwoFactorToken, Code: recoveryCodes.RecoveryCodes[2]})
+	if !errors.Is(err, coreservices.ErrInvalidTwoFactorCode) {
+		t.Errorf("expected two factor token to be revoked, got %v", err)
+	}
+
+	// A correct password doesn't reset the account's failed logins until the login is completed with a code
+	testModule.dbClient.Where("1 = 1").Delete(&db.LoginThrottle{})
+	pending, err = testModule.users.serv.LoginUser(login)
+	if err != nil {
+		t.Fatalf("failed to login user: %v", err)
+	}
+	testModule.users.serv.VerifyTwoFactorLogin(&models.TwoFactorLogin{TwoFactorToken: pending.TwoFactorToken, Code: "000000"})
+	pending, err = testModule.users.serv.LoginUser(login)
+	if err != nil {
+		t.Fatalf("failed to login user: %v", err)
+	}
+	if throttle, err := testModule.users.serv.FindLoginThrottle(userId); err != nil || throttle == nil || throttle.Failures != 1 {
+		t.Errorf("expected failed logins to be kept before the code, got %+v (%v)", throttle, err)
+	}
+	_, err = testModule.users.serv.VerifyTwoFactorLogin(&models.TwoFactorLogin{TwoFactorToken: pending.TwoFactorToken, Code: recoveryCodes.RecoveryCodes[4]})
+	if err != nil {
+		t.Fatalf("failed to complete two factor login: %v", err)
+	}
+	if throttle, err := testModule.users.serv.FindLoginThrottle(userId); err != nil || throttle != nil {
+		t.Errorf("expected failed logins to be reset after the code, got %+v (%v)", throttle, err)
+	}
+
+	// Invalid codes count as failed logins for the account (locking it, even for valid codes)
+	t.Setenv("LOGIN_MAX_ATTEMPTS", "3")
+	testModule.dbClient.Where("1 = 1").Delete(&db.LoginThrottle{})
+	pending, err = testModule.users.serv.LoginUser(login)
+	if err != nil {
+		t.Fatalf("failed to login user: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		testModule.users.serv.VerifyTwoFactorLogin(&models.TwoFactorLogin{TwoFactorToken: pending.TwoFactorToken, Code: "000000"})
+	}
+	throttle, err := testModule.users.serv.FindLoginThrottle(userId)
+	if err != nil || throttle == nil || throttle.Failures != 3 || throttle.LockedUntil == nil {
+		t.Errorf("expected account to be locked after invalid codes, got %+v (%v)", throttle, err)
+	}
+	_, err = testModule.users.serv.VerifyTwoFactorLogin(&models.TwoFactorLogin{TwoFactorToken: pending.TwoFactorToken, Code: recoveryCodes.RecoveryCodes[2]})
+	if !errors.Is(err, coreservices.ErrLoginThrottled) {
+		t.Errorf("expected locked account to be throttled, got %v", err)
+	}
+	testModule.dbClient.Where("1 = 1").Delete(&db.LoginThrottle{})
+	testModule.dbClient.Where("unique_key = ?", fmt.Sprintf("account-locked:%d", createdUser.ID)).Delete(&db.Job{})
+
+	// Disable (requires a code)
+	err = testModule.users.serv.DisableTwoFactor(userId, "000000")
+	if !errors.Is(err, coreservices.ErrInvalidTwoFactorCode) {
+		t.Errorf("expected invalid code error, got %v", err)
+	}
+	err = testModule.users.serv.DisableTwoFactor(userId, recoveryCodes.RecoveryCodes[3])
+	if err != nil {
+		t.Fatalf("failed to disable two factor: %v", err)
+	}
+	loginResponse, err = testModule.users.serv.LoginUser(login)
+	if err != nil || loginResponse.TwoFactorRequired || loginResponse.Token == "" {
+		t.Errorf("expected login without two factor once disabled, got %+v (%v)", loginResponse, err)
+	}
+
+	// Clean up: Delete created user and tokens
+	testModule.dbClient.Where("user_id = ?", createdUser.ID).Delete(&db.RefreshToken{})
+	testModule.dbClient.Where("user_id = ?", createdUser.ID).Delete(&db.RevokedToken{})
+	err = testModule.users.serv.Delete(userId, time.Time{})
+	if err != nil {
+		t.Fatalf("failed to delete created user: %v", err)
+	}
+}